@@ -0,0 +1,337 @@
+package eme
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// AgeVersion is the version line of the age files written by NewAgeWriter.
+// The header follows the age v1 format, but the payload is an envelope (see
+// NewEnvelopeWriter) instead of ChaCha20-Poly1305. age plugins can only
+// wrap file keys, not change the payload, so the files use their own
+// version line; age rejects them as an unsupported version rather than
+// failing on the payload. For files that age reads, use the plugin in
+// cmd/age-plugin-eme, which wraps the file key of standard age v1 files in
+// the same stanzas.
+const AgeVersion = "age-encryption.org/v1/eme"
+
+// AgeStanzaType is the type of the recipient stanzas of WrapAgeFileKey. A
+// stanza is "-> eme <tag> <tweak>", where the tag is 4 bytes that tell
+// recipient keys apart without revealing them, the tweak is 16 random
+// bytes, and the body is the 16-byte file key EME-encrypted under the
+// recipient key and the tweak.
+const AgeStanzaType = "eme"
+
+// ErrAgeStanzaKey is returned by UnwrapAgeFileKey for stanzas that were
+// wrapped for a different key.
+var ErrAgeStanzaKey = errors.New("eme: age stanza is for a different key")
+
+// ageTagDomain - encrypted under the recipient key to derive the stanza tag
+var ageTagDomain = [16]byte{'e', 'm', 'e', ' ', 'a', 'g', 'e', ' ', 's', 't', 'a', 'n', 'z', 'a', ' ', 't'}
+
+// ageMaxStanzas - the most stanzas NewAgeReader accepts
+const ageMaxStanzas = 256
+
+// AgeStanza is one recipient stanza of an age header.
+type AgeStanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+// NewAgeWriter writes an age header for "recipients" to "w" and returns a
+// Writer for the payload. Every recipient is a block cipher under a key
+// shared with the reader. The header is authenticated with HMAC-SHA256 as in
+// age, but the payload, like every envelope, is not. Close must be called
+// to finish the payload.
+func NewAgeWriter(w io.Writer, recipients ...cipher.Block) (*Writer, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("eme: no age recipients")
+	}
+	fileKey := make([]byte, 16)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+	defer clear(fileKey)
+	var hdr bytes.Buffer
+	hdr.WriteString(AgeVersion + "\n")
+	for _, r := range recipients {
+		s, err := WrapAgeFileKey(r, fileKey)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.Marshal(&hdr); err != nil {
+			return nil, err
+		}
+	}
+	hdr.WriteString("---")
+	mac, err := ageHeaderMAC(fileKey, hdr.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	hdr.WriteString(" " + base64.RawStdEncoding.EncodeToString(mac) + "\n")
+	if _, err = w.Write(hdr.Bytes()); err != nil {
+		return nil, err
+	}
+	bc, err := agePayloadCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvelopeWriter(w, bc)
+}
+
+// NewAgeReader reads what NewAgeWriter wrote, with the first of
+// "identities" that unwraps a stanza to a file key matching the header MAC.
+// It reads the header through a buffer, so "r" is read past the header.
+func NewAgeReader(r io.Reader, identities ...cipher.Block) (*Reader, error) {
+	br := bufio.NewReader(r)
+	stanzas, hdr, mac, err := parseAgeHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stanzas {
+		if s.Type != AgeStanzaType {
+			continue
+		}
+		for _, id := range identities {
+			fileKey, err := UnwrapAgeFileKey(id, &s)
+			if errors.Is(err, ErrAgeStanzaKey) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			want, err := ageHeaderMAC(fileKey, hdr)
+			if err != nil {
+				return nil, err
+			}
+			if !hmac.Equal(mac, want) {
+				clear(fileKey)
+				continue
+			}
+			bc, err := agePayloadCipher(fileKey)
+			clear(fileKey)
+			if err != nil {
+				return nil, err
+			}
+			return NewEnvelopeReader(br, bc)
+		}
+	}
+	return nil, errors.New("eme: no identity matches an age recipient")
+}
+
+// WrapAgeFileKey returns the stanza that wraps the 16-byte age file key
+// "fileKey" for the recipient key "bc", see AgeStanzaType.
+func WrapAgeFileKey(bc cipher.Block, fileKey []byte) (*AgeStanza, error) {
+	if len(fileKey) != 16 {
+		return nil, fmt.Errorf("eme: age file key must be 16 bytes long, is %d", len(fileKey))
+	}
+	tweak := make([]byte, 16)
+	if _, err := rand.Read(tweak); err != nil {
+		return nil, err
+	}
+	b64 := base64.RawStdEncoding
+	return &AgeStanza{
+		Type: AgeStanzaType,
+		Args: []string{b64.EncodeToString(ageStanzaTag(bc)), b64.EncodeToString(tweak)},
+		Body: Transform(bc, tweak, fileKey, DirectionEncrypt),
+	}, nil
+}
+
+// UnwrapAgeFileKey returns the file key that "s", a stanza of type
+// AgeStanzaType, wraps for "bc". It returns ErrAgeStanzaKey if the tag of
+// the stanza belongs to a different key.
+func UnwrapAgeFileKey(bc cipher.Block, s *AgeStanza) ([]byte, error) {
+	b64 := base64.RawStdEncoding.Strict()
+	if s.Type != AgeStanzaType || len(s.Args) != 2 || len(s.Body) != 16 {
+		return nil, errors.New("eme: malformed age eme stanza")
+	}
+	tag, err := b64.DecodeString(s.Args[0])
+	if err != nil || len(tag) != 4 {
+		return nil, errors.New("eme: malformed age eme stanza")
+	}
+	tweak, err := b64.DecodeString(s.Args[1])
+	if err != nil || len(tweak) != 16 {
+		return nil, errors.New("eme: malformed age eme stanza")
+	}
+	if !hmac.Equal(tag, ageStanzaTag(bc)) {
+		return nil, ErrAgeStanzaKey
+	}
+	return Transform(bc, tweak, s.Body, DirectionDecrypt), nil
+}
+
+// ageStanzaTag - the first 4 bytes of the encryption of ageTagDomain
+func ageStanzaTag(bc cipher.Block) []byte {
+	t := make([]byte, 16)
+	bc.Encrypt(t, ageTagDomain[:])
+	return t[:4]
+}
+
+// Marshal writes the stanza in the age format: "-> type args...", then the
+// body in base64 lines of 64 columns, the last one shorter (maybe empty).
+// The messages of the age plugin protocol use the same format.
+func (s *AgeStanza) Marshal(w io.Writer) error {
+	for _, a := range append([]string{s.Type}, s.Args...) {
+		if a == "" || !isASCII(a) {
+			return fmt.Errorf("eme: invalid age stanza argument %q", a)
+		}
+	}
+	var buf bytes.Buffer
+	buf.WriteString("-> " + strings.Join(append([]string{s.Type}, s.Args...), " ") + "\n")
+	b := base64.RawStdEncoding.EncodeToString(s.Body)
+	for len(b) >= 64 {
+		buf.WriteString(b[:64] + "\n")
+		b = b[64:]
+	}
+	buf.WriteString(b + "\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadAgeStanza reads one stanza in the format of Marshal from "br".
+func ReadAgeStanza(br *bufio.Reader) (*AgeStanza, error) {
+	var buf bytes.Buffer
+	line, err := readAgeLine(br, &buf)
+	if err != nil {
+		return nil, err
+	}
+	args, ok := strings.CutPrefix(line, "-> ")
+	if !ok {
+		return nil, errors.New("eme: malformed age stanza")
+	}
+	return readAgeStanzaBody(br, &buf, args)
+}
+
+// parseAgeHeader - the stanzas, the header bytes covered by the MAC, and the
+// MAC
+func parseAgeHeader(br *bufio.Reader) (stanzas []AgeStanza, hdr []byte, mac []byte, err error) {
+	var buf bytes.Buffer
+	line, err := readAgeLine(br, &buf)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if line != AgeVersion {
+		return nil, nil, nil, fmt.Errorf("eme: unsupported age version %q", line)
+	}
+	b64 := base64.RawStdEncoding.Strict()
+	for {
+		if line, err = readAgeLine(br, &buf); err != nil {
+			return nil, nil, nil, err
+		}
+		if rest, ok := strings.CutPrefix(line, "--- "); ok {
+			// The MAC covers the header up to and including "---"
+			hdr = buf.Bytes()[:buf.Len()-len(line)-1+3]
+			if mac, err = b64.DecodeString(rest); err != nil || len(mac) != sha256.Size {
+				return nil, nil, nil, errors.New("eme: malformed age header MAC")
+			}
+			return stanzas, hdr, mac, nil
+		}
+		args, ok := strings.CutPrefix(line, "-> ")
+		if !ok || len(stanzas) == ageMaxStanzas {
+			return nil, nil, nil, errors.New("eme: malformed age header")
+		}
+		s, err := readAgeStanzaBody(br, &buf, args)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		stanzas = append(stanzas, *s)
+	}
+}
+
+// readAgeStanzaBody - the stanza with the arguments "args" of its first
+// line, and the body read from the following lines
+func readAgeStanzaBody(br *bufio.Reader, buf *bytes.Buffer, args string) (*AgeStanza, error) {
+	f := strings.Split(args, " ")
+	for _, a := range f {
+		if a == "" || !isASCII(a) {
+			return nil, errors.New("eme: malformed age stanza")
+		}
+	}
+	s := &AgeStanza{Type: f[0], Args: f[1:]}
+	var body strings.Builder
+	for {
+		line, err := readAgeLine(br, buf)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) > 64 {
+			return nil, errors.New("eme: malformed age stanza body")
+		}
+		body.WriteString(line)
+		if len(line) < 64 {
+			break
+		}
+	}
+	var err error
+	if s.Body, err = base64.RawStdEncoding.Strict().DecodeString(body.String()); err != nil {
+		return nil, fmt.Errorf("eme: malformed age stanza body: %w", err)
+	}
+	return s, nil
+}
+
+// readAgeLine - read one line of at most 1 KiB, append it with its newline
+// to "buf", and return it without the newline
+func readAgeLine(br *bufio.Reader, buf *bytes.Buffer) (string, error) {
+	var line []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", fmt.Errorf("eme: reading age header: %w", err)
+		}
+		if b == '\n' {
+			break
+		}
+		if len(line) == 1024 {
+			return "", errors.New("eme: age header line too long")
+		}
+		line = append(line, b)
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	return string(line), nil
+}
+
+// isASCII - only printable ASCII without spaces, as age arguments
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 33 || s[i] > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// ageHeaderMAC - HMAC-SHA256 of "hdr" under HKDF(fileKey, "header"), as in
+// age
+func ageHeaderMAC(fileKey []byte, hdr []byte) ([]byte, error) {
+	key, err := hkdf.Key(sha256.New, fileKey, nil, "header", 32)
+	if err != nil {
+		return nil, err
+	}
+	m := hmac.New(sha256.New, key)
+	m.Write(hdr)
+	return m.Sum(nil), nil
+}
+
+// agePayloadCipher - AES-256 under HKDF(fileKey, "eme payload")
+func agePayloadCipher(fileKey []byte) (cipher.Block, error) {
+	key, err := hkdf.Key(sha256.New, fileKey, nil, "eme payload", 32)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	return aes.NewCipher(key)
+}
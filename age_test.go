@@ -0,0 +1,133 @@
+package eme
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func ageTestKey(t *testing.T, b byte) cipher.Block {
+	bc, err := aes.NewCipher(bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bc
+}
+
+func TestAge(t *testing.T) {
+	alice, bob, eve := ageTestKey(t, 1), ageTestKey(t, 2), ageTestKey(t, 3)
+	for _, n := range []int{0, 1, 4096, 10000} {
+		plain := bytes.Repeat([]byte("age!"), n)[:n]
+		var buf bytes.Buffer
+		w, err := NewAgeWriter(&buf, alice, bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(plain)
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(buf.String(), AgeVersion+"\n-> eme ") {
+			t.Fatalf("bad header %q", buf.String()[:40])
+		}
+		for _, id := range []cipher.Block{alice, bob} {
+			r, err := NewAgeReader(bytes.NewReader(buf.Bytes()), eve, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("n=%d: round trip failed: %v", n, err)
+			}
+		}
+		if _, err = NewAgeReader(bytes.NewReader(buf.Bytes()), eve); err == nil {
+			t.Errorf("decrypted with a wrong key")
+		}
+	}
+}
+
+func TestAgeHeaderTampering(t *testing.T) {
+	alice := ageTestKey(t, 1)
+	var buf bytes.Buffer
+	w, err := NewAgeWriter(&buf, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	hdr := buf.Bytes()[:bytes.Index(buf.Bytes(), []byte("\n---"))]
+	// Add an unknown stanza, which leaves the MAC stale
+	extra := append(append([]byte{}, hdr...), "\n-> X25519 abc\n\n"...)
+	extra = append(extra, buf.Bytes()[len(hdr)+1:]...)
+	if _, err = NewAgeReader(bytes.NewReader(extra), alice); err == nil {
+		t.Errorf("accepted a modified header")
+	}
+	for _, bad := range []string{
+		"age-encryption.org/v1\n--- AAAA\n",
+		AgeVersion + "\n-> eme\n",
+		AgeVersion + "\nfoo\n",
+		AgeVersion + "\n--- !!\n",
+	} {
+		if _, err = NewAgeReader(strings.NewReader(bad), alice); err == nil {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+}
+
+func TestAgeStanzaRoundTrip(t *testing.T) {
+	for _, n := range []int{0, 16, 47, 48, 49, 96, 200} {
+		s := AgeStanza{Type: "test", Args: []string{"a", "b"}, Body: bytes.Repeat([]byte{7}, n)}
+		var buf bytes.Buffer
+		buf.WriteString(AgeVersion + "\n")
+		if err := s.Marshal(&buf); err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString("--- " + strings.Repeat("A", 43) + "\n")
+		stanzas, _, _, err := parseAgeHeader(bufio.NewReader(&buf))
+		if err != nil || len(stanzas) != 1 || !bytes.Equal(stanzas[0].Body, s.Body) || len(stanzas[0].Args) != 2 {
+			t.Errorf("n=%d: %+v, %v", n, stanzas, err)
+		}
+	}
+	if err := (&AgeStanza{Type: "a b"}).Marshal(&bytes.Buffer{}); err == nil {
+		t.Errorf("accepted a space in the stanza type")
+	}
+}
+
+func TestAgeWrapFileKey(t *testing.T) {
+	alice, bob := ageTestKey(t, 1), ageTestKey(t, 2)
+	fileKey := bytes.Repeat([]byte{9}, 16)
+	s, err := WrapAgeFileKey(alice, fileKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != AgeStanzaType || len(s.Args) != 2 {
+		t.Fatalf("bad stanza %+v", s)
+	}
+	// The stanza survives the plugin protocol encoding
+	var buf bytes.Buffer
+	if err = s.Marshal(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := ReadAgeStanza(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnwrapAgeFileKey(alice, s2)
+	if err != nil || !bytes.Equal(got, fileKey) {
+		t.Errorf("unwrap: %x, %v", got, err)
+	}
+	if _, err = UnwrapAgeFileKey(bob, s2); !errors.Is(err, ErrAgeStanzaKey) {
+		t.Errorf("other key: got %v", err)
+	}
+	s2.Args = s2.Args[1:]
+	if _, err = UnwrapAgeFileKey(alice, s2); err == nil || errors.Is(err, ErrAgeStanzaKey) {
+		t.Errorf("malformed stanza: got %v", err)
+	}
+	if _, err = WrapAgeFileKey(alice, fileKey[:15]); err == nil {
+		t.Error("15-byte file key accepted")
+	}
+}
@@ -0,0 +1,54 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+)
+
+// TestAllocs guards the code paths documented not to allocate
+func TestAllocs(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := make([]byte, 16)
+	buf := make([]byte, 16384)
+	for _, pageSize := range []int{16, 512, 2048, 4096, 16384} {
+		pc := NewPageCipher(bc, pageSize)
+		page := buf[:pageSize]
+		if n := testing.AllocsPerRun(100, func() { pc.EncryptPage(7, page) }); n != 0 {
+			t.Errorf("EncryptPage with %d byte pages: %v allocations, want 0", pageSize, n)
+		}
+		if n := testing.AllocsPerRun(100, func() { pc.DecryptPage(7, page) }); n != 0 {
+			t.Errorf("DecryptPage with %d byte pages: %v allocations, want 0", pageSize, n)
+		}
+	}
+	s := NewScratch()
+	if n := testing.AllocsPerRun(100, func() { TransformWithScratch(bc, tweak, buf[:2048], buf[:2048], DirectionEncrypt, s) }); n != 0 {
+		t.Errorf("TransformWithScratch: %v allocations, want 0", n)
+	}
+	for _, padding := range []Padding{PadPKCS7, PadNone, PadCTS} {
+		w := NewWriter(io.Discard, bc, 4096, tweak)
+		w.Padding = padding
+		// The first sector allocates the held-back sector of PadCTS
+		w.Write(buf[:4096])
+		if n := testing.AllocsPerRun(100, func() { w.Write(buf[:5000]) }); n != 0 {
+			t.Errorf("Writer.Write with padding %d: %v allocations, want 0", padding, n)
+		}
+	}
+
+	var ct bytes.Buffer
+	w := NewWriter(&ct, bc, 4096, tweak)
+	w.Write(buf)
+	w.Close()
+	sr, err := NewSeekReader(bytes.NewReader(ct.Bytes()), int64(ct.Len()), bc, 4096, tweak, PadPKCS7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 5000)
+	if n := testing.AllocsPerRun(100, func() { sr.ReadAt(p, 1000) }); n != 0 {
+		t.Errorf("SeekReader.ReadAt: %v allocations, want 0", n)
+	}
+}
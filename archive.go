@@ -0,0 +1,262 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// ArchiveVersion is the archive format version written by this package.
+const ArchiveVersion = 1
+
+var (
+	// archiveMagic starts every archive
+	archiveMagic = []byte("EMEARCH\x00")
+	// archiveIndexMagic ends every archive
+	archiveIndexMagic = []byte("EMEAIDX\x00")
+)
+
+const (
+	archiveHeaderLen  = 32
+	archiveTrailerLen = 16
+	archiveRecordLen  = 12
+	archiveEntryLen   = 20
+)
+
+// An encrypted archive is an append-only sequence of chunks followed by an
+// index, suited for incremental backups to storage that can only append
+// files and read byte ranges. Layout (all integers big-endian):
+//
+//	header:  magic "EMEARCH\0", version (uint16), 6 reserved bytes, salt (16 bytes)
+//	chunk:   id (uint64), plaintext length (uint32), ciphertext
+//	index:   entry count (uint32), entries, CRC-32 of count and entries (uint32)
+//	entry:   id (uint64), chunk offset (uint64), plaintext length (uint32)
+//	trailer: index offset (uint64), magic "EMEAIDX\0"
+//
+// Appending writes more chunks, a new index and a new trailer behind the old
+// trailer; only the last index counts. The ciphertext of a chunk is its
+// plaintext, zero-padded to a multiple of 16 bytes, encrypted in segments of
+// up to 2048 bytes. Segment "i" of chunk "id" uses the tweak (id, i) XORed
+// with the archive salt.
+
+// archiveEntry - location of a chunk
+type archiveEntry struct {
+	offset uint64
+	length uint32
+}
+
+// ArchiveWriter adds chunks to an encrypted archive.
+type ArchiveWriter struct {
+	w      io.Writer
+	bc     cipher.Block
+	salt   []byte
+	off    uint64
+	nextID uint64
+	index  map[uint64]archiveEntry
+}
+
+// NewArchiveWriter writes the header of a new archive to "w" and returns an
+// ArchiveWriter for it. Close must be called to write the index.
+func NewArchiveWriter(w io.Writer, bc cipher.Block) (*ArchiveWriter, error) {
+	hdr := make([]byte, archiveHeaderLen)
+	copy(hdr, archiveMagic)
+	binary.BigEndian.PutUint16(hdr[8:10], ArchiveVersion)
+	salt := hdr[16:32]
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{
+		w:     w,
+		bc:    bc,
+		salt:  salt,
+		off:   archiveHeaderLen,
+		index: make(map[uint64]archiveEntry),
+	}, nil
+}
+
+// AppendArchive continues the existing archive "r" of "size" bytes. "w" must
+// append to the same archive, i.e. its first byte lands at offset "size".
+// New chunks get IDs following the highest existing one.
+func AppendArchive(r io.ReaderAt, size int64, w io.Writer, bc cipher.Block) (*ArchiveWriter, error) {
+	ar, err := OpenArchive(r, size, bc)
+	if err != nil {
+		return nil, err
+	}
+	aw := &ArchiveWriter{
+		w:     w,
+		bc:    bc,
+		salt:  ar.salt,
+		off:   uint64(size),
+		index: ar.index,
+	}
+	for id := range ar.index {
+		if id >= aw.nextID {
+			aw.nextID = id + 1
+		}
+	}
+	return aw, nil
+}
+
+// Add encrypts and appends "chunk" and returns its ID.
+func (aw *ArchiveWriter) Add(chunk []byte) (uint64, error) {
+	if uint64(len(chunk)) > 0xffffffff {
+		return 0, fmt.Errorf("chunk too large (%d bytes)", len(chunk))
+	}
+	id := aw.nextID
+	rec := make([]byte, archiveRecordLen, archiveRecordLen+len(chunk)+15)
+	binary.BigEndian.PutUint64(rec[0:8], id)
+	binary.BigEndian.PutUint32(rec[8:12], uint32(len(chunk)))
+	rec = append(rec, chunk...)
+	rec = append(rec, make([]byte, padLen16(len(chunk)))...)
+	transformChunk(aw.bc, aw.salt, id, rec[archiveRecordLen:], DirectionEncrypt)
+	if _, err := aw.w.Write(rec); err != nil {
+		return 0, err
+	}
+	aw.index[id] = archiveEntry{offset: aw.off, length: uint32(len(chunk))}
+	aw.off += uint64(len(rec))
+	aw.nextID++
+	return id, nil
+}
+
+// Close writes the index and the trailer. It does not close the underlying
+// writer.
+func (aw *ArchiveWriter) Close() error {
+	ids := make([]uint64, 0, len(aw.index))
+	for id := range aw.index {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(len(ids)))
+	for _, id := range ids {
+		e := aw.index[id]
+		binary.Write(&b, binary.BigEndian, id)
+		binary.Write(&b, binary.BigEndian, e.offset)
+		binary.Write(&b, binary.BigEndian, e.length)
+	}
+	binary.Write(&b, binary.BigEndian, crc32.ChecksumIEEE(b.Bytes()))
+	binary.Write(&b, binary.BigEndian, aw.off)
+	b.Write(archiveIndexMagic)
+	_, err := aw.w.Write(b.Bytes())
+	return err
+}
+
+// ArchiveReader gives random access to the chunks of an encrypted archive.
+type ArchiveReader struct {
+	r     io.ReaderAt
+	bc    cipher.Block
+	salt  []byte
+	index map[uint64]archiveEntry
+}
+
+// OpenArchive reads the header and the index of the archive "r", which is
+// "size" bytes long.
+func OpenArchive(r io.ReaderAt, size int64, bc cipher.Block) (*ArchiveReader, error) {
+	if size < archiveHeaderLen+4+4+archiveTrailerLen {
+		return nil, errors.New("archive too short")
+	}
+	hdr := make([]byte, archiveHeaderLen)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hdr[:8], archiveMagic) {
+		return nil, errors.New("not an EME archive (bad magic)")
+	}
+	if v := binary.BigEndian.Uint16(hdr[8:10]); v != ArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version %d", v)
+	}
+	trailer := make([]byte, archiveTrailerLen)
+	if _, err := r.ReadAt(trailer, size-archiveTrailerLen); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(trailer[8:], archiveIndexMagic) {
+		return nil, errors.New("archive has no index (not closed properly?)")
+	}
+	idxOff := int64(binary.BigEndian.Uint64(trailer[0:8]))
+	idxLen := size - archiveTrailerLen - idxOff
+	if idxOff < archiveHeaderLen || idxLen < 8 {
+		return nil, errors.New("archive index is corrupt (bad offset)")
+	}
+	idx := make([]byte, idxLen)
+	if _, err := r.ReadAt(idx, idxOff); err != nil {
+		return nil, err
+	}
+	count := binary.BigEndian.Uint32(idx[0:4])
+	if int64(count)*archiveEntryLen+8 != idxLen {
+		return nil, errors.New("archive index is corrupt (bad length)")
+	}
+	if crc32.ChecksumIEEE(idx[:idxLen-4]) != binary.BigEndian.Uint32(idx[idxLen-4:]) {
+		return nil, errors.New("archive index is corrupt (checksum mismatch)")
+	}
+	ar := &ArchiveReader{
+		r:     r,
+		bc:    bc,
+		salt:  hdr[16:32],
+		index: make(map[uint64]archiveEntry, count),
+	}
+	for e := idx[4 : idxLen-4]; len(e) > 0; e = e[archiveEntryLen:] {
+		ar.index[binary.BigEndian.Uint64(e[0:8])] = archiveEntry{
+			offset: binary.BigEndian.Uint64(e[8:16]),
+			length: binary.BigEndian.Uint32(e[16:20]),
+		}
+	}
+	return ar, nil
+}
+
+// IDs returns the IDs of all chunks in the archive in ascending order.
+func (ar *ArchiveReader) IDs() []uint64 {
+	ids := make([]uint64, 0, len(ar.index))
+	for id := range ar.index {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Chunk reads and decrypts the chunk with ID "id".
+func (ar *ArchiveReader) Chunk(id uint64) ([]byte, error) {
+	e, ok := ar.index[id]
+	if !ok {
+		return nil, fmt.Errorf("chunk %d not found", id)
+	}
+	rec := make([]byte, archiveRecordLen+int(e.length)+padLen16(int(e.length)))
+	if _, err := ar.r.ReadAt(rec, int64(e.offset)); err != nil {
+		return nil, fmt.Errorf("chunk %d: %w", id, err)
+	}
+	if binary.BigEndian.Uint64(rec[0:8]) != id || binary.BigEndian.Uint32(rec[8:12]) != e.length {
+		return nil, fmt.Errorf("chunk %d: record does not match the index", id)
+	}
+	data := rec[archiveRecordLen:]
+	transformChunk(ar.bc, ar.salt, id, data, DirectionDecrypt)
+	return data[:e.length], nil
+}
+
+// padLen16 - number of zero bytes needed to pad "n" to a multiple of 16
+func padLen16(n int) int {
+	return (16 - n%16) % 16
+}
+
+// transformChunk - en- or decrypt "data" (a multiple of 16 bytes long) in
+// place, in segments of up to 2048 bytes. Segment "i" uses the tweak
+// (id, i) XORed with "salt".
+func transformChunk(bc cipher.Block, salt []byte, id uint64, data []byte, direction directionConst) {
+	tweak := make([]byte, 16)
+	for i := 0; i*pageSegmentSize < len(data); i++ {
+		seg := data[i*pageSegmentSize:]
+		if len(seg) > pageSegmentSize {
+			seg = seg[:pageSegmentSize]
+		}
+		pageTweak(tweak, id, uint64(i))
+		xorBlocks(tweak, tweak, salt)
+		copy(seg, Transform(bc, tweak, seg, direction))
+	}
+}
@@ -0,0 +1,103 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	aw, err := NewArchiveWriter(&buf, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := [][]byte{
+		[]byte("first chunk"),
+		{},
+		bytes.Repeat([]byte("x"), 5000),
+	}
+	for i, c := range chunks {
+		id, err := aw.Add(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != uint64(i) {
+			t.Errorf("chunk %d got id %d", i, id)
+		}
+	}
+	if err = aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("first chunk")) {
+		t.Errorf("plaintext visible in archive")
+	}
+
+	// Incremental backup: append one more chunk
+	old := append([]byte{}, buf.Bytes()...)
+	aw, err = AppendArchive(bytes.NewReader(old), int64(len(old)), &buf, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := aw.Add([]byte("appended"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 3 {
+		t.Errorf("appended chunk got id %d", id)
+	}
+	if err = aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), old) {
+		t.Fatalf("append modified existing data")
+	}
+	chunks = append(chunks, []byte("appended"))
+
+	ar, err := OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ar.IDs()) != len(chunks) {
+		t.Errorf("wrong number of chunks: %v", ar.IDs())
+	}
+	for i := len(chunks) - 1; i >= 0; i-- {
+		got, err := ar.Chunk(uint64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, chunks[i]) {
+			t.Errorf("chunk %d differs", i)
+		}
+	}
+	if _, err = ar.Chunk(99); err == nil {
+		t.Errorf("missing chunk did not return an error")
+	}
+}
+
+func TestArchiveCorrupt(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	aw, err := NewArchiveWriter(&buf, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.Add([]byte("data"))
+	// Not closed: no index
+	if _, err = OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), bc); err == nil {
+		t.Errorf("archive without index was accepted")
+	}
+	aw.Close()
+	b := buf.Bytes()
+	b[len(b)-archiveTrailerLen-6] ^= 1
+	if _, err = OpenArchive(bytes.NewReader(b), int64(len(b)), bc); err == nil {
+		t.Errorf("corrupt index was accepted")
+	}
+}
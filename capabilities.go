@@ -0,0 +1,50 @@
+package eme
+
+// maxMessageBlocks - the most 16-byte blocks one EME transformation takes,
+// 128, from the limit of the paper
+const maxMessageBlocks = 16 * 8
+
+// Mode names, as returned by SupportedModes
+const (
+	// ModeEME - single messages with Transform and EMECipher
+	ModeEME = "eme"
+	// ModePage - pages larger than 2048 bytes with PageCipher
+	ModePage = "page"
+	// ModeStream - sector streams with Writer and Reader, with PadPKCS7,
+	// PadNone or PadCTS
+	ModeStream = "stream"
+	// ModeContainer - container files, see ImageToContainer
+	ModeContainer = "container"
+	// ModeEnvelope - self-describing streams with NewEnvelopeWriter
+	ModeEnvelope = "envelope"
+	// ModeJWE - authenticated JWE tokens, see JWEEncrypt
+	ModeJWE = "jwe"
+	// ModeAge - age-format files, see NewAgeWriter
+	ModeAge = "age"
+	// ModeCMS - CMS EnvelopedData, see NewCMSWriter
+	ModeCMS = "cms"
+	// ModeSIV - deterministic authenticated encryption, see NewSIV
+	ModeSIV = "siv"
+)
+
+// HasAssembly reports whether the EME core uses assembly on this CPU. On
+// amd64 with AVX-512 and VPCLMULQDQ, and on every arm64 CPU, the mask math
+// runs four blocks at a time in assembly; everywhere else, and with the
+// purego build tag, the core is pure Go. The block cipher is accelerated by crypto/aes where the CPU
+// supports it, and by BlockBatcher implementations like HSMBlock.
+func HasAssembly() bool {
+	return useGFAsm
+}
+
+// MaxMessageBlocks returns the most 16-byte blocks Transform accepts in one
+// message, so messages are at most 16*MaxMessageBlocks() bytes long. Use
+// PageCipher or the streams for more.
+func MaxMessageBlocks() int {
+	return maxMessageBlocks
+}
+
+// SupportedModes returns the names of the modes this build of the package
+// implements, see ModeEME and the following constants.
+func SupportedModes() []string {
+	return []string{ModeEME, ModePage, ModeStream, ModeContainer, ModeEnvelope, ModeJWE, ModeAge, ModeCMS, ModeSIV}
+}
@@ -0,0 +1,20 @@
+package eme
+
+import (
+	"crypto/aes"
+	"slices"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 16))
+	// The largest message is accepted
+	Transform(bc, make([]byte, 16), make([]byte, 16*MaxMessageBlocks()), DirectionEncrypt)
+	if HasAssembly() != useGFAsm {
+		t.Errorf("HasAssembly=%v, but useGFAsm=%v", HasAssembly(), useGFAsm)
+	}
+	modes := SupportedModes()
+	if !slices.Contains(modes, ModeEME) || !slices.Contains(modes, ModeContainer) {
+		t.Errorf("modes %v", modes)
+	}
+}
@@ -0,0 +1,59 @@
+package eme
+
+import "crypto/cipher"
+
+// cascadeTweakMask - XORed into the tweak of the second pass of a Cascade
+var cascadeTweakMask = [16]byte{'e', 'm', 'e', ' ', 'c', 'a', 's', 'c', 'a', 'd', 'e', ' ', 'p', 'a', 's', 's'}
+
+// Cascade encrypts every message twice with EME: first under "first" and
+// the tweak, then under "second" and the tweak XORed with a constant. It is
+// for defense-in-depth mandates that require two independent layers of
+// encryption, for example two different block ciphers or keys held by
+// different parties.
+//
+// The cascade is at least as strong as the stronger of its two layers, if
+// their keys are independent. It is not needed against any known attack on
+// EME or AES: a single EMECipher with AES-256 is the better choice unless a
+// policy asks for two layers. The cost is twice the time of a single
+// EMECipher; the message size limits are the same.
+//
+// The keys of the two layers must be independent: with the same key, the
+// layers protect no better than one. The different second tweak keeps the
+// two passes from being the same permutation even then, but it does not
+// make up for the missing second key.
+type Cascade struct {
+	first  *EMECipher
+	second *EMECipher
+}
+
+var _ TweakableBlockCipher = (*Cascade)(nil)
+
+// NewCascade returns a Cascade of "first" and "second", which must have a
+// block size of 16, or subsequent calls to Encrypt and Decrypt will panic.
+func NewCascade(first cipher.Block, second cipher.Block) *Cascade {
+	return &Cascade{first: New(first), second: New(second)}
+}
+
+// Encrypt encrypts "inputData" under "tweak" with both layers. The
+// parameters are checked like those of Transform.
+func (c *Cascade) Encrypt(tweak []byte, inputData []byte) []byte {
+	mid := c.first.Encrypt(tweak, inputData)
+	return c.second.Encrypt(cascadeTweak(tweak), mid)
+}
+
+// Decrypt reverses Encrypt.
+func (c *Cascade) Decrypt(tweak []byte, inputData []byte) []byte {
+	mid := c.second.Decrypt(cascadeTweak(tweak), inputData)
+	return c.first.Decrypt(tweak, mid)
+}
+
+// cascadeTweak - the tweak of the second layer. A tweak of the wrong length
+// is passed on, for Transform to reject.
+func cascadeTweak(tweak []byte) []byte {
+	if len(tweak) != 16 {
+		return tweak
+	}
+	t := make([]byte, 16)
+	xorBlocks(t, tweak, cascadeTweakMask[:])
+	return t
+}
@@ -0,0 +1,309 @@
+// Command age-plugin-eme is an age plugin (https://age-encryption.org) that
+// wraps the file keys of standard age v1 files with EME, in the stanzas of
+// eme.WrapAgeFileKey. The payload stays age's ChaCha20-Poly1305: the plugin
+// protocol only lets plugins wrap file keys. For files with an EME payload,
+// see eme.NewAgeWriter.
+//
+// An identity is a symmetric AES key, encoded as AGE-PLUGIN-EME-1...
+// There are no public recipients, since anyone who can encrypt to a key can
+// also decrypt with it. Encrypt to an identity with "age -e -i":
+//
+//	age-plugin-eme -generate > key.txt
+//	age -e -i key.txt -o file.age file
+//	age -d -i key.txt file.age
+//
+// Usage:
+//
+//	age-plugin-eme -generate
+//	age-plugin-eme -key HEX|@FILE
+//
+// age runs the plugin with --age-plugin=recipient-v1 or identity-v1 and
+// talks to it over standard input and output.
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rfjakob/eme"
+)
+
+// identityHRP - the human-readable part of the identities of the plugin
+const identityHRP = "AGE-PLUGIN-EME-"
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) int {
+	fs := flag.NewFlagSet("age-plugin-eme", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: age-plugin-eme -generate | -key HEX|@FILE\n\n"+
+			"Prints an age identity for EME key wrapping. Use it with \"age -e -i\"\n"+
+			"and \"age -d -i\".\n\n")
+		fs.PrintDefaults()
+	}
+	sm := fs.String("age-plugin", "", "run a state machine of the age plugin protocol (used by age)")
+	generate := fs.Bool("generate", false, "print a new identity with a random AES-256 key")
+	hexKey := fs.String("key", "", "print the identity of this hex-encoded AES key, or of the key file @FILE written by \"eme keygen\"")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return exitUsage
+	}
+	var err error
+	switch {
+	case *sm == "recipient-v1":
+		err = runRecipient(newConn(stdin, stdout))
+	case *sm == "identity-v1":
+		err = runIdentity(newConn(stdin, stdout))
+	case *sm != "":
+		err = fmt.Errorf("unsupported state machine %q", *sm)
+	case *generate:
+		key := make([]byte, 32)
+		if _, err = rand.Read(key); err == nil {
+			err = printIdentity(stdout, key)
+		}
+	case *hexKey != "":
+		var key []byte
+		if key, err = parseKey(*hexKey); err == nil {
+			err = printIdentity(stdout, key)
+		}
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "age-plugin-eme: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// parseKey - the key bytes of a -key flag, like in cmd/eme
+func parseKey(hexKey string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(hexKey, "@"); ok {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		hexKey = strings.TrimSpace(string(b))
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("bad key: %v", err)
+	}
+	if _, err = aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func printIdentity(w io.Writer, key []byte) error {
+	id, err := bech32Encode(identityHRP, key)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "# EME key wrapping identity, keep it secret\n%s\n", id)
+	return err
+}
+
+// parseIdentity - the block cipher of an AGE-PLUGIN-EME-1... identity
+func parseIdentity(s string) (cipher.Block, error) {
+	hrp, key, err := bech32Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(hrp, identityHRP) {
+		return nil, fmt.Errorf("not an eme identity")
+	}
+	return aes.NewCipher(key)
+}
+
+// conn - the plugin side of the protocol: stanzas in both directions
+type conn struct {
+	br *bufio.Reader
+	w  io.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{br: bufio.NewReader(r), w: w}
+}
+
+// readPhase1 - the commands of age up to "done"
+func (c *conn) readPhase1() ([]*eme.AgeStanza, error) {
+	var cmds []*eme.AgeStanza
+	for {
+		s, err := eme.ReadAgeStanza(c.br)
+		if err != nil {
+			return nil, err
+		}
+		if s.Type == "done" {
+			return cmds, nil
+		}
+		cmds = append(cmds, s)
+	}
+}
+
+// request - send a phase 2 command and wait for the response of age
+func (c *conn) request(typ string, body []byte, args ...string) error {
+	s := &eme.AgeStanza{Type: typ, Args: args, Body: body}
+	if err := s.Marshal(c.w); err != nil {
+		return err
+	}
+	resp, err := eme.ReadAgeStanza(c.br)
+	if err != nil {
+		return err
+	}
+	if resp.Type != "ok" {
+		return fmt.Errorf("age responded %q to %q", resp.Type, typ)
+	}
+	return nil
+}
+
+// fail - report an error to age and return it
+func (c *conn) fail(err error, args ...string) error {
+	if rerr := c.request("error", []byte(err.Error()), args...); rerr != nil {
+		return rerr
+	}
+	return err
+}
+
+// done - end phase 2
+func (c *conn) done() error {
+	return (&eme.AgeStanza{Type: "done"}).Marshal(c.w)
+}
+
+// runRecipient - wrap every file key for every identity. Recipients are
+// rejected, see the package documentation.
+func runRecipient(c *conn) error {
+	cmds, err := c.readPhase1()
+	if err != nil {
+		return err
+	}
+	var ids []cipher.Block
+	var fileKeys [][]byte
+	for _, s := range cmds {
+		switch s.Type {
+		case "add-recipient":
+			return c.fail(errors.New("eme has no recipients; encrypt with \"age -e -i\" and an identity"),
+				"recipient", "0")
+		case "add-identity":
+			if len(s.Args) != 1 {
+				return c.fail(errors.New("malformed add-identity"), "internal")
+			}
+			bc, err := parseIdentity(s.Args[0])
+			if err != nil {
+				return c.fail(err, "identity", strconv.Itoa(len(ids)))
+			}
+			ids = append(ids, bc)
+		case "wrap-file-key":
+			fileKeys = append(fileKeys, s.Body)
+		}
+		// Other commands, like extension-labels and the grease of age,
+		// need no answer
+	}
+	for f, fileKey := range fileKeys {
+		for _, bc := range ids {
+			s, err := eme.WrapAgeFileKey(bc, fileKey)
+			if err != nil {
+				return c.fail(err, "internal")
+			}
+			args := append([]string{strconv.Itoa(f), s.Type}, s.Args...)
+			if err = c.request("recipient-stanza", s.Body, args...); err != nil {
+				return err
+			}
+		}
+	}
+	return c.done()
+}
+
+// runIdentity - unwrap the file key of every file from the first eme stanza
+// that belongs to one of the identities
+func runIdentity(c *conn) error {
+	cmds, err := c.readPhase1()
+	if err != nil {
+		return err
+	}
+	var ids []cipher.Block
+	stanzas := make(map[int][]*eme.AgeStanza)
+	for _, s := range cmds {
+		switch s.Type {
+		case "add-identity":
+			if len(s.Args) != 1 {
+				return c.fail(errors.New("malformed add-identity"), "internal")
+			}
+			bc, err := parseIdentity(s.Args[0])
+			if err != nil {
+				return c.fail(err, "identity", strconv.Itoa(len(ids)))
+			}
+			ids = append(ids, bc)
+		case "recipient-stanza":
+			if len(s.Args) < 2 {
+				return c.fail(errors.New("malformed recipient-stanza"), "internal")
+			}
+			f, err := strconv.Atoi(s.Args[0])
+			if err != nil {
+				return c.fail(errors.New("malformed recipient-stanza"), "internal")
+			}
+			stanzas[f] = append(stanzas[f], &eme.AgeStanza{Type: s.Args[1], Args: s.Args[2:], Body: s.Body})
+		}
+	}
+	files := make([]int, 0, len(stanzas))
+	for f := range stanzas {
+		files = append(files, f)
+	}
+	sort.Ints(files)
+	for _, f := range files {
+		fileKey, i, err := unwrapFile(stanzas[f], ids)
+		if err != nil {
+			return c.fail(err, "stanza", strconv.Itoa(f), strconv.Itoa(i))
+		}
+		if fileKey == nil {
+			continue
+		}
+		err = c.request("file-key", fileKey, strconv.Itoa(f))
+		clear(fileKey)
+		if err != nil {
+			return err
+		}
+	}
+	return c.done()
+}
+
+// unwrapFile - the file key from the first of "stanzas" that belongs to one
+// of the identities, nil if none does, and the index of the stanza it came
+// from or failed on
+func unwrapFile(stanzas []*eme.AgeStanza, ids []cipher.Block) ([]byte, int, error) {
+	for i, s := range stanzas {
+		if s.Type != eme.AgeStanzaType {
+			continue
+		}
+		for _, bc := range ids {
+			key, err := eme.UnwrapAgeFileKey(bc, s)
+			if errors.Is(err, eme.ErrAgeStanzaKey) {
+				continue
+			} else if err != nil {
+				return nil, i, err
+			}
+			return key, i, nil
+		}
+	}
+	return nil, 0, nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/rfjakob/eme"
+)
+
+// marshal - age protocol messages, as age would send them
+func marshal(t *testing.T, stanzas ...*eme.AgeStanza) string {
+	var buf bytes.Buffer
+	for _, s := range stanzas {
+		if err := s.Marshal(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.String()
+}
+
+// plugin - run a state machine with "in" as the messages of age, and return
+// the exit code and the messages of the plugin
+func plugin(t *testing.T, sm string, in string) (int, []*eme.AgeStanza) {
+	var out bytes.Buffer
+	code := run([]string{"--age-plugin=" + sm}, strings.NewReader(in), &out)
+	var msgs []*eme.AgeStanza
+	br := bufio.NewReader(&out)
+	for br.Buffered() > 0 || out.Len() > 0 {
+		s, err := eme.ReadAgeStanza(br)
+		if err != nil {
+			t.Fatalf("plugin output: %v", err)
+		}
+		msgs = append(msgs, s)
+	}
+	return code, msgs
+}
+
+func testIdentity(t *testing.T, b byte) string {
+	var out bytes.Buffer
+	if code := run([]string{"-key", hex.EncodeToString(bytes.Repeat([]byte{b}, 32))}, nil, &out); code != exitOK {
+		t.Fatalf("-key exited with %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	return lines[len(lines)-1]
+}
+
+func TestWrapUnwrap(t *testing.T) {
+	alice, bob := testIdentity(t, 1), testIdentity(t, 2)
+	fileKey := bytes.Repeat([]byte{0x42}, 16)
+	ok := &eme.AgeStanza{Type: "ok"}
+	done := &eme.AgeStanza{Type: "done"}
+
+	// Phase 1 of recipient-v1, with grease, then the answer to the stanza
+	code, msgs := plugin(t, "recipient-v1", marshal(t,
+		&eme.AgeStanza{Type: "add-identity", Args: []string{alice}},
+		&eme.AgeStanza{Type: "grease-x", Args: []string{"a"}, Body: []byte("b")},
+		&eme.AgeStanza{Type: "wrap-file-key", Body: fileKey},
+		&eme.AgeStanza{Type: "extension-labels"},
+		done, ok))
+	if code != exitOK || len(msgs) != 2 || msgs[0].Type != "recipient-stanza" || msgs[1].Type != "done" {
+		t.Fatalf("recipient-v1: exit %d, %+v", code, msgs)
+	}
+	rs := msgs[0]
+	if rs.Args[0] != "0" || rs.Args[1] != eme.AgeStanzaType {
+		t.Fatalf("bad recipient-stanza %+v", rs)
+	}
+
+	// identity-v1 gets every stanza of the file
+	stanzas := marshal(t,
+		&eme.AgeStanza{Type: "recipient-stanza", Args: []string{"0", "X25519", "abc"}, Body: []byte("x")},
+		rs,
+		done, ok)
+	for _, id := range []string{alice, bob} {
+		code, msgs = plugin(t, "identity-v1", marshal(t, &eme.AgeStanza{Type: "add-identity", Args: []string{id}})+stanzas)
+		if code != exitOK || msgs[len(msgs)-1].Type != "done" {
+			t.Fatalf("identity-v1: exit %d, %+v", code, msgs)
+		}
+		if id == bob {
+			if len(msgs) != 1 {
+				t.Errorf("unwrapped with the wrong identity: %+v", msgs)
+			}
+			continue
+		}
+		if len(msgs) != 2 || msgs[0].Type != "file-key" || msgs[0].Args[0] != "0" || !bytes.Equal(msgs[0].Body, fileKey) {
+			t.Errorf("identity-v1: %+v", msgs)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ok := &eme.AgeStanza{Type: "ok"}
+	done := &eme.AgeStanza{Type: "done"}
+	for _, c := range []struct {
+		sm   string
+		cmds []*eme.AgeStanza
+	}{
+		{"recipient-v1", []*eme.AgeStanza{{Type: "add-recipient", Args: []string{"age1eme1qqqq"}}}},
+		{"recipient-v1", []*eme.AgeStanza{{Type: "add-identity", Args: []string{"AGE-PLUGIN-EME-1QQQQ"}}}},
+		{"identity-v1", []*eme.AgeStanza{
+			{Type: "add-identity", Args: []string{testIdentity(t, 1)}},
+			{Type: "recipient-stanza", Args: []string{"0", "eme", "!!"}, Body: make([]byte, 16)},
+		}},
+	} {
+		code, msgs := plugin(t, c.sm, marshal(t, append(c.cmds, done, ok)...))
+		if code != exitError || len(msgs) != 1 || msgs[0].Type != "error" {
+			t.Errorf("%s %+v: exit %d, %+v", c.sm, c.cmds[0], code, msgs)
+		}
+	}
+}
+
+func TestBech32(t *testing.T) {
+	// Valid strings of BIP 173
+	for _, s := range []string{"A12UEL5L", "a12uel5l", "an83characterlonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1tt5tgs"} {
+		if _, _, err := bech32Decode(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+	for _, s := range []string{"A12UeL5L", "a12uel5m", "1qzzfhee", "a1qqqqq"} {
+		if _, _, err := bech32Decode(s); err == nil {
+			t.Errorf("%s: accepted", s)
+		}
+	}
+	data := []byte("some data of 23 bytes..")
+	s, err := bech32Encode(identityHRP, data)
+	if err != nil || s != strings.ToUpper(s) {
+		t.Fatalf("%s, %v", s, err)
+	}
+	hrp, got, err := bech32Decode(s)
+	if err != nil || hrp != identityHRP || !bytes.Equal(got, data) {
+		t.Errorf("roundtrip: %q %q %v", hrp, got, err)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rfjakob/eme"
+)
+
+// benchReport - output of "eme bench"
+type benchReport struct {
+	GOOS   string `json:"goos"`
+	GOARCH string `json:"goarch"`
+	CPUs   int    `json:"cpus"`
+	// AESHardware is whether the CPU advertises AES instructions, or nil if
+	// that could not be determined
+	AESHardware *bool         `json:"aes_hardware"`
+	Results     []benchResult `json:"results"`
+}
+
+type benchResult struct {
+	SectorSize int  `json:"sector_size"`
+	Workers    int  `json:"workers"`
+	Accel      bool `json:"accel"`
+	// MiBps - encryption throughput in MiB/s
+	MiBps float64 `json:"mib_per_s"`
+}
+
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme bench [-sizes LIST] [-time D] [-compare]\n\n"+
+			"Prints a JSON report of the encryption throughput at each sector\n"+
+			"size, on one core and on all cores.\n\n")
+		fs.PrintDefaults()
+	}
+	sizes := fs.String("sizes", "512,4096,65536", "comma-separated sector sizes")
+	d := fs.Duration("time", time.Second, "duration of each measurement")
+	compare := fs.Bool("compare", false, "also measure with AES instructions disabled (GODEBUG=cpu.aes=off, amd64 only)")
+	noAccel := fs.Bool("no-accel", false, "internal, set in the child process started by -compare")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return exitUsage
+	}
+	var sectorSizes []int
+	for _, s := range strings.Split(*sizes, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n%16 != 0 || (n > 2048 && n%2048 != 0) {
+			return fatal("invalid sector size %q", s)
+		}
+		sectorSizes = append(sectorSizes, n)
+	}
+	var results []benchResult
+	for _, ss := range sectorSizes {
+		for _, workers := range []int{1, runtime.GOMAXPROCS(0)} {
+			results = append(results, benchResult{
+				SectorSize: ss,
+				Workers:    workers,
+				Accel:      !*noAccel,
+				MiBps:      benchThroughput(ss, workers, *d),
+			})
+			if runtime.GOMAXPROCS(0) == 1 {
+				break
+			}
+		}
+	}
+	if *noAccel {
+		// Child process started by -compare
+		json.NewEncoder(os.Stdout).Encode(results)
+		return exitOK
+	}
+	if *compare {
+		more, err := benchWithoutAccel(args)
+		if err != nil {
+			return fatal("measuring without AES instructions: %v", err)
+		}
+		results = append(results, more...)
+	}
+	report := benchReport{
+		GOOS:        runtime.GOOS,
+		GOARCH:      runtime.GOARCH,
+		CPUs:        runtime.NumCPU(),
+		AESHardware: aesHardware(),
+		Results:     results,
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
+
+// benchThroughput - MiB/s encrypted by "workers" goroutines in sectors of
+// "sectorSize" bytes during "d"
+func benchThroughput(sectorSize int, workers int, d time.Duration) float64 {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int64
+	)
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pc := eme.NewPageCipher(bc, sectorSize)
+			buf := make([]byte, sectorSize)
+			var n int64
+			for page := uint64(0); time.Since(start) < d; page++ {
+				pc.EncryptPage(page, buf)
+				n += int64(sectorSize)
+			}
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return float64(total) / (1 << 20) / time.Since(start).Seconds()
+}
+
+// benchWithoutAccel - run the measurements again in a child process with the
+// AES instructions disabled
+func benchWithoutAccel(args []string) ([]benchResult, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(exe, append(append([]string{"bench"}, args...), "-no-accel")...)
+	cmd.Env = append(os.Environ(), "GODEBUG=cpu.aes=off")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	var results []benchResult
+	err = json.Unmarshal(out, &results)
+	return results, err
+}
+
+// aesHardware - whether /proc/cpuinfo lists AES support, nil if unknown
+func aesHardware() *bool {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	found := false
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key, val, ok := strings.Cut(s.Text(), ":")
+		key = strings.TrimSpace(key)
+		if !ok || (key != "flags" && key != "Features") {
+			continue
+		}
+		for _, flag := range strings.Fields(val) {
+			if flag == "aes" {
+				found = true
+			}
+		}
+		break
+	}
+	return &found
+}
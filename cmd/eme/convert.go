@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rfjakob/eme"
+)
+
+func runConvert(args []string) int {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme convert -key HEX -to container|image [-sector N] [-sparse] SRC DST\n\n"+
+			"SRC and DST may be the same file to convert in place.\n\n")
+		fs.PrintDefaults()
+	}
+	key := fs.String("key", "", "hex-encoded AES key (16, 24 or 32 bytes)")
+	to := fs.String("to", "", `target format, "container" or "image"`)
+	sector := fs.Int("sector", 4096, "sector size when creating a container")
+	sparse := fs.Bool("sparse", false, "keep holes and all-zero sectors unencrypted (reveals which sectors are empty)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 2 || *key == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	bc, err := blockCipher(*key)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	src, dst := fs.Arg(0), fs.Arg(1)
+	switch *to {
+	case "container":
+		opts := eme.ContainerOptions{SectorSize: *sector}
+		if *sparse {
+			opts.Sparse = eme.SparsePreserve
+		}
+		err = eme.ImageToContainer(dst, src, bc, opts)
+	case "image":
+		err = eme.ContainerToImage(dst, src, bc)
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	if err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rfjakob/eme"
+)
+
+// passphraseEnv - environment variable the passphrase is taken from when
+// neither -key nor -passfile is given
+const passphraseEnv = "EME_PASSPHRASE"
+
+// cryptFlags - flags shared by encrypt and decrypt
+type cryptFlags struct {
+	fs       *flag.FlagSet
+	key      *string
+	passfile *string
+	keystore *string
+	in       *string
+	out      *string
+	progress *bool
+}
+
+func newCryptFlags(name string, usage string) *cryptFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme %s %s\n\n"+
+			"Without -key or -passfile, the passphrase is read from $%s or,\n"+
+			"if that is unset, from standard input.\n\n", name, usage, passphraseEnv)
+		fs.PrintDefaults()
+	}
+	return &cryptFlags{
+		fs:       fs,
+		key:      fs.String("key", "", "hex-encoded AES key (16, 24 or 32 bytes) instead of a passphrase"),
+		passfile: fs.String("passfile", "", "read the passphrase from the first line of this file"),
+		keystore: fs.String("keystore", "", "use the keys of this keystore, unlocked with the passphrase (see \"eme keystore\")"),
+		in:       fs.String("in", "", "input file"),
+		out:      fs.String("out", "", "output file"),
+		progress: fs.Bool("progress", false, "print progress to standard error"),
+	}
+}
+
+func (f *cryptFlags) parse(args []string) bool {
+	if err := f.fs.Parse(args); err != nil {
+		return false
+	}
+	if f.fs.NArg() != 0 || *f.in == "" || *f.out == "" {
+		f.fs.Usage()
+		return false
+	}
+	return true
+}
+
+// passphrase - from -passfile, $EME_PASSPHRASE or standard input
+func (f *cryptFlags) passphrase() ([]byte, error) {
+	return readPassphrase(*f.passfile)
+}
+
+// cipherFromKDF - AES-256 from the passphrase and "p"
+func (f *cryptFlags) cipherFromKDF(p *eme.KDFParams) (cipher.Block, error) {
+	pw, err := f.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.Key(pw)
+	if err != nil {
+		return nil, err
+	}
+	return aes.NewCipher(key)
+}
+
+// progressFunc - prints the percentage whenever it changes, or nil if
+// progress output is off
+func (f *cryptFlags) progressFunc() func(done uint64, total uint64) {
+	if !*f.progress {
+		return nil
+	}
+	last := -1
+	return func(done uint64, total uint64) {
+		pct := 100
+		if total > 0 {
+			pct = int(done * 100 / total)
+		}
+		if pct != last {
+			last = pct
+			fmt.Fprintf(os.Stderr, "\r%3d%%", pct)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
+}
+
+func runEncrypt(args []string) int {
+	f := newCryptFlags("encrypt", "[-key HEX | -passfile FILE] [-keystore FILE] [-sector N] [-kdftime D] [-progress] -in FILE -out FILE")
+	sector := f.fs.Int("sector", 4096, "sector size of the container")
+	kdfTime := f.fs.Duration("kdftime", 0, "tune Argon2id to take this long on this machine, instead of the default parameters")
+	if !f.parse(args) {
+		return exitUsage
+	}
+	opts := eme.ContainerOptions{SectorSize: *sector, Progress: f.progressFunc()}
+	var bc cipher.Block
+	var err error
+	if *f.key != "" {
+		bc, err = blockCipher(*f.key)
+	} else if *f.keystore != "" {
+		var ks *eme.Keystore
+		if ks, err = loadKeystore(*f.keystore, "", *f.passfile); err != nil {
+			return fatal("%v", err)
+		}
+		if opts.KeyID = ks.Current(); opts.KeyID == 0 {
+			return fatal("keystore %s has no keys, see \"eme keystore add\"", *f.keystore)
+		}
+		bc, err = ks.Block(opts.KeyID)
+	} else {
+		if *kdfTime > 0 {
+			opts.KDF, err = eme.NewCalibratedKDFParams(*kdfTime)
+		} else {
+			opts.KDF, err = eme.NewArgon2KDFParams()
+		}
+		if err != nil {
+			return fatal("%v", err)
+		}
+		bc, err = f.cipherFromKDF(opts.KDF)
+	}
+	if err != nil {
+		return fatal("%v", err)
+	}
+	if err = eme.ImageToContainer(*f.out, *f.in, bc, opts); err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
+
+func runDecrypt(args []string) int {
+	f := newCryptFlags("decrypt", "[-key HEX | -passfile FILE] [-keystore FILE] [-progress] -in FILE -out FILE")
+	if !f.parse(args) {
+		return exitUsage
+	}
+	bc, err := f.cipherForContainer()
+	if err != nil {
+		return fatal("%v", err)
+	}
+	if err = decryptContainer(*f.out, *f.in, bc, f.progressFunc()); err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
+
+// cipherForContainer - the key from -key, the keystore key named in the
+// header of the input container, or the key derived from the passphrase with
+// the KDF parameters in the header
+func (f *cryptFlags) cipherForContainer() (cipher.Block, error) {
+	if *f.key != "" {
+		return blockCipher(*f.key)
+	}
+	fd, err := os.Open(*f.in)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	h, err := eme.ReadContainerHeader(fd)
+	if err != nil {
+		return nil, err
+	}
+	p, err := h.KDF()
+	if err != nil {
+		return nil, err
+	}
+	if *f.keystore != "" {
+		if h.KeyID() == 0 {
+			return nil, errors.New("the container was not encrypted with a keystore key")
+		}
+		ks, err := loadKeystore(*f.keystore, "", *f.passfile)
+		if err != nil {
+			return nil, err
+		}
+		return ks.Block(h.KeyID())
+	}
+	if p == nil {
+		return nil, errors.New("the container was not encrypted with a passphrase, use -key or -keystore")
+	}
+	return f.cipherFromKDF(p)
+}
+
+// decryptContainer - write the plaintext of container "src" to "dst",
+// reporting progress. Unlike eme.ContainerToImage, "src" and "dst" must be
+// different files. "src" is only read; a pending key rotation is an error.
+func decryptContainer(dst string, src string, bc cipher.Block, progress func(uint64, uint64)) error {
+	c, err := eme.OpenContainerReadOnly(src, bc)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	h := c.Header()
+	buf := make([]byte, h.SectorSize)
+	w := bufio.NewWriter(out)
+	for n := uint64(0); n < h.Sectors(); n++ {
+		if progress != nil {
+			progress(n, h.Sectors())
+		}
+		if err = c.ReadSector(n, buf); err != nil {
+			out.Close()
+			return err
+		}
+		plain := buf
+		if rest := h.Size - n*uint64(h.SectorSize); rest < uint64(len(buf)) {
+			plain = buf[:rest]
+		}
+		if _, err = w.Write(plain); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if progress != nil {
+		progress(h.Sectors(), h.Sectors())
+	}
+	if err = w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// readPassphrase - the first line of "passfile" if it is set, or else
+// $EME_PASSPHRASE or a line from standard input
+func readPassphrase(passfile string) ([]byte, error) {
+	var r io.Reader
+	if passfile != "" {
+		fd, err := os.Open(passfile)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		r = fd
+	} else if p, ok := os.LookupEnv(passphraseEnv); ok {
+		r = bytes.NewReader([]byte(p))
+	} else {
+		fmt.Fprintf(os.Stderr, "Passphrase: ")
+		r = os.Stdin
+	}
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, errors.New("empty passphrase")
+	}
+	return line, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecryptPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	in, ct, out := filepath.Join(dir, "in"), filepath.Join(dir, "ct"), filepath.Join(dir, "out")
+	plain := bytes.Repeat([]byte("plaintext "), 1000)
+	os.WriteFile(in, plain, 0600)
+	pass, wrong := filepath.Join(dir, "pass"), filepath.Join(dir, "wrong")
+	os.WriteFile(pass, []byte("correct horse\n"), 0600)
+	os.WriteFile(wrong, []byte("battery staple\n"), 0600)
+	if code := run([]string{"encrypt", "-passfile", pass, "-in", in, "-out", ct}); code != exitOK {
+		t.Fatalf("encrypt exited with %d", code)
+	}
+	if code := run([]string{"decrypt", "-passfile", pass, "-in", ct, "-out", out}); code != exitOK {
+		t.Fatalf("decrypt exited with %d", code)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, plain) {
+		t.Errorf("roundtrip failed")
+	}
+	os.Remove(out)
+	if code := run([]string{"decrypt", "-passfile", wrong, "-in", ct, "-out", out}); code != exitError {
+		t.Errorf("decrypt with the wrong passphrase exited with %d", code)
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Errorf("decrypt with the wrong passphrase wrote output")
+	}
+}
+
+func TestEncryptDecryptKey(t *testing.T) {
+	dir := t.TempDir()
+	in, ct, out := filepath.Join(dir, "in"), filepath.Join(dir, "ct"), filepath.Join(dir, "out")
+	plain := bytes.Repeat([]byte{7}, 10000)
+	os.WriteFile(in, plain, 0600)
+	key := strings.Repeat("ab", 32)
+	if code := run([]string{"encrypt", "-key", key, "-sector", "512", "-in", in, "-out", ct}); code != exitOK {
+		t.Fatalf("encrypt exited with %d", code)
+	}
+	if code := run([]string{"decrypt", "-key", key, "-in", ct, "-out", out}); code != exitOK {
+		t.Fatalf("decrypt exited with %d", code)
+	}
+	if got, _ := os.ReadFile(out); !bytes.Equal(got, plain) {
+		t.Errorf("roundtrip failed")
+	}
+	if code := run([]string{"decrypt", "-key", strings.Repeat("cd", 32), "-in", ct, "-out", out}); code != exitError {
+		t.Errorf("decrypt with the wrong key exited with %d", code)
+	}
+}
+
+// Unsupported sector sizes are usage errors, not panics
+func TestImageBadSector(t *testing.T) {
+	img := filepath.Join(t.TempDir(), "img")
+	os.WriteFile(img, make([]byte, 6000), 0600)
+	key := strings.Repeat("ab", 32)
+	for _, args := range [][]string{
+		{"image", "encrypt", "-key", key, "-sector", "3000", img},
+		{"image", "encrypt", "-key", key, "-sector", "3000", "-verify", img},
+		{"image", "verify", "-key", key, "-sector", "100", img},
+	} {
+		if code := run(args); code == exitOK {
+			t.Errorf("%v exited with %d", args, code)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rfjakob/eme"
+)
+
+// corpusEntry - the arguments of one fuzz input, []byte, string or byte
+type corpusEntry []any
+
+func runFuzzCorpus(args []string) int {
+	fs := flag.NewFlagSet("fuzzcorpus", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme fuzzcorpus [-out DIR]\n\n"+
+			"Writes seed corpus files with valid and boundary-case inputs for the\n"+
+			"fuzz targets of package eme, in the format of \"go test -fuzz\".\n\n")
+		fs.PrintDefaults()
+	}
+	out := fs.String("out", filepath.Join("testdata", "fuzz"), "corpus directory")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return exitUsage
+	}
+	corpora := map[string][]corpusEntry{
+		"FuzzTransform":           transformCorpus(),
+		"FuzzReadContainerHeader": containerHeaderCorpus(),
+		"FuzzDecryptFilename":     filenameCorpus(),
+		"FuzzEnvelopeReader":      envelopeCorpus(),
+		"FuzzStream":              streamCorpus(),
+	}
+	n := 0
+	for target, entries := range corpora {
+		dir := filepath.Join(*out, target)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fatal("%v", err)
+		}
+		for _, e := range entries {
+			data := e.marshal()
+			name := fmt.Sprintf("%x", sha256.Sum256(data))[:16]
+			if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				return fatal("%v", err)
+			}
+			n++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d corpus files to %s\n", n, *out)
+	return exitOK
+}
+
+// marshal - the "go test fuzz v1" file format
+func (e corpusEntry) marshal() []byte {
+	var b bytes.Buffer
+	b.WriteString("go test fuzz v1\n")
+	for _, v := range e {
+		switch v := v.(type) {
+		case []byte:
+			fmt.Fprintf(&b, "[]byte(%q)\n", v)
+		case string:
+			fmt.Fprintf(&b, "string(%q)\n", v)
+		case byte:
+			fmt.Fprintf(&b, "byte(%q)\n", v)
+		default:
+			panic(fmt.Sprintf("unsupported corpus type %T", v))
+		}
+	}
+	return b.Bytes()
+}
+
+// transformCorpus - all key sizes, the shortest and longest inputs, and
+// extreme tweaks and data
+func transformCorpus() []corpusEntry {
+	var entries []corpusEntry
+	for _, keyLen := range []int{16, 24, 32} {
+		for _, dataLen := range []int{16, 32, 2032, 2048} {
+			entries = append(entries,
+				corpusEntry{make([]byte, keyLen), make([]byte, 16), make([]byte, dataLen)},
+				corpusEntry{bytes.Repeat([]byte{0xff}, keyLen), bytes.Repeat([]byte{0xff}, 16), bytes.Repeat([]byte{0xff}, dataLen)},
+			)
+		}
+	}
+	// Invalid lengths, which the target must skip
+	entries = append(entries,
+		corpusEntry{make([]byte, 16), make([]byte, 15), make([]byte, 16)},
+		corpusEntry{make([]byte, 16), make([]byte, 16), make([]byte, 17)},
+		corpusEntry{make([]byte, 16), make([]byte, 16), make([]byte, 2064)},
+		corpusEntry{make([]byte, 16), make([]byte, 16), []byte{}},
+	)
+	return entries
+}
+
+// containerHeaderCorpus - valid headers and typical corruptions of them
+func containerHeaderCorpus() []corpusEntry {
+	var entries []corpusEntry
+	for _, ss := range []uint32{512, 4096, 65536} {
+		h := &eme.ContainerHeader{
+			Version:    eme.ContainerVersion,
+			SectorSize: ss,
+			Size:       10 * uint64(ss),
+			DataOffset: uint64(max(ss, 4096)),
+			Fields:     []eme.ContainerField{{Type: 3, Value: make([]byte, 16)}, {Type: 1, Value: []byte{1}}},
+		}
+		valid, err := h.MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		// Everything after the field area is zero and not needed
+		valid = valid[:64]
+		entries = append(entries, corpusEntry{valid})
+		badCRC := bytes.Clone(valid)
+		badCRC[36] ^= 1
+		entries = append(entries, corpusEntry{badCRC})
+		longFields := bytes.Clone(valid)
+		binary.BigEndian.PutUint32(longFields[32:36], 0xffffffff)
+		entries = append(entries, corpusEntry{longFields})
+		entries = append(entries, corpusEntry{valid[:39]}, corpusEntry{valid[:42]})
+	}
+	return entries
+}
+
+// filenameCorpus - valid encrypted names, including the longest one, and
+// malformed base64
+func filenameCorpus() []corpusEntry {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	e := eme.New(bc)
+	iv := make([]byte, 16)
+	var entries []corpusEntry
+	for _, name := range []string{"a", "hello.txt", string(bytes.Repeat([]byte{'x'}, 15)), string(bytes.Repeat([]byte{'x'}, 16)), string(bytes.Repeat([]byte{'x'}, 255))} {
+		enc, err := e.EncryptFilename(iv, name)
+		if err != nil {
+			panic(err)
+		}
+		entries = append(entries, corpusEntry{iv, enc})
+	}
+	entries = append(entries,
+		corpusEntry{iv, ""},
+		corpusEntry{iv, "AAAAAAAAAAAAAAAAAAAAAA"},
+		corpusEntry{iv, "AAAAAAAAAAAAAAAAAAAAAB"},
+		corpusEntry{iv, "not base64!"},
+	)
+	return entries
+}
+
+// envelopeCorpus - envelopes around the boundary sizes of a sector, and
+// truncated ones
+func envelopeCorpus() []corpusEntry {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	var entries []corpusEntry
+	for _, n := range []int{0, 1, 15, 16, 17, eme.EnvelopeSectorSize - 1, eme.EnvelopeSectorSize, eme.EnvelopeSectorSize + 1} {
+		var buf bytes.Buffer
+		w, err := eme.NewEnvelopeWriter(&buf, bc)
+		if err != nil {
+			panic(err)
+		}
+		w.Write(make([]byte, n))
+		w.Close()
+		entries = append(entries, corpusEntry{buf.Bytes()})
+		if n == 17 {
+			entries = append(entries, corpusEntry{buf.Bytes()[:buf.Len()-1]}, corpusEntry{buf.Bytes()[:31]})
+		}
+	}
+	return entries
+}
+
+// streamCorpus - lengths around 16 and sector boundaries, for every sector
+// size choice and padding
+func streamCorpus() []corpusEntry {
+	var entries []corpusEntry
+	for _, n := range []int{0, 1, 15, 16, 17, 511, 512, 513, 2047, 2048, 2049, 4096, 4113} {
+		for sector := byte(0); sector < 4; sector++ {
+			for padding := byte(0); padding < 3; padding++ {
+				entries = append(entries, corpusEntry{bytes.Repeat([]byte{0xa5}, n), sector, padding})
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rfjakob/eme"
+)
+
+func runImage(args []string) int {
+	if len(args) < 1 {
+		imageUsage()
+		return exitUsage
+	}
+	switch args[0] {
+	case "encrypt", "decrypt":
+		return runImageTransform(args[0], args[1:])
+	case "verify":
+		return runImageVerify(args[1:])
+	}
+	imageUsage()
+	return exitUsage
+}
+
+func imageUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: eme image encrypt|decrypt|verify [flags] IMAGE\n\n"+
+		"Run \"eme image <subcommand> -h\" for the flags.\n")
+}
+
+// imageFlags - flags shared by the image subcommands
+type imageFlags struct {
+	fs     *flag.FlagSet
+	key    *string
+	sector *int
+	sparse *bool
+}
+
+func newImageFlags(name string, usage string) *imageFlags {
+	fs := flag.NewFlagSet("image "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme image %s %s\n\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return &imageFlags{
+		fs:     fs,
+		key:    fs.String("key", "", "hex-encoded AES key (16, 24 or 32 bytes), or @FILE"),
+		sector: fs.Int("sector", 512, "sector size"),
+		sparse: fs.Bool("sparse", false, "keep holes and all-zero sectors unencrypted (reveals which sectors are empty)"),
+	}
+}
+
+func (f *imageFlags) parse(args []string) bool {
+	if err := f.fs.Parse(args); err != nil {
+		return false
+	}
+	if f.fs.NArg() != 1 || *f.key == "" {
+		f.fs.Usage()
+		return false
+	}
+	if err := eme.CheckPageSize(*f.sector); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return false
+	}
+	return true
+}
+
+func (f *imageFlags) options() eme.ImageOptions {
+	opts := eme.ImageOptions{SectorSize: *f.sector}
+	if *f.sparse {
+		opts.Sparse = eme.SparsePreserve
+	}
+	return opts
+}
+
+func runImageTransform(name string, args []string) int {
+	f := newImageFlags(name, "-key HEX [-sector N] [-sparse] [-checkpoint FILE] [-verify] IMAGE\n\n"+
+		"Works in place. An interrupted run is resumed by running the same\n"+
+		"command again.")
+	checkpoint := f.fs.String("checkpoint", "", `progress file, default IMAGE + ".eme-progress"`)
+	verify := f.fs.Bool("verify", false, "check that the plaintext is unchanged, by comparing SHA-256 checksums before and after")
+	if !f.parse(args) {
+		return exitUsage
+	}
+	bc, err := blockCipher(*f.key)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	path := f.fs.Arg(0)
+	opts := f.options()
+	opts.Checkpoint = *checkpoint
+	if opts.Checkpoint == "" {
+		opts.Checkpoint = path + ".eme-progress"
+	}
+	encrypt := name == "encrypt"
+	var before []byte
+	if *verify {
+		if _, err = os.Stat(opts.Checkpoint); err == nil {
+			return fatal("cannot verify a resumed run: the image is partly converted. " +
+				"Finish without -verify, then use \"eme image verify -sha256\"")
+		}
+		// Before encryption, the image is plaintext
+		if before, err = imageChecksum(path, bc, opts, !encrypt); err != nil {
+			return fatal("%v", err)
+		}
+	}
+	if encrypt {
+		err = eme.EncryptImage(path, bc, opts)
+	} else {
+		err = eme.DecryptImage(path, bc, opts)
+	}
+	if err != nil {
+		return fatal("%v", err)
+	}
+	if *verify {
+		after, err := imageChecksum(path, bc, opts, encrypt)
+		if err != nil {
+			return fatal("%v", err)
+		}
+		if !bytes.Equal(before, after) {
+			return fatal("verification failed: plaintext SHA-256 changed from %x to %x", before, after)
+		}
+		fmt.Fprintf(os.Stderr, "verified, plaintext SHA-256 %x\n", after)
+	}
+	return exitOK
+}
+
+func runImageVerify(args []string) int {
+	f := newImageFlags("verify", "-key HEX [-sector N] [-sparse] [-sha256 HEX] IMAGE\n\n"+
+		"Prints the SHA-256 checksum of the plaintext of an encrypted image\n"+
+		"without modifying it, or compares it with -sha256.")
+	want := f.fs.String("sha256", "", "expected hex-encoded checksum")
+	if !f.parse(args) {
+		return exitUsage
+	}
+	bc, err := blockCipher(*f.key)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	sum, err := imageChecksum(f.fs.Arg(0), bc, f.options(), true)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	if *want != "" {
+		w, err := hex.DecodeString(*want)
+		if err != nil {
+			return fatal("bad -sha256: %v", err)
+		}
+		if !bytes.Equal(w, sum) {
+			return fatal("checksum mismatch: got %x", sum)
+		}
+	}
+	fmt.Printf("%x\n", sum)
+	return exitOK
+}
+
+// imageChecksum - SHA-256 of the plaintext of the image at "path". If
+// "encrypted" is set, the sectors are decrypted in memory first.
+func imageChecksum(path string, bc cipher.Block, opts eme.ImageOptions, encrypted bool) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	pc := eme.NewPageCipher(bc, opts.SectorSize)
+	r := bufio.NewReaderSize(f, 1<<20)
+	buf := make([]byte, opts.SectorSize)
+	h := sha256.New()
+	for n := uint64(0); ; n++ {
+		_, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return h.Sum(nil), nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sector %d: %w", n, err)
+		}
+		if encrypted && !(opts.Sparse == eme.SparsePreserve && allZero(buf)) {
+			pc.DecryptPage(n, buf)
+		}
+		h.Write(buf)
+	}
+}
+
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
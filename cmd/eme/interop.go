@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emevectors"
+)
+
+func runInterop(args []string) int {
+	fs := flag.NewFlagSet("interop", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme interop [-cases N] [-seed N] [-vectors FILE] [-external CMD] [-report FILE]\n\n"+
+			"Checks this implementation against the test vectors of package\n"+
+			"emevectors and its edge cases, those of a JSON vector FILE, and N\n"+
+			"random cases. The random cases are cross-checked against eme.Trace,\n"+
+			"an independent implementation, and against CMD if given. The same\n"+
+			"seed gives the same cases. -report writes every divergence in full.\n\n"+
+			"CMD is run once through the shell and must answer every line\n"+
+			"  enc|dec KEY TWEAK DATA\n"+
+			"on standard input with one line holding the result, or \"error\"\n"+
+			"and a message. All values are hex-encoded.\n\n")
+		fs.PrintDefaults()
+	}
+	cases := fs.Int("cases", 1000, "number of random cases")
+	external := fs.String("external", "", "external implementation to compare with")
+	seed := fs.Uint64("seed", 1, "seed of the random cases")
+	reportFile := fs.String("report", "", "write the divergence reports to this JSON file")
+	vectorFile := fs.String("vectors", "", "JSON vector file, as written by \"eme vectors\"")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return exitUsage
+	}
+	vectors := emevectors.All
+	if *vectorFile != "" {
+		b, err := os.ReadFile(*vectorFile)
+		if err != nil {
+			return fatal("%v", err)
+		}
+		extra, err := emevectors.Unmarshal(b)
+		if err != nil {
+			return fatal("%s: %v", *vectorFile, err)
+		}
+		vectors = append(vectors[:len(vectors):len(vectors)], extra...)
+	}
+	failures := 0
+	report := func(format string, a ...any) {
+		failures++
+		fmt.Printf("FAIL "+format+"\n", a...)
+	}
+	for _, v := range vectors {
+		if !checkVector(v) {
+			report("vector %s (%s)", v.Name, v.Source)
+		}
+	}
+	fmt.Printf("%d vectors checked\n", len(vectors))
+	// The invalid edge cases make eme panic, which logs the message first
+	log.SetOutput(io.Discard)
+	edgeErrs := emevectors.CheckEdgeCases(transformImpl)
+	log.SetOutput(os.Stderr)
+	for _, err := range edgeErrs {
+		report("%v", err)
+	}
+	fmt.Printf("%d edge cases checked\n", len(emevectors.EdgeCases))
+
+	// Trace is an independent implementation inside this package
+	reports := []*emevectors.Report{emevectors.CrossCheck(traceImpl, *seed, *cases)}
+	fmt.Printf("eme.Trace: %v\n", reports[0])
+	if *external != "" {
+		ext, err := emevectors.StartCommand(*external)
+		if err != nil {
+			return fatal("%v", err)
+		}
+		r := emevectors.CrossCheck(ext.Transform, *seed, *cases)
+		ext.Close()
+		fmt.Printf("external: %v\n", r)
+		reports = append(reports, r)
+	}
+	for _, r := range reports {
+		failures += r.Failures
+		for _, d := range r.Divergences[:min(len(r.Divergences), 10)] {
+			fmt.Printf("FAIL case %d: %s key %x, tweak %x, %d bytes of data starting with %x\n", d.Case, opName(d.Decrypt), d.Key, d.Tweak, len(d.In), d.In[:16])
+		}
+	}
+	if *reportFile != "" {
+		b, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			return fatal("%v", err)
+		}
+		if err = os.WriteFile(*reportFile, append(b, '\n'), 0644); err != nil {
+			return fatal("%v", err)
+		}
+	}
+	fmt.Printf("%d random cases checked\n", *cases)
+	if failures > 0 {
+		fmt.Printf("%d failures\n", failures)
+		return exitError
+	}
+	fmt.Println("OK")
+	return exitOK
+}
+
+func checkVector(v emevectors.Vector) bool {
+	bc, err := aes.NewCipher(v.Key)
+	if err != nil {
+		return false
+	}
+	out := v.In
+	for i := 0; i < v.Iterations; i++ {
+		out, _ = transformBoth(bc, v.Tweak, out, !v.Decrypt)
+	}
+	return bytes.Equal(out, v.Out)
+}
+
+// transformBoth - the results of eme.Transform and eme.Trace
+func transformBoth(bc cipher.Block, tweak []byte, data []byte, encrypt bool) ([]byte, []byte) {
+	dir := eme.DirectionEncrypt
+	if !encrypt {
+		dir = eme.DirectionDecrypt
+	}
+	traced, _ := eme.Trace(bc, tweak, data, dir)
+	return eme.Transform(bc, tweak, data, dir), traced
+}
+
+// traceImpl - eme.Trace as an emevectors.Impl
+func traceImpl(key, tweak, in []byte, decrypt bool) ([]byte, error) {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	_, traced := transformBoth(bc, tweak, in, !decrypt)
+	return traced, nil
+}
+
+// transformImpl - eme.Transform as an emevectors.Impl
+func transformImpl(key, tweak, in []byte, decrypt bool) ([]byte, error) {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out, _ := transformBoth(bc, tweak, in, !decrypt)
+	return out, nil
+}
+
+func opName(decrypt bool) string {
+	if decrypt {
+		return "dec"
+	}
+	return "enc"
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rfjakob/eme"
+)
+
+// wrappedKeyFile - the file written by "eme wrapkey", values hex-encoded
+type wrappedKeyFile struct {
+	// KDF - marshaled eme.KDFParams if the KEK is derived from a passphrase
+	KDF     string `json:"kdf,omitempty"`
+	Wrapped string `json:"wrapped"`
+}
+
+// writeKeyFile - write "data" to "path" readable only by the owner, or to
+// standard output if "path" is empty
+func writeKeyFile(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func runKeygen(args []string) int {
+	fs := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme keygen [-size N] [-out FILE]\n\n"+
+			"Prints a random hex-encoded AES key, usable as -key @FILE.\n\n")
+		fs.PrintDefaults()
+	}
+	size := fs.Int("size", 32, "key size in bytes (16, 24 or 32)")
+	out := fs.String("out", "", "write the key to this file (mode 0600) instead of standard output")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		return exitUsage
+	}
+	if *size != 16 && *size != 24 && *size != 32 {
+		return fatal("invalid key size %d", *size)
+	}
+	key := make([]byte, *size)
+	if _, err := rand.Read(key); err != nil {
+		return fatal("%v", err)
+	}
+	if err := writeKeyFile(*out, []byte(hex.EncodeToString(key)+"\n")); err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
+
+// keyWrapFlags - flags selecting the key-encryption key
+type keyWrapFlags struct {
+	fs       *flag.FlagSet
+	kek      *string
+	passfile *string
+	in       *string
+	out      *string
+}
+
+func newKeyWrapFlags(name string, usage string) *keyWrapFlags {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme %s [-kek HEX | -passfile FILE] -in FILE [-out FILE]\n\n%s\n"+
+			"Without -kek, the key-encryption key is derived from a passphrase, read\n"+
+			"from -passfile, $%s or standard input. -kek takes a key\n"+
+			"from a KMS or HSM, exported as hex.\n\n", name, usage, passphraseEnv)
+		fs.PrintDefaults()
+	}
+	return &keyWrapFlags{
+		fs:       fs,
+		kek:      fs.String("kek", "", "hex-encoded AES key-encryption key, or @FILE"),
+		passfile: fs.String("passfile", "", "read the passphrase from the first line of this file"),
+		in:       fs.String("in", "", "input file"),
+		out:      fs.String("out", "", "output file, standard output if not set"),
+	}
+}
+
+func (f *keyWrapFlags) parse(args []string) bool {
+	if err := f.fs.Parse(args); err != nil {
+		return false
+	}
+	if f.fs.NArg() != 0 || *f.in == "" {
+		f.fs.Usage()
+		return false
+	}
+	return true
+}
+
+// keyEncryptionKey - from -kek, or from the passphrase and "p"
+func (f *keyWrapFlags) keyEncryptionKey(p *eme.KDFParams) (cipher.Block, error) {
+	if *f.kek != "" {
+		return blockCipher(*f.kek)
+	}
+	if p == nil {
+		return nil, errors.New("the key was wrapped with a key-encryption key, use -kek")
+	}
+	pw, err := readPassphrase(*f.passfile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := p.Key(pw)
+	if err != nil {
+		return nil, err
+	}
+	return aes.NewCipher(key)
+}
+
+func runWrapKey(args []string) int {
+	f := newKeyWrapFlags("wrapkey", "Wraps the hex-encoded key in -in (see keygen) with AES key wrap (RFC 3394).\n")
+	if !f.parse(args) {
+		return exitUsage
+	}
+	key, err := parseKey("@" + *f.in)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	var file wrappedKeyFile
+	var p *eme.KDFParams
+	if *f.kek == "" {
+		if p, err = eme.NewArgon2KDFParams(); err != nil {
+			return fatal("%v", err)
+		}
+		b, _ := p.MarshalBinary()
+		file.KDF = hex.EncodeToString(b)
+	}
+	kek, err := f.keyEncryptionKey(p)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	wrapped, err := eme.WrapKey(kek, key)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	file.Wrapped = hex.EncodeToString(wrapped)
+	out, _ := json.MarshalIndent(file, "", "  ")
+	if err = writeKeyFile(*f.out, append(out, '\n')); err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
+
+func runUnwrapKey(args []string) int {
+	f := newKeyWrapFlags("unwrapkey", "Recovers a key wrapped by wrapkey and writes it hex-encoded.\n")
+	if !f.parse(args) {
+		return exitUsage
+	}
+	data, err := os.ReadFile(*f.in)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	var file wrappedKeyFile
+	if err = json.Unmarshal(data, &file); err != nil {
+		return fatal("%s: %v", *f.in, err)
+	}
+	var p *eme.KDFParams
+	if file.KDF != "" {
+		b, err := hex.DecodeString(file.KDF)
+		if err != nil {
+			return fatal("%s: %v", *f.in, err)
+		}
+		p = &eme.KDFParams{}
+		if err = p.UnmarshalBinary(b); err != nil {
+			return fatal("%s: %v", *f.in, err)
+		}
+	}
+	wrapped, err := hex.DecodeString(file.Wrapped)
+	if err != nil {
+		return fatal("%s: %v", *f.in, err)
+	}
+	kek, err := f.keyEncryptionKey(p)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	key, err := eme.UnwrapKey(kek, wrapped)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	if err = writeKeyFile(*f.out, []byte(hex.EncodeToString(key)+"\n")); err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
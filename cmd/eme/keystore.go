@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/cipher"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/rfjakob/eme"
+)
+
+func runKeystore(args []string) int {
+	fs := flag.NewFlagSet("keystore", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme keystore [-kek HEX | -passfile FILE] -file FILE init|add|list|retire ID\n\n"+
+			"Manages a keystore of wrapped data keys. init creates an empty\n"+
+			"keystore, add adds a random key that becomes the current key, list\n"+
+			"prints the keys and retire destroys a key that is no longer needed.\n"+
+			"encrypt and decrypt use the keystore with -keystore.\n\n"+
+			"Without -kek, the key-encryption key is derived from a passphrase, read\n"+
+			"from -passfile, $%s or standard input.\n\n", passphraseEnv)
+		fs.PrintDefaults()
+	}
+	kek := fs.String("kek", "", "hex-encoded AES key-encryption key, or @FILE")
+	passfile := fs.String("passfile", "", "read the passphrase from the first line of this file")
+	file := fs.String("file", "", "keystore file")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if *file == "" || fs.NArg() < 1 || (fs.Arg(0) == "retire") != (fs.NArg() == 2) || fs.NArg() > 2 {
+		fs.Usage()
+		return exitUsage
+	}
+	if fs.Arg(0) == "init" {
+		if _, err := os.Stat(*file); err == nil {
+			return fatal("%s already exists", *file)
+		}
+		var ks *eme.Keystore
+		if *kek != "" {
+			bc, err := blockCipher(*kek)
+			if err != nil {
+				return fatal("%v", err)
+			}
+			ks = eme.NewKeystore(bc, nil)
+		} else {
+			pw, err := readPassphrase(*passfile)
+			if err != nil {
+				return fatal("%v", err)
+			}
+			if ks, err = eme.NewPassphraseKeystore(pw); err != nil {
+				return fatal("%v", err)
+			}
+		}
+		if err := ks.Save(*file); err != nil {
+			return fatal("%v", err)
+		}
+		return exitOK
+	}
+	ks, err := loadKeystore(*file, *kek, *passfile)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	switch fs.Arg(0) {
+	case "list":
+		for _, e := range ks.Keys() {
+			state := "active"
+			if e.ID == ks.Current() {
+				state = "current"
+			} else if !e.Retired.IsZero() {
+				state = "retired " + e.Retired.Format(time.RFC3339)
+			}
+			fmt.Printf("%d\t%s\t%s\n", e.ID, e.Created.Format(time.RFC3339), state)
+		}
+		return exitOK
+	case "add":
+		id, err := ks.AddKey()
+		if err != nil {
+			return fatal("%v", err)
+		}
+		fmt.Println(id)
+	case "retire":
+		id, err := strconv.ParseUint(fs.Arg(1), 10, 32)
+		if err != nil {
+			return fatal("invalid key ID %q", fs.Arg(1))
+		}
+		if err = ks.Retire(uint32(id)); err != nil {
+			return fatal("%v", err)
+		}
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	if err = ks.Save(*file); err != nil {
+		return fatal("%v", err)
+	}
+	return exitOK
+}
+
+// loadKeystore - the keystore at "path", under the key-encryption key "kek"
+// if set, or else under the passphrase from "passfile"
+func loadKeystore(path string, kek string, passfile string) (*eme.Keystore, error) {
+	return eme.LoadKeystore(path, func(p *eme.KDFParams) (cipher.Block, error) {
+		if kek != "" {
+			return blockCipher(kek)
+		}
+		pw, err := readPassphrase(passfile)
+		if err != nil {
+			return nil, err
+		}
+		return eme.KeystorePassphrase(pw)(p)
+	})
+}
@@ -0,0 +1,129 @@
+// Command eme works with files and disk images encrypted by package
+// github.com/rfjakob/eme.
+//
+// Usage:
+//
+//	eme [-cpuprofile FILE] [-memprofile FILE] [-trace FILE] <command> [flags] [arguments]
+//
+// Run "eme <command> -h" for the flags of each command. Wherever a -key flag
+// takes a hex-encoded key, "@FILE" reads it from a key file instead.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) int
+}
+
+var commands = []command{
+	{"convert", "convert a raw image to an encrypted container and back", runConvert},
+	{"image", "encrypt, decrypt or verify a raw disk image in place", runImage},
+	{"encrypt", "encrypt a file into a container, with a key or passphrase", runEncrypt},
+	{"decrypt", "decrypt a container created by encrypt", runDecrypt},
+	{"selftest", "run the built-in known-answer tests", runSelfTest},
+	{"bench", "measure encryption throughput", runBench},
+	{"vectors", "generate JSON test vectors for other implementations", runVectors},
+	{"interop", "check against published vectors and other implementations", runInterop},
+	{"trace", "print the intermediate values of a transformation (debugging only)", runTrace},
+	{"fuzzcorpus", "write seed corpora for the fuzz targets", runFuzzCorpus},
+	{"keygen", "generate a random key", runKeygen},
+	{"wrapkey", "wrap a key under a passphrase or key-encryption key", runWrapKey},
+	{"unwrapkey", "recover a key wrapped by wrapkey", runUnwrapKey},
+	{"keystore", "manage a keystore of wrapped data keys", runKeystore},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: eme [-cpuprofile FILE] [-memprofile FILE] [-trace FILE] <command> [flags] [arguments]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fs := flag.NewFlagSet("eme", flag.ContinueOnError)
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(os.Stderr, "\nGlobal flags, for attaching to performance reports:\n")
+		fs.PrintDefaults()
+	}
+	var prof profiles
+	fs.StringVar(&prof.cpu, "cpuprofile", "", "write a CPU profile to this file")
+	fs.StringVar(&prof.mem, "memprofile", "", "write a heap profile to this file when the command finishes")
+	fs.StringVar(&prof.trace, "trace", "", "write an execution trace to this file")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	name := fs.Arg(0)
+	for _, c := range commands {
+		if c.name == name {
+			if err := prof.start(); err != nil {
+				return fatal("%v", err)
+			}
+			code := c.run(fs.Args()[1:])
+			if err := prof.stop(); err != nil {
+				return fatal("%v", err)
+			}
+			return code
+		}
+	}
+	fmt.Fprintf(os.Stderr, "eme: unknown command %q\n", name)
+	usage()
+	return exitUsage
+}
+
+// fatal - print an error message and return the error exit code
+func fatal(format string, a ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "eme: "+format+"\n", a...)
+	return exitError
+}
+
+// blockCipher - AES cipher from a hex-encoded 16, 24 or 32 byte key, or from
+// the key file "@FILE" written by "eme keygen" or "eme unwrapkey"
+func blockCipher(hexKey string) (cipher.Block, error) {
+	key, err := parseKey(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	return aes.NewCipher(key)
+}
+
+// parseKey - the key bytes of a -key flag, see blockCipher
+func parseKey(hexKey string) ([]byte, error) {
+	if name, ok := strings.CutPrefix(hexKey, "@"); ok {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		hexKey = strings.TrimSpace(string(b))
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("bad key: %v", err)
+	}
+	return key, nil
+}
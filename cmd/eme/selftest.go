@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rfjakob/eme"
+)
+
+func runSelfTest(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: eme selftest\n\n"+
+			"Runs the built-in known-answer tests and exits with status 1 if any\n"+
+			"of them fails.\n")
+		return exitUsage
+	}
+	if err := eme.SelfTest(); err != nil {
+		return fatal("self-test failed: %v", err)
+	}
+	fmt.Println("self-test passed")
+	return exitOK
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rfjakob/eme"
+)
+
+func runTrace(args []string) int {
+	fs := flag.NewFlagSet("trace", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme trace -key HEX -tweak HEX [-decrypt] DATA_HEX\n\n"+
+			"Prints the intermediate values of one EME transformation, for\n"+
+			"debugging other implementations. NOT FOR PRODUCTION KEYS: the\n"+
+			"output reveals key-dependent values.\n\n")
+		fs.PrintDefaults()
+	}
+	key := fs.String("key", "", "hex-encoded AES key (16, 24 or 32 bytes)")
+	tweak := fs.String("tweak", "", "hex-encoded 16-byte tweak")
+	decrypt := fs.Bool("decrypt", false, "trace decryption instead of encryption")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 || *key == "" || *tweak == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	bc, err := blockCipher(*key)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	t, err := hex.DecodeString(*tweak)
+	if err != nil || len(t) != 16 {
+		return fatal("tweak must be 16 hex-encoded bytes")
+	}
+	data, err := hex.DecodeString(fs.Arg(0))
+	if err != nil || len(data) == 0 || len(data)%16 != 0 || len(data) > 2048 {
+		return fatal("data must be 16 to 2048 hex-encoded bytes, a multiple of 16")
+	}
+	dir := eme.DirectionEncrypt
+	if *decrypt {
+		dir = eme.DirectionDecrypt
+	}
+	out, tr := eme.Trace(bc, t, data, dir)
+	fmt.Println("# UNSAFE FOR PRODUCTION: these values reveal key-dependent secrets")
+	fmt.Printf("T    %x\n", t)
+	fmt.Printf("L    %x\n", tr.L)
+	printBlocks("PP", tr.PP)
+	printBlocks("PPP", tr.PPP)
+	fmt.Printf("MP   %x\n", tr.MP)
+	fmt.Printf("MC   %x\n", tr.MC)
+	fmt.Printf("M    %x\n", tr.M)
+	printBlocks("CCC", tr.CCC)
+	printBlocks("CC", tr.CC)
+	printBlocks("C", tr.C)
+	fmt.Printf("out  %x\n", out)
+	return exitOK
+}
+
+// printBlocks - one line per block, numbered from 1 like in the paper
+func printBlocks(name string, blocks [][]byte) {
+	for j, b := range blocks {
+		fmt.Printf("%-4s %x\n", fmt.Sprintf("%s%d", name, j+1), b)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emevectors"
+)
+
+func runVectors(args []string) int {
+	fs := flag.NewFlagSet("vectors", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: eme vectors -seed N | -key HEX [-tweak HEX] [-sizes LIST]\n\n"+
+			"Prints EME-AES test vectors, one per size, as a JSON vector file (see\n"+
+			"package emevectors). With -seed, keys, tweaks and plaintexts are derived\n"+
+			"from the seed and the same seed always gives the same vectors. With\n"+
+			"-key, the plaintexts are random.\n\n")
+		fs.PrintDefaults()
+	}
+	seed := fs.String("seed", "", "derive everything from this unsigned integer")
+	key := fs.String("key", "", "hex-encoded AES key (16, 24 or 32 bytes)")
+	tweak := fs.String("tweak", strings.Repeat("00", 16), "hex-encoded 16-byte tweak, with -key")
+	sizesFlag := fs.String("sizes", "16,512,2048", "comma-separated plaintext sizes (multiples of 16, at most 2048)")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 0 || (*key == "") == (*seed == "") {
+		fs.Usage()
+		return exitUsage
+	}
+	var sizes []int
+	for _, s := range strings.Split(*sizesFlag, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n%16 != 0 || n > 16*128 {
+			return fatal("invalid size %q", s)
+		}
+		sizes = append(sizes, n)
+	}
+	var vectors []emevectors.Vector
+	if *seed != "" {
+		s, err := strconv.ParseUint(*seed, 10, 64)
+		if err != nil {
+			return fatal("invalid seed %q", *seed)
+		}
+		vectors = emevectors.Generate(s, sizes)
+	} else {
+		k, err := parseKey(*key)
+		if err != nil {
+			return fatal("%v", err)
+		}
+		bc, err := blockCipher(*key)
+		if err != nil {
+			return fatal("%v", err)
+		}
+		t, err := hex.DecodeString(*tweak)
+		if err != nil || len(t) != 16 {
+			return fatal("tweak must be 16 hex-encoded bytes")
+		}
+		for _, n := range sizes {
+			p := make([]byte, n)
+			if _, err = rand.Read(p); err != nil {
+				return fatal("%v", err)
+			}
+			vectors = append(vectors, emevectors.Vector{
+				Name:       fmt.Sprintf("enc%d", n),
+				Source:     emevectors.SourceRfjakob,
+				Iterations: 1,
+				Key:        k,
+				Tweak:      t,
+				In:         p,
+				Out:        eme.Transform(bc, t, p, eme.DirectionEncrypt),
+			})
+		}
+	}
+	b, err := emevectors.Marshal(vectors)
+	if err != nil {
+		return fatal("%v", err)
+	}
+	os.Stdout.Write(append(b, '\n'))
+	return exitOK
+}
@@ -0,0 +1,249 @@
+package eme
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// Object identifiers used by the CMS functions
+var (
+	oidEnvelopedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidRSAESOAEP     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// CMSEnvelopeOID identifies the envelope format (see NewEnvelopeWriter) as a
+// CMS content-encryption algorithm. It is the OID of the UUID
+// 298d155e-8436-4ea5-bd28-29998b508403 (ITU-T X.667), which needs no
+// registration.
+const CMSEnvelopeOID = "2.25.55230895103201589203210891192511267843"
+
+// cmsEnvelopeOIDDER - CMSEnvelopeOID, DER-encoded. encoding/asn1 cannot
+// handle its 128-bit arc.
+var cmsEnvelopeOIDDER = uuidOIDDER(CMSEnvelopeOID[len("2.25."):])
+
+// uuidOIDDER - DER encoding of the OID 2.25.<decimal>
+func uuidOIDDER(decimal string) []byte {
+	n, ok := new(big.Int).SetString(decimal, 10)
+	if !ok {
+		panic("bad UUID OID")
+	}
+	var arc []byte
+	for last := true; last || n.Sign() > 0; last = false {
+		b := byte(n.Uint64() & 0x7f)
+		if !last {
+			b |= 0x80
+		}
+		arc = append([]byte{b}, arc...)
+		n.Rsh(n, 7)
+	}
+	// The first two arcs 2.25 encode as 2*40+25
+	body := append([]byte{2*40 + 25}, arc...)
+	return append([]byte{asn1.TagOID, byte(len(body))}, body...)
+}
+
+// cmsMaxHeader - the largest EnvelopedData NewCMSReader accepts
+const cmsMaxHeader = 1 << 20
+
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     cmsEnvelopedData `asn1:"explicit,tag:0"`
+}
+
+type cmsEnvelopedData struct {
+	Version              int
+	RecipientInfos       []cmsKeyTransRecipientInfo `asn1:"set"`
+	EncryptedContentInfo cmsEncryptedContentInfo
+}
+
+type cmsKeyTransRecipientInfo struct {
+	Version                int
+	Rid                    cmsIssuerAndSerialNumber
+	KeyEncryptionAlgorithm cmsAlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAlgorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// cmsRawAlgorithmIdentifier - an AlgorithmIdentifier whose OID may be
+// CMSEnvelopeOID
+type cmsRawAlgorithmIdentifier struct {
+	Algorithm  asn1.RawValue
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type cmsEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm cmsRawAlgorithmIdentifier
+	// EncryptedContent is absent: the content is detached and follows the
+	// EnvelopedData as an envelope
+	EncryptedContent asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+type cmsOAEPParams struct {
+	HashFunc    cmsAlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MaskGenFunc cmsAlgorithmIdentifier `asn1:"explicit,tag:1"`
+}
+
+// cmsOAEPAlgorithm - RSAES-OAEP with SHA-256 and MGF1-SHA-256
+func cmsOAEPAlgorithm() (cmsAlgorithmIdentifier, error) {
+	sha := cmsAlgorithmIdentifier{Algorithm: oidSHA256}
+	shaDER, err := asn1.Marshal(sha)
+	if err != nil {
+		return cmsAlgorithmIdentifier{}, err
+	}
+	params, err := asn1.Marshal(cmsOAEPParams{
+		HashFunc:    sha,
+		MaskGenFunc: cmsAlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: shaDER}},
+	})
+	if err != nil {
+		return cmsAlgorithmIdentifier{}, err
+	}
+	return cmsAlgorithmIdentifier{Algorithm: oidRSAESOAEP, Parameters: asn1.RawValue{FullBytes: params}}, nil
+}
+
+// NewCMSWriter encrypts to "w" for the holders of the "recipients"
+// certificates. It writes a DER-encoded CMS ContentInfo with EnvelopedData
+// (RFC 5652) that carries a random AES-256 data key for every recipient,
+// encrypted with RSAES-OAEP-SHA256. The content is detached: the returned
+// Writer writes it as an envelope under the data key right after the
+// EnvelopedData, with CMSEnvelopeOID as the content-encryption algorithm.
+// Close must be called to finish the envelope.
+//
+// Only RSA recipients are supported.
+func NewCMSWriter(w io.Writer, recipients []*x509.Certificate) (*Writer, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("eme: no CMS recipients")
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	alg, err := cmsOAEPAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+	ed := cmsEnvelopedData{
+		EncryptedContentInfo: cmsEncryptedContentInfo{
+			ContentType:                oidData,
+			ContentEncryptionAlgorithm: cmsRawAlgorithmIdentifier{Algorithm: asn1.RawValue{FullBytes: cmsEnvelopeOIDDER}},
+		},
+	}
+	for _, cert := range recipients {
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("eme: CMS recipient %q does not have an RSA key", cert.Subject)
+		}
+		ek, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+		if err != nil {
+			return nil, err
+		}
+		ed.RecipientInfos = append(ed.RecipientInfos, cmsKeyTransRecipientInfo{
+			Rid:                    cmsIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber},
+			KeyEncryptionAlgorithm: alg,
+			EncryptedKey:           ek,
+		})
+	}
+	der, err := asn1.Marshal(cmsContentInfo{ContentType: oidEnvelopedData, Content: ed})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(der); err != nil {
+		return nil, err
+	}
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvelopeWriter(w, bc)
+}
+
+// NewCMSReader reads what NewCMSWriter wrote. "cert" selects the
+// recipient, and "priv" is its private key, like an *rsa.PrivateKey or a
+// signer backed by a token.
+func NewCMSReader(r io.Reader, cert *x509.Certificate, priv crypto.Decrypter) (*Reader, error) {
+	der, err := readDERElement(r, cmsMaxHeader)
+	if err != nil {
+		return nil, fmt.Errorf("eme: CMS header: %w", err)
+	}
+	var ci cmsContentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("eme: CMS header: %w", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("eme: CMS header: trailing data")
+	}
+	ed := ci.Content
+	if !ci.ContentType.Equal(oidEnvelopedData) || !bytes.Equal(ed.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm.FullBytes, cmsEnvelopeOIDDER) {
+		return nil, errors.New("eme: not an EnvelopedData written by NewCMSWriter")
+	}
+	for _, ri := range ed.RecipientInfos {
+		if !bytes.Equal(ri.Rid.Issuer.FullBytes, cert.RawIssuer) || ri.Rid.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+			continue
+		}
+		if !ri.KeyEncryptionAlgorithm.Algorithm.Equal(oidRSAESOAEP) {
+			return nil, fmt.Errorf("eme: unsupported key encryption algorithm %v", ri.KeyEncryptionAlgorithm.Algorithm)
+		}
+		key, err := priv.Decrypt(rand.Reader, ri.EncryptedKey, &rsa.OAEPOptions{Hash: crypto.SHA256})
+		if err != nil {
+			return nil, err
+		}
+		bc, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return NewEnvelopeReader(r, bc)
+	}
+	return nil, errors.New("eme: certificate is not a recipient")
+}
+
+// readDERElement - read exactly one DER TLV of at most "max" bytes from "r"
+func readDERElement(r io.Reader, max int) ([]byte, error) {
+	hdr := make([]byte, 2, 6)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, err
+	}
+	n := int(hdr[1])
+	if n >= 0x80 {
+		k := n & 0x7f
+		if k == 0 || k > 4 {
+			return nil, errors.New("unsupported DER length")
+		}
+		hdr = hdr[:2+k]
+		if _, err := io.ReadFull(r, hdr[2:]); err != nil {
+			return nil, err
+		}
+		n = 0
+		for _, b := range hdr[2:] {
+			n = n<<8 | int(b)
+		}
+	}
+	if n > max {
+		return nil, fmt.Errorf("DER element too large (%d bytes)", n)
+	}
+	out := make([]byte, len(hdr)+n)
+	copy(out, hdr)
+	if _, err := io.ReadFull(r, out[len(hdr):]); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,83 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCert - a self-signed certificate with a fresh RSA key
+func testCert(t *testing.T, serial int64) (*x509.Certificate, *rsa.PrivateKey) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "eme test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, priv
+}
+
+func TestCMS(t *testing.T) {
+	alice, aliceKey := testCert(t, 1)
+	bob, bobKey := testCert(t, 2)
+	eve, eveKey := testCert(t, 3)
+	plain := bytes.Repeat([]byte("document "), 2000)
+	var buf bytes.Buffer
+	w, err := NewCMSWriter(&buf, []*x509.Certificate{alice, bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plain)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		cert *x509.Certificate
+		key  *rsa.PrivateKey
+	}{{alice, aliceKey}, {bob, bobKey}} {
+		r, err := NewCMSReader(bytes.NewReader(buf.Bytes()), c.cert, c.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%d: roundtrip failed", c.cert.SerialNumber)
+		}
+	}
+	if _, err = NewCMSReader(bytes.NewReader(buf.Bytes()), eve, eveKey); err == nil {
+		t.Errorf("non-recipient accepted")
+	}
+	if _, err = NewCMSReader(bytes.NewReader(plain), alice, aliceKey); err == nil {
+		t.Errorf("plaintext accepted")
+	}
+}
+
+func TestUUIDOIDDER(t *testing.T) {
+	// X.667 example: 2.25.329800735698586629295641978511506172918
+	der := uuidOIDDER("329800735698586629295641978511506172918")
+	if got := hex.EncodeToString(der); got != "06146983f09da7ebcfdee0c7a1a7b2c0948cc8f9d776" {
+		t.Errorf("got %s", got)
+	}
+}
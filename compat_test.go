@@ -0,0 +1,47 @@
+package eme_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emevectors"
+)
+
+// The API of the upstream github.com/rfjakob/eme v1 releases. Existing users
+// must keep compiling and getting the same outputs, so these signatures must
+// not change.
+var (
+	_ func(cipher.Block) *eme.EMECipher           = eme.New
+	_ func(*eme.EMECipher, []byte, []byte) []byte = (*eme.EMECipher).Encrypt
+	_ func(*eme.EMECipher, []byte, []byte) []byte = (*eme.EMECipher).Decrypt
+	// The direction type is unexported, so only calls can be checked
+	_ = func(bc cipher.Block, tweak []byte, data []byte) []byte {
+		return eme.Transform(bc, tweak, data, eme.DirectionEncrypt)
+	}
+)
+
+// TestCompatVectors checks the upstream vectors through the EMECipher
+// methods, which is how most projects call this package.
+func TestCompatVectors(t *testing.T) {
+	for _, v := range emevectors.All {
+		bc, err := aes.NewCipher(v.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := eme.New(bc)
+		out := v.In
+		for i := 0; i < v.Iterations; i++ {
+			if v.Decrypt {
+				out = e.Decrypt(v.Tweak, out)
+			} else {
+				out = e.Encrypt(v.Tweak, out)
+			}
+		}
+		if !bytes.Equal(out, v.Out) {
+			t.Errorf("vector %s (%s) differs", v.Name, v.Source)
+		}
+	}
+}
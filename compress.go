@@ -0,0 +1,70 @@
+package eme
+
+import (
+	"compress/gzip"
+	"crypto/cipher"
+	"io"
+)
+
+// Compressor is a compression format such as gzip or zstd. Implementations
+// for formats outside the standard library are a few lines around their
+// package's writer and reader.
+type Compressor interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// Gzip is the gzip Compressor with default compression.
+var Gzip Compressor = gzipCompressor{}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func (gzipCompressor) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// NewCompressWriter returns a writer that compresses with "c" and then
+// encrypts the compressed stream as an envelope (see NewEnvelopeWriter) to
+// "w". Compression has to come first: ciphertext does not compress. Close
+// must be called to finish both; it does not close "w".
+//
+// The size of the output depends on how well the plaintext compresses, so it
+// leaks information about the plaintext. Do not compress data that mixes
+// secrets with content an attacker controls.
+func NewCompressWriter(w io.Writer, bc cipher.Block, c Compressor) (io.WriteCloser, error) {
+	ew, err := NewEnvelopeWriter(w, bc)
+	if err != nil {
+		return nil, err
+	}
+	cw, err := c.NewWriter(ew)
+	if err != nil {
+		return nil, err
+	}
+	return &compressWriter{cw, ew}, nil
+}
+
+// NewDecompressReader reverses NewCompressWriter. "c" must be the Compressor
+// used for writing.
+func NewDecompressReader(r io.Reader, bc cipher.Block, c Compressor) (io.ReadCloser, error) {
+	er, err := NewEnvelopeReader(r, bc)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewReader(er)
+}
+
+type compressWriter struct {
+	io.WriteCloser
+	ew *Writer
+}
+
+func (c *compressWriter) Close() error {
+	if err := c.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return c.ew.Close()
+}
@@ -0,0 +1,39 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := bytes.Repeat([]byte("compressible "), 10000)
+	var buf bytes.Buffer
+	w, err := NewCompressWriter(&buf, bc, Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plain)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > len(plain)/10 {
+		t.Errorf("output is %d bytes, not compressed", buf.Len())
+	}
+	r, err := NewDecompressReader(&buf, bc, Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("roundtrip failed")
+	}
+}
@@ -0,0 +1,245 @@
+package eme
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Tweak policies of Config
+const (
+	// TweakZero - streams use the all-zero base tweak
+	TweakZero = "zero"
+	// TweakFixed - streams use Config.BaseTweak
+	TweakFixed = "fixed"
+)
+
+// Config holds the parameters of a mode in a form that the configuration
+// systems of applications can carry: it has JSON and TOML tags and only
+// plain fields. NewFromConfig turns it into ciphers.
+type Config struct {
+	// Mode is ModeEME, ModePage, ModeStream, ModeEnvelope or ModeContainer
+	Mode string `json:"mode" toml:"mode"`
+	// SectorSize is the page or sector size of all modes but ModeEME.
+	// Defaults to 4096.
+	SectorSize int `json:"sector_size,omitempty" toml:"sector_size,omitempty"`
+	// Padding of ModeStream is "pkcs7" (the default), "none" or "cts", see
+	// Padding
+	Padding string `json:"padding,omitempty" toml:"padding,omitempty"`
+	// TweakPolicy selects the base tweak of ModeStream, TweakZero (the
+	// default) or TweakFixed. Pages and sectors always use their number as
+	// tweak, envelopes a random base tweak.
+	TweakPolicy string `json:"tweak_policy,omitempty" toml:"tweak_policy,omitempty"`
+	// BaseTweak is the hex-encoded 16-byte base tweak of TweakFixed
+	BaseTweak string `json:"base_tweak,omitempty" toml:"base_tweak,omitempty"`
+	// KDF, if set, makes NewFromConfig derive the key from a passphrase
+	KDF *KDFConfig `json:"kdf,omitempty" toml:"kdf,omitempty"`
+}
+
+// KDFConfig is KDFParams in the plain form of Config.
+type KDFConfig struct {
+	// Algorithm is "argon2id" or "pbkdf2-sha256"
+	Algorithm string `json:"algorithm" toml:"algorithm"`
+	// Iterations of PBKDF2
+	Iterations uint32 `json:"iterations,omitempty" toml:"iterations,omitempty"`
+	// Time, Memory (KiB) and Threads of Argon2id, see Argon2Params
+	Time    uint32 `json:"time,omitempty" toml:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty" toml:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty" toml:"threads,omitempty"`
+	// Salt is hex-encoded
+	Salt string `json:"salt" toml:"salt"`
+}
+
+// NewKDFConfig returns the plain form of "p".
+func NewKDFConfig(p *KDFParams) *KDFConfig {
+	c := &KDFConfig{Salt: hex.EncodeToString(p.Salt)}
+	if a := p.Argon2; a != nil {
+		c.Algorithm, c.Time, c.Memory, c.Threads = "argon2id", a.Time, a.Memory, a.Threads
+	} else {
+		c.Algorithm, c.Iterations = "pbkdf2-sha256", p.Iterations
+	}
+	return c
+}
+
+// Params returns the KDFParams of the configuration.
+func (c *KDFConfig) Params() (*KDFParams, error) {
+	salt, err := hex.DecodeString(c.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("KDF salt: %w", err)
+	}
+	if len(salt) < 16 {
+		return nil, fmt.Errorf("KDF salt must be at least 16 bytes long, is %d", len(salt))
+	}
+	switch c.Algorithm {
+	case "argon2id":
+		if c.Time == 0 || c.Threads == 0 || c.Memory < 8*uint32(c.Threads) || c.Memory > MaxArgon2Memory {
+			return nil, fmt.Errorf("invalid Argon2id parameters time=%d memory=%d threads=%d", c.Time, c.Memory, c.Threads)
+		}
+		return &KDFParams{Salt: salt, Argon2: &Argon2Params{Time: c.Time, Memory: c.Memory, Threads: c.Threads}}, nil
+	case "pbkdf2-sha256":
+		if c.Iterations == 0 {
+			return nil, errors.New("KDF iteration count is zero")
+		}
+		return &KDFParams{Iterations: c.Iterations, Salt: salt}, nil
+	}
+	return nil, fmt.Errorf("unknown KDF algorithm %q", c.Algorithm)
+}
+
+// ParseConfig decodes a JSON Config and checks it like NewFromConfig. TOML
+// and other formats decode into Config directly through its tags.
+func ParseConfig(b []byte) (*Config, error) {
+	c := &Config{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	if _, err := c.check(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Configured creates the ciphers and streams of a Config under one key, see
+// NewFromConfig.
+type Configured struct {
+	cfg     Config
+	bc      cipher.Block
+	padding Padding
+	tweak   []byte
+}
+
+// NewFromConfig checks "c" and returns its ciphers under "secret": an AES
+// key (16, 24 or 32 bytes), or the passphrase if c.KDF is set.
+func NewFromConfig(c Config, secret []byte) (*Configured, error) {
+	x, err := c.check()
+	if err != nil {
+		return nil, err
+	}
+	key := secret
+	if c.KDF != nil {
+		p, err := c.KDF.Params()
+		if err != nil {
+			return nil, err
+		}
+		if key, err = p.Key(secret); err != nil {
+			return nil, err
+		}
+		defer clear(key)
+	}
+	if x.bc, err = aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// check - validate the configuration and fill in the defaults, without a key
+func (c *Config) check() (*Configured, error) {
+	x := &Configured{cfg: *c, tweak: make([]byte, 16)}
+	if x.cfg.SectorSize == 0 {
+		x.cfg.SectorSize = 4096
+	}
+	switch c.Mode {
+	case ModeEME:
+	case ModePage, ModeStream, ModeEnvelope, ModeContainer:
+		if !validPageSize(x.cfg.SectorSize) {
+			return nil, fmt.Errorf("invalid sector size %d", x.cfg.SectorSize)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported mode %q", c.Mode)
+	}
+	switch c.Padding {
+	case "", "pkcs7":
+		x.padding = PadPKCS7
+	case "none":
+		x.padding = PadNone
+	case "cts":
+		x.padding = PadCTS
+	default:
+		return nil, fmt.Errorf("unknown padding %q", c.Padding)
+	}
+	switch c.TweakPolicy {
+	case "", TweakZero:
+		if c.BaseTweak != "" {
+			return nil, errors.New("base tweak is set, but the tweak policy is not fixed")
+		}
+	case TweakFixed:
+		t, err := hex.DecodeString(c.BaseTweak)
+		if err != nil || len(t) != 16 {
+			return nil, errors.New("base tweak must be 16 hex-encoded bytes")
+		}
+		x.tweak = t
+	default:
+		return nil, fmt.Errorf("unknown tweak policy %q", c.TweakPolicy)
+	}
+	if c.KDF != nil {
+		if _, err := c.KDF.Params(); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// Config returns the configuration, with defaults filled in.
+func (x *Configured) Config() Config {
+	return x.cfg
+}
+
+// Block returns the AES cipher under the key.
+func (x *Configured) Block() cipher.Block {
+	return x.bc
+}
+
+// Cipher returns an EMECipher, for ModeEME.
+func (x *Configured) Cipher() *EMECipher {
+	return New(x.bc)
+}
+
+// PageCipher returns a PageCipher for pages of the sector size, for
+// ModePage.
+func (x *Configured) PageCipher() *PageCipher {
+	return NewPageCipher(x.bc, x.cfg.SectorSize)
+}
+
+// NewWriter returns a Writer with the configured sector size, padding and
+// base tweak for ModeStream, or an envelope Writer for ModeEnvelope.
+func (x *Configured) NewWriter(w io.Writer) (*Writer, error) {
+	switch x.cfg.Mode {
+	case ModeStream:
+		sw := NewWriter(w, x.bc, x.cfg.SectorSize, x.tweak)
+		sw.Padding = x.padding
+		return sw, nil
+	case ModeEnvelope:
+		return NewEnvelopeWriter(w, x.bc)
+	}
+	return nil, fmt.Errorf("mode %q has no streams", x.cfg.Mode)
+}
+
+// NewReader is the reverse of NewWriter.
+func (x *Configured) NewReader(r io.Reader) (*Reader, error) {
+	switch x.cfg.Mode {
+	case ModeStream:
+		sr := NewReader(r, x.bc, x.cfg.SectorSize, x.tweak)
+		sr.Padding = x.padding
+		return sr, nil
+	case ModeEnvelope:
+		return NewEnvelopeReader(r, x.bc)
+	}
+	return nil, fmt.Errorf("mode %q has no streams", x.cfg.Mode)
+}
+
+// ContainerOptions returns options for ImageToContainer with the sector size
+// and KDF parameters of ModeContainer.
+func (x *Configured) ContainerOptions() (ContainerOptions, error) {
+	opts := ContainerOptions{SectorSize: x.cfg.SectorSize}
+	if x.cfg.KDF != nil {
+		p, err := x.cfg.KDF.Params()
+		if err != nil {
+			return opts, err
+		}
+		opts.KDF = p
+	}
+	return opts, nil
+}
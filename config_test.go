@@ -0,0 +1,81 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+func TestConfigStream(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{"mode": "stream", "sector_size": 512, "padding": "cts",
+		"tweak_policy": "fixed", "base_tweak": "000102030405060708090a0b0c0d0e0f"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{1}, 32)
+	x, err := NewFromConfig(*cfg, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	w, _ := x.NewWriter(&buf)
+	msg := bytes.Repeat([]byte("config"), 100)
+	w.Write(msg)
+	w.Close()
+	if buf.Len() != len(msg) {
+		t.Errorf("ciphertext stealing not applied: %d bytes", buf.Len())
+	}
+	// The same parameters, set up by hand
+	sr := NewReader(bytes.NewReader(buf.Bytes()), x.Block(), 512, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15})
+	sr.Padding = PadCTS
+	if got, err := io.ReadAll(sr); err != nil || !bytes.Equal(got, msg) {
+		t.Errorf("round trip: %v", err)
+	}
+	if x.PageCipher().pageSize != 512 {
+		t.Errorf("sector size lost")
+	}
+}
+
+func TestConfigKDF(t *testing.T) {
+	p := &KDFParams{Salt: make([]byte, 16), Argon2: &Argon2Params{Time: 1, Memory: 64, Threads: 1}}
+	cfg := Config{Mode: ModeContainer, KDF: NewKDFConfig(p)}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseConfig(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := NewFromConfig(*back, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := p.Key([]byte("passphrase"))
+	bc, _ := aes.NewCipher(key)
+	want := New(bc).Encrypt(make([]byte, 16), make([]byte, 16))
+	if !bytes.Equal(x.Cipher().Encrypt(make([]byte, 16), make([]byte, 16)), want) {
+		t.Errorf("key not derived from the passphrase")
+	}
+	opts, err := x.ContainerOptions()
+	if err != nil || opts.SectorSize != 4096 || opts.KDF == nil || *opts.KDF.Argon2 != *p.Argon2 {
+		t.Errorf("container options %+v, %v", opts, err)
+	}
+}
+
+func TestConfigInvalid(t *testing.T) {
+	for _, s := range []string{
+		`{"mode": "rot13"}`,
+		`{"mode": "page", "sector_size": 100}`,
+		`{"mode": "stream", "padding": "zeros"}`,
+		`{"mode": "stream", "tweak_policy": "fixed", "base_tweak": "00"}`,
+		`{"mode": "stream", "base_tweak": "000102030405060708090a0b0c0d0e0f"}`,
+		`{"mode": "eme", "kdf": {"algorithm": "argon2id", "salt": "00000000000000000000000000000000"}}`,
+	} {
+		if _, err := ParseConfig([]byte(s)); err == nil {
+			t.Errorf("%s was accepted", s)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestConn(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2b := bytes.Repeat([]byte{1}, 16)
+	b2a := bytes.Repeat([]byte{2}, 16)
+	ca, cb := net.Pipe()
+	a := NewConn(ca, bc, a2b, b2a)
+	b := NewConn(cb, bc, b2a, a2b)
+	msg := make([]byte, MaxRecordSize*2+100)
+	for i := range msg {
+		msg[i] = byte(i)
+	}
+	go func() {
+		a.Write([]byte("hello"))
+		a.Write(msg)
+		a.Close()
+	}()
+	got, err := io.ReadAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, append([]byte("hello"), msg...)) {
+		t.Errorf("wrong data received")
+	}
+}
@@ -0,0 +1,390 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ContainerVersion is the container format version written by this package.
+const ContainerVersion = 1
+
+// containerMagic identifies encrypted containers
+var containerMagic = []byte("EMECONT\x00")
+
+// containerMinHeader - the header region is at least this large, and always
+// a multiple of the sector size, so that the data sectors stay aligned.
+const containerMinHeader = 4096
+
+// containerFixedLen - length of the fixed part of the header, up to and
+// including the checksum
+const containerFixedLen = 40
+
+// Header field types used by this package
+const (
+	// fieldSparse - one byte, the SparsePolicy the container was written with
+	fieldSparse uint16 = 1
+	// fieldKeyEpoch - number of completed key rotations (uint32), followed
+	// by the offset of the per-sector epoch map (uint64) while a rotation is
+	// in progress
+	fieldKeyEpoch uint16 = 2
+	// fieldSalt - 16 random bytes XORed into every sector tweak, so that
+	// equal sectors at the same position in different containers encrypt
+	// differently under the same key
+	fieldSalt uint16 = 3
+	// fieldKDF - the marshaled KDFParams the key was derived with, if it was
+	// derived from a passphrase
+	fieldKDF uint16 = 4
+	// fieldWrappedKey - the data key wrapped by a KMS (see OpenKMSContainer)
+	fieldWrappedKey uint16 = 5
+	// fieldWrappedKeyNext - the wrapped key a KMS key rotation rotates to.
+	// It replaces fieldWrappedKey when the rotation finishes.
+	fieldWrappedKeyNext uint16 = 6
+	// fieldKeyID - the Keystore ID of the key (uint32)
+	fieldKeyID uint16 = 7
+	// fieldFIDO2 - the marshaled FIDO2Params the key was derived with, if it
+	// comes from a FIDO2 security key
+	fieldFIDO2 uint16 = 8
+	// fieldEscrow - the data key encrypted to a recovery public key (see
+	// WrapKeyRSA, WrapKeyECIES and WrapKeyHybrid)
+	fieldEscrow uint16 = 9
+	// fieldKeyCheck - a check value of the data key (see keyCheck), so that
+	// opening with a wrong key or passphrase fails instead of decrypting to
+	// garbage. Containers written before it was added have none.
+	fieldKeyCheck uint16 = 10
+	// fieldKeyCheckNext - the check value of the key a rotation rotates to,
+	// so that it cannot be resumed with another key. It replaces
+	// fieldKeyCheck when the rotation finishes.
+	fieldKeyCheckNext uint16 = 11
+)
+
+// ErrWrongKey is returned when a container is opened with a key that does
+// not match the check value in its header.
+var ErrWrongKey = errors.New("eme: wrong key or passphrase")
+
+// keyCheckDomain - encrypted under the data key to derive the key of
+// keyCheck; EME itself never encrypts these blocks as such
+var keyCheckDomain = [2][16]byte{
+	{'e', 'm', 'e', ' ', 'k', 'e', 'y', ' ', 'c', 'h', 'e', 'c', 'k', ' ', 'k', '1'},
+	{'e', 'm', 'e', ' ', 'k', 'e', 'y', ' ', 'c', 'h', 'e', 'c', 'k', ' ', 'k', '2'},
+}
+
+// keyCheck - the check value of data key "bc" for a container with salt
+// "salt": HMAC-SHA256 of the salt under a subkey made of the encryptions of
+// keyCheckDomain, truncated to 16 bytes. It reveals nothing about the key
+// that a brute-force attack could not learn from any sector.
+func keyCheck(bc cipher.Block, salt []byte) []byte {
+	sub := make([]byte, 32)
+	defer clear(sub)
+	bc.Encrypt(sub[:16], keyCheckDomain[0][:])
+	bc.Encrypt(sub[16:], keyCheckDomain[1][:])
+	m := hmac.New(sha256.New, sub)
+	m.Write([]byte("eme container key check v1"))
+	m.Write(salt)
+	return m.Sum(nil)[:16]
+}
+
+// checkKey - ErrWrongKey unless "bc" matches the key check value of the
+// header, if it has one
+func (h *ContainerHeader) checkKey(bc cipher.Block) error {
+	return h.checkKeyField(fieldKeyCheck, bc)
+}
+
+// checkKeyField - like checkKey, with the check value in field "t"
+func (h *ContainerHeader) checkKeyField(t uint16, bc cipher.Block) error {
+	v := h.Field(t)
+	if v == nil {
+		return nil
+	}
+	if !hmac.Equal(v, keyCheck(bc, h.Field(fieldSalt))) {
+		return ErrWrongKey
+	}
+	return nil
+}
+
+// ContainerField is an optional, typed header entry. Types are defined by the
+// features that use them; readers skip types they do not know.
+type ContainerField struct {
+	Type  uint16
+	Value []byte
+}
+
+// ContainerHeader is the plaintext header at the start of an encrypted
+// container. It is followed by the encrypted sectors, starting at DataOffset.
+//
+// On-disk layout (all integers big-endian):
+//
+//	0   magic "EMECONT\0"
+//	8   version (uint16)
+//	10  reserved (uint16)
+//	12  sector size (uint32)
+//	16  plaintext size in bytes (uint64)
+//	24  data offset (uint64)
+//	32  length of the field area (uint32)
+//	36  CRC-32 (IEEE) of bytes 0-35 and the field area (uint32)
+//	40  field area: repeated type (uint16), length (uint16), value
+//
+// The rest of the header region up to the data offset is zero.
+type ContainerHeader struct {
+	Version uint16
+	// SectorSize is the size of the independently encrypted sectors
+	SectorSize uint32
+	// Size is the length of the plaintext. The last sector is zero-padded.
+	Size uint64
+	// DataOffset is where the first encrypted sector starts
+	DataOffset uint64
+	// Fields holds the optional header entries
+	Fields []ContainerField
+}
+
+// newContainerHeader - header for "size" bytes of plaintext in sectors of
+// "sectorSize" bytes, with a fresh random salt
+func newContainerHeader(sectorSize int, size int64) (*ContainerHeader, error) {
+	off := uint64(containerMinHeader)
+	if rem := off % uint64(sectorSize); rem != 0 {
+		off += uint64(sectorSize) - rem
+	}
+	h := &ContainerHeader{
+		Version:    ContainerVersion,
+		SectorSize: uint32(sectorSize),
+		Size:       uint64(size),
+		DataOffset: off,
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	h.SetField(fieldSalt, salt)
+	return h, nil
+}
+
+// Sectors returns the number of data sectors in the container.
+func (h *ContainerHeader) Sectors() uint64 {
+	return (h.Size + uint64(h.SectorSize) - 1) / uint64(h.SectorSize)
+}
+
+// Field returns the value of the first field of type "t", or nil.
+func (h *ContainerHeader) Field(t uint16) []byte {
+	for _, f := range h.Fields {
+		if f.Type == t {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// SetField replaces the value of the field of type "t", or adds it.
+func (h *ContainerHeader) SetField(t uint16, v []byte) {
+	for i := range h.Fields {
+		if h.Fields[i].Type == t {
+			h.Fields[i].Value = v
+			return
+		}
+	}
+	h.Fields = append(h.Fields, ContainerField{Type: t, Value: v})
+}
+
+// removeField - drop all fields of type "t"
+func (h *ContainerHeader) removeField(t uint16) {
+	fields := h.Fields[:0]
+	for _, f := range h.Fields {
+		if f.Type != t {
+			fields = append(fields, f)
+		}
+	}
+	h.Fields = fields
+}
+
+// sparsePolicy - the SparsePolicy recorded in the header
+func (h *ContainerHeader) sparsePolicy() SparsePolicy {
+	if v := h.Field(fieldSparse); len(v) == 1 {
+		return SparsePolicy(v[0])
+	}
+	return SparseEncrypt
+}
+
+// pageCipher - a PageCipher for the sectors of this container under key
+// "bc", including the salt
+func (h *ContainerHeader) pageCipher(bc cipher.Block) *PageCipher {
+	pc := NewPageCipher(bc, int(h.SectorSize))
+	copy(pc.salt[:], h.Field(fieldSalt))
+	return pc
+}
+
+// KDF returns the parameters the key of the container was derived with, or
+// nil if none were recorded.
+func (h *ContainerHeader) KDF() (*KDFParams, error) {
+	v := h.Field(fieldKDF)
+	if v == nil {
+		return nil, nil
+	}
+	p := &KDFParams{}
+	if err := p.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// FIDO2 returns the parameters the key of the container was derived from a
+// FIDO2 security key with, or nil if none were recorded.
+func (h *ContainerHeader) FIDO2() (*FIDO2Params, error) {
+	v := h.Field(fieldFIDO2)
+	if v == nil {
+		return nil, nil
+	}
+	p := &FIDO2Params{}
+	if err := p.UnmarshalBinary(v); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// WrappedKey returns the KMS-wrapped data key recorded in the header, or nil.
+func (h *ContainerHeader) WrappedKey() []byte {
+	return h.Field(fieldWrappedKey)
+}
+
+// Escrow returns the escrowed data key recorded in the header, or nil. Pass
+// it to UnwrapKeyRSA, UnwrapKeyECIES or UnwrapKeyHybrid with the recovery
+// private key.
+func (h *ContainerHeader) Escrow() []byte {
+	return h.Field(fieldEscrow)
+}
+
+// KeyID returns the keystore key ID recorded in the header, or 0.
+func (h *ContainerHeader) KeyID() uint32 {
+	if v := h.Field(fieldKeyID); len(v) == 4 {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+// keyEpoch - the key rotation state recorded in the header
+func (h *ContainerHeader) keyEpoch() (epoch uint32, mapOff uint64, rotating bool) {
+	v := h.Field(fieldKeyEpoch)
+	if len(v) >= 4 {
+		epoch = binary.BigEndian.Uint32(v[0:4])
+	}
+	if len(v) == 12 {
+		return epoch, binary.BigEndian.Uint64(v[4:12]), true
+	}
+	return epoch, 0, false
+}
+
+func (h *ContainerHeader) setKeyEpoch(epoch uint32, mapOff uint64, rotating bool) {
+	v := make([]byte, 4, 12)
+	binary.BigEndian.PutUint32(v, epoch)
+	if rotating {
+		v = binary.BigEndian.AppendUint64(v, mapOff)
+	}
+	h.SetField(fieldKeyEpoch, v)
+}
+
+// MarshalBinary encodes the header into a buffer of DataOffset bytes.
+func (h *ContainerHeader) MarshalBinary() ([]byte, error) {
+	var fields bytes.Buffer
+	for _, f := range h.Fields {
+		if len(f.Value) > 0xffff {
+			return nil, fmt.Errorf("header field %d is too long (%d bytes)", f.Type, len(f.Value))
+		}
+		var tl [4]byte
+		binary.BigEndian.PutUint16(tl[0:2], f.Type)
+		binary.BigEndian.PutUint16(tl[2:4], uint16(len(f.Value)))
+		fields.Write(tl[:])
+		fields.Write(f.Value)
+	}
+	if uint64(containerFixedLen+fields.Len()) > h.DataOffset {
+		return nil, fmt.Errorf("header fields do not fit into %d bytes", h.DataOffset)
+	}
+	buf := make([]byte, h.DataOffset)
+	copy(buf, containerMagic)
+	binary.BigEndian.PutUint16(buf[8:10], h.Version)
+	binary.BigEndian.PutUint32(buf[12:16], h.SectorSize)
+	binary.BigEndian.PutUint64(buf[16:24], h.Size)
+	binary.BigEndian.PutUint64(buf[24:32], h.DataOffset)
+	binary.BigEndian.PutUint32(buf[32:36], uint32(fields.Len()))
+	copy(buf[containerFixedLen:], fields.Bytes())
+	crc := crc32.NewIEEE()
+	crc.Write(buf[:36])
+	crc.Write(fields.Bytes())
+	binary.BigEndian.PutUint32(buf[36:40], crc.Sum32())
+	return buf, nil
+}
+
+// ReadContainerHeader reads and checks the header at the start of "r".
+func ReadContainerHeader(r io.Reader) (*ContainerHeader, error) {
+	h, crcOK, err := readContainerHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if !crcOK {
+		return nil, errHeaderChecksum
+	}
+	return h, nil
+}
+
+var errHeaderChecksum = errors.New("container header is corrupt (checksum mismatch)")
+
+// readContainerHeader - like ReadContainerHeader, but a checksum mismatch is
+// only reported through "crcOK", so that damaged headers can still be used
+// for recovery. All other checks still apply.
+func readContainerHeader(r io.Reader) (h *ContainerHeader, crcOK bool, err error) {
+	fixed := make([]byte, containerFixedLen)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, false, fmt.Errorf("reading container header: %w", err)
+	}
+	if !bytes.Equal(fixed[:8], containerMagic) {
+		return nil, false, errors.New("not an EME container (bad magic)")
+	}
+	h = &ContainerHeader{
+		Version:    binary.BigEndian.Uint16(fixed[8:10]),
+		SectorSize: binary.BigEndian.Uint32(fixed[12:16]),
+		Size:       binary.BigEndian.Uint64(fixed[16:24]),
+		DataOffset: binary.BigEndian.Uint64(fixed[24:32]),
+	}
+	if h.Version != ContainerVersion {
+		return nil, false, fmt.Errorf("unsupported container version %d", h.Version)
+	}
+	fieldLen := binary.BigEndian.Uint32(fixed[32:36])
+	if uint64(containerFixedLen)+uint64(fieldLen) > h.DataOffset {
+		return nil, false, errors.New("container header is corrupt (field area too long)")
+	}
+	// Read through a LimitReader so that a corrupt length does not allocate
+	// gigabytes up front
+	fields, err := io.ReadAll(io.LimitReader(r, int64(fieldLen)))
+	if err != nil {
+		return nil, false, fmt.Errorf("reading container header: %w", err)
+	}
+	if len(fields) != int(fieldLen) {
+		return nil, false, fmt.Errorf("reading container header: %w", io.ErrUnexpectedEOF)
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(fixed[:36])
+	crc.Write(fields)
+	crcOK = crc.Sum32() == binary.BigEndian.Uint32(fixed[36:40])
+	// The sector size must be one NewPageCipher accepts, or opening the
+	// container would panic
+	if !validPageSize(int(h.SectorSize)) || h.DataOffset%uint64(h.SectorSize) != 0 {
+		return nil, false, fmt.Errorf("container header is corrupt (sector size %d)", h.SectorSize)
+	}
+	for len(fields) > 0 {
+		if len(fields) < 4 {
+			return nil, false, errors.New("container header is corrupt (truncated field)")
+		}
+		t := binary.BigEndian.Uint16(fields[0:2])
+		n := int(binary.BigEndian.Uint16(fields[2:4]))
+		if len(fields) < 4+n {
+			return nil, false, errors.New("container header is corrupt (truncated field)")
+		}
+		h.Fields = append(h.Fields, ContainerField{Type: t, Value: fields[4 : 4+n]})
+		fields = fields[4+n:]
+	}
+	return h, crcOK, nil
+}
@@ -0,0 +1,368 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Container gives random access to the sectors of an encrypted container
+// file. It is safe for concurrent use; operations are serialized internally.
+type Container struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+	h    *ContainerHeader
+	// cur decrypts sectors whose epoch bit is clear, next those whose bit is
+	// set. next is only used while a key rotation is in progress.
+	cur  *PageCipher
+	next *PageCipher
+	// epochs - per-sector epoch bits, nil when no rotation is in progress
+	epochs []byte
+	// readOnly - opened with OpenContainerForRecovery
+	readOnly bool
+	// headerDamage - why the header is not trustworthy, if it is not
+	headerDamage error
+	// journal - unapplied rotation batch, only kept in recovery mode
+	journal *checkpoint
+}
+
+// ErrReadOnly is returned when writing to a container opened with
+// OpenContainerForRecovery.
+var ErrReadOnly = errors.New("container is opened read-only")
+
+// SectorError reports a sector that could not be read.
+type SectorError struct {
+	Sector uint64
+	Err    error
+}
+
+func (e *SectorError) Error() string {
+	return fmt.Sprintf("sector %d: %v", e.Sector, e.Err)
+}
+
+func (e *SectorError) Unwrap() error {
+	return e.Err
+}
+
+// OpenContainer opens the container at "path" for reading and writing, using
+// key "bc". If a key rotation was interrupted, "next" must be the new key,
+// and the rotation can be finished with Container.RotateKey. Otherwise "next"
+// is ignored and may be nil.
+func OpenContainer(path string, bc cipher.Block, next cipher.Block) (*Container, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	c, err := openContainer(path, f, bc, next, false)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// OpenContainerReadOnly opens the container at "path" for reading only,
+// using key "bc". It never writes to the file, so it works on read-only media,
+// and WriteSector returns ErrReadOnly. A container with an interrupted key
+// rotation is refused, because finishing the rotation needs write access:
+// open it with OpenContainer and the new key first.
+func OpenContainerReadOnly(path string, bc cipher.Block) (*Container, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := openContainerReadOnly(path, f, bc)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func openContainerReadOnly(path string, f *os.File, bc cipher.Block) (*Container, error) {
+	h, err := ReadContainerHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, rotating := h.keyEpoch(); rotating {
+		return nil, errors.New("a key rotation is in progress, finish it with RotateKey first")
+	}
+	if err = h.checkKey(bc); err != nil {
+		return nil, err
+	}
+	return &Container{
+		path:     path,
+		f:        f,
+		h:        h,
+		cur:      h.pageCipher(bc),
+		readOnly: true,
+	}, nil
+}
+
+// OpenContainerForRecovery opens the container at "path" read-only, for
+// getting data off a damaged container. Unlike OpenContainer, it accepts
+// a header whose checksum does not match (see HeaderDamage), never writes to
+// the file, and reports unreadable sectors individually as *SectorError from
+// ReadSector instead of failing. A batch left over from an interrupted key
+// rotation is served from the journal rather than applied. DamageMap lists
+// all unreadable sectors.
+//
+// EME is not authenticated, so damage inside a sector that can still be read
+// is not detected; it decrypts to garbage confined to that sector.
+func OpenContainerForRecovery(path string, bc cipher.Block, next cipher.Block) (*Container, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := openContainer(path, f, bc, next, true)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func openContainer(path string, f *os.File, bc cipher.Block, next cipher.Block, recovery bool) (*Container, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	h, crcOK, err := readContainerHeader(io.NewSectionReader(f, 0, fi.Size()))
+	if err != nil {
+		return nil, err
+	}
+	// A damaged header may have a damaged check value, which must not stand
+	// in the way of recovery
+	if err = h.checkKey(bc); err != nil && crcOK {
+		return nil, err
+	}
+	c := &Container{
+		path:     path,
+		f:        f,
+		h:        h,
+		cur:      h.pageCipher(bc),
+		readOnly: recovery,
+	}
+	if !crcOK {
+		if !recovery {
+			return nil, errHeaderChecksum
+		}
+		c.headerDamage = errHeaderChecksum
+	}
+	if _, mapOff, rotating := h.keyEpoch(); rotating {
+		if next == nil {
+			return nil, errors.New("a key rotation is in progress, the new key is required")
+		}
+		if err = h.checkKeyField(fieldKeyCheckNext, next); err != nil && crcOK {
+			return nil, fmt.Errorf("new key of the rotation in progress: %w", err)
+		}
+		c.next = h.pageCipher(next)
+		c.epochs = make([]byte, c.epochMapLen())
+		if _, err = f.ReadAt(c.epochs, int64(mapOff)); err != nil {
+			return nil, fmt.Errorf("reading key epoch map: %w", err)
+		}
+		if recovery {
+			if cp, err := loadCheckpoint(c.journalPath()); err == nil && cp.sectorSize == h.SectorSize {
+				c.journal = &cp
+			}
+		} else if err = c.replayRotation(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Header returns the container header.
+func (c *Container) Header() *ContainerHeader {
+	return c.h
+}
+
+// HeaderDamage returns why the header of a container opened with
+// OpenContainerForRecovery failed its checks, or nil if it is intact.
+func (c *Container) HeaderDamage() error {
+	return c.headerDamage
+}
+
+// Close closes the underlying file.
+func (c *Container) Close() error {
+	return c.f.Close()
+}
+
+// ReadSector reads and decrypts sector "n" into "buf", which must be exactly
+// one sector long.
+func (c *Container) ReadSector(n uint64, buf []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkSector(n, buf); err != nil {
+		return err
+	}
+	pc := c.cipherFor(n)
+	if j := c.journal; j != nil && n >= j.sector && n < j.sector+uint64(len(j.data))/uint64(c.h.SectorSize) {
+		copy(buf, j.data[(n-j.sector)*uint64(c.h.SectorSize):])
+		pc = c.next
+	} else if _, err := c.f.ReadAt(buf, c.sectorOffset(n)); err != nil {
+		return &SectorError{Sector: n, Err: err}
+	}
+	if c.h.sparsePolicy() == SparsePreserve && allZero(buf) {
+		return nil
+	}
+	pc.DecryptPage(n, buf)
+	return nil
+}
+
+// WriteSector encrypts "buf", which must be exactly one sector long, and
+// writes it to sector "n". "buf" is encrypted in place.
+func (c *Container) WriteSector(n uint64, buf []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readOnly {
+		return ErrReadOnly
+	}
+	if err := c.checkSector(n, buf); err != nil {
+		return err
+	}
+	if c.h.sparsePolicy() == SparsePreserve && allZero(buf) {
+		_, err := c.f.WriteAt(buf, c.sectorOffset(n))
+		return err
+	}
+	c.cipherFor(n).EncryptPage(n, buf)
+	_, err := c.f.WriteAt(buf, c.sectorOffset(n))
+	return err
+}
+
+// ReadSectors reads and decrypts the sectors starting at "first" into "buf",
+// whose length must be a multiple of the sector size. Unlike a loop over
+// ReadSector, it does not stop at a sector that fails: it reads all of them
+// and returns the errors.Join of one *SectorError per failed sector, which
+// SectorErrors breaks down, so that callers can retry or report exactly
+// those sectors.
+func (c *Container) ReadSectors(first uint64, buf []byte) error {
+	return c.eachSector(first, buf, c.ReadSector)
+}
+
+// WriteSectors encrypts "buf" and writes it to the sectors starting at
+// "first", like WriteSector, and reports failed sectors like ReadSectors.
+// "buf" is encrypted in place.
+func (c *Container) WriteSectors(first uint64, buf []byte) error {
+	return c.eachSector(first, buf, c.WriteSector)
+}
+
+// eachSector - run "f" on every sector of "buf", collecting the errors
+func (c *Container) eachSector(first uint64, buf []byte, f func(uint64, []byte) error) error {
+	ss := uint64(c.h.SectorSize)
+	if uint64(len(buf))%ss != 0 {
+		return fmt.Errorf("buffer must be a multiple of %d bytes long, is %d", ss, len(buf))
+	}
+	count := uint64(len(buf)) / ss
+	if first > c.h.Sectors() || count > c.h.Sectors()-first {
+		return fmt.Errorf("sectors %d to %d are beyond the end of the container (%d sectors)", first, first+count-1, c.h.Sectors())
+	}
+	var errs []error
+	for i := uint64(0); i < count; i++ {
+		n := first + i
+		if err := f(n, buf[i*ss:(i+1)*ss]); err != nil {
+			var se *SectorError
+			if !errors.As(err, &se) {
+				err = &SectorError{Sector: n, Err: err}
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SectorErrors returns the errors of the individual sectors in "err", as
+// returned by ReadSectors and WriteSectors, keyed by sector number. It is
+// nil if "err" holds no *SectorError.
+func SectorErrors(err error) map[uint64]error {
+	var m map[uint64]error
+	var walk func(error)
+	walk = func(err error) {
+		if se, ok := err.(*SectorError); ok {
+			if m == nil {
+				m = make(map[uint64]error)
+			}
+			m[se.Sector] = se.Err
+			return
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				walk(e)
+			}
+		case interface{ Unwrap() error }:
+			walk(u.Unwrap())
+		}
+	}
+	if err != nil {
+		walk(err)
+	}
+	return m
+}
+
+func (c *Container) checkSector(n uint64, buf []byte) error {
+	if n >= c.h.Sectors() {
+		return fmt.Errorf("sector %d is beyond the end of the container (%d sectors)", n, c.h.Sectors())
+	}
+	if len(buf) != int(c.h.SectorSize) {
+		return fmt.Errorf("buffer must be %d bytes long, is %d", c.h.SectorSize, len(buf))
+	}
+	return nil
+}
+
+func (c *Container) sectorOffset(n uint64) int64 {
+	return int64(c.h.DataOffset + n*uint64(c.h.SectorSize))
+}
+
+// cipherFor - the PageCipher that sector "n" is currently encrypted with
+func (c *Container) cipherFor(n uint64) *PageCipher {
+	if c.epochs != nil && c.epochs[n/8]&(1<<(n%8)) != 0 {
+		return c.next
+	}
+	return c.cur
+}
+
+func (c *Container) epochMapLen() uint64 {
+	return (c.h.Sectors() + 7) / 8
+}
+
+// DamageMap reads every sector and returns the errors of the sectors that
+// could not be read, keyed by sector number. It is meant for containers
+// opened with OpenContainerForRecovery.
+func (c *Container) DamageMap() map[uint64]error {
+	damage := make(map[uint64]error)
+	buf := make([]byte, c.h.SectorSize)
+	for n := uint64(0); n < c.h.Sectors(); n++ {
+		if err := c.ReadSector(n, buf); err != nil {
+			damage[n] = err
+		}
+	}
+	return damage
+}
+
+// WriteDamageMap writes "damage", as returned by DamageMap, to "w" as text:
+// one line per damaged sector, in ascending order, with the sector number
+// and the error separated by a tab.
+func WriteDamageMap(w io.Writer, damage map[uint64]error) error {
+	sectors := make([]uint64, 0, len(damage))
+	for n := range damage {
+		sectors = append(sectors, n)
+	}
+	sort.Slice(sectors, func(i, j int) bool { return sectors[i] < sectors[j] })
+	for _, n := range sectors {
+		err := damage[n]
+		var se *SectorError
+		if errors.As(err, &se) {
+			err = se.Err
+		}
+		if _, werr := fmt.Fprintf(w, "%d\t%v\n", n, err); werr != nil {
+			return werr
+		}
+	}
+	return nil
+}
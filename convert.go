@@ -0,0 +1,288 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ContainerOptions control ImageToContainer.
+type ContainerOptions struct {
+	// SectorSize is the size of the independently encrypted sectors. It must
+	// be acceptable to NewPageCipher. Defaults to 4096.
+	SectorSize int
+	// Sparse selects how holes and all-zero sectors are stored. The policy is
+	// recorded in the container header.
+	Sparse SparsePolicy
+	// KDF, if set, is recorded in the container header, so that the key can
+	// be derived again from the passphrase (see ContainerHeader.KDF).
+	KDF *KDFParams
+	// FIDO2, if set, is recorded in the container header, so that the key
+	// can be derived again with the security key (see ContainerHeader.FIDO2).
+	FIDO2 *FIDO2Params
+	// WrappedKey, if set, is recorded in the container header. It is the
+	// data key wrapped by a KMS, see GenerateKMSKey.
+	WrappedKey []byte
+	// Escrow, if set, is recorded in the container header. It is the data
+	// key encrypted to a recovery public key, see WrapKeyRSA, WrapKeyECIES
+	// and WrapKeyHybrid.
+	Escrow []byte
+	// KeyID, if not zero, is recorded in the container header. It is the ID
+	// of the key in a Keystore, see Keystore.OpenContainer.
+	KeyID uint32
+	// Tracer, if set, gets a span for the whole conversion
+	Tracer Tracer
+	// Progress, if set, is called before every sector and once at the end
+	// with the number of sectors converted so far and the total.
+	Progress func(done uint64, total uint64)
+}
+
+// ImageToContainer converts the raw image at "src" into an encrypted
+// container at "dst". Sector "n" of the image is encrypted with a PageCipher
+// under page number "n". Every sector is read back after it has been written
+// and checked to decrypt to the original data.
+//
+// "src" and "dst" may name the same file, in which case the image is
+// converted in place. Memory use is bounded by a few sectors regardless of
+// the image size. The in-place conversion cannot be resumed; use
+// EncryptImage if that is needed.
+func ImageToContainer(dst string, src string, bc cipher.Block, opts ContainerOptions) (err error) {
+	if opts.SectorSize == 0 {
+		opts.SectorSize = 4096
+	}
+	if !validPageSize(opts.SectorSize) {
+		return fmt.Errorf("eme: invalid sector size %d", opts.SectorSize)
+	}
+	span := startSpan(opts.Tracer, "eme.ImageToContainer")
+	defer func() { span.End(err) }()
+	in, out, err := openConvertFiles(dst, src)
+	if err != nil {
+		return err
+	}
+	defer closeConvertFiles(in, out)
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	h, err := newContainerHeader(opts.SectorSize, fi.Size())
+	if err != nil {
+		return err
+	}
+	if opts.Sparse != SparseEncrypt {
+		h.SetField(fieldSparse, []byte{byte(opts.Sparse)})
+	}
+	if opts.KDF != nil {
+		v, err := opts.KDF.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		h.SetField(fieldKDF, v)
+	}
+	if opts.FIDO2 != nil {
+		v, err := opts.FIDO2.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		h.SetField(fieldFIDO2, v)
+	}
+	if opts.WrappedKey != nil {
+		h.SetField(fieldWrappedKey, opts.WrappedKey)
+	}
+	if opts.Escrow != nil {
+		h.SetField(fieldEscrow, opts.Escrow)
+	}
+	if opts.KeyID != 0 {
+		h.SetField(fieldKeyID, binary.BigEndian.AppendUint32(nil, opts.KeyID))
+	}
+	h.SetField(fieldKeyCheck, keyCheck(bc, h.Field(fieldSalt)))
+	hdr, err := h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	pc := h.pageCipher(bc)
+	ss := int64(opts.SectorSize)
+	span.SetAttribute(AttrSectorSize, ss)
+	span.SetAttribute(AttrSectors, int64(h.Sectors()))
+	span.SetAttribute(AttrBytes, fi.Size())
+	plain := make([]byte, ss)
+	sec := make([]byte, ss)
+	verify := make([]byte, ss)
+	holes := newHoleFinder(in, fi.Size())
+	// Work backwards: the encrypted copy of sector "n" lands at a higher
+	// offset than the plaintext, so going from the end never overwrites data
+	// that has not been read yet when converting in place.
+	for n := int64(h.Sectors()) - 1; n >= 0; n-- {
+		if opts.Progress != nil {
+			opts.Progress(h.Sectors()-uint64(n)-1, h.Sectors())
+		}
+		for i := range plain {
+			plain[i] = 0
+		}
+		off := int64(h.DataOffset) + n*ss
+		if opts.Sparse == SparsePreserve && holes.isHole(n*ss, ss) {
+			if err = skipZeroSector(in, out, plain, off); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err = in.ReadAt(plain, n*ss); err != nil && err != io.EOF {
+			return err
+		}
+		if opts.Sparse == SparsePreserve && allZero(plain) {
+			if err = skipZeroSector(in, out, plain, off); err != nil {
+				return err
+			}
+			continue
+		}
+		copy(sec, plain)
+		pc.EncryptPage(uint64(n), sec)
+		if err = writeVerified(out, sec, verify, off); err != nil {
+			return err
+		}
+		pc.DecryptPage(uint64(n), verify)
+		if !bytes.Equal(verify, plain) {
+			return fmt.Errorf("sector %d does not decrypt to the original data", n)
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(h.Sectors(), h.Sectors())
+	}
+	if _, err = out.WriteAt(hdr, 0); err != nil {
+		return err
+	}
+	if err = out.Truncate(int64(h.DataOffset) + int64(h.Sectors())*ss); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// ContainerToImage is the inverse of ImageToContainer: it decrypts the
+// container at "src" into the raw image "dst", again verifying every sector
+// after it has been written. "src" and "dst" may name the same file. A key
+// that does not match the header gives ErrWrongKey before anything is
+// written.
+func ContainerToImage(dst string, src string, bc cipher.Block) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	h, err := ReadContainerHeader(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if err = h.checkKey(bc); err != nil {
+		return err
+	}
+	if _, _, rotating := h.keyEpoch(); rotating {
+		return errors.New("a key rotation is in progress, finish it with RotateKey first")
+	}
+	in, out, err := openConvertFiles(dst, src)
+	if err != nil {
+		return err
+	}
+	defer closeConvertFiles(in, out)
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	pc := h.pageCipher(bc)
+	ss := int64(h.SectorSize)
+	sec := make([]byte, ss)
+	verify := make([]byte, ss)
+	sparse := h.sparsePolicy() == SparsePreserve
+	holes := newHoleFinder(in, fi.Size())
+	// Work forwards: plaintext sector "n" lands below its ciphertext.
+	for n := int64(0); n < int64(h.Sectors()); n++ {
+		off := int64(h.DataOffset) + n*ss
+		if sparse && holes.isHole(off, ss) {
+			for i := range sec {
+				sec[i] = 0
+			}
+		} else if _, err = in.ReadAt(sec, off); err != nil {
+			return fmt.Errorf("sector %d: %w", n, err)
+		}
+		if sparse && allZero(sec) {
+			if err = skipZeroSector(in, out, sec, n*ss); err != nil {
+				return err
+			}
+			continue
+		}
+		pc.DecryptPage(uint64(n), sec)
+		// The last sector only partially belongs to the image
+		plain := sec
+		if rest := int64(h.Size) - n*ss; rest < ss {
+			plain = sec[:rest]
+		}
+		if err = writeVerified(out, plain, verify[:len(plain)], n*ss); err != nil {
+			return err
+		}
+	}
+	if err = out.Truncate(int64(h.Size)); err != nil {
+		return err
+	}
+	return out.Sync()
+}
+
+// openConvertFiles - open "src" for reading and "dst" for writing. If both
+// are the same file, the same *os.File is returned twice.
+func openConvertFiles(dst string, src string) (in *os.File, out *os.File, err error) {
+	si, err := os.Stat(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	if di, err := os.Stat(dst); err == nil && os.SameFile(si, di) {
+		f, err := os.OpenFile(src, os.O_RDWR, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, f, nil
+	}
+	in, err = os.Open(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err = os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		in.Close()
+		return nil, nil, err
+	}
+	return in, out, nil
+}
+
+func closeConvertFiles(in *os.File, out *os.File) {
+	if in != out {
+		in.Close()
+	}
+	out.Close()
+}
+
+// skipZeroSector - leave an all-zero sector at "off" as a hole. A freshly
+// created output already reads as zero there, but when converting in place
+// the old data has to be overwritten with "zero".
+func skipZeroSector(in *os.File, out *os.File, zero []byte, off int64) error {
+	if in != out {
+		return nil
+	}
+	_, err := out.WriteAt(zero, off)
+	return err
+}
+
+// writeVerified - write "data" at "off" and read it back into "verify",
+// which must have the same length, failing if it does not match
+func writeVerified(f *os.File, data []byte, verify []byte, off int64) error {
+	if _, err := f.WriteAt(data, off); err != nil {
+		return err
+	}
+	if _, err := f.ReadAt(verify, off); err != nil {
+		return err
+	}
+	if !bytes.Equal(verify, data) {
+		return fmt.Errorf("read-back mismatch at offset %d", off)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainerRoundtrip(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	img := filepath.Join(dir, "disk.img")
+	orig := make([]byte, 3*4096+100)
+	for i := range orig {
+		orig[i] = byte(i)
+	}
+	if err = os.WriteFile(img, orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cont := filepath.Join(dir, "disk.eme")
+	if err = ImageToContainer(cont, img, bc, ContainerOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(cont)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := ReadContainerHeader(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Size != uint64(len(orig)) || h.SectorSize != 4096 || h.Sectors() != 4 {
+		t.Errorf("unexpected header %+v", h)
+	}
+	out := filepath.Join(dir, "out.img")
+	if err = ContainerToImage(out, cont, bc); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	if !bytes.Equal(got, orig) {
+		t.Errorf("roundtrip failed")
+	}
+}
+
+func TestContainerInPlace(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	img := filepath.Join(dir, "disk.img")
+	orig := make([]byte, 10*512)
+	for i := range orig {
+		orig[i] = byte(i * 3)
+	}
+	if err = os.WriteFile(img, orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	ref := filepath.Join(dir, "ref.eme")
+	if err = ImageToContainer(ref, img, bc, ContainerOptions{SectorSize: 512}); err != nil {
+		t.Fatal(err)
+	}
+	if err = ImageToContainer(img, img, bc, ContainerOptions{SectorSize: 512}); err != nil {
+		t.Fatal(err)
+	}
+	// The containers have different salts, so only the sizes can match
+	a, _ := os.ReadFile(ref)
+	b, _ := os.ReadFile(img)
+	if len(a) != len(b) || bytes.Equal(a[containerMinHeader:], b[containerMinHeader:]) {
+		t.Errorf("in-place container: len %d, copied container: len %d", len(b), len(a))
+	}
+	if err = ContainerToImage(img, img, bc); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(img)
+	if !bytes.Equal(got, orig) {
+		t.Errorf("in-place roundtrip failed")
+	}
+}
+
+// A wrong key must not touch the container, even in place
+func TestContainerToImageWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	cont, _ := newTestContainer(t, dir, bytes.Repeat([]byte{1}, 32))
+	before, _ := os.ReadFile(cont)
+	wrong, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	if err := ContainerToImage(cont, cont, wrong); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("in place: got %v", err)
+	}
+	out := filepath.Join(dir, "out.img")
+	if err := ContainerToImage(out, cont, wrong); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("to a new file: got %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("output created with the wrong key: %v", err)
+	}
+	after, _ := os.ReadFile(cont)
+	if !bytes.Equal(after, before) {
+		t.Errorf("container modified with the wrong key")
+	}
+}
+
+func TestImageToContainerBadSectorSize(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	dir := t.TempDir()
+	img := filepath.Join(dir, "disk.img")
+	if err := os.WriteFile(img, make([]byte, 4096), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, ss := range []int{-512, 100, 3000, 2 << 20} {
+		if err := ImageToContainer(filepath.Join(dir, "c"), img, bc, ContainerOptions{SectorSize: ss}); err == nil {
+			t.Errorf("sector size %d accepted", ss)
+		}
+	}
+}
+
+func TestContainerHeaderCorrupt(t *testing.T) {
+	h, err := newContainerHeader(512, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.SetField(1, []byte("hello"))
+	buf, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := ReadContainerHeader(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(h2.Field(1)) != "hello" {
+		t.Errorf("field lost")
+	}
+	buf[17] ^= 1
+	if _, err = ReadContainerHeader(bytes.NewReader(buf)); err == nil {
+		t.Errorf("corrupt header was accepted")
+	}
+}
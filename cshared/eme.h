@@ -0,0 +1,49 @@
+/*
+ * eme.h - C interface of libeme, EME-AES from github.com/rfjakob/eme.
+ *
+ * Build the library with
+ *
+ *     go build -buildmode=c-shared -o libeme.so ./cshared
+ *
+ * and include this header rather than the libeme.h that go build writes
+ * next to the library; this one is stable across releases.
+ *
+ * eme_encrypt and eme_decrypt transform "len" bytes from "in" to "out" under
+ * the 16, 24 or 32 byte AES key "key" and the 16-byte "tweak". "len" must be
+ * a multiple of 16 from 16 to 2048. "in" and "out" may be the same buffer.
+ * The functions return EME_OK or one of the negative EME_ERR_* codes, and
+ * are safe to call from several threads at once.
+ */
+#ifndef EME_H
+#define EME_H
+
+#include <stddef.h>
+#include <stdint.h>
+
+#define EME_TWEAK_LEN 16
+#define EME_MAX_LEN 2048
+
+#define EME_OK 0
+/* A pointer argument is NULL */
+#define EME_ERR_NULL (-1)
+/* key_len is not 16, 24 or 32 */
+#define EME_ERR_KEY (-2)
+/* len is not a multiple of 16 from 16 to EME_MAX_LEN */
+#define EME_ERR_LEN (-3)
+
+#ifndef EME_CGO_BUILD
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+int eme_encrypt(const uint8_t *key, size_t key_len, const uint8_t *tweak,
+                const uint8_t *in, uint8_t *out, size_t len);
+int eme_decrypt(const uint8_t *key, size_t key_len, const uint8_t *tweak,
+                const uint8_t *in, uint8_t *out, size_t len);
+
+#ifdef __cplusplus
+}
+#endif
+#endif
+
+#endif
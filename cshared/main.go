@@ -0,0 +1,49 @@
+// Command cshared builds package eme as a C shared library for C, C++ and
+// Python tools (through ctypes or cffi):
+//
+//	go build -buildmode=c-shared -o libeme.so ./cshared
+//
+// The C API is described in eme.h.
+package main
+
+/*
+#define EME_CGO_BUILD
+#include "eme.h"
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+//export eme_encrypt
+func eme_encrypt(key *C.uint8_t, keyLen C.size_t, tweak *C.uint8_t, in *C.uint8_t, out *C.uint8_t, n C.size_t) C.int {
+	return cTransform(key, keyLen, tweak, in, out, n, true)
+}
+
+//export eme_decrypt
+func eme_decrypt(key *C.uint8_t, keyLen C.size_t, tweak *C.uint8_t, in *C.uint8_t, out *C.uint8_t, n C.size_t) C.int {
+	return cTransform(key, keyLen, tweak, in, out, n, false)
+}
+
+// cTransform - convert the C arguments and call transform
+func cTransform(key *C.uint8_t, keyLen C.size_t, tweak *C.uint8_t, in *C.uint8_t, out *C.uint8_t, n C.size_t, encrypt bool) C.int {
+	if key == nil || tweak == nil || in == nil || out == nil {
+		return C.EME_ERR_NULL
+	}
+	// Checked here already so that the slices below cannot be huge
+	if keyLen > 32 {
+		return C.EME_ERR_KEY
+	}
+	if n > C.EME_MAX_LEN {
+		return C.EME_ERR_LEN
+	}
+	return C.int(transform(
+		unsafe.Slice((*byte)(key), int(keyLen)),
+		unsafe.Slice((*byte)(tweak), C.EME_TWEAK_LEN),
+		unsafe.Slice((*byte)(in), int(n)),
+		unsafe.Slice((*byte)(out), int(n)),
+		encrypt))
+}
+
+func main() {}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"crypto/aes"
+
+	"github.com/rfjakob/eme"
+)
+
+// Return codes, the EME_* constants of eme.h
+const (
+	codeOK     = 0
+	codeErrNil = -1
+	codeErrKey = -2
+	codeErrLen = -3
+)
+
+// transform - eme_encrypt or eme_decrypt on Go slices. Validates everything
+// so that package eme never panics across the C boundary.
+func transform(key []byte, tweak []byte, in []byte, out []byte, encrypt bool) int {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return codeErrKey
+	}
+	if len(in) == 0 || len(in)%16 != 0 || len(in) > 2048 || len(out) != len(in) || len(tweak) != 16 {
+		return codeErrLen
+	}
+	dir := eme.DirectionEncrypt
+	if !encrypt {
+		dir = eme.DirectionDecrypt
+	}
+	copy(out, eme.Transform(bc, tweak, in, dir))
+	return codeOK
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/rfjakob/eme/emevectors"
+)
+
+func TestTransform(t *testing.T) {
+	for _, v := range emevectors.All {
+		if v.Iterations != 1 {
+			continue
+		}
+		out := make([]byte, len(v.In))
+		if code := transform(v.Key, v.Tweak, v.In, out, !v.Decrypt); code != codeOK || !bytes.Equal(out, v.Out) {
+			t.Errorf("vector %s: code %d", v.Name, code)
+		}
+		// in place
+		buf := bytes.Clone(v.In)
+		transform(v.Key, v.Tweak, buf, buf, !v.Decrypt)
+		if !bytes.Equal(buf, v.Out) {
+			t.Errorf("vector %s in place failed", v.Name)
+		}
+	}
+	key := make([]byte, 32)
+	tweak := make([]byte, 16)
+	if code := transform(key[:20], tweak, make([]byte, 16), make([]byte, 16), true); code != codeErrKey {
+		t.Errorf("bad key: code %d", code)
+	}
+	for _, n := range []int{0, 15, 2064} {
+		if code := transform(key, tweak, make([]byte, n), make([]byte, n), true); code != codeErrLen {
+			t.Errorf("%d bytes: code %d", n, code)
+		}
+	}
+}
+
+// TestHeader checks that eme.h and the Go constants agree
+func TestHeader(t *testing.T) {
+	h, err := os.ReadFile("eme.h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{
+		"EME_OK":        codeOK,
+		"EME_ERR_NULL":  codeErrNil,
+		"EME_ERR_KEY":   codeErrKey,
+		"EME_ERR_LEN":   codeErrLen,
+		"EME_TWEAK_LEN": 16,
+		"EME_MAX_LEN":   2048,
+	}
+	re := regexp.MustCompile(`(?m)^#define (EME_\w+) \(?(-?\d+)\)?$`)
+	found := 0
+	for _, m := range re.FindAllSubmatch(h, -1) {
+		v, _ := strconv.Atoi(string(m[2]))
+		if w, ok := want[string(m[1])]; !ok || v != w {
+			t.Errorf("eme.h: %s is %d, Go has %d", m[1], v, w)
+		}
+		found++
+	}
+	if found != len(want) {
+		t.Errorf("found %d constants in eme.h, want %d", found, len(want))
+	}
+}
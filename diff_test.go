@@ -0,0 +1,91 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestChangedSectors(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc := NewPageCipher(bc, 4096)
+	v1 := make([]byte, 8*4096)
+	v2 := append([]byte{}, v1...)
+	v2[2*4096+100]++
+	v2[5*4096+4095]++
+	enc := func(plain []byte) []byte {
+		c := append([]byte{}, plain...)
+		for i := 0; i < len(c)/4096; i++ {
+			pc.EncryptPage(uint64(i), c[i*4096:(i+1)*4096])
+		}
+		return c
+	}
+	want := []uint64{2, 5}
+	got, err := ChangedSectors(bytes.NewReader(v1), bytes.NewReader(v2), 4096)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("plaintext: got %v, %v", got, err)
+	}
+	got, err = ChangedSectors(bytes.NewReader(enc(v1)), bytes.NewReader(enc(v2)), 4096)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ciphertext: got %v, %v", got, err)
+	}
+	// Appended data
+	v3 := append(append([]byte{}, v1...), 1, 2, 3)
+	got, err = ChangedSectors(bytes.NewReader(v1), bytes.NewReader(v3), 4096)
+	if err != nil || !reflect.DeepEqual(got, []uint64{8}) {
+		t.Errorf("appended: got %v, %v", got, err)
+	}
+}
+
+// Containers are only comparable under the same salt and key
+func TestChangedSectorsContainers(t *testing.T) {
+	dir := t.TempDir()
+	key1 := bytes.Repeat([]byte{1}, 32)
+	c1, _ := newTestContainer(t, dir, key1)
+	orig, _ := os.ReadFile(c1)
+	bc1, _ := aes.NewCipher(key1)
+
+	// A later version of the same container
+	c, err := OpenContainer(c1, bc1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.WriteSector(2, bytes.Repeat([]byte{9}, 512)); err != nil {
+		t.Fatal(err)
+	}
+	first := c.Header().DataOffset / 512
+	c.Close()
+	changed, _ := os.ReadFile(c1)
+	got, err := ChangedSectors(bytes.NewReader(orig), bytes.NewReader(changed), 512)
+	if err != nil || !reflect.DeepEqual(got, []uint64{first + 2}) {
+		t.Errorf("same container: got %v, %v", got, err)
+	}
+
+	// The same image converted again gets a new salt
+	c2, _ := newTestContainer(t, t.TempDir(), key1)
+	again, _ := os.ReadFile(c2)
+	if _, err = ChangedSectors(bytes.NewReader(orig), bytes.NewReader(again), 512); err == nil {
+		t.Errorf("compared containers with different salts")
+	}
+
+	// Same salt, other key
+	h, err := ReadContainerHeader(bytes.NewReader(orig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc2, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	h.SetField(fieldKeyCheck, keyCheck(bc2, h.Field(fieldSalt)))
+	hdr, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rekeyed := append(hdr, orig[len(hdr):]...)
+	if _, err = ChangedSectors(bytes.NewReader(orig), bytes.NewReader(rekeyed), 512); err == nil {
+		t.Errorf("compared containers with different keys")
+	}
+}
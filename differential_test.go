@@ -0,0 +1,64 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/rfjakob/eme/internal/refimpl"
+)
+
+// TestDifferential compares the optimized code paths with the reference
+// implementation on random keys, tweaks and messages.
+func TestDifferential(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	rnd := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = byte(rng.Uint32())
+		}
+		return b
+	}
+	for i := 0; i < 300; i++ {
+		key := rnd([]int{16, 24, 32}[i%3])
+		bc, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak := rnd(16)
+		n := 16 * (1 + rng.IntN(128))
+		if i < 128 {
+			n = 16 * (i + 1)
+		}
+		data := rnd(n)
+		wantEnc := refimpl.Encrypt(bc, tweak, data)
+		wantDec := refimpl.Decrypt(bc, tweak, data)
+
+		if got := Transform(bc, tweak, data, DirectionEncrypt); !bytes.Equal(got, wantEnc) {
+			t.Fatalf("Transform encrypt differs: key %x tweak %x, %d bytes", key, tweak, n)
+		}
+		if got := Transform(bc, tweak, data, DirectionDecrypt); !bytes.Equal(got, wantDec) {
+			t.Fatalf("Transform decrypt differs: key %x tweak %x, %d bytes", key, tweak, n)
+		}
+		if got, _ := Trace(bc, tweak, data, DirectionEncrypt); !bytes.Equal(got, wantEnc) {
+			t.Fatalf("Trace differs: key %x tweak %x, %d bytes", key, tweak, n)
+		}
+
+		// PageCipher, in place and with its preallocated workspace
+		pageNo := rng.Uint64()
+		pageT := make([]byte, 16)
+		pageTweak(pageT, pageNo, 0)
+		pc := NewPageCipher(bc, n)
+		page := bytes.Clone(data)
+		pc.EncryptPage(pageNo, page)
+		if !bytes.Equal(page, refimpl.Encrypt(bc, pageT, data)) {
+			t.Fatalf("EncryptPage differs: key %x page %d, %d bytes", key, pageNo, n)
+		}
+		page = bytes.Clone(data)
+		pc.DecryptPage(pageNo, page)
+		if !bytes.Equal(page, refimpl.Decrypt(bc, pageT, data)) {
+			t.Fatalf("DecryptPage differs: key %x page %d, %d bytes", key, pageNo, n)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package eme
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DirIVFileName is the name of the file that holds the filename IV of an
+// encrypted directory, like "gocryptfs.diriv" in gocryptfs. Names encrypted
+// by EncryptFilename never collide with it.
+const DirIVFileName = "eme.diriv"
+
+// DirIVLen is the length of a directory IV.
+const DirIVLen = 16
+
+// DirIVStore manages the per-directory IVs used by EncryptFilename and
+// DecryptFilename. "dir" is always the path of the encrypted directory.
+type DirIVStore interface {
+	// CreateDirIV generates and stores a new random IV for "dir". It fails
+	// if "dir" already has one.
+	CreateDirIV(dir string) ([]byte, error)
+	// LoadDirIV returns the IV of "dir". The error satisfies os.IsNotExist
+	// if "dir" has none.
+	LoadDirIV(dir string) ([]byte, error)
+	// Forget drops any cached state for "dir", for use after the directory
+	// was renamed or deleted.
+	Forget(dir string)
+}
+
+// dirIVCacheSize - FileDirIVStore drops its cache when it grows beyond this
+const dirIVCacheSize = 1024
+
+// FileDirIVStore is the gocryptfs-style DirIVStore: the IV of every encrypted
+// directory is kept in a read-only file called DirIVFileName inside it.
+// Loaded IVs are cached. It is safe for concurrent use.
+type FileDirIVStore struct {
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+// NewFileDirIVStore returns an empty FileDirIVStore.
+func NewFileDirIVStore() *FileDirIVStore {
+	return &FileDirIVStore{cache: make(map[string][]byte)}
+}
+
+// CreateDirIV implements DirIVStore.
+func (s *FileDirIVStore) CreateDirIV(dir string) ([]byte, error) {
+	iv := make([]byte, DirIVLen)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, DirIVFileName), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0400)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.Write(iv)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.remember(dir, iv)
+	return iv, nil
+}
+
+// LoadDirIV implements DirIVStore.
+func (s *FileDirIVStore) LoadDirIV(dir string) ([]byte, error) {
+	s.mu.Lock()
+	iv, ok := s.cache[dir]
+	s.mu.Unlock()
+	if ok {
+		return iv, nil
+	}
+	iv, err := os.ReadFile(filepath.Join(dir, DirIVFileName))
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != DirIVLen {
+		return nil, fmt.Errorf("%q: directory IV has length %d, want %d", dir, len(iv), DirIVLen)
+	}
+	s.remember(dir, iv)
+	return iv, nil
+}
+
+// Forget implements DirIVStore.
+func (s *FileDirIVStore) Forget(dir string) {
+	s.mu.Lock()
+	delete(s.cache, dir)
+	s.mu.Unlock()
+}
+
+func (s *FileDirIVStore) remember(dir string, iv []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.cache) >= dirIVCacheSize {
+		s.cache = make(map[string][]byte)
+	}
+	s.cache[dir] = iv
+}
@@ -0,0 +1,31 @@
+package eme
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestFileDirIVStore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileDirIVStore()
+	if _, err := s.LoadDirIV(dir); !os.IsNotExist(err) {
+		t.Errorf("missing IV: %v", err)
+	}
+	iv, err := s.CreateDirIV(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.CreateDirIV(dir); err == nil {
+		t.Errorf("second CreateDirIV succeeded")
+	}
+	// Fresh store, no cache
+	iv2, err := NewFileDirIVStore().LoadDirIV(dir)
+	if err != nil || !bytes.Equal(iv, iv2) {
+		t.Errorf("reloaded IV differs: %v", err)
+	}
+	other, err := s.CreateDirIV(t.TempDir())
+	if err != nil || bytes.Equal(iv, other) {
+		t.Errorf("IVs are not random: %v", err)
+	}
+}
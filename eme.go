@@ -9,8 +9,11 @@
 package eme
 
 import (
+	"crypto/aes"
 	"crypto/cipher"
-	"log"
+	"fmt"
+	"runtime"
+	"unsafe"
 )
 
 type directionConst bool
@@ -44,9 +47,11 @@ func multByTwo(out []byte, in []byte) {
 
 func xorBlocks(out []byte, in1 []byte, in2 []byte) {
 	if len(in1) != len(in2) {
-		log.Panicf("len(in1)=%d is not equal to len(in2)=%d", len(in1), len(in2))
+		logPanicf("len(in1)=%d is not equal to len(in2)=%d", len(in1), len(in2))
 	}
 
+	// One bounds check here instead of one per byte below
+	out = out[:len(in1)]
 	for i := range in1 {
 		out[i] = in1[i] ^ in2[i]
 	}
@@ -64,22 +69,83 @@ func aesTransform(dst []byte, src []byte, direction directionConst, bc cipher.Bl
 	}
 }
 
-// tabulateL - calculate L_i for messages up to a length of m cipher blocks
-func tabulateL(bc cipher.Block, m int) [][]byte {
+// BlockBatcher is a cipher.Block that can also en- or decrypt many blocks in
+// one call, in ECB mode. "dst" and "src" are multiples of the block size long
+// and overlap entirely or not at all. Transform uses it for its two ECB
+// passes when the block cipher implements it, which matters for block ciphers
+// with a high per-call cost, like HSMBlock.
+type BlockBatcher interface {
+	cipher.Block
+	EncryptBlocks(dst []byte, src []byte)
+	DecryptBlocks(dst []byte, src []byte)
+}
+
+// aesBlocks - aesTransform every 16-byte block of "src" into "dst", in one
+// call if "bc" is a BlockBatcher. Otherwise, the blocks go through the
+// cipher in groups of four, so that their independent AES rounds can overlap
+// in the CPU.
+func aesBlocks(dst []byte, src []byte, direction directionConst, bc cipher.Block) {
+	if bb, ok := bc.(BlockBatcher); ok {
+		if direction == DirectionEncrypt {
+			bb.EncryptBlocks(dst, src)
+		} else {
+			bb.DecryptBlocks(dst, src)
+		}
+		return
+	}
+	f := bc.Decrypt
+	if direction == DirectionEncrypt {
+		f = bc.Encrypt
+	}
+	dst = dst[:len(src)]
+	j := 0
+	for ; j+64 <= len(src); j += 64 {
+		d, s := (*[64]byte)(dst[j:]), (*[64]byte)(src[j:])
+		f(d[0:16], s[0:16])
+		f(d[16:32], s[16:32])
+		f(d[32:48], s[32:48])
+		f(d[48:64], s[48:64])
+	}
+	for ; j+16 <= len(src); j += 16 {
+		f(dst[j:j+16], src[j:j+16])
+	}
+}
+
+// tabulateL - calculate L_i for messages up to a length of m cipher blocks.
+// The table is one flat, cache-line aligned slice: L_i is at [i*16:(i+1)*16].
+// m is at most 128, since larger pages reuse the table per segment, so this
+// is one block encryption and 128 doublings: a few microseconds even for 64
+// KiB pages (see BenchmarkNewPageCipher). ExportLTable and LTableCache
+// store tables for reuse across restarts.
+func tabulateL(bc cipher.Block, m int) []byte {
+	LTable := alignedBytes(m * 16)
+	var w workspace
+	fillL(bc, LTable, &w)
+	return LTable
+}
+
+// fillL - write L_i into every 16-byte block of "LTable", using the scratch
+// blocks of "w"
+func fillL(bc cipher.Block, LTable []byte, w *workspace) {
 	/* set L0 = 2*AESenc(K; 0) */
-	eZero := make([]byte, 16)
-	Li := make([]byte, 16)
+	eZero := w.MP[:]
+	clear(eZero)
+	Li := w.M[:]
 	bc.Encrypt(Li, eZero)
 
-	LTable := make([][]byte, m)
-	// Allocate pool once and slice into m pieces in the loop
-	pool := make([]byte, m*16)
-	for i := 0; i < m; i++ {
+	for i := 0; i < len(LTable); i += 16 {
 		multByTwo(Li, Li)
-		LTable[i] = pool[i*16 : (i+1)*16]
-		copy(LTable[i], Li)
+		copy(LTable[i:i+16], Li)
 	}
-	return LTable
+}
+
+// alignedBytes - a slice of "n" bytes that starts on a 64-byte (cache line)
+// boundary. The Go heap does not move objects, so the alignment holds for the
+// lifetime of the slice.
+func alignedBytes(n int) []byte {
+	buf := make([]byte, n+63)
+	off := int(-uintptr(unsafe.Pointer(&buf[0])) & 63)
+	return buf[off : off+n : off+n]
 }
 
 // Transform - EME-encrypt or EME-decrypt, according to "direction"
@@ -100,7 +166,8 @@ func tabulateL(bc cipher.Block, m int) [][]byte {
 // * The block cipher must have block size 16 (usually AES).
 // * The size of "tweak" must be 16
 // * "inputData" must be a multiple of 16 bytes long
-// If any of these pre-conditions are not met, the function will panic.
+// If any of these pre-conditions are not met, the function will panic with a
+// *ParamError.
 //
 // Note that you probably don't want to call this function directly and instead
 // use eme.New(), which provides conventient wrappers.
@@ -114,79 +181,117 @@ func Transform(bc cipher.Block, tweak []byte, inputData []byte, direction direct
 	// "C", regardless of the direction.
 	P := inputData
 
+	m := checkParams(bc, T, P)
+
+	C := make([]byte, len(P))
+	LTable := tabulateL(bc, m)
+	var w workspace
+	transform(bc, T, C, P, direction, LTable, &w)
+	return C
+}
+
+// checkParams - panic with a *ParamError unless Transform accepts the
+// arguments, and return the number of blocks in "P"
+func checkParams(bc cipher.Block, T []byte, P []byte) int {
 	if bc.BlockSize() != 16 {
-		log.Panicf("Using a block size other than 16 is not implemented")
+		paramPanicf(ErrBlockSize, "Using a block size other than 16 is not implemented")
 	}
 	if len(T) != 16 {
-		log.Panicf("Tweak must be 16 bytes long, is %d", len(T))
+		paramPanicf(ErrTweakSize, "Tweak must be 16 bytes long, is %d", len(T))
 	}
 	if len(P)%16 != 0 {
-		log.Panicf("Data P must be a multiple of 16 long, is %d", len(P))
+		paramPanicf(ErrDataSize, "Data P must be a multiple of 16 long, is %d", len(P))
 	}
 	m := len(P) / 16
-	if m == 0 || m > 16*8 {
-		log.Panicf("EME operates on 1 to %d block-cipher blocks, you passed %d", 16*8, m)
+	if m == 0 || m > maxMessageBlocks {
+		paramPanicf(ErrDataSize, "EME operates on 1 to %d block-cipher blocks, you passed %d", maxMessageBlocks, m)
 	}
+	return m
+}
 
-	C := make([]byte, len(P))
+// SafeTransform is Transform, but returns an error instead of panicking: a
+// *ParamError for invalid parameters, or the error a block cipher panicked
+// with, like *HSMError. Other panics, including runtime errors like a nil
+// dereference or an index out of range in the block cipher, are passed on.
+func SafeTransform(bc cipher.Block, tweak []byte, inputData []byte, direction directionConst) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(error)
+			if _, bug := r.(runtime.Error); !ok || bug {
+				panic(r)
+			}
+			out, err = nil, e
+		}
+	}()
+	return Transform(bc, tweak, inputData, direction), nil
+}
 
-	LTable := tabulateL(bc, m)
+// workspace - scratch blocks used by transform. Callers that keep a workspace
+// around across calls avoid allocating it every time.
+type workspace struct {
+	MP   [16]byte
+	MC   [16]byte
+	M    [16]byte
+	CCC1 [16]byte
+}
 
-	PPj := make([]byte, 16)
-	for j := 0; j < m; j++ {
-		Pj := P[j*16 : (j+1)*16]
-		/* PPj = 2**(j-1)*L xor Pj */
-		xorBlocks(PPj, Pj, LTable[j])
-		/* PPPj = AESenc(K; PPj) */
-		aesTransform(C[j*16:(j+1)*16], PPj, direction, bc)
-	}
+// transform - the EME core. Writes the transformation of "P" into "C", which
+// must have the same length. "C" and "P" may be the same slice, which makes
+// the operation in-place. "LTable" must hold at least len(P)/16 entries, see
+// tabulateL. Input validation is left to the callers.
+func transform(bc cipher.Block, T []byte, C []byte, P []byte, direction directionConst, LTable []byte, w *workspace) {
+	runTraceHook(bc, T, P, direction, LTable)
+
+	/* PPj = 2**(j-1)*L xor Pj */
+	maskBlocks(C, P, LTable)
+	/* PPPj = AESenc(K; PPj) */
+	aesBlocks(C, C, direction, bc)
 
 	/* MP =(xorSum PPPj) xor T */
-	MP := make([]byte, 16)
+	MP := w.MP[:]
 	xorBlocks(MP, C[0:16], T)
-	for j := 1; j < m; j++ {
-		xorBlocks(MP, MP, C[j*16:(j+1)*16])
-	}
+	xorSumBlocks(MP, C[16:])
 
 	/* MC = AESenc(K; MP) */
-	MC := make([]byte, 16)
+	MC := w.MC[:]
 	aesTransform(MC, MP, direction, bc)
 
 	/* M = MP xor MC */
-	M := make([]byte, 16)
+	M := w.M[:]
 	xorBlocks(M, MP, MC)
-	CCCj := make([]byte, 16)
-	for j := 1; j < m; j++ {
-		multByTwo(M, M)
-		/* CCCj = 2**(j-1)*M xor PPPj */
-		xorBlocks(CCCj, C[j*16:(j+1)*16], M)
-		copy(C[j*16:(j+1)*16], CCCj)
-	}
-
+	/* CCCj = 2**(j-1)*M xor PPPj, for j > 1 */
 	/* CCC1 = (xorSum CCCj) xor T xor MC */
-	CCC1 := make([]byte, 16)
+	CCC1 := w.CCC1[:]
 	xorBlocks(CCC1, MC, T)
-	for j := 1; j < m; j++ {
-		xorBlocks(CCC1, CCC1, C[j*16:(j+1)*16])
-	}
+	mixBlocks(C[16:], M, CCC1)
 	copy(C[0:16], CCC1)
 
-	for j := 0; j < m; j++ {
-		/* CCj = AES-enc(K; CCCj) */
-		aesTransform(C[j*16:(j+1)*16], C[j*16:(j+1)*16], direction, bc)
-		/* Cj = 2**(j-1)*L xor CCj */
-		xorBlocks(C[j*16:(j+1)*16], C[j*16:(j+1)*16], LTable[j])
-	}
-
-	return C
+	/* CCj = AES-enc(K; CCCj) */
+	aesBlocks(C, C, direction, bc)
+	/* Cj = 2**(j-1)*L xor CCj */
+	maskBlocks(C, C, LTable)
 }
 
 // EMECipher provides EME-Encryption and -Decryption functions that are more
 // convenient than calling Transform directly.
 type EMECipher struct {
 	bc cipher.Block
+	// usage - the usage counters, nil if not counting
+	usage *usageCounter
+	// metrics - where operations are reported, or nil
+	metrics MetricsSink
 }
 
+// TweakableBlockCipher is a wide-block cipher that encrypts a whole message
+// of up to 2048 bytes as one block under a 16-byte tweak. EMECipher
+// implements it; package emetest checks other implementations.
+type TweakableBlockCipher interface {
+	Encrypt(tweak []byte, inputData []byte) []byte
+	Decrypt(tweak []byte, inputData []byte) []byte
+}
+
+var _ TweakableBlockCipher = (*EMECipher)(nil)
+
 // New returns a new EMECipher object. "bc" must have a block size of 16,
 // or subsequent calls to Encrypt and Decrypt will panic.
 func New(bc cipher.Block) *EMECipher {
@@ -195,12 +300,54 @@ func New(bc cipher.Block) *EMECipher {
 	}
 }
 
+// NewAES128 returns an EMECipher with AES-128 under "key", which must be 16
+// bytes long.
+func NewAES128(key []byte) (*EMECipher, error) {
+	return newAES(key, 16)
+}
+
+// NewAES192 returns an EMECipher with AES-192 under "key", which must be 24
+// bytes long.
+func NewAES192(key []byte) (*EMECipher, error) {
+	return newAES(key, 24)
+}
+
+// NewAES256 returns an EMECipher with AES-256 under "key", which must be 32
+// bytes long.
+func NewAES256(key []byte) (*EMECipher, error) {
+	return newAES(key, 32)
+}
+
+// newAES - New with AES under "key", which must be "size" bytes long. The
+// size is checked here because aes.NewCipher would accept any AES key size.
+func newAES(key []byte, size int) (*EMECipher, error) {
+	if len(key) != size {
+		return nil, fmt.Errorf("eme: AES-%d key must be %d bytes long, is %d", size*8, size, len(key))
+	}
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return New(bc), nil
+}
+
 // Encrypt is equivalent to calling Transform with direction=DirectionEncrypt.
 func (e *EMECipher) Encrypt(tweak []byte, inputData []byte) []byte {
-	return Transform(e.bc, tweak, inputData, DirectionEncrypt)
+	return e.transform(tweak, inputData, DirectionEncrypt)
 }
 
 // Decrypt is equivalent to calling Transform with direction=DirectionDecrypt.
 func (e *EMECipher) Decrypt(tweak []byte, inputData []byte) []byte {
-	return Transform(e.bc, tweak, inputData, DirectionDecrypt)
+	return e.transform(tweak, inputData, DirectionDecrypt)
+}
+
+// transform - Transform, with usage counting and metrics if enabled
+func (e *EMECipher) transform(tweak []byte, inputData []byte, direction directionConst) []byte {
+	if e.metrics != nil {
+		return e.observe(tweak, inputData, direction)
+	}
+	if e.usage != nil {
+		e.usage.count(len(inputData))
+	}
+	return Transform(e.bc, tweak, inputData, direction)
 }
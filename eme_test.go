@@ -88,3 +88,34 @@ c4dfd3cd4fab2dad812d88d02690f606b52dcfb0ab220dc65a7dee6f31e951324a1c442adfe9cf67
 323d09e4256b7e5ac`)
 	verifyTestVec(v, t)
 }
+
+func TestNewAES(t *testing.T) {
+	e, err := NewAES256(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := e.Encrypt(make([]byte, 16), make([]byte, 16))
+	if want := unhex("f1b9ce8ca15a4ba9fb476905434b9fd3"); string(out) != string(want) {
+		t.Errorf("got %x, want %x", out, want)
+	}
+	for _, tc := range []struct {
+		f    func([]byte) (*EMECipher, error)
+		size int
+	}{
+		{NewAES128, 16},
+		{NewAES192, 24},
+		{NewAES256, 32},
+	} {
+		if _, err := tc.f(make([]byte, tc.size)); err != nil {
+			t.Errorf("%d-byte key: %v", tc.size, err)
+		}
+		for _, bad := range []int{0, 16, 24, 32} {
+			if bad == tc.size {
+				continue
+			}
+			if _, err := tc.f(make([]byte, bad)); err == nil {
+				t.Errorf("%d-byte constructor accepts a %d-byte key", tc.size, bad)
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package emekeys derives the keys used with package github.com/rfjakob/eme
+// from one master key, so that applications do not need their own
+// derivation scheme.
+//
+// Keys are derived with HKDF-SHA256 (RFC 5869) as
+//
+//	PRK = HKDF-Extract(salt = "github.com/rfjakob/eme/emekeys v1", master)
+//	key = HKDF-Expand(PRK, label || 0x00 || context, 32)
+//
+// with the labels "eme aes-256" for the encryption key and "eme hmac-sha256"
+// for the MAC key. Different contexts give independent keys, so one master
+// key can serve several containers, tables or tenants. Per-object keys (see
+// DeriveObjectCipher) use the label "eme object aes-256" with the object ID
+// as context.
+package emekeys
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/rfjakob/eme"
+)
+
+// MinMasterKeySize is the shortest master key DeriveKeys accepts.
+const MinMasterKeySize = 16
+
+// KeySize is the length of the derived keys.
+const KeySize = 32
+
+// Labels of the derived keys, see the package documentation
+const (
+	salt     = "github.com/rfjakob/eme/emekeys v1"
+	labelAES = "eme aes-256"
+	labelMAC = "eme hmac-sha256"
+)
+
+// Keys are the keys derived for one context.
+type Keys struct {
+	// AES is the AES-256 key for EME
+	AES []byte
+	// MAC is the HMAC-SHA256 key of the authenticated modes, which take it
+	// in front of the AES key (see eme.JWEContentCipher)
+	MAC []byte
+}
+
+// DeriveKeys derives the keys for "context" from "master", which must be at
+// least MinMasterKeySize bytes of secret random data, not a passphrase.
+func DeriveKeys(master []byte, context string) (*Keys, error) {
+	if len(master) < MinMasterKeySize {
+		return nil, fmt.Errorf("emekeys: master key must be at least %d bytes long, is %d", MinMasterKeySize, len(master))
+	}
+	prk, err := hkdf.Extract(sha256.New, master, []byte(salt))
+	if err != nil {
+		return nil, err
+	}
+	defer clear(prk)
+	k := &Keys{}
+	if k.AES, err = hkdf.Expand(sha256.New, prk, labelAES+"\x00"+context, KeySize); err != nil {
+		return nil, err
+	}
+	if k.MAC, err = hkdf.Expand(sha256.New, prk, labelMAC+"\x00"+context, KeySize); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Block returns AES-256 under the AES key.
+func (k *Keys) Block() cipher.Block {
+	bc, err := aes.NewCipher(k.AES)
+	if err != nil {
+		// Only happens if the key was modified
+		panic(err)
+	}
+	return bc
+}
+
+// Cipher returns an EMECipher under the AES key.
+func (k *Keys) Cipher() *eme.EMECipher {
+	return eme.New(k.Block())
+}
+
+// Authenticated returns the MAC key followed by the AES key, the key layout
+// of eme.JWEContentCipher.
+func (k *Keys) Authenticated() []byte {
+	return append(append(make([]byte, 0, 2*KeySize), k.MAC...), k.AES...)
+}
+
+// String prints the key sizes only, so that the keys cannot leak through %v.
+func (k Keys) String() string {
+	return fmt.Sprintf("emekeys.Keys{AES: %d bytes, MAC: %d bytes}", len(k.AES), len(k.MAC))
+}
+
+// GoString is String.
+func (k Keys) GoString() string {
+	return k.String()
+}
+
+// Wipe zeroes the keys. Ciphers created from them stay usable.
+func (k *Keys) Wipe() {
+	clear(k.AES)
+	clear(k.MAC)
+}
@@ -0,0 +1,66 @@
+package emekeys
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/rfjakob/eme"
+)
+
+// TestDeriveKeysVector pins the derivation; the values were computed with
+// an independent HKDF implementation
+func TestDeriveKeysVector(t *testing.T) {
+	master := make([]byte, 32)
+	for i := range master {
+		master[i] = byte(i)
+	}
+	k, err := DeriveKeys(master, "containers/disk0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(k.AES); got != "dc23f151c3098f4173aba401bee5d30d2d81571ca780786c3ec5a23b9bf92ad4" {
+		t.Errorf("AES key %s", got)
+	}
+	if got := hex.EncodeToString(k.MAC); got != "e7cf8412f1ed782ee672dadf85e44b1aff8a85eb2aece8d750ba4ead23ded5ec" {
+		t.Errorf("MAC key %s", got)
+	}
+	if a := k.Authenticated(); !bytes.Equal(a[:32], k.MAC) || !bytes.Equal(a[32:], k.AES) {
+		t.Errorf("bad authenticated key layout")
+	}
+}
+
+func TestDeriveKeysContexts(t *testing.T) {
+	master := bytes.Repeat([]byte{9}, 16)
+	a, _ := DeriveKeys(master, "a")
+	b, _ := DeriveKeys(master, "b")
+	if bytes.Equal(a.AES, b.AES) || bytes.Equal(a.MAC, b.MAC) || bytes.Equal(a.AES, a.MAC) {
+		t.Errorf("keys are not independent")
+	}
+	tweak := make([]byte, 16)
+	in := make([]byte, 64)
+	ct := a.Cipher().Encrypt(tweak, in)
+	a.Wipe()
+	if !bytes.Equal(a.AES, make([]byte, 32)) {
+		t.Errorf("Wipe left key material")
+	}
+	if bytes.Equal(ct, b.Cipher().Encrypt(tweak, in)) {
+		t.Errorf("same ciphertext under two contexts")
+	}
+	if _, err := eme.JWEEncrypt(b.Authenticated(), []byte("x")); err != nil {
+		t.Errorf("Authenticated is no JWE key: %v", err)
+	}
+	if _, err := DeriveKeys(make([]byte, 15), "a"); err == nil {
+		t.Errorf("accepted a 15-byte master key")
+	}
+}
+
+func TestKeysString(t *testing.T) {
+	k, _ := DeriveKeys(bytes.Repeat([]byte{1}, 32), "a")
+	for _, s := range []string{fmt.Sprintf("%v", k), fmt.Sprintf("%#v", *k), fmt.Sprintf("%+v", k)} {
+		if s != "emekeys.Keys{AES: 32 bytes, MAC: 32 bytes}" {
+			t.Errorf("formatted as %s", s)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package emekeys
+
+import (
+	"crypto/aes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rfjakob/eme"
+)
+
+// labelObject - the label of per-object keys, see the package documentation
+const labelObject = "eme object aes-256"
+
+// objectCacheSize - ObjectCiphers drops its cache when it grows beyond this
+const objectCacheSize = 1024
+
+// DeriveObjectCipher returns an EMECipher under a key of its own for the
+// file or object "objectID", derived from "master" like DeriveKeys. A leaked
+// object key exposes only that object. Use ObjectCiphers to derive the keys
+// of many objects.
+func DeriveObjectCipher(master []byte, objectID string) (*eme.EMECipher, error) {
+	o, err := NewObjectCiphers(master)
+	if err != nil {
+		return nil, err
+	}
+	defer o.Wipe()
+	return o.Cipher(objectID)
+}
+
+// ObjectCiphers derives per-object ciphers like DeriveObjectCipher, but runs
+// HKDF-Extract only once and caches the ciphers of recently used objects.
+// It is safe for concurrent use.
+type ObjectCiphers struct {
+	mu    sync.Mutex
+	prk   []byte
+	cache map[string]*eme.EMECipher
+}
+
+// NewObjectCiphers returns the ObjectCiphers of "master", which must be at
+// least MinMasterKeySize bytes of secret random data.
+func NewObjectCiphers(master []byte) (*ObjectCiphers, error) {
+	if len(master) < MinMasterKeySize {
+		return nil, fmt.Errorf("emekeys: master key must be at least %d bytes long, is %d", MinMasterKeySize, len(master))
+	}
+	prk, err := hkdf.Extract(sha256.New, master, []byte(salt))
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectCiphers{prk: prk, cache: make(map[string]*eme.EMECipher)}, nil
+}
+
+// Cipher returns the EMECipher of "objectID".
+func (o *ObjectCiphers) Cipher(objectID string) (*eme.EMECipher, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if c, ok := o.cache[objectID]; ok {
+		return c, nil
+	}
+	if o.prk == nil {
+		return nil, errors.New("emekeys: ObjectCiphers was wiped")
+	}
+	key, err := hkdf.Expand(sha256.New, o.prk, labelObject+"\x00"+objectID, KeySize)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c := eme.New(bc)
+	if len(o.cache) >= objectCacheSize {
+		o.cache = make(map[string]*eme.EMECipher)
+	}
+	o.cache[objectID] = c
+	return c, nil
+}
+
+// String prints the number of cached ciphers only.
+func (o *ObjectCiphers) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return fmt.Sprintf("emekeys.ObjectCiphers{cached: %d}", len(o.cache))
+}
+
+// GoString is String.
+func (o *ObjectCiphers) GoString() string {
+	return o.String()
+}
+
+// Forget drops the cached cipher of "objectID", for use once the object was
+// deleted.
+func (o *ObjectCiphers) Forget(objectID string) {
+	o.mu.Lock()
+	delete(o.cache, objectID)
+	o.mu.Unlock()
+}
+
+// Wipe zeroes the extracted key and empties the cache. Ciphers returned
+// before stay usable; Cipher fails afterwards.
+func (o *ObjectCiphers) Wipe() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	clear(o.prk)
+	o.prk = nil
+	o.cache = make(map[string]*eme.EMECipher)
+}
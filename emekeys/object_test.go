@@ -0,0 +1,43 @@
+package emekeys
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestObjectCiphers(t *testing.T) {
+	master := bytes.Repeat([]byte{3}, 32)
+	o, err := NewObjectCiphers(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := o.Cipher("a")
+	if a2, _ := o.Cipher("a"); a2 != a {
+		t.Errorf("cipher of %q was not cached", "a")
+	}
+	b, _ := o.Cipher("b")
+	d, err := DeriveObjectCipher(master, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := make([]byte, 16)
+	in := make([]byte, 64)
+	ct := a.Encrypt(tweak, in)
+	if !bytes.Equal(ct, d.Encrypt(tweak, in)) {
+		t.Errorf("DeriveObjectCipher and ObjectCiphers disagree")
+	}
+	if bytes.Equal(ct, b.Encrypt(tweak, in)) {
+		t.Errorf("same ciphertext for two objects")
+	}
+	k, _ := DeriveKeys(master, "a")
+	if bytes.Equal(ct, k.Cipher().Encrypt(tweak, in)) {
+		t.Errorf("object key equals the DeriveKeys key of the same context")
+	}
+	o.Wipe()
+	if _, err = o.Cipher("a"); err == nil {
+		t.Errorf("Cipher works after Wipe")
+	}
+	if _, err = NewObjectCiphers(make([]byte, 15)); err == nil {
+		t.Errorf("accepted a 15-byte master key")
+	}
+}
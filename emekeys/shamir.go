@@ -0,0 +1,106 @@
+package emekeys
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// MaxShares is the most shares Split creates, one per non-zero element of
+// GF(2^8).
+const MaxShares = 255
+
+// Split divides "secret", usually a master key, into "n" shares of which
+// any "k" recover it with Combine, while fewer reveal nothing about it.
+// This is Shamir's secret sharing over GF(2^8), one random polynomial of
+// degree k-1 per byte of the secret. A share is its x coordinate (1 to n)
+// followed by len(secret) bytes; shares must be stored and handed out
+// whole.
+func Split(secret []byte, n int, k int) ([][]byte, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("emekeys: empty secret")
+	}
+	if k < 2 || k > n || n > MaxShares {
+		return nil, fmt.Errorf("emekeys: invalid threshold %d of %d shares", k, n)
+	}
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, 1+len(secret))
+		shares[i][0] = byte(i + 1)
+	}
+	// coef[0] is the secret byte, coef[1:] random
+	coef := make([]byte, k)
+	defer clear(coef)
+	for j, s := range secret {
+		if _, err := rand.Read(coef[1:]); err != nil {
+			return nil, err
+		}
+		coef[0] = s
+		for _, sh := range shares {
+			// Horner's rule
+			var y byte
+			for c := k - 1; c >= 0; c-- {
+				y = gfMul(y, sh[0]) ^ coef[c]
+			}
+			sh[1+j] = y
+		}
+	}
+	return shares, nil
+}
+
+// Combine recovers the secret from shares created by Split. It needs at
+// least the threshold number of them; with fewer it returns a wrong secret
+// that cannot be told apart from the right one, so the result should be
+// checked, for example by opening the container it belongs to.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("emekeys: at least 2 shares are needed")
+	}
+	size := len(shares[0])
+	seen := map[byte]bool{}
+	for _, sh := range shares {
+		if len(sh) != size || size < 2 {
+			return nil, errors.New("emekeys: shares have different or invalid lengths")
+		}
+		if sh[0] == 0 || seen[sh[0]] {
+			return nil, fmt.Errorf("emekeys: invalid or duplicate share number %d", sh[0])
+		}
+		seen[sh[0]] = true
+	}
+	// Lagrange interpolation at x = 0: secret = sum of y_i * l_i(0), with
+	// l_i(0) = prod x_m / (x_m - x_i) over m != i; subtraction is XOR
+	secret := make([]byte, size-1)
+	for i, si := range shares {
+		l := byte(1)
+		for m, sm := range shares {
+			if m != i {
+				l = gfMul(l, gfMul(sm[0], gfInv(sm[0]^si[0])))
+			}
+		}
+		for j := range secret {
+			secret[j] ^= gfMul(si[1+j], l)
+		}
+	}
+	return secret, nil
+}
+
+// gfMul - multiplication in GF(2^8) with the AES polynomial, without
+// secret-dependent branches or table lookups
+func gfMul(a byte, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = a<<1 ^ -(a>>7)&0x1b
+		b >>= 1
+	}
+	return p
+}
+
+// gfInv - the multiplicative inverse, a^254; gfInv(0) is 0
+func gfInv(a byte) byte {
+	r := a
+	for i := 0; i < 6; i++ {
+		r = gfMul(gfMul(r, r), a)
+	}
+	return gfMul(r, r)
+}
@@ -0,0 +1,59 @@
+package emekeys
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGF(t *testing.T) {
+	// FIPS 197, section 4.2
+	if gfMul(0x57, 0x83) != 0xc1 {
+		t.Errorf("gfMul(0x57, 0x83) = %#x", gfMul(0x57, 0x83))
+	}
+	for a := 1; a < 256; a++ {
+		if gfMul(byte(a), gfInv(byte(a))) != 1 {
+			t.Fatalf("no inverse for %#x", a)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := bytes.Repeat([]byte{0xa5, 0x00, 0xff, 0x3c}, 8)
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var sub [][]byte
+		for _, i := range set {
+			sub = append(sub, shares[i])
+		}
+		got, err := Combine(sub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("shares %v: wrong secret", set)
+		}
+	}
+	if got, _ := Combine(shares[:2]); bytes.Equal(got, secret) {
+		t.Errorf("2 of 3 shares recovered the secret")
+	}
+	if _, err = Combine([][]byte{shares[0], shares[0]}); err == nil {
+		t.Errorf("duplicate shares were accepted")
+	}
+	if _, err = Combine([][]byte{shares[0], shares[1][:5]}); err == nil {
+		t.Errorf("truncated share was accepted")
+	}
+}
+
+func TestSplitParams(t *testing.T) {
+	for _, p := range [][2]int{{3, 1}, {2, 3}, {256, 2}} {
+		if _, err := Split([]byte{1}, p[0], p[1]); err == nil {
+			t.Errorf("n=%d k=%d was accepted", p[0], p[1])
+		}
+	}
+	if _, err := Split(nil, 3, 2); err == nil {
+		t.Errorf("empty secret was accepted")
+	}
+}
@@ -0,0 +1,198 @@
+// Package emetest checks implementations of eme.TweakableBlockCipher.
+//
+// The RoundTrip checks are properties every tweakable wide-block cipher must
+// have, so they apply to EMECipher as well as to other modes and to
+// third-party implementations:
+//
+//	func TestRoundTrip(t *testing.T) {
+//		emetest.RoundTrip(t, func(key []byte) eme.TweakableBlockCipher {
+//			bc, err := aes.NewCipher(key)
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return eme.New(bc)
+//		})
+//	}
+//
+// Stress checks EME implementations under concurrent use, and
+// ExpectParamError checks the panics package eme raises for invalid
+// parameters.
+package emetest
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/internal/refimpl"
+)
+
+// KeySize is the length of the keys passed to the cipher factory.
+const KeySize = 32
+
+// Factory returns a cipher for a random KeySize-byte key.
+type Factory func(key []byte) eme.TweakableBlockCipher
+
+// keysPerRun - distinct keys tried by RoundTripSizes
+const keysPerRun = 3
+
+// RoundTrip checks every message length EME supports, all multiples of 16
+// from 16 to 2048 bytes. See RoundTripSizes.
+func RoundTrip(t testing.TB, newCipher Factory) {
+	t.Helper()
+	var sizes []int
+	for n := 16; n <= 2048; n += 16 {
+		sizes = append(sizes, n)
+	}
+	RoundTripSizes(t, newCipher, sizes)
+}
+
+// RoundTripSizes checks, for several keys and tweaks and for every message
+// length in "sizes", that
+//
+//   - Decrypt(Encrypt(x)) == x and the ciphertext has the length of x
+//   - Encrypt is deterministic and does not modify its input
+//   - the ciphertext differs from the plaintext and depends on the tweak
+//   - changing the last plaintext byte changes the first ciphertext block,
+//     and changing the last ciphertext byte changes the first plaintext
+//     block, as it must for a wide-block cipher
+//
+// The inputs are pseudo-random but the same on every run. It reports the
+// first failure for each size and continues with the next size.
+func RoundTripSizes(t testing.TB, newCipher Factory, sizes []int) {
+	t.Helper()
+	rng := rand.New(rand.NewChaCha8([32]byte{'e', 'm', 'e', 't', 'e', 's', 't'}))
+	for k := 0; k < keysPerRun; k++ {
+		key := randBytes(rng, KeySize)
+		c := newCipher(key)
+		tweaks := [][]byte{make([]byte, 16), bytes.Repeat([]byte{0xff}, 16), randBytes(rng, 16)}
+		for _, n := range sizes {
+			for _, tweak := range tweaks {
+				if msg := check(c, tweak, randBytes(rng, n)); msg != "" {
+					t.Errorf("key %x, tweak %x, %d bytes: %s", key, tweak, n, msg)
+					break
+				}
+			}
+		}
+	}
+}
+
+// check - one message through all properties, "" if they hold
+func check(c eme.TweakableBlockCipher, tweak []byte, plain []byte) string {
+	orig := bytes.Clone(plain)
+	ct := c.Encrypt(tweak, plain)
+	switch {
+	case !bytes.Equal(plain, orig):
+		return "Encrypt modified its input"
+	case len(ct) != len(plain):
+		return "ciphertext has a different length"
+	case bytes.Equal(ct, plain):
+		return "ciphertext equals plaintext"
+	case !bytes.Equal(c.Encrypt(tweak, plain), ct):
+		return "Encrypt is not deterministic"
+	}
+	ctCopy := bytes.Clone(ct)
+	if !bytes.Equal(c.Decrypt(tweak, ct), plain) {
+		return "Decrypt(Encrypt(x)) != x"
+	}
+	if !bytes.Equal(ct, ctCopy) {
+		return "Decrypt modified its input"
+	}
+	other := bytes.Clone(tweak)
+	other[0] ^= 1
+	if bytes.Equal(c.Encrypt(other, plain), ct) {
+		return "ciphertext does not depend on the tweak"
+	}
+	flipped := bytes.Clone(plain)
+	flipped[len(flipped)-1] ^= 1
+	if bytes.Equal(c.Encrypt(tweak, flipped)[:16], ct[:16]) {
+		return "last plaintext byte does not affect the first ciphertext block"
+	}
+	flipped = bytes.Clone(ct)
+	flipped[len(flipped)-1] ^= 1
+	if bytes.Equal(c.Decrypt(tweak, flipped)[:16], plain[:16]) {
+		return "last ciphertext byte does not affect the first plaintext block"
+	}
+	return ""
+}
+
+func randBytes(rng *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.Uint32())
+	}
+	return b
+}
+
+// stressIterations - operations per goroutine in Stress
+const stressIterations = 500
+
+// Stress uses "c" from "goroutines" goroutines at once, with random tweaks
+// and message lengths, and checks every result against the reference
+// implementation of EME with block cipher "bc", which must be the one "c"
+// was created with. All goroutines read their inputs from one shared buffer,
+// so running the test with -race also reports implementations that write to
+// their input or share scratch space between calls.
+func Stress(t testing.TB, c eme.TweakableBlockCipher, bc cipher.Block, goroutines int) {
+	t.Helper()
+	seed := rand.New(rand.NewPCG(1, 1))
+	shared := randBytes(seed, 2048+16)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(rng *rand.Rand) {
+			defer wg.Done()
+			for i := 0; i < stressIterations; i++ {
+				off := rng.IntN(len(shared) - 16)
+				tweak := shared[off : off+16]
+				n := 16 * (1 + rng.IntN(128))
+				off = 16 * rng.IntN((len(shared)-n)/16+1)
+				in := shared[off : off+n]
+				if got, want := c.Encrypt(tweak, in), refimpl.Encrypt(bc, tweak, in); !bytes.Equal(got, want) {
+					t.Errorf("Encrypt differs from the reference (tweak %x, %d bytes at offset %d)", tweak, n, off)
+					return
+				}
+				if got, want := c.Decrypt(tweak, in), refimpl.Decrypt(bc, tweak, in); !bytes.Equal(got, want) {
+					t.Errorf("Decrypt differs from the reference (tweak %x, %d bytes at offset %d)", tweak, n, off)
+					return
+				}
+			}
+		}(rand.New(rand.NewPCG(seed.Uint64(), uint64(g))))
+	}
+	wg.Wait()
+}
+
+// ExpectParamError checks that "f" panics with an *eme.ParamError of kind
+// "want", like eme.ErrTweakSize.
+func ExpectParamError(t testing.TB, want error, f func()) {
+	t.Helper()
+	if err := catch(f); err == nil {
+		t.Errorf("no panic, want %v", want)
+	} else if !errors.Is(err, want) {
+		t.Errorf("panic %v, want %v", err, want)
+	}
+}
+
+// catch - the *eme.ParamError "f" panics with, nil if it does not panic.
+// Other panic values are returned wrapped in an error that is not a
+// ParamError.
+func catch(f func()) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if pe, ok := r.(*eme.ParamError); ok {
+			err = pe
+			return
+		}
+		err = fmt.Errorf("panic value is not a *eme.ParamError: %v", r)
+	}()
+	f()
+	return nil
+}
@@ -0,0 +1,102 @@
+package emetest_test
+
+import (
+	"crypto/aes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emetest"
+)
+
+func newEME(t testing.TB) emetest.Factory {
+	return func(key []byte) eme.TweakableBlockCipher {
+		bc, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return eme.New(bc)
+	}
+}
+
+func TestRoundTripEME(t *testing.T) {
+	emetest.RoundTrip(t, newEME(t))
+}
+
+// recorder - a testing.TB that collects errors instead of failing
+type recorder struct {
+	testing.TB
+	mu   sync.Mutex
+	errs []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+// narrowCipher - encrypts every 16-byte block on its own, which is not a
+// wide-block cipher
+type narrowCipher struct {
+	e *eme.EMECipher
+}
+
+func (c narrowCipher) Encrypt(tweak []byte, in []byte) []byte {
+	out := make([]byte, 0, len(in))
+	for i := 0; i < len(in); i += 16 {
+		out = append(out, c.e.Encrypt(tweak, in[i:i+16])...)
+	}
+	return out
+}
+
+func (c narrowCipher) Decrypt(tweak []byte, in []byte) []byte {
+	out := make([]byte, 0, len(in))
+	for i := 0; i < len(in); i += 16 {
+		out = append(out, c.e.Decrypt(tweak, in[i:i+16])...)
+	}
+	return out
+}
+
+func TestRoundTripDetectsNarrowCipher(t *testing.T) {
+	r := &recorder{TB: t}
+	emetest.RoundTripSizes(r, func(key []byte) eme.TweakableBlockCipher {
+		return narrowCipher{newEME(t)(key).(*eme.EMECipher)}
+	}, []int{16, 32, 2048})
+	// 16 bytes is a single block and passes; 32 and 2048 fail for every key
+	if len(r.errs) != 2*3 {
+		t.Errorf("got %d errors, want 6: %q", len(r.errs), r.errs)
+	}
+}
+
+func TestStressEME(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	emetest.Stress(t, eme.New(bc), bc, 8)
+}
+
+func TestStressDetectsWrongCipher(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	other, _ := aes.NewCipher(make([]byte, 16))
+	r := &recorder{TB: t}
+	emetest.Stress(r, eme.New(other), bc, 2)
+	if len(r.errs) != 2 {
+		t.Errorf("got %d errors, want one per goroutine: %q", len(r.errs), r.errs)
+	}
+}
+
+func TestExpectParamError(t *testing.T) {
+	r := &recorder{TB: t}
+	emetest.ExpectParamError(r, eme.ErrTweakSize, func() {})
+	emetest.ExpectParamError(r, eme.ErrTweakSize, func() { panic("not a ParamError") })
+	emetest.ExpectParamError(r, eme.ErrTweakSize, func() { panic(&eme.ParamError{Err: eme.ErrDataSize}) })
+	if len(r.errs) != 3 {
+		t.Errorf("got %d errors, want 3: %q", len(r.errs), r.errs)
+	}
+	emetest.ExpectParamError(t, eme.ErrTweakSize, func() { panic(&eme.ParamError{Err: eme.ErrTweakSize}) })
+}
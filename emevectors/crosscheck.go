@@ -0,0 +1,194 @@
+package emevectors
+
+import (
+	"bufio"
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/rfjakob/eme"
+)
+
+// MaxDivergences is the number of divergences a Report keeps in full.
+// Further ones are only counted.
+const MaxDivergences = 100
+
+// Divergence is a case where the implementation under test disagreed with
+// package eme, or failed.
+type Divergence struct {
+	Case    int
+	Decrypt bool
+	Key     []byte
+	Tweak   []byte
+	In      []byte
+	// Want is the result of package eme
+	Want []byte
+	// Got is the result of the implementation, nil if it failed
+	Got []byte
+	// Err is the error or panic of the implementation
+	Err string
+}
+
+// jsonDivergence - the JSON form of a Divergence
+type jsonDivergence struct {
+	Case    int      `json:"case"`
+	Decrypt bool     `json:"decrypt,omitempty"`
+	Key     hexBytes `json:"key"`
+	Tweak   hexBytes `json:"tweak"`
+	In      hexBytes `json:"input"`
+	Want    hexBytes `json:"want"`
+	Got     hexBytes `json:"got,omitempty"`
+	Err     string   `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the divergence with hex-encoded byte strings.
+func (d Divergence) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDivergence{d.Case, d.Decrypt, d.Key, d.Tweak, d.In, d.Want, d.Got, d.Err})
+}
+
+// UnmarshalJSON reverses MarshalJSON.
+func (d *Divergence) UnmarshalJSON(b []byte) error {
+	var j jsonDivergence
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*d = Divergence{j.Case, j.Decrypt, j.Key, j.Tweak, j.In, j.Want, j.Got, j.Err}
+	return nil
+}
+
+// Report is the outcome of CrossCheck.
+type Report struct {
+	Seed  uint64 `json:"seed"`
+	Cases int    `json:"cases"`
+	// Failures counts all divergences, Divergences holds the first
+	// MaxDivergences of them
+	Failures    int          `json:"failures"`
+	Divergences []Divergence `json:"divergences"`
+	// BySize counts the divergences per input length
+	BySize map[int]int `json:"bySize"`
+}
+
+// String summarizes the report in one line.
+func (r *Report) String() string {
+	if r.Failures == 0 {
+		return fmt.Sprintf("seed %d: %d cases, no divergences", r.Seed, r.Cases)
+	}
+	sizes := make([]int, 0, len(r.BySize))
+	for n := range r.BySize {
+		sizes = append(sizes, n)
+	}
+	sort.Ints(sizes)
+	return fmt.Sprintf("seed %d: %d cases, %d divergences at %d input lengths from %d to %d bytes",
+		r.Seed, r.Cases, r.Failures, len(sizes), sizes[0], sizes[len(sizes)-1])
+}
+
+// CrossCheck runs "cases" random transformations through "impl" and compares
+// the results with package eme. The cases are drawn from the byte stream of
+// "seed" (see Generate), so the same seed reproduces a report. They cover
+// all AES key sizes, both directions and every length from 16 to 2048
+// bytes; one case in eight uses one of the extreme lengths 16 and 2048.
+func CrossCheck(impl Impl, seed uint64, cases int) *Report {
+	s := &seedStream{seed: seed}
+	r := &Report{Seed: seed, Cases: cases, BySize: map[int]int{}}
+	for i := 0; i < cases; i++ {
+		ctl := s.bytes(4)
+		c := EdgeCase{
+			Decrypt: ctl[0]&1 == 1,
+			Key:     s.bytes([]int{16, 24, 32}[int(ctl[1])%3]),
+			Tweak:   s.bytes(16),
+		}
+		m := 1 + int(binary.BigEndian.Uint16(ctl[2:]))%128
+		if ctl[0]&0xe == 0 {
+			m = []int{1, 128}[ctl[0]>>4&1]
+		}
+		c.In = s.bytes(16 * m)
+		bc, _ := aes.NewCipher(c.Key)
+		dir := eme.DirectionEncrypt
+		if c.Decrypt {
+			dir = eme.DirectionDecrypt
+		}
+		want := eme.Transform(bc, c.Tweak, c.In, dir)
+		got, err := callImpl(impl, c)
+		if err == nil && hex.EncodeToString(got) == hex.EncodeToString(want) {
+			continue
+		}
+		r.Failures++
+		r.BySize[len(c.In)]++
+		if len(r.Divergences) == MaxDivergences {
+			continue
+		}
+		d := Divergence{Case: i, Decrypt: c.Decrypt, Key: c.Key, Tweak: c.Tweak, In: c.In, Want: want, Got: got}
+		if err != nil {
+			d.Got, d.Err = nil, err.Error()
+		}
+		r.Divergences = append(r.Divergences, d)
+	}
+	return r
+}
+
+// Command is an external EME implementation, run as a process that answers
+// every line
+//
+//	enc|dec KEY TWEAK DATA
+//
+// on standard input with one line on standard output: the hex-encoded
+// result, or "error" followed by a message if it rejects the input. KEY,
+// TWEAK and DATA are hex-encoded. Wrapping another implementation in such a
+// process takes a few lines in most languages; implementations that can be
+// linked are better wrapped in an Impl directly.
+type Command struct {
+	cmd *exec.Cmd
+	in  io.WriteCloser
+	out *bufio.Reader
+}
+
+// StartCommand starts "command" through the shell.
+func StartCommand(command string) (*Command, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &Command{cmd: cmd, in: in, out: bufio.NewReader(out)}, nil
+}
+
+// Transform runs one case through the command. Its method value is an Impl.
+func (c *Command) Transform(key, tweak, in []byte, decrypt bool) ([]byte, error) {
+	op := "enc"
+	if decrypt {
+		op = "dec"
+	}
+	if _, err := fmt.Fprintf(c.in, "%s %x %x %x\n", op, key, tweak, in); err != nil {
+		return nil, err
+	}
+	line, err := c.out.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading from external implementation: %w", err)
+	}
+	line = strings.TrimSpace(line)
+	if msg, ok := strings.CutPrefix(line, "error"); ok {
+		return nil, fmt.Errorf("external implementation: %s", strings.TrimSpace(msg))
+	}
+	return hex.DecodeString(line)
+}
+
+// Close ends the input of the command and waits for it to exit.
+func (c *Command) Close() error {
+	c.in.Close()
+	return c.cmd.Wait()
+}
@@ -0,0 +1,124 @@
+package emevectors_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emevectors"
+)
+
+// emeImpl - package eme as an Impl
+func emeImpl(key, tweak, in []byte, decrypt bool) ([]byte, error) {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	dir := eme.DirectionEncrypt
+	if decrypt {
+		dir = eme.DirectionDecrypt
+	}
+	return eme.Transform(bc, tweak, in, dir), nil
+}
+
+func TestCrossCheck(t *testing.T) {
+	r := emevectors.CrossCheck(emeImpl, 7, 500)
+	if r.Failures != 0 || len(r.Divergences) != 0 {
+		t.Errorf("divergences against eme itself: %v", r)
+	}
+
+	// An implementation that is wrong for long inputs and rejects 16-byte ones
+	var sizes = map[int]bool{}
+	bad := func(key, tweak, in []byte, decrypt bool) ([]byte, error) {
+		sizes[len(in)] = true
+		if len(in) == 16 {
+			return nil, errors.New("rejected")
+		}
+		out, _ := emeImpl(key, tweak, in, decrypt)
+		if len(in) > 1024 {
+			out[0] ^= 1
+		}
+		return out, nil
+	}
+	r = emevectors.CrossCheck(bad, 7, 500)
+	if r.Failures == 0 || r.BySize[16] == 0 || r.BySize[2048] == 0 || r.BySize[512] != 0 {
+		t.Errorf("bad report %v", r)
+	}
+	if !sizes[16] || !sizes[2048] || len(sizes) < 50 {
+		t.Errorf("poor size coverage: %d sizes", len(sizes))
+	}
+	for _, d := range r.Divergences {
+		if want, _ := emeImpl(d.Key, d.Tweak, d.In, d.Decrypt); !bytes.Equal(d.Want, want) {
+			t.Errorf("case %d: bad Want", d.Case)
+		}
+	}
+	if again := emevectors.CrossCheck(bad, 7, 500); !reflect.DeepEqual(again, r) {
+		t.Errorf("the same seed gave a different report")
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back emevectors.Report
+	if err = json.Unmarshal(b, &back); err != nil || !reflect.DeepEqual(&back, r) {
+		t.Errorf("JSON round trip failed: %v", err)
+	}
+}
+
+// The test binary doubles as the external implementation for TestCommand
+func TestMain(m *testing.M) {
+	if os.Getenv("EMEVECTORS_TEST_COMMAND") == "1" {
+		serveCommand()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestCommand(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := emevectors.StartCommand("EMEVECTORS_TEST_COMMAND=1 " + filepath.Clean(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := emevectors.CrossCheck(c.Transform, 3, 50)
+	if _, err = c.Transform(make([]byte, 32), make([]byte, 16), make([]byte, 17), false); err == nil {
+		t.Errorf("bad length accepted")
+	}
+	if err = c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Failures != 0 {
+		t.Errorf("divergences: %v", r)
+	}
+}
+
+// serveCommand - answer the Command protocol with eme.Transform
+func serveCommand() {
+	in := bufio.NewScanner(os.Stdin)
+	in.Buffer(nil, 1<<20)
+	for in.Scan() {
+		var op string
+		var key, tweak, data []byte
+		if _, err := fmt.Sscanf(in.Text(), "%s %x %x %x", &op, &key, &tweak, &data); err != nil {
+			fmt.Println("error", err)
+			continue
+		}
+		if len(data)%16 != 0 {
+			fmt.Println("error bad length")
+			continue
+		}
+		out, _ := emeImpl(key, tweak, data, op == "dec")
+		fmt.Printf("%x\n", out)
+	}
+}
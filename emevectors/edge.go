@@ -0,0 +1,160 @@
+package emevectors
+
+import (
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Result is the expected outcome of an edge case.
+type Result string
+
+const (
+	// ResultValid - the implementation must return Out
+	ResultValid Result = "valid"
+	// ResultInvalid - the implementation must reject the input
+	ResultInvalid Result = "invalid"
+)
+
+// Flags of the edge cases, saying what each one targets
+const (
+	FlagZeroPlaintext    = "ZeroPlaintext"
+	FlagZeroTweak        = "ZeroTweak"
+	FlagAllOnes          = "AllOnes"
+	FlagTweakEqualsBlock = "TweakEqualsBlock"
+	FlagRepeatedBlocks   = "RepeatedBlocks"
+	FlagSingleBlock      = "SingleBlock"
+	FlagMaxLength        = "MaxLength"
+	FlagShortKey         = "ShortKey"
+	FlagBadLength        = "BadLength"
+	FlagBadTweak         = "BadTweak"
+)
+
+// EdgeCase is a vector that targets one edge case of EME, in the style of
+// Project Wycheproof. For ResultInvalid cases Out is empty.
+type EdgeCase struct {
+	ID      int
+	Comment string
+	// Flags are the Flag* constants that apply
+	Flags   []string
+	Result  Result
+	Decrypt bool
+	Key     []byte
+	Tweak   []byte
+	In      []byte
+	Out     []byte
+}
+
+// jsonEdgeCase - the JSON form of an EdgeCase
+type jsonEdgeCase struct {
+	ID      int      `json:"id"`
+	Comment string   `json:"comment"`
+	Flags   []string `json:"flags"`
+	Result  Result   `json:"result"`
+	Decrypt bool     `json:"decrypt,omitempty"`
+	Key     hexBytes `json:"key"`
+	Tweak   hexBytes `json:"tweak"`
+	In      hexBytes `json:"input"`
+	Out     hexBytes `json:"output"`
+}
+
+// MarshalJSON encodes the case like Wycheproof does, with hex-encoded byte
+// strings.
+func (c EdgeCase) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonEdgeCase{c.ID, c.Comment, c.Flags, c.Result, c.Decrypt, c.Key, c.Tweak, c.In, c.Out})
+}
+
+// UnmarshalJSON reverses MarshalJSON.
+func (c *EdgeCase) UnmarshalJSON(b []byte) error {
+	var j jsonEdgeCase
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*c = EdgeCase{j.ID, j.Comment, j.Flags, j.Result, j.Decrypt, j.Key, j.Tweak, j.In, j.Out}
+	return nil
+}
+
+// edgeCasesJSON - generated by "go test -run TestEdgeCasesFile -update"
+//
+//go:embed edgecases.json
+var edgeCasesJSON []byte
+
+// EdgeCases holds all edge cases, also available as the file
+// edgecases.json in this package's directory.
+var EdgeCases = mustDecodeEdgeCases(edgeCasesJSON)
+
+// edgeCaseFile - the layout of edgecases.json
+type edgeCaseFile struct {
+	Algorithm     string            `json:"algorithm"`
+	NumberOfTests int               `json:"numberOfTests"`
+	Notes         map[string]string `json:"notes"`
+	Tests         []EdgeCase        `json:"tests"`
+}
+
+// flagNotes - what the flags mean, for the "notes" of edgecases.json
+var flagNotes = map[string]string{
+	FlagZeroPlaintext:    "the input is all zeros",
+	FlagZeroTweak:        "the tweak is all zeros",
+	FlagAllOnes:          "input and tweak are all ones, so every doubling in GF(2^128) reduces",
+	FlagTweakEqualsBlock: "the tweak equals a block of the input",
+	FlagRepeatedBlocks:   "the input consists of one block repeated",
+	FlagSingleBlock:      "the input is one block, so there is nothing to mix",
+	FlagMaxLength:        "the input has the maximum length of 128 blocks",
+	FlagShortKey:         "the key is shorter than 32 bytes",
+	FlagBadLength:        "the input is empty, not a multiple of 16 or too long",
+	FlagBadTweak:         "the tweak is not 16 bytes long",
+}
+
+func mustDecodeEdgeCases(b []byte) []EdgeCase {
+	var f edgeCaseFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		panic(err)
+	}
+	return f.Tests
+}
+
+// Impl is an implementation under test for CheckEdgeCases. It must return an
+// error, or panic, for inputs it rejects.
+type Impl func(key, tweak, in []byte, decrypt bool) ([]byte, error)
+
+// CheckEdgeCases runs all EdgeCases against "impl" and returns one error for
+// every case it got wrong.
+func CheckEdgeCases(impl Impl) []error {
+	var errs []error
+	for _, c := range EdgeCases {
+		out, err := callImpl(impl, c)
+		switch {
+		case c.Result == ResultInvalid && err == nil:
+			errs = append(errs, fmt.Errorf("edge case %d (%s): invalid input accepted", c.ID, c.Comment))
+		case c.Result == ResultValid && err != nil:
+			errs = append(errs, fmt.Errorf("edge case %d (%s): %v", c.ID, c.Comment, err))
+		case c.Result == ResultValid && hex.EncodeToString(out) != hex.EncodeToString(c.Out):
+			errs = append(errs, fmt.Errorf("edge case %d (%s): wrong result", c.ID, c.Comment))
+		}
+	}
+	return errs
+}
+
+// callImpl - run one case, turning a panic into an error
+func callImpl(impl Impl, c EdgeCase) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return impl(c.Key, c.Tweak, c.In, c.Decrypt)
+}
+
+// hexBytes - a byte slice that is hex-encoded in JSON
+type hexBytes []byte
+
+func (h hexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h)), nil
+}
+
+func (h *hexBytes) UnmarshalText(b []byte) error {
+	d, err := hex.DecodeString(string(b))
+	*h = d
+	return err
+}
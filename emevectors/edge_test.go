@@ -0,0 +1,143 @@
+package emevectors
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/internal/refimpl"
+)
+
+var update = flag.Bool("update", false, "rewrite edgecases.json")
+
+// edgeInput - a deterministic, non-repeating input of "n" bytes
+func edgeInput(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7) ^ byte(i>>8) ^ seed
+	}
+	return b
+}
+
+// generateEdgeCases - the contents of edgecases.json
+func generateEdgeCases(t *testing.T) []byte {
+	key := edgeInput(32, 0x4b)
+	zero16 := make([]byte, 16)
+	ones := func(n int) []byte { return bytes.Repeat([]byte{0xff}, n) }
+	varied := edgeInput(2048, 0x11)
+	repeated := bytes.Repeat(varied[:16], 128)
+	valid := []EdgeCase{
+		{Comment: "all-zero single block, zero tweak", Flags: []string{FlagZeroPlaintext, FlagZeroTweak, FlagSingleBlock}, Key: key, Tweak: zero16, In: make([]byte, 16)},
+		{Comment: "all-zero maximum length", Flags: []string{FlagZeroPlaintext, FlagZeroTweak, FlagMaxLength}, Key: key, Tweak: zero16, In: make([]byte, 2048)},
+		{Comment: "all ones", Flags: []string{FlagAllOnes, FlagMaxLength}, Key: ones(32), Tweak: ones(16), In: ones(2048)},
+		{Comment: "single block", Flags: []string{FlagSingleBlock}, Key: key, Tweak: varied[16:32], In: varied[:16]},
+		{Comment: "single block, decrypt", Flags: []string{FlagSingleBlock}, Decrypt: true, Key: key, Tweak: varied[16:32], In: varied[:16]},
+		{Comment: "two blocks", Key: key, Tweak: varied[32:48], In: varied[:32]},
+		{Comment: "tweak equals the first block", Flags: []string{FlagTweakEqualsBlock}, Key: key, Tweak: varied[:16], In: varied[:256]},
+		{Comment: "tweak equals the only block", Flags: []string{FlagTweakEqualsBlock, FlagSingleBlock}, Key: key, Tweak: varied[:16], In: varied[:16]},
+		{Comment: "tweak equals the last block", Flags: []string{FlagTweakEqualsBlock, FlagMaxLength}, Key: key, Tweak: varied[2032:], In: varied},
+		{Comment: "two equal blocks", Flags: []string{FlagRepeatedBlocks}, Key: key, Tweak: zero16, In: repeated[:32]},
+		{Comment: "128 equal blocks", Flags: []string{FlagRepeatedBlocks, FlagMaxLength}, Key: key, Tweak: zero16, In: repeated},
+		{Comment: "maximum length", Flags: []string{FlagMaxLength}, Key: key, Tweak: varied[100:116], In: varied},
+		{Comment: "maximum length, decrypt", Flags: []string{FlagMaxLength}, Decrypt: true, Key: key, Tweak: varied[100:116], In: varied},
+		{Comment: "one block less than the maximum", Key: key, Tweak: varied[:16], In: varied[:2032]},
+		{Comment: "AES-128", Flags: []string{FlagShortKey}, Key: key[:16], Tweak: varied[:16], In: varied[:512]},
+		{Comment: "AES-192", Flags: []string{FlagShortKey}, Key: key[:24], Tweak: varied[:16], In: varied[:512]},
+	}
+	invalid := []EdgeCase{
+		{Comment: "empty input", Flags: []string{FlagBadLength}, Key: key, Tweak: zero16, In: []byte{}},
+		{Comment: "15-byte input", Flags: []string{FlagBadLength}, Key: key, Tweak: zero16, In: varied[:15]},
+		{Comment: "17-byte input", Flags: []string{FlagBadLength}, Key: key, Tweak: zero16, In: varied[:17]},
+		{Comment: "2047-byte input", Flags: []string{FlagBadLength}, Key: key, Tweak: zero16, In: varied[:2047]},
+		{Comment: "129 blocks", Flags: []string{FlagBadLength}, Key: key, Tweak: zero16, In: append(bytes.Clone(varied), varied[:16]...)},
+		{Comment: "129 blocks, decrypt", Flags: []string{FlagBadLength}, Decrypt: true, Key: key, Tweak: zero16, In: append(bytes.Clone(varied), varied[:16]...)},
+		{Comment: "empty tweak", Flags: []string{FlagBadTweak}, Key: key, Tweak: []byte{}, In: varied[:16]},
+		{Comment: "15-byte tweak", Flags: []string{FlagBadTweak}, Key: key, Tweak: varied[:15], In: varied[:16]},
+		{Comment: "32-byte tweak", Flags: []string{FlagBadTweak}, Key: key, Tweak: varied[:32], In: varied[:16]},
+	}
+	var cases []EdgeCase
+	for _, c := range valid {
+		bc, err := aes.NewCipher(c.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Result = ResultValid
+		if c.Decrypt {
+			c.Out = eme.Transform(bc, c.Tweak, c.In, eme.DirectionDecrypt)
+			if !bytes.Equal(c.Out, refimpl.Decrypt(bc, c.Tweak, c.In)) {
+				t.Fatalf("%s: reference implementation disagrees", c.Comment)
+			}
+		} else {
+			c.Out = eme.Transform(bc, c.Tweak, c.In, eme.DirectionEncrypt)
+			if !bytes.Equal(c.Out, refimpl.Encrypt(bc, c.Tweak, c.In)) {
+				t.Fatalf("%s: reference implementation disagrees", c.Comment)
+			}
+		}
+		cases = append(cases, c)
+	}
+	for _, c := range invalid {
+		c.Result = ResultInvalid
+		c.Out = []byte{}
+		cases = append(cases, c)
+	}
+	for i := range cases {
+		cases[i].ID = i + 1
+		if cases[i].Flags == nil {
+			cases[i].Flags = []string{}
+		}
+	}
+	b, err := json.MarshalIndent(edgeCaseFile{
+		Algorithm:     Algorithm,
+		NumberOfTests: len(cases),
+		Notes:         flagNotes,
+		Tests:         cases,
+	}, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(b, '\n')
+}
+
+func TestEdgeCasesFile(t *testing.T) {
+	b := generateEdgeCases(t)
+	if *update {
+		if err := os.WriteFile("edgecases.json", b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if !bytes.Equal(b, edgeCasesJSON) {
+		t.Errorf("edgecases.json is out of date, run go test -run TestEdgeCasesFile -update")
+	}
+}
+
+// emeImpl - package eme as an Impl
+func emeImpl(key, tweak, in []byte, decrypt bool) ([]byte, error) {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	dir := eme.DirectionEncrypt
+	if decrypt {
+		dir = eme.DirectionDecrypt
+	}
+	return eme.Transform(bc, tweak, in, dir), nil
+}
+
+func TestCheckEdgeCases(t *testing.T) {
+	if len(EdgeCases) == 0 {
+		t.Fatal("no edge cases")
+	}
+	for _, err := range CheckEdgeCases(emeImpl) {
+		t.Error(err)
+	}
+	// An implementation that accepts everything fails every case
+	identity := func(key, tweak, in []byte, decrypt bool) ([]byte, error) { return in, nil }
+	if errs := CheckEdgeCases(identity); len(errs) != len(EdgeCases) {
+		t.Errorf("identity function failed %d of %d cases", len(errs), len(EdgeCases))
+	}
+}
@@ -0,0 +1,90 @@
+package emevectors_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emevectors"
+)
+
+func TestVectors(t *testing.T) {
+	for _, v := range emevectors.All {
+		bc, err := aes.NewCipher(v.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := eme.DirectionEncrypt
+		if v.Decrypt {
+			dir = eme.DirectionDecrypt
+		}
+		out := v.In
+		for i := 0; i < v.Iterations; i++ {
+			out = eme.Transform(bc, v.Tweak, out, dir)
+		}
+		if !bytes.Equal(out, v.Out) {
+			t.Errorf("vector %s failed", v.Name)
+		}
+	}
+}
+
+func TestJSONRoundtrip(t *testing.T) {
+	b, err := emevectors.Marshal(emevectors.All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := emevectors.Unmarshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, emevectors.All) {
+		t.Errorf("roundtrip changed the vectors")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	good := `"direction": "encrypt", "key": "` + strings.Repeat("00", 16) + `", "tweak": "` + strings.Repeat("00", 16) + `"`
+	for _, in := range []string{
+		`{"algorithm": "EME2-AES", "vectors": []}`,
+		`{"algorithm": "EME-AES", "vectors": [{"direction": "up"}]}`,
+		`{"algorithm": "EME-AES", "vectors": [{` + good + `, "input": "00", "output": "00"}]}`,
+		`{"algorithm": "EME-AES", "vectors": [{` + good + `, "input": "` + strings.Repeat("00", 16) + `", "output": "zz"}]}`,
+		`{"algorithm": "EME-AES", "vectors": [{` + good + `, "iterations": -1, "input": "` + strings.Repeat("00", 16) + `", "output": "` + strings.Repeat("00", 16) + `"}]}`,
+	} {
+		if _, err := emevectors.Unmarshal([]byte(in)); err == nil {
+			t.Errorf("accepted %s", in)
+		}
+	}
+	v, err := emevectors.Unmarshal([]byte(`{"algorithm": "EME-AES", "vectors": [{` + good + `, "input": "` + strings.Repeat("00", 16) + `", "output": "` + strings.Repeat("00", 16) + `"}]}`))
+	if err != nil || v[0].Iterations != 1 {
+		t.Errorf("omitted iteration count: %v, %v", v, err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	sizes := []int{16, 2048, 512}
+	vs := emevectors.Generate(7, sizes)
+	if !reflect.DeepEqual(vs, emevectors.Generate(7, sizes)) {
+		t.Fatal("Generate is not deterministic")
+	}
+	h := sha256.Sum256([]byte{0, 0, 0, 0, 0, 0, 0, 7, 0, 0, 0, 0, 0, 0, 0, 0})
+	if !bytes.Equal(vs[0].Key, h[:]) {
+		t.Errorf("first key %x, want SHA-256(seed || 0) = %x", vs[0].Key, h)
+	}
+	for i, v := range vs {
+		bc, err := aes.NewCipher(v.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(v.In) != sizes[i] || !bytes.Equal(eme.Transform(bc, v.Tweak, v.In, eme.DirectionEncrypt), v.Out) {
+			t.Errorf("vector %s is wrong", v.Name)
+		}
+	}
+	if bytes.Equal(vs[0].Key, emevectors.Generate(8, sizes)[0].Key) {
+		t.Errorf("seed is ignored")
+	}
+}
@@ -0,0 +1,184 @@
+package emevectors
+
+import (
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rfjakob/eme"
+)
+
+// Algorithm is the value of the "algorithm" member of a vector file.
+const Algorithm = "EME-AES"
+
+// vectorFile - a JSON vector file, see Marshal
+type vectorFile struct {
+	Algorithm string       `json:"algorithm"`
+	Vectors   []jsonVector `json:"vectors"`
+}
+
+// jsonVector - the JSON form of a Vector
+type jsonVector struct {
+	Name       string `json:"name"`
+	Source     string `json:"source,omitempty"`
+	Direction  string `json:"direction"`
+	Iterations int    `json:"iterations,omitempty"`
+	Key        string `json:"key"`
+	Tweak      string `json:"tweak"`
+	Input      string `json:"input"`
+	Output     string `json:"output"`
+}
+
+// Marshal encodes "vectors" as a JSON vector file, the format for exchanging
+// vectors with other implementations. All byte strings are hex-encoded:
+//
+//	{
+//	  "algorithm": "EME-AES",
+//	  "vectors": [
+//	    {
+//	      "name": "enc16",
+//	      "source": "github.com/rfjakob/eme",
+//	      "direction": "encrypt",
+//	      "iterations": 1,
+//	      "key": "00...",
+//	      "tweak": "00...",
+//	      "input": "00...",
+//	      "output": "f1b9..."
+//	    }
+//	  ]
+//	}
+//
+// "direction" is "encrypt" or "decrypt". "iterations" may be omitted and
+// defaults to 1. "name" and "source" are informational.
+func Marshal(vectors []Vector) ([]byte, error) {
+	f := vectorFile{Algorithm: Algorithm, Vectors: make([]jsonVector, 0, len(vectors))}
+	for _, v := range vectors {
+		dir := "encrypt"
+		if v.Decrypt {
+			dir = "decrypt"
+		}
+		f.Vectors = append(f.Vectors, jsonVector{
+			Name:       v.Name,
+			Source:     v.Source,
+			Direction:  dir,
+			Iterations: v.Iterations,
+			Key:        hex.EncodeToString(v.Key),
+			Tweak:      hex.EncodeToString(v.Tweak),
+			Input:      hex.EncodeToString(v.In),
+			Output:     hex.EncodeToString(v.Out),
+		})
+	}
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Unmarshal decodes a JSON vector file written by Marshal or by another
+// implementation. It checks that every vector is well-formed, but not that
+// its output is correct.
+func Unmarshal(data []byte) ([]Vector, error) {
+	var f vectorFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if f.Algorithm != Algorithm {
+		return nil, fmt.Errorf("unsupported algorithm %q", f.Algorithm)
+	}
+	vectors := make([]Vector, 0, len(f.Vectors))
+	for i, jv := range f.Vectors {
+		v, err := jv.vector()
+		if err != nil {
+			return nil, fmt.Errorf("vector %d (%q): %w", i, jv.Name, err)
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors, nil
+}
+
+func (jv jsonVector) vector() (Vector, error) {
+	v := Vector{Name: jv.Name, Source: jv.Source, Iterations: jv.Iterations}
+	switch jv.Direction {
+	case "encrypt":
+	case "decrypt":
+		v.Decrypt = true
+	default:
+		return v, fmt.Errorf("bad direction %q", jv.Direction)
+	}
+	if v.Iterations == 0 {
+		v.Iterations = 1
+	} else if v.Iterations < 0 {
+		return v, fmt.Errorf("bad iteration count %d", v.Iterations)
+	}
+	for _, f := range []struct {
+		name string
+		hex  string
+		dst  *[]byte
+	}{{"key", jv.Key, &v.Key}, {"tweak", jv.Tweak, &v.Tweak}, {"input", jv.Input, &v.In}, {"output", jv.Output, &v.Out}} {
+		b, err := hex.DecodeString(f.hex)
+		if err != nil {
+			return v, fmt.Errorf("%s: %w", f.name, err)
+		}
+		*f.dst = b
+	}
+	switch {
+	case len(v.Key) != 16 && len(v.Key) != 24 && len(v.Key) != 32:
+		return v, fmt.Errorf("key is %d bytes, want 16, 24 or 32", len(v.Key))
+	case len(v.Tweak) != 16:
+		return v, fmt.Errorf("tweak is %d bytes, want 16", len(v.Tweak))
+	case len(v.In) == 0 || len(v.In)%16 != 0 || len(v.In) > 2048:
+		return v, fmt.Errorf("input is %d bytes, want a multiple of 16 up to 2048", len(v.In))
+	case len(v.Out) != len(v.In):
+		return v, fmt.Errorf("output is %d bytes, input %d", len(v.Out), len(v.In))
+	}
+	return v, nil
+}
+
+// Generate returns one encryption vector per entry of "sizes", with a
+// 32-byte key, tweak and input derived from "seed". Other implementations
+// can regenerate the same vectors: the bytes are taken in the order key,
+// tweak, input, vector after vector, from the stream
+//
+//	SHA-256(seed || 0) || SHA-256(seed || 1) || ...
+//
+// where seed and the counter are 8-byte big-endian integers. The sizes must
+// be multiples of 16 up to 2048, or Generate panics.
+func Generate(seed uint64, sizes []int) []Vector {
+	s := &seedStream{seed: seed}
+	vectors := make([]Vector, 0, len(sizes))
+	for _, n := range sizes {
+		v := Vector{
+			Name:       fmt.Sprintf("seed%d-enc%d", seed, n),
+			Source:     SourceRfjakob,
+			Iterations: 1,
+			Key:        s.bytes(32),
+			Tweak:      s.bytes(16),
+			In:         s.bytes(n),
+		}
+		bc, _ := aes.NewCipher(v.Key)
+		v.Out = eme.Transform(bc, v.Tweak, v.In, eme.DirectionEncrypt)
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+// seedStream - the byte stream described at Generate
+type seedStream struct {
+	seed    uint64
+	counter uint64
+	buf     []byte
+}
+
+func (s *seedStream) bytes(n int) []byte {
+	for len(s.buf) < n {
+		var in [16]byte
+		binary.BigEndian.PutUint64(in[:8], s.seed)
+		binary.BigEndian.PutUint64(in[8:], s.counter)
+		s.counter++
+		h := sha256.Sum256(in[:])
+		s.buf = append(s.buf, h[:]...)
+	}
+	out := s.buf[:n:n]
+	s.buf = s.buf[n:]
+	return out
+}
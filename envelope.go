@@ -0,0 +1,98 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// EnvelopeSectorSize is the sector size NewEnvelopeWriter uses.
+const EnvelopeSectorSize = 4096
+
+// EnvelopeVersion is the envelope format version written by this package.
+// It is the last byte of the magic.
+const EnvelopeVersion = 1
+
+// envelopeMagic - starts every envelope
+var envelopeMagic = append([]byte("EMEENV\x00"), EnvelopeVersion)
+
+// envelopeHeaderLen - magic, sector size, reserved, base tweak
+const envelopeHeaderLen = 8 + 4 + 4 + 16
+
+// The envelope format frames a Writer stream so that it can be decrypted
+// knowing only the key:
+//
+//	magic "EMEENV\x00\x01" | sector size, uint32 BE | key ID, uint32 BE |
+//	base tweak, 16 bytes | Writer output with PadPKCS7
+//
+// The base tweak is random, so equal plaintexts produce different envelopes.
+// The key ID names the key in a Keyring, and is zero outside of one.
+
+// NewEnvelopeWriter writes an envelope header with a random base tweak to "w"
+// and returns a Writer for the content. Close must be called to finish the
+// envelope.
+func NewEnvelopeWriter(w io.Writer, bc cipher.Block) (*Writer, error) {
+	return newEnvelopeWriter(w, bc, 0)
+}
+
+// newEnvelopeWriter - NewEnvelopeWriter, recording "keyID" in the header
+func newEnvelopeWriter(w io.Writer, bc cipher.Block, keyID uint32) (*Writer, error) {
+	hdr := make([]byte, envelopeHeaderLen)
+	copy(hdr, envelopeMagic)
+	binary.BigEndian.PutUint32(hdr[8:], EnvelopeSectorSize)
+	binary.BigEndian.PutUint32(hdr[12:], keyID)
+	tweak := hdr[16:]
+	if _, err := rand.Read(tweak); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return NewWriter(w, bc, EnvelopeSectorSize, tweak), nil
+}
+
+// NewEnvelopeReader reads the envelope header from "r" and returns a Reader
+// for the content.
+func NewEnvelopeReader(r io.Reader, bc cipher.Block) (*Reader, error) {
+	hdr, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeReader(r, bc, hdr), nil
+}
+
+// readEnvelopeHeader - read and check the envelope header
+func readEnvelopeHeader(r io.Reader) ([]byte, error) {
+	hdr := make([]byte, envelopeHeaderLen)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errors.New("eme: envelope header is truncated")
+		}
+		return nil, err
+	}
+	if !bytes.Equal(hdr[:7], envelopeMagic[:7]) {
+		return nil, errors.New("eme: not an envelope")
+	}
+	if hdr[7] != EnvelopeVersion {
+		return nil, fmt.Errorf("eme: unsupported envelope version %d", hdr[7])
+	}
+	sectorSize := binary.BigEndian.Uint32(hdr[8:])
+	if !validPageSize(int(sectorSize)) {
+		return nil, fmt.Errorf("eme: envelope has invalid sector size %d", sectorSize)
+	}
+	return hdr, nil
+}
+
+// newEnvelopeReader - a Reader for the content after header "hdr"
+func newEnvelopeReader(r io.Reader, bc cipher.Block, hdr []byte) *Reader {
+	return NewReader(r, bc, int(binary.BigEndian.Uint32(hdr[8:])), hdr[16:])
+}
+
+// envelopeKeyID - the key ID in header "hdr"
+func envelopeKeyID(hdr []byte) uint32 {
+	return binary.BigEndian.Uint32(hdr[12:])
+}
@@ -0,0 +1,70 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/rfjakob/eme/internal/testsupport"
+)
+
+func TestEnvelope(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := bytes.Repeat([]byte("envelope "), 1000)
+	var buf bytes.Buffer
+	w, err := NewEnvelopeWriter(&buf, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plain)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewEnvelopeReader(&buf, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("roundtrip failed")
+	}
+	if _, err = NewEnvelopeReader(bytes.NewReader(plain), bc); err == nil {
+		t.Errorf("plaintext accepted as envelope")
+	}
+}
+
+// TestEnvelopeFraming checks the header layout and the body length, which do
+// not depend on the block cipher
+func TestEnvelopeFraming(t *testing.T) {
+	bc := testsupport.NewRotateCipher(1)
+	for _, n := range []int{0, 15, 16, EnvelopeSectorSize + 1} {
+		var buf bytes.Buffer
+		w, err := NewEnvelopeWriter(&buf, bc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(make([]byte, n))
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		if !bytes.Equal(b[:8], envelopeMagic) {
+			t.Errorf("%d bytes: magic %q", n, b[:8])
+		}
+		if ss := binary.BigEndian.Uint32(b[8:12]); ss != EnvelopeSectorSize {
+			t.Errorf("%d bytes: sector size %d", n, ss)
+		}
+		// PKCS#7 padding adds 1 to 16 bytes
+		if want := envelopeHeaderLen + n + 16 - n%16; len(b) != want {
+			t.Errorf("%d bytes: envelope is %d bytes, want %d", n, len(b), want)
+		}
+	}
+}
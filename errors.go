@@ -0,0 +1,47 @@
+package eme
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of invalid parameters. Passing invalid parameters is a programming
+// error, so the functions of this package panic instead of returning an
+// error. The panic value is a *ParamError that wraps one of these, and
+// errors.Is tells them apart after a recover().
+var (
+	// ErrBlockSize - the block cipher does not have a block size of 16
+	ErrBlockSize = errors.New("eme: block size must be 16")
+	// ErrTweakSize - a tweak is not 16 bytes long
+	ErrTweakSize = errors.New("eme: tweak must be 16 bytes long")
+	// ErrDataSize - the data passed to Transform is not 1 to 128 blocks
+	// long, or a page does not have the size of its PageCipher
+	ErrDataSize = errors.New("eme: invalid data length")
+	// ErrPageSize - NewPageCipher or a function built on it was given a page
+	// or sector size it does not support
+	ErrPageSize = errors.New("eme: invalid page size")
+)
+
+// ParamError is the panic value for invalid parameters. Its message is the
+// detailed one that is also logged (see SetLogger).
+type ParamError struct {
+	// Err is one of ErrBlockSize, ErrTweakSize, ErrDataSize, ErrPageSize
+	Err error
+	Msg string
+}
+
+func (e *ParamError) Error() string {
+	return e.Msg
+}
+
+// Unwrap returns Err.
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// paramPanicf - like logPanicf, but panic with a *ParamError of kind "err"
+func paramPanicf(err error, format string, a ...interface{}) {
+	pe := &ParamError{Err: err, Msg: fmt.Sprintf(format, a...)}
+	logError(1, pe.Msg)
+	panic(pe)
+}
@@ -0,0 +1,103 @@
+package eme
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Algorithm identifiers of escrowed keys
+const (
+	escrowRSAOAEP = 1
+	escrowECIES   = 2
+)
+
+// escrowLabel - the OAEP label and HKDF info of escrowed keys
+const escrowLabel = "github.com/rfjakob/eme escrow v1"
+
+// WrapKeyRSA encrypts the data key "key" to the recovery public key "pub"
+// with RSA-OAEP and SHA-256, for key escrow: whoever holds the private key
+// can recover the data, for example after the passphrase was lost. Keep the
+// result with the data, see ContainerOptions.Escrow.
+func WrapKeyRSA(pub *rsa.PublicKey, key []byte) ([]byte, error) {
+	ct, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, []byte(escrowLabel))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{escrowRSAOAEP}, ct...), nil
+}
+
+// UnwrapKeyRSA reverses WrapKeyRSA.
+func UnwrapKeyRSA(priv *rsa.PrivateKey, wrapped []byte) ([]byte, error) {
+	if len(wrapped) == 0 || wrapped[0] != escrowRSAOAEP {
+		return nil, errors.New("eme: not an RSA-escrowed key")
+	}
+	return rsa.DecryptOAEP(sha256.New(), nil, priv, wrapped[1:], []byte(escrowLabel))
+}
+
+// WrapKeyECIES encrypts the data key "key" to the recovery public key "pub",
+// on any curve of crypto/ecdh, like WrapKeyRSA. An ephemeral key agreement
+// with "pub" gives a key-encryption key through HKDF-SHA256, which wraps
+// "key" with WrapKey. The result is an algorithm byte, the length of the
+// ephemeral public key (1 byte), the ephemeral public key and the wrapped
+// key.
+func WrapKeyECIES(pub *ecdh.PublicKey, key []byte) ([]byte, error) {
+	eph, err := pub.Curve().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ephPub := eph.PublicKey().Bytes()
+	kek, err := escrowKEK(eph, pub, ephPub)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := WrapKey(kek, key)
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte{escrowECIES, byte(len(ephPub))}, ephPub...)
+	return append(b, wrapped...), nil
+}
+
+// UnwrapKeyECIES reverses WrapKeyECIES.
+func UnwrapKeyECIES(priv *ecdh.PrivateKey, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 2 || wrapped[0] != escrowECIES {
+		return nil, errors.New("eme: not an ECIES-escrowed key")
+	}
+	n := int(wrapped[1])
+	if len(wrapped) < 2+n {
+		return nil, errors.New("eme: escrowed key is truncated")
+	}
+	ephPub := wrapped[2 : 2+n]
+	eph, err := priv.Curve().NewPublicKey(ephPub)
+	if err != nil {
+		return nil, fmt.Errorf("eme: escrowed key: %w", err)
+	}
+	kek, err := escrowKEK(priv, eph, ephPub)
+	if err != nil {
+		return nil, err
+	}
+	return UnwrapKey(kek, wrapped[2+n:])
+}
+
+// escrowKEK - the key-encryption key of WrapKeyECIES, salted with the
+// ephemeral public key
+func escrowKEK(priv *ecdh.PrivateKey, pub *ecdh.PublicKey, ephPub []byte) (cipher.Block, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(shared)
+	key, err := hkdf.Key(sha256.New, shared, ephPub, escrowLabel, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	return aes.NewCipher(key)
+}
@@ -0,0 +1,76 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrapKeyRSA(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{4}, 32)
+	w, err := WrapKeyRSA(&priv.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := UnwrapKeyRSA(priv, w); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("UnwrapKeyRSA = %x, %v", got, err)
+	}
+	w[len(w)-1] ^= 1
+	if _, err = UnwrapKeyRSA(priv, w); err == nil {
+		t.Errorf("modified key was accepted")
+	}
+}
+
+func TestWrapKeyECIES(t *testing.T) {
+	for _, curve := range []ecdh.Curve{ecdh.X25519(), ecdh.P256()} {
+		priv, _ := curve.GenerateKey(rand.Reader)
+		key := bytes.Repeat([]byte{5}, 32)
+		w, err := WrapKeyECIES(priv.PublicKey(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := UnwrapKeyECIES(priv, w); err != nil || !bytes.Equal(got, key) {
+			t.Errorf("%v: UnwrapKeyECIES = %x, %v", curve, got, err)
+		}
+		other, _ := curve.GenerateKey(rand.Reader)
+		if _, err = UnwrapKeyECIES(other, w); err == nil {
+			t.Errorf("%v: wrong private key was accepted", curve)
+		}
+		if _, err = UnwrapKeyRSA(nil, w); err == nil {
+			t.Errorf("%v: ECIES key passed as RSA", curve)
+		}
+	}
+}
+
+func TestEscrowContainer(t *testing.T) {
+	dir := t.TempDir()
+	priv, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	key := bytes.Repeat([]byte{6}, 32)
+	w, _ := WrapKeyECIES(priv.PublicKey(), key)
+	bc, _ := aes.NewCipher(key)
+	img := filepath.Join(dir, "img")
+	os.WriteFile(img, bytes.Repeat([]byte{8}, 4096), 0600)
+	out := filepath.Join(dir, "c")
+	if err := ImageToContainer(out, img, bc, ContainerOptions{Escrow: w}); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(out)
+	h, err := ReadContainerHeader(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnwrapKeyECIES(priv, h.Escrow())
+	if err != nil || !bytes.Equal(got, key) {
+		t.Errorf("recovered key %x, %v", got, err)
+	}
+}
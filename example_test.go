@@ -0,0 +1,90 @@
+package eme_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/rfjakob/eme"
+)
+
+func Example() {
+	// Use a random key in real code
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		panic(err)
+	}
+	e := eme.New(bc)
+	tweak := make([]byte, 16)
+	ct := e.Encrypt(tweak, []byte("sixteen byte msg"))
+	fmt.Println(hex.EncodeToString(ct))
+	fmt.Printf("%s\n", e.Decrypt(tweak, ct))
+	// Output:
+	// dcef26d22940a7a8802b407647d1fe29
+	// sixteen byte msg
+}
+
+func ExamplePageCipher() {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		panic(err)
+	}
+	pc := eme.NewPageCipher(bc, 4096)
+	sector := bytes.Repeat([]byte{'x'}, 4096)
+	pc.EncryptPage(7, sector)
+	fmt.Println(hex.EncodeToString(sector[:16]))
+	pc.DecryptPage(7, sector)
+	fmt.Printf("%s\n", sector[:16])
+	// Output:
+	// 09da83ce97f97c104d21ef3be427c4e9
+	// xxxxxxxxxxxxxxxx
+}
+
+func ExampleEMECipher_EncryptFilename() {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		panic(err)
+	}
+	e := eme.New(bc)
+	// The IV of the directory, see DirIVStore
+	iv := make([]byte, eme.DirIVLen)
+	enc, err := e.EncryptFilename(iv, "report.pdf")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(enc)
+	name, err := e.DecryptFilename(iv, enc)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(name)
+	// Output:
+	// iDarkysbCTm4UffKe3ecww
+	// report.pdf
+}
+
+func ExampleNewWriter() {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		panic(err)
+	}
+	baseTweak := make([]byte, 16)
+	var ct bytes.Buffer
+	w := eme.NewWriter(&ct, bc, 512, baseTweak)
+	io.WriteString(w, "streamed through sectors of 512 bytes")
+	// Close writes the final, padded sector
+	if err = w.Close(); err != nil {
+		panic(err)
+	}
+	fmt.Println(ct.Len())
+	plain, err := io.ReadAll(eme.NewReader(&ct, bc, 512, baseTweak))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("%s\n", plain)
+	// Output:
+	// 48
+	// streamed through sectors of 512 bytes
+}
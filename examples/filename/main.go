@@ -0,0 +1,53 @@
+// Command filename encrypts the names of the entries of a directory the way
+// gocryptfs does, with a per-directory IV, and decrypts them again.
+//
+//	go run ./examples/filename [DIR]
+//
+// DIR defaults to the current directory. Nothing is renamed.
+package main
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rfjakob/eme"
+)
+
+func main() {
+	dir := "."
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	key := make([]byte, 32)
+	// A real file system keeps the IV in the directory, see
+	// eme.FileDirIVStore
+	iv := make([]byte, eme.DirIVLen)
+	for _, b := range [][]byte{key, iv} {
+		if _, err = rand.Read(b); err != nil {
+			log.Fatal(err)
+		}
+	}
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	e := eme.New(bc)
+	for _, de := range entries {
+		enc, err := e.EncryptFilename(iv, de.Name())
+		if err != nil {
+			log.Fatalf("%s: %v", de.Name(), err)
+		}
+		dec, err := e.DecryptFilename(iv, enc)
+		if err != nil || dec != de.Name() {
+			log.Fatalf("%s: does not decrypt to the original: %v", de.Name(), err)
+		}
+		fmt.Printf("%-30s %s\n", de.Name(), enc)
+	}
+}
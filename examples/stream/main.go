@@ -0,0 +1,58 @@
+// Command stream encrypts standard input to standard output with a Writer,
+// or decrypts with a Reader when given -d. The hex-encoded key is read from
+// $EME_KEY; the stream is prefixed with its random base tweak.
+//
+//	EME_KEY=$(go run ./cmd/eme keygen) go run ./examples/stream < in > out
+//	EME_KEY=... go run ./examples/stream -d < out
+package main
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rfjakob/eme"
+)
+
+const sectorSize = 4096
+
+func main() {
+	decrypt := flag.Bool("d", false, "decrypt")
+	flag.Parse()
+	key, err := hex.DecodeString(strings.TrimSpace(os.Getenv("EME_KEY")))
+	if err != nil {
+		log.Fatalf("EME_KEY: %v", err)
+	}
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		log.Fatalf("EME_KEY: %v", err)
+	}
+	tweak := make([]byte, 16)
+	if *decrypt {
+		if _, err = io.ReadFull(os.Stdin, tweak); err != nil {
+			log.Fatalf("reading the base tweak: %v", err)
+		}
+		if _, err = io.Copy(os.Stdout, eme.NewReader(os.Stdin, bc, sectorSize, tweak)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if _, err = rand.Read(tweak); err != nil {
+		log.Fatal(err)
+	}
+	if _, err = os.Stdout.Write(tweak); err != nil {
+		log.Fatal(err)
+	}
+	w := eme.NewWriter(os.Stdout, bc, sectorSize, tweak)
+	if _, err = io.Copy(w, os.Stdin); err != nil {
+		log.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
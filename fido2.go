@@ -0,0 +1,84 @@
+package eme
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// fido2Info - the HKDF info the key is derived from the hmac-secret output
+// with
+const fido2Info = "github.com/rfjakob/eme fido2 aes-256"
+
+// HMACSecretDevice is a FIDO2 security key with the hmac-secret extension
+// (CTAP 2.0, section 11.4). HMACSecret gets an assertion for the credential
+// "credentialID" with the hmac-secret extension and "salt" (32 bytes) as
+// salt1, and returns the 32-byte output. The token usually waits for a tap.
+// The method matches a thin wrapper around the assertion call of the usual
+// libfido2 bindings, so no binding is imported here.
+type HMACSecretDevice interface {
+	HMACSecret(credentialID []byte, salt []byte) ([]byte, error)
+}
+
+// FIDO2Params describe how a key is derived from a FIDO2 security key: the
+// credential, created on the token beforehand with the hmac-secret
+// extension, and a random salt. They are not secret and are stored next to
+// the data, for example in a container header (see ContainerOptions.FIDO2).
+// The same credential and salt give the same key, other salts independent
+// ones.
+type FIDO2Params struct {
+	CredentialID []byte
+	Salt         []byte
+}
+
+// NewFIDO2Params returns parameters for "credentialID" with a fresh 32-byte
+// salt.
+func NewFIDO2Params(credentialID []byte) (*FIDO2Params, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &FIDO2Params{CredentialID: credentialID, Salt: salt}, nil
+}
+
+// Key derives a 32-byte key, suitable for AES-256, from the hmac-secret
+// output of "dev" with HKDF-SHA256.
+func (p *FIDO2Params) Key(dev HMACSecretDevice) ([]byte, error) {
+	if len(p.Salt) != 32 {
+		return nil, fmt.Errorf("FIDO2 salt has length %d, want 32", len(p.Salt))
+	}
+	secret, err := dev.HMACSecret(p.CredentialID, p.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("eme: FIDO2: %w", err)
+	}
+	defer clear(secret)
+	if len(secret) != 32 {
+		return nil, fmt.Errorf("eme: FIDO2: hmac-secret output has length %d, want 32", len(secret))
+	}
+	return hkdf.Key(sha256.New, secret, nil, fido2Info, 32)
+}
+
+// MarshalBinary encodes the parameters as the length of the credential ID
+// (uint16, big-endian), the credential ID and the salt.
+func (p *FIDO2Params) MarshalBinary() ([]byte, error) {
+	if len(p.CredentialID) > 0xffff {
+		return nil, errors.New("FIDO2 credential ID is too long")
+	}
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(p.CredentialID)))
+	b = append(b, p.CredentialID...)
+	return append(b, p.Salt...), nil
+}
+
+// UnmarshalBinary decodes parameters encoded by MarshalBinary.
+func (p *FIDO2Params) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		return errors.New("FIDO2 parameters are truncated")
+	}
+	n := 2 + int(binary.BigEndian.Uint16(b))
+	p.CredentialID = append([]byte{}, b[2:n]...)
+	p.Salt = append([]byte{}, b[n:]...)
+	return nil
+}
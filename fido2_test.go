@@ -0,0 +1,85 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeToken - an HMACSecretDevice computing hmac-secret like a token does,
+// HMAC-SHA-256 under a per-credential random value
+type fakeToken struct {
+	credRandom []byte
+	taps       int
+}
+
+func (t *fakeToken) HMACSecret(credentialID []byte, salt []byte) ([]byte, error) {
+	if !bytes.Equal(credentialID, []byte("cred")) {
+		return nil, errors.New("no credentials")
+	}
+	t.taps++
+	m := hmac.New(sha256.New, t.credRandom)
+	m.Write(salt)
+	return m.Sum(nil), nil
+}
+
+func TestFIDO2Container(t *testing.T) {
+	dir := t.TempDir()
+	tok := &fakeToken{credRandom: bytes.Repeat([]byte{1}, 32)}
+	p, err := NewFIDO2Params([]byte("cred"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := p.Key(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, _ := aes.NewCipher(key)
+	img := filepath.Join(dir, "img")
+	os.WriteFile(img, bytes.Repeat([]byte{7}, 2*4096), 0600)
+	out := filepath.Join(dir, "c")
+	if err = ImageToContainer(out, img, bc, ContainerOptions{FIDO2: p}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ := os.Open(out)
+	h, err := ReadContainerHeader(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := h.FIDO2()
+	if err != nil || p2 == nil {
+		t.Fatalf("FIDO2 = %v, %v", p2, err)
+	}
+	key2, err := p2.Key(tok)
+	if err != nil || !bytes.Equal(key, key2) || tok.taps != 2 {
+		t.Fatalf("key not derived again: %v", err)
+	}
+	bc2, _ := aes.NewCipher(key2)
+	c, err := OpenContainer(out, bc2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec := make([]byte, 4096)
+	if err = c.ReadSector(1, sec); err != nil || sec[0] != 7 {
+		t.Errorf("ReadSector: %v", err)
+	}
+	c.Close()
+
+	other, _ := NewFIDO2Params([]byte("cred"))
+	if k, _ := other.Key(tok); bytes.Equal(k, key) {
+		t.Errorf("different salts gave the same key")
+	}
+	if _, err = (&FIDO2Params{CredentialID: []byte("x"), Salt: p.Salt}).Key(tok); err == nil {
+		t.Errorf("unknown credential gave a key")
+	}
+	if err = p2.UnmarshalBinary([]byte{0, 9, 1}); err == nil {
+		t.Errorf("truncated parameters were accepted")
+	}
+}
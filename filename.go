@@ -0,0 +1,84 @@
+package eme
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// EncryptFilename encrypts the file name "name" for storage in a directory
+// whose 16-byte IV is "iv", the way gocryptfs does: the name is padded to a
+// multiple of 16 bytes (PKCS#7), EME-encrypted with the IV as the tweak and
+// encoded as unpadded URL-safe base64.
+//
+// Equal names in the same directory encrypt to the same string, which is
+// what makes lookups by name possible. Use a different IV for every directory
+// so that equal names in different directories do not.
+func (e *EMECipher) EncryptFilename(iv []byte, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+	if len(iv) != 16 {
+		return "", fmt.Errorf("directory IV must be 16 bytes long, is %d", len(iv))
+	}
+	padded := pad16([]byte(name))
+	if len(padded) > pageSegmentSize {
+		return "", fmt.Errorf("file name too long (%d bytes)", len(name))
+	}
+	return base64.RawURLEncoding.EncodeToString(e.Encrypt(iv, padded)), nil
+}
+
+// DecryptFilename reverses EncryptFilename.
+func (e *EMECipher) DecryptFilename(iv []byte, encName string) (string, error) {
+	if len(iv) != 16 {
+		return "", fmt.Errorf("directory IV must be 16 bytes long, is %d", len(iv))
+	}
+	// Strict: reject non-zero trailing bits, otherwise several encrypted
+	// names would decrypt to the same plaintext name
+	bin, err := base64.RawURLEncoding.Strict().DecodeString(encName)
+	if err != nil {
+		return "", fmt.Errorf("encrypted file name %q: %w", encName, err)
+	}
+	if len(bin) == 0 || len(bin)%16 != 0 || len(bin) > pageSegmentSize {
+		return "", fmt.Errorf("encrypted file name %q has a bad length", encName)
+	}
+	plain, err := unpad16(e.Decrypt(iv, bin))
+	if err != nil {
+		return "", fmt.Errorf("encrypted file name %q: %w", encName, err)
+	}
+	name := string(plain)
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return "", fmt.Errorf("encrypted file name %q decrypts to an invalid name", encName)
+	}
+	return name, nil
+}
+
+// pad16 - PKCS#7 padding to a multiple of 16 bytes. Always adds 1 to 16
+// bytes.
+func pad16(b []byte) []byte {
+	n := 16 - len(b)%16
+	out := make([]byte, len(b)+n)
+	copy(out, b)
+	for i := len(b); i < len(out); i++ {
+		out[i] = byte(n)
+	}
+	return out
+}
+
+// unpad16 - remove and check PKCS#7 padding added by pad16
+func unpad16(b []byte) ([]byte, error) {
+	if len(b) == 0 || len(b)%16 != 0 {
+		return nil, errors.New("bad padding")
+	}
+	n := int(b[len(b)-1])
+	if n == 0 || n > 16 {
+		return nil, errors.New("bad padding")
+	}
+	for _, v := range b[len(b)-n:] {
+		if int(v) != n {
+			return nil, errors.New("bad padding")
+		}
+	}
+	return b[:len(b)-n], nil
+}
@@ -0,0 +1,42 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"strings"
+	"testing"
+)
+
+func TestFilename(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := New(bc)
+	iv := make([]byte, 16)
+	for _, name := range []string{"a", "hello.txt", strings.Repeat("x", 16), strings.Repeat("ü", 100)} {
+		enc, err := e.EncryptFilename(iv, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.ContainsAny(enc, "/+=") {
+			t.Errorf("%q: encrypted name %q is not path-safe", name, enc)
+		}
+		dec, err := e.DecryptFilename(iv, enc)
+		if err != nil || dec != name {
+			t.Errorf("%q: roundtrip gave %q, %v", name, dec, err)
+		}
+		enc2, _ := e.EncryptFilename(bytes.Repeat([]byte{1}, 16), name)
+		if enc2 == enc {
+			t.Errorf("%q: IV not used", name)
+		}
+	}
+	for _, bad := range []string{"", ".", "..", "a/b"} {
+		if _, err = e.EncryptFilename(iv, bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+	if _, err = e.DecryptFilename(iv, "AAAA"); err == nil {
+		t.Errorf("garbage accepted")
+	}
+}
@@ -0,0 +1,131 @@
+package fpe
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// FF1 encrypts strings over an alphabet with FF1, SP 800-38G section 5.1.
+// It is safe for concurrent use.
+type FF1 struct {
+	bc    cipher.Block
+	alpha *alphabet
+}
+
+// ff1MaxTweak - the longest tweak FF1 accepts here
+const ff1MaxTweak = 256
+
+// NewFF1 returns an FF1 under the AES key "key" (16, 24 or 32 bytes) for
+// strings over "alphabet", whose characters are the numerals 0, 1, ... of
+// the radix.
+func NewFF1(key []byte, alphabet string) (*FF1, error) {
+	a, err := newAlphabet(alphabet)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return &FF1{bc: bc, alpha: a}, nil
+}
+
+// MinLen returns the length of the shortest strings FF1 accepts: those with
+// at least a million possible values.
+func (f *FF1) MinLen() int {
+	return f.alpha.minLen()
+}
+
+// Encrypt encrypts "s" under "tweak", which may be empty and is at most 256
+// bytes long. The result has the length and alphabet of "s".
+func (f *FF1) Encrypt(tweak []byte, s string) (string, error) {
+	return f.crypt(tweak, s, true)
+}
+
+// Decrypt reverses Encrypt.
+func (f *FF1) Decrypt(tweak []byte, s string) (string, error) {
+	return f.crypt(tweak, s, false)
+}
+
+func (f *FF1) crypt(tweak []byte, s string, encrypt bool) (string, error) {
+	if len(tweak) > ff1MaxTweak {
+		return "", fmt.Errorf("fpe: FF1 tweak must be at most %d bytes long, is %d", ff1MaxTweak, len(tweak))
+	}
+	x, err := f.alpha.numerals(s, f.MinLen(), math.MaxInt32)
+	if err != nil {
+		return "", err
+	}
+	radix := f.alpha.radix()
+	n, t := len(x), len(tweak)
+	u := n / 2
+	v := n - u
+	a, b := x[:u], x[u:]
+	// Bytes of NUM_radix(B), and of the PRF output y
+	bLen := (int(math.Ceil(float64(v)*math.Log2(float64(radix)))) + 7) / 8
+	d := 4*((bLen+3)/4) + 4
+
+	p := []byte{1, 2, 1, byte(radix >> 16), byte(radix >> 8), byte(radix), 10, byte(u),
+		byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n),
+		byte(t >> 24), byte(t >> 16), byte(t >> 8), byte(t)}
+	q := make([]byte, t+((-t-bLen-1)%16+16)%16+1+bLen)
+	copy(q, tweak)
+	modU, modV := pow(radix, u), pow(radix, v)
+
+	for j := 0; j < 10; j++ {
+		i := j
+		if !encrypt {
+			i = 9 - j
+		}
+		// Q = T || 0^pad || [i]^1 || [NUM_radix(B)]^b, where B is A when
+		// decrypting
+		src := b
+		if !encrypt {
+			src = a
+		}
+		q[len(q)-bLen-1] = byte(i)
+		num(src, radix).FillBytes(q[len(q)-bLen:])
+		y := new(big.Int).SetBytes(f.prfExpand(p, q, d))
+		m, mod := u, modU
+		if i%2 == 1 {
+			m, mod = v, modV
+		}
+		if encrypt {
+			c := num(a, radix)
+			c.Add(c, y).Mod(c, mod)
+			a, b = b, str(c, radix, m)
+		} else {
+			c := num(b, radix)
+			c.Sub(c, y).Mod(c, mod)
+			a, b = str(c, radix, m), a
+		}
+	}
+	return f.alpha.format(append(append([]int{}, a...), b...)), nil
+}
+
+// prfExpand - S, the first "d" bytes of R || CIPH(R xor [1]^16) || ..., with
+// R = PRF(P || Q), the CBC-MAC of P || Q
+func (f *FF1) prfExpand(p []byte, q []byte, d int) []byte {
+	var r [16]byte
+	for _, blocks := range [][]byte{p, q} {
+		for k := 0; k < len(blocks); k += 16 {
+			for l := range 16 {
+				r[l] ^= blocks[k+l]
+			}
+			f.bc.Encrypt(r[:], r[:])
+		}
+	}
+	s := make([]byte, 0, (d+15)/16*16)
+	s = append(s, r[:]...)
+	for j := 1; len(s) < d; j++ {
+		var blk [16]byte
+		copy(blk[:], r[:])
+		blk[15] ^= byte(j)
+		blk[14] ^= byte(j >> 8)
+		f.bc.Encrypt(blk[:], blk[:])
+		s = append(s, blk[:]...)
+	}
+	return s[:d]
+}
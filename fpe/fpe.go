@@ -0,0 +1,121 @@
+// Package fpe implements the format-preserving encryption modes FF1 and
+// FF3-1 of NIST SP 800-38G (Rev. 1) for small domains, like card numbers,
+// account numbers and short identifiers that must keep their format when
+// encrypted. Package github.com/rfjakob/eme preserves the length of byte
+// strings of 16 bytes and more; these modes preserve the alphabet and length
+// of strings too short for that.
+//
+// Both modes take a raw AES key, so that keys derived by package emekeys can
+// be used directly:
+//
+//	k, _ := emekeys.DeriveKeys(master, "card numbers")
+//	ff1, _ := fpe.NewFF1(k.AES, fpe.Digits)
+//	ct, _ := ff1.Encrypt(tweak, "4111111111111111")
+//
+// FPE on small domains is weaker than EME on large blocks, and FF3-1 has had
+// more cryptanalysis against it than FF1. Prefer FF1, and domains of more
+// than a million values, which both modes require.
+package fpe
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"unicode/utf8"
+)
+
+// Common alphabets
+const (
+	// Digits - radix 10
+	Digits = "0123456789"
+	// LowerAlphanumeric - radix 36
+	LowerAlphanumeric = "0123456789abcdefghijklmnopqrstuvwxyz"
+)
+
+// minDomain - the smallest domain, radix^minlen, SP 800-38G Rev. 1 allows
+const minDomain = 1000000
+
+// alphabet - the numerals of a radix, as runes
+type alphabet struct {
+	runes []rune
+	index map[rune]int
+}
+
+func newAlphabet(s string) (*alphabet, error) {
+	a := &alphabet{index: make(map[rune]int)}
+	for _, r := range s {
+		if _, dup := a.index[r]; dup {
+			return nil, fmt.Errorf("fpe: alphabet has %q twice", r)
+		}
+		a.index[r] = len(a.runes)
+		a.runes = append(a.runes, r)
+	}
+	if len(a.runes) < 2 || len(a.runes) > 1<<16 {
+		return nil, fmt.Errorf("fpe: alphabet must have 2 to 65536 characters, has %d", len(a.runes))
+	}
+	return a, nil
+}
+
+func (a *alphabet) radix() int {
+	return len(a.runes)
+}
+
+// minLen - the shortest strings with at least minDomain values
+func (a *alphabet) minLen() int {
+	return int(math.Ceil(math.Log(minDomain) / math.Log(float64(a.radix()))))
+}
+
+// numerals - the numerals of "s", which must be "minLen" to "maxLen"
+// characters of the alphabet long
+func (a *alphabet) numerals(s string, minLen int, maxLen int) ([]int, error) {
+	n := utf8.RuneCountInString(s)
+	if n < minLen || n > maxLen {
+		return nil, fmt.Errorf("fpe: input must be %d to %d characters long, is %d", minLen, maxLen, n)
+	}
+	x := make([]int, 0, n)
+	for _, r := range s {
+		i, ok := a.index[r]
+		if !ok {
+			return nil, fmt.Errorf("fpe: input has %q, which is not in the alphabet", r)
+		}
+		x = append(x, i)
+	}
+	return x, nil
+}
+
+func (a *alphabet) format(x []int) string {
+	out := make([]rune, len(x))
+	for i, d := range x {
+		out[i] = a.runes[d]
+	}
+	return string(out)
+}
+
+// num - NUM_radix(X), the value of the numerals "x", most significant first
+func num(x []int, radix int) *big.Int {
+	v := new(big.Int)
+	r := big.NewInt(int64(radix))
+	for _, d := range x {
+		v.Mul(v, r)
+		v.Add(v, big.NewInt(int64(d)))
+	}
+	return v
+}
+
+// str - STR^m_radix(v), the "m" numerals of "v", most significant first
+func str(v *big.Int, radix int, m int) []int {
+	x := make([]int, m)
+	v = new(big.Int).Set(v)
+	r := big.NewInt(int64(radix))
+	d := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		v.DivMod(v, r, d)
+		x[i] = int(d.Int64())
+	}
+	return x
+}
+
+// pow - radix^m
+func pow(radix int, m int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(m)), nil)
+}
@@ -0,0 +1,116 @@
+package fpe
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// Samples 1 to 3 of the NIST FF1 examples
+func TestFF1Vectors(t *testing.T) {
+	key := unhex("2b7e151628aed2a6abf7158809cf4f3c")
+	for _, tc := range []struct {
+		alphabet, tweak, plain, cipher string
+	}{
+		{Digits, "", "0123456789", "2433477484"},
+		{Digits, "39383736353433323130", "0123456789", "6124200773"},
+		{LowerAlphanumeric, "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+	} {
+		f, err := NewFF1(key, tc.alphabet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Encrypt(unhex(tc.tweak), tc.plain)
+		if err != nil || got != tc.cipher {
+			t.Errorf("Encrypt(%q) = %q, %v, want %q", tc.plain, got, err, tc.cipher)
+		}
+		back, err := f.Decrypt(unhex(tc.tweak), got)
+		if err != nil || back != tc.plain {
+			t.Errorf("Decrypt(%q) = %q, %v", got, back, err)
+		}
+	}
+}
+
+// Sample 1 of the NIST FF3 examples, through the 64-bit tweak core of FF3-1
+func TestFF3Vector(t *testing.T) {
+	f, err := NewFF31(unhex("ef4359d8d580aa4f7f036d6f04fc6a94"), Digits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tweak [8]byte
+	copy(tweak[:], unhex("d8e7920afa330a73"))
+	got, err := f.ff3(tweak, "890121234567890000", true)
+	if want := "750918814058654607"; err != nil || got != want {
+		t.Errorf("got %q, %v, want %q", got, err, want)
+	}
+	back, err := f.ff3(tweak, got, false)
+	if err != nil || back != "890121234567890000" {
+		t.Errorf("Decrypt = %q, %v", back, err)
+	}
+}
+
+func TestFF31(t *testing.T) {
+	f, err := NewFF31(unhex("ef4359d8d580aa4f7f036d6f04fc6a94"), Digits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := unhex("d8e7920afa330a")
+	// Sample 1 of the FF3-1 examples
+	if got, err := f.Encrypt(tweak, "890121234567890000"); err != nil || got != "477064185124354662" {
+		t.Errorf("got %q, %v", got, err)
+	}
+	for _, plain := range []string{"123456", "4111111111111111", "890121234567890000"} {
+		ct, err := f.Encrypt(tweak, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ct) != len(plain) || ct == plain {
+			t.Errorf("Encrypt(%q) = %q", plain, ct)
+		}
+		back, err := f.Decrypt(tweak, ct)
+		if err != nil || back != plain {
+			t.Errorf("Decrypt(%q) = %q, %v", ct, back, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	key := make([]byte, 16)
+	ff1, _ := NewFF1(key, Digits)
+	ff31, _ := NewFF31(key, Digits)
+	if ff1.MinLen() != 6 || ff31.MaxLen() != 56 {
+		t.Errorf("MinLen %d, MaxLen %d", ff1.MinLen(), ff31.MaxLen())
+	}
+	for _, s := range []string{"12345", "12a456"} {
+		if _, err := ff1.Encrypt(nil, s); err == nil {
+			t.Errorf("FF1 accepted %q", s)
+		}
+		if _, err := ff31.Encrypt(make([]byte, 7), s); err == nil {
+			t.Errorf("FF3-1 accepted %q", s)
+		}
+	}
+	if _, err := ff31.Encrypt(make([]byte, 8), "123456"); err == nil {
+		t.Error("FF3-1 accepted an 8-byte tweak")
+	}
+	for _, a := range []string{"0", "001"} {
+		if _, err := NewFF1(key, a); err == nil {
+			t.Errorf("alphabet %q accepted", a)
+		}
+	}
+	// Non-ASCII alphabets keep their characters
+	greek, _ := NewFF1(key, "αβγδεζηθικ")
+	ct, err := greek.Encrypt(nil, "αβγδεζηθ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back, _ := greek.Decrypt(nil, ct); back != "αβγδεζηθ" {
+		t.Errorf("roundtrip through %q gave %q", ct, back)
+	}
+}
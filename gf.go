@@ -0,0 +1,79 @@
+package eme
+
+import "encoding/binary"
+
+// The mask math of EME: XORing the L table into the message, and the
+// doubling chain of M in the middle pass. gf_amd64.s and gf_arm64.s
+// implement both for four blocks at a time; the portable versions below work
+// on 64-bit words, which the compiler turns into plain loads and stores on
+// the other 64-bit platforms.
+
+// maskBlocksGeneric - dst = src XOR L, for len(src) bytes
+func maskBlocksGeneric(dst []byte, src []byte, L []byte) {
+	le := binary.LittleEndian
+	n := len(src)
+	src, dst, L = src[:n:n], dst[:n:n], L[:n:n]
+	for j := 0; j+16 <= n; j += 16 {
+		// With equal lengths, the compiler checks the bounds of the first
+		// conversion only
+		s := (*[16]byte)(src[j:])
+		d := (*[16]byte)(dst[j:])
+		l := (*[16]byte)(L[j:])
+		le.PutUint64(d[0:], le.Uint64(s[0:])^le.Uint64(l[0:]))
+		le.PutUint64(d[8:], le.Uint64(s[8:])^le.Uint64(l[8:]))
+	}
+}
+
+// mixBlocksGeneric - for every block C_j of "C": double "M", XOR it into C_j
+// and XOR the result into "acc". "M" is clobbered.
+func mixBlocksGeneric(C []byte, M []byte, acc []byte) {
+	le := binary.LittleEndian
+	m, a := (*[16]byte)(M), (*[16]byte)(acc)
+	// Blocks are little-endian 128-bit numbers, see multByTwo
+	lo, hi := le.Uint64(m[0:]), le.Uint64(m[8:])
+	accLo, accHi := le.Uint64(a[0:]), le.Uint64(a[8:])
+	for j := 0; j+16 <= len(C); j += 16 {
+		c := (*[16]byte)(C[j:])
+		carry := hi >> 63
+		hi = hi<<1 | lo>>63
+		lo = lo<<1 ^ carry*0x87
+		cLo := le.Uint64(c[0:]) ^ lo
+		cHi := le.Uint64(c[8:]) ^ hi
+		le.PutUint64(c[0:], cLo)
+		le.PutUint64(c[8:], cHi)
+		accLo ^= cLo
+		accHi ^= cHi
+	}
+	le.PutUint64(m[0:], lo)
+	le.PutUint64(m[8:], hi)
+	le.PutUint64(a[0:], accLo)
+	le.PutUint64(a[8:], accHi)
+}
+
+// xorSumBlocks - XOR every 16-byte block of "src" into "acc". The loop
+// handles four blocks per iteration with independent accumulators, so that
+// the XORs of a group do not wait for each other.
+func xorSumBlocks(acc []byte, src []byte) {
+	le := binary.LittleEndian
+	var a0, a1, b0, b1, c0, c1, d0, d1 uint64
+	j := 0
+	for ; j+64 <= len(src); j += 64 {
+		g := (*[64]byte)(src[j:])
+		a0 ^= le.Uint64(g[0:])
+		a1 ^= le.Uint64(g[8:])
+		b0 ^= le.Uint64(g[16:])
+		b1 ^= le.Uint64(g[24:])
+		c0 ^= le.Uint64(g[32:])
+		c1 ^= le.Uint64(g[40:])
+		d0 ^= le.Uint64(g[48:])
+		d1 ^= le.Uint64(g[56:])
+	}
+	for ; j+16 <= len(src); j += 16 {
+		b := (*[16]byte)(src[j:])
+		a0 ^= le.Uint64(b[0:])
+		a1 ^= le.Uint64(b[8:])
+	}
+	a := (*[16]byte)(acc)
+	le.PutUint64(a[0:], le.Uint64(a[0:])^a0^b0^c0^d0)
+	le.PutUint64(a[8:], le.Uint64(a[8:])^a1^b1^c1^d1)
+}
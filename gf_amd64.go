@@ -0,0 +1,79 @@
+//go:build amd64 && !purego
+
+package eme
+
+// useGFAsm - whether the CPU and OS support the AVX-512 and VPCLMULQDQ
+// instructions of gf_amd64.s
+var useGFAsm = detectGFAsm()
+
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+
+func xgetbv() (eax, edx uint32)
+
+//go:noescape
+func maskBlocksAVX512(dst []byte, src []byte, L []byte)
+
+//go:noescape
+func mixBlocksAVX512(C []byte, lanes *[64]byte, acc *[16]byte)
+
+func detectGFAsm() bool {
+	maxLeaf, _, _, _ := cpuid(0, 0)
+	if maxLeaf < 7 {
+		return false
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	const osxsave = 1 << 27
+	if ecx1&osxsave == 0 {
+		return false
+	}
+	// The OS must save the SSE, AVX, opmask and all ZMM registers
+	const xcr0ZMM = 1<<1 | 1<<2 | 1<<5 | 1<<6 | 1<<7
+	if xcr0, _ := xgetbv(); xcr0&xcr0ZMM != xcr0ZMM {
+		return false
+	}
+	_, ebx7, ecx7, _ := cpuid(7, 0)
+	// AVX512VL for the EVEX forms on Y registers that fold the lanes
+	const (
+		avx2       = 1 << 5
+		avx512f    = 1 << 16
+		avx512vl   = 1 << 31
+		vpclmulqdq = 1 << 10
+	)
+	return ebx7&(avx2|avx512f|avx512vl) == avx2|avx512f|avx512vl && ecx7&vpclmulqdq != 0
+}
+
+func maskBlocks(dst []byte, src []byte, L []byte) {
+	n := 0
+	if useGFAsm {
+		n = len(src) &^ 63
+		if n > 0 {
+			maskBlocksAVX512(dst[:n], src[:n], L[:n])
+		}
+	}
+	maskBlocksGeneric(dst[n:], src[n:], L[n:])
+}
+
+func mixBlocks(C []byte, M []byte, acc []byte) {
+	n := len(C) &^ 63
+	if !useGFAsm || n == 0 {
+		mixBlocksGeneric(C, M, acc)
+		return
+	}
+	// Four lanes of multipliers, 2*M to 16*M, that the assembly multiplies
+	// by 16 after every group of four blocks
+	var lanes [64]byte
+	for i := 0; i < 4; i++ {
+		multByTwo(M, M)
+		copy(lanes[i*16:], M)
+	}
+	var a [16]byte
+	copy(a[:], acc)
+	mixBlocksAVX512(C[:n], &lanes, &a)
+	copy(acc, a[:])
+	// At most three blocks are left, and their multipliers are in the lanes
+	for j := n; j < len(C); j += 16 {
+		Cj := C[j : j+16]
+		xorBlocks(Cj, Cj, lanes[j-n:j-n+16])
+		xorBlocks(acc, acc, Cj)
+	}
+}
@@ -0,0 +1,114 @@
+//go:build amd64 && !purego
+
+#include "textflag.h"
+
+// gfPoly - the reduction constant 0x87 of GF(2^128) in the low qword of
+// every lane
+DATA gfPoly<>+0x00(SB)/8, $0x87
+DATA gfPoly<>+0x08(SB)/8, $0
+DATA gfPoly<>+0x10(SB)/8, $0x87
+DATA gfPoly<>+0x18(SB)/8, $0
+DATA gfPoly<>+0x20(SB)/8, $0x87
+DATA gfPoly<>+0x28(SB)/8, $0
+DATA gfPoly<>+0x30(SB)/8, $0x87
+DATA gfPoly<>+0x38(SB)/8, $0
+GLOBL gfPoly<>(SB), RODATA|NOPTR, $64
+
+// gfHigh - selects the high qword of every lane
+DATA gfHigh<>+0x00(SB)/8, $0
+DATA gfHigh<>+0x08(SB)/8, $-1
+DATA gfHigh<>+0x10(SB)/8, $0
+DATA gfHigh<>+0x18(SB)/8, $-1
+DATA gfHigh<>+0x20(SB)/8, $0
+DATA gfHigh<>+0x28(SB)/8, $-1
+DATA gfHigh<>+0x30(SB)/8, $0
+DATA gfHigh<>+0x38(SB)/8, $-1
+GLOBL gfHigh<>(SB), RODATA|NOPTR, $64
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// func maskBlocksAVX512(dst []byte, src []byte, L []byte)
+// len(src) is a multiple of 64.
+TEXT ·maskBlocksAVX512(SB), NOSPLIT, $0-72
+	MOVQ dst_base+0(FP), DI
+	MOVQ src_base+24(FP), SI
+	MOVQ src_len+32(FP), CX
+	MOVQ L_base+48(FP), DX
+
+maskLoop:
+	VMOVDQU64 (SI), Z0
+	VPXORQ    (DX), Z0, Z0
+	VMOVDQU64 Z0, (DI)
+	ADDQ      $64, SI
+	ADDQ      $64, DX
+	ADDQ      $64, DI
+	SUBQ      $64, CX
+	JNZ       maskLoop
+
+	VZEROUPPER
+	RET
+
+// func mixBlocksAVX512(C []byte, lanes *[64]byte, acc *[16]byte)
+// len(C) is a multiple of 64. Lane i of "lanes" is the multiplier of block i
+// of the first group of four; on return, it is that of the next group.
+TEXT ·mixBlocksAVX512(SB), NOSPLIT, $0-40
+	MOVQ C_base+0(FP), DI
+	MOVQ C_len+8(FP), CX
+	MOVQ lanes+24(FP), SI
+	MOVQ acc+32(FP), DX
+
+	VMOVDQU64 (SI), Z0
+	VMOVDQU64 gfPoly<>(SB), Z2
+	VMOVDQU64 gfHigh<>(SB), Z3
+	VPXORQ    Z6, Z6, Z6
+
+mixLoop:
+	// C_j ^= M_j, and accumulate
+	VPXORQ    (DI), Z0, Z5
+	VMOVDQU64 Z5, (DI)
+	VPXORQ    Z5, Z6, Z6
+
+	// M_j *= x^4 in every lane: shift the 128-bit lanes left by 4 bits,
+	// carry the top nibble of the low qword into the high qword, and reduce
+	// the top nibble of the high qword with 0x87
+	VPSRLQ     $60, Z0, Z1
+	VPSHUFD    $0x4e, Z1, Z1
+	VPSLLQ     $4, Z0, Z0
+	VPCLMULQDQ $0x00, Z2, Z1, Z4
+	VPANDQ     Z3, Z1, Z1
+	VPXORQ     Z4, Z0, Z0
+	VPXORQ     Z1, Z0, Z0
+
+	ADDQ $64, DI
+	SUBQ $64, CX
+	JNZ  mixLoop
+
+	VMOVDQU64 Z0, (SI)
+
+	// Fold the four accumulator lanes into "acc"
+	VEXTRACTI64X4 $1, Z6, Y7
+	VPXORQ        Y7, Y6, Y6
+	VEXTRACTI128  $1, Y6, X7
+	VPXOR         X7, X6, X6
+	VPXOR         (DX), X6, X6
+	VMOVDQU       X6, (DX)
+
+	VZEROUPPER
+	RET
@@ -0,0 +1,46 @@
+//go:build arm64 && !purego
+
+package eme
+
+// useGFAsm - the ASIMD instructions of gf_arm64.s are part of every arm64
+// CPU, so the assembly always runs
+const useGFAsm = true
+
+//go:noescape
+func maskBlocksNEON(dst []byte, src []byte, L []byte)
+
+//go:noescape
+func mixBlocksNEON(C []byte, lanes *[64]byte, acc *[16]byte)
+
+func maskBlocks(dst []byte, src []byte, L []byte) {
+	n := len(src) &^ 63
+	if n > 0 {
+		maskBlocksNEON(dst[:n], src[:n], L[:n])
+	}
+	maskBlocksGeneric(dst[n:], src[n:], L[n:])
+}
+
+func mixBlocks(C []byte, M []byte, acc []byte) {
+	n := len(C) &^ 63
+	if n == 0 {
+		mixBlocksGeneric(C, M, acc)
+		return
+	}
+	// Four lanes of multipliers, 2*M to 16*M, that the assembly multiplies
+	// by 16 after every group of four blocks
+	var lanes [64]byte
+	for i := 0; i < 4; i++ {
+		multByTwo(M, M)
+		copy(lanes[i*16:], M)
+	}
+	var a [16]byte
+	copy(a[:], acc)
+	mixBlocksNEON(C[:n], &lanes, &a)
+	copy(acc, a[:])
+	// At most three blocks are left, and their multipliers are in the lanes
+	for j := n; j < len(C); j += 16 {
+		Cj := C[j : j+16]
+		xorBlocks(Cj, Cj, lanes[j-n:j-n+16])
+		xorBlocks(acc, acc, Cj)
+	}
+}
@@ -0,0 +1,104 @@
+//go:build arm64 && !purego
+
+#include "textflag.h"
+
+// gfLow, gfHigh - select the low and the high doubleword of a block
+DATA gfLow<>+0x00(SB)/8, $-1
+DATA gfLow<>+0x08(SB)/8, $0
+DATA gfHigh<>+0x00(SB)/8, $0
+DATA gfHigh<>+0x08(SB)/8, $-1
+GLOBL gfLow<>(SB), RODATA|NOPTR, $16
+GLOBL gfHigh<>(SB), RODATA|NOPTR, $16
+
+// func maskBlocksNEON(dst []byte, src []byte, L []byte)
+// len(src) is a multiple of 64.
+TEXT ·maskBlocksNEON(SB), NOSPLIT, $0-72
+	MOVD dst_base+0(FP), R0
+	MOVD src_base+24(FP), R1
+	MOVD src_len+32(FP), R2
+	MOVD L_base+48(FP), R3
+
+maskLoop:
+	VLD1.P 64(R1), [V0.B16, V1.B16, V2.B16, V3.B16]
+	VLD1.P 64(R3), [V4.B16, V5.B16, V6.B16, V7.B16]
+	VEOR   V4.B16, V0.B16, V0.B16
+	VEOR   V5.B16, V1.B16, V1.B16
+	VEOR   V6.B16, V2.B16, V2.B16
+	VEOR   V7.B16, V3.B16, V3.B16
+	VST1.P [V0.B16, V1.B16, V2.B16, V3.B16], 64(R0)
+	SUBS   $64, R2, R2
+	BNE    maskLoop
+
+	RET
+
+// TIMES16 - multiply the block in "m" by x^4: shift it left by 4 bits, carry
+// the top nibble of the low doubleword into the high one, and reduce the top
+// nibble t of the high doubleword as t*0x87 = t ^ t<<1 ^ t<<2 ^ t<<7. V30
+// and V31 hold gfLow and gfHigh; V8 and V9 are clobbered.
+#define TIMES16(m) \
+	VUSHR $60, m.D2, V8.D2 \
+	VSHL  $4, m.D2, m.D2 \
+	VEXT  $8, V8.B16, V8.B16, V8.B16 \
+	VAND  V31.B16, V8.B16, V9.B16 \
+	VEOR  V9.B16, m.B16, m.B16 \
+	VAND  V30.B16, V8.B16, V8.B16 \
+	VEOR  V8.B16, m.B16, m.B16 \
+	VSHL  $1, V8.D2, V9.D2 \
+	VEOR  V9.B16, m.B16, m.B16 \
+	VSHL  $2, V8.D2, V9.D2 \
+	VEOR  V9.B16, m.B16, m.B16 \
+	VSHL  $7, V8.D2, V9.D2 \
+	VEOR  V9.B16, m.B16, m.B16
+
+// func mixBlocksNEON(C []byte, lanes *[64]byte, acc *[16]byte)
+// len(C) is a multiple of 64. Lane i of "lanes" is the multiplier of block i
+// of the first group of four; on return, it is that of the next group.
+TEXT ·mixBlocksNEON(SB), NOSPLIT, $0-40
+	MOVD C_base+0(FP), R0
+	MOVD C_len+8(FP), R2
+	MOVD lanes+24(FP), R1
+	MOVD acc+32(FP), R3
+
+	VLD1 (R1), [V0.B16, V1.B16, V2.B16, V3.B16]
+	MOVD $gfLow<>(SB), R4
+	VLD1 (R4), [V30.B16]
+	MOVD $gfHigh<>(SB), R4
+	VLD1 (R4), [V31.B16]
+	VEOR V16.B16, V16.B16, V16.B16
+	VEOR V17.B16, V17.B16, V17.B16
+	VEOR V18.B16, V18.B16, V18.B16
+	VEOR V19.B16, V19.B16, V19.B16
+
+mixLoop:
+	// C_j ^= M_j, and accumulate
+	VLD1   (R0), [V4.B16, V5.B16, V6.B16, V7.B16]
+	VEOR   V0.B16, V4.B16, V4.B16
+	VEOR   V1.B16, V5.B16, V5.B16
+	VEOR   V2.B16, V6.B16, V6.B16
+	VEOR   V3.B16, V7.B16, V7.B16
+	VST1.P [V4.B16, V5.B16, V6.B16, V7.B16], 64(R0)
+	VEOR   V4.B16, V16.B16, V16.B16
+	VEOR   V5.B16, V17.B16, V17.B16
+	VEOR   V6.B16, V18.B16, V18.B16
+	VEOR   V7.B16, V19.B16, V19.B16
+
+	// M_j *= x^4 in every lane
+	TIMES16(V0)
+	TIMES16(V1)
+	TIMES16(V2)
+	TIMES16(V3)
+
+	SUBS $64, R2, R2
+	BNE  mixLoop
+
+	VST1 [V0.B16, V1.B16, V2.B16, V3.B16], (R1)
+
+	// Fold the four accumulators into "acc"
+	VLD1 (R3), [V4.B16]
+	VEOR V17.B16, V16.B16, V16.B16
+	VEOR V19.B16, V18.B16, V18.B16
+	VEOR V18.B16, V16.B16, V16.B16
+	VEOR V4.B16, V16.B16, V16.B16
+	VST1 [V16.B16], (R3)
+
+	RET
@@ -0,0 +1,13 @@
+//go:build (!amd64 && !arm64) || purego
+
+package eme
+
+const useGFAsm = false
+
+func maskBlocks(dst []byte, src []byte, L []byte) {
+	maskBlocksGeneric(dst, src, L)
+}
+
+func mixBlocks(C []byte, M []byte, acc []byte) {
+	mixBlocksGeneric(C, M, acc)
+}
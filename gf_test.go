@@ -0,0 +1,59 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+// maskBlocks and mixBlocks must match the portable versions for every
+// message length, including the lengths the assembly leaves a tail of.
+func TestGFMatchesGeneric(t *testing.T) {
+	t.Logf("useGFAsm=%v", useGFAsm)
+	for m := 0; m <= maxMessageBlocks; m++ {
+		src := make([]byte, m*16)
+		L := make([]byte, m*16)
+		M := make([]byte, 16)
+		acc := make([]byte, 16)
+		rand.Read(src)
+		rand.Read(L)
+		rand.Read(M)
+		rand.Read(acc)
+
+		want := make([]byte, len(src))
+		got := make([]byte, len(src))
+		maskBlocksGeneric(want, src, L)
+		maskBlocks(got, src, L)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("m=%d: maskBlocks mismatch", m)
+		}
+
+		wantM, gotM := bytes.Clone(M), bytes.Clone(M)
+		wantAcc, gotAcc := bytes.Clone(acc), bytes.Clone(acc)
+		mixBlocksGeneric(want, wantM, wantAcc)
+		mixBlocks(got, gotM, gotAcc)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("m=%d: mixBlocks data mismatch", m)
+		}
+		if !bytes.Equal(gotAcc, wantAcc) {
+			t.Fatalf("m=%d: mixBlocks sum mismatch", m)
+		}
+	}
+}
+
+func TestXorSumBlocks(t *testing.T) {
+	for m := 0; m <= maxMessageBlocks; m++ {
+		src := make([]byte, m*16)
+		rand.Read(src)
+		want := make([]byte, 16)
+		want[0] = 1
+		got := bytes.Clone(want)
+		for j := 0; j < len(src); j += 16 {
+			xorBlocks(want, want, src[j:j+16])
+		}
+		xorSumBlocks(got, src)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("m=%d: got %x, want %x", m, got, want)
+		}
+	}
+}
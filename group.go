@@ -0,0 +1,69 @@
+package eme
+
+import "encoding/binary"
+
+// groupDomain - separates the chain start of EncryptGroup from page tweaks
+var groupDomain = [8]byte{'e', 'm', 'e', 'g', 'r', 'o', 'u', 'p'}
+
+// EncryptGroup encrypts the sectors (pages) in "data" in place as one group,
+// for data that is always written as a unit, like a database WAL segment.
+// "data" must be a multiple of PageSize() bytes long.
+//
+// The tweaks are chained: the first sector's tweak is derived from
+// "groupID", and every following sector's from the previous tweak and the
+// previous ciphertext sector. Decrypting a sector therefore needs the
+// ciphertext of all sectors before it in the group, and a sector that is
+// changed, rolled back or torn on its own turns every following sector of
+// the group into garbage. So a group must be rewritten as a whole. Sectors
+// cannot be decrypted at random, and EME does not authenticate: garbage is
+// detected only by the application's own checks, like a WAL checksum.
+func (p *PageCipher) EncryptGroup(groupID uint64, data []byte) {
+	p.transformGroup(groupID, data, DirectionEncrypt)
+}
+
+// DecryptGroup is the inverse of EncryptGroup.
+func (p *PageCipher) DecryptGroup(groupID uint64, data []byte) {
+	p.transformGroup(groupID, data, DirectionDecrypt)
+}
+
+func (p *PageCipher) transformGroup(groupID uint64, data []byte, direction directionConst) {
+	if len(data)%p.pageSize != 0 {
+		paramPanicf(ErrDataSize, "Data must be a multiple of %d bytes long, is %d", p.pageSize, len(data))
+	}
+	// chain - the tweak of the current sector, chain_0 = AESenc(K; ID || domain)
+	var chain, sum [16]byte
+	binary.BigEndian.PutUint64(chain[0:8], groupID)
+	copy(chain[8:], groupDomain[:])
+	xorBlocks(chain[:], chain[:], p.salt[:])
+	p.bc.Encrypt(chain[:], chain[:])
+	for off := 0; off < len(data); off += p.pageSize {
+		page := data[off : off+p.pageSize]
+		if direction == DirectionDecrypt {
+			groupSum(&sum, page)
+		}
+		for i := 0; i*pageSegmentSize < len(page); i++ {
+			seg := page[i*pageSegmentSize:]
+			if len(seg) > pageSegmentSize {
+				seg = seg[:pageSegmentSize]
+			}
+			p.tweak = chain
+			p.tweak[15] ^= byte(i)
+			p.tweak[14] ^= byte(i >> 8)
+			transform(p.bc, p.tweak[:], seg, seg, direction, p.lTable, &p.w)
+		}
+		if direction == DirectionEncrypt {
+			groupSum(&sum, page)
+		}
+		/* chain_i+1 = AESenc(K; chain_i xor sum(C_i)) */
+		xorBlocks(chain[:], chain[:], sum[:])
+		p.bc.Encrypt(chain[:], chain[:])
+	}
+}
+
+// groupSum - the XOR of all blocks of the ciphertext sector "page". A
+// rewritten EME segment is pseudorandom, so this changes whenever the sector
+// does.
+func groupSum(sum *[16]byte, page []byte) {
+	*sum = [16]byte{}
+	xorSumBlocks(sum[:], page)
+}
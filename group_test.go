@@ -0,0 +1,54 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{512, 4096} {
+		p := NewPageCipher(bc, size)
+		plain := make([]byte, 6*size)
+		for i := range plain {
+			plain[i] = byte(i * 5)
+		}
+		ct := bytes.Clone(plain)
+		p.EncryptGroup(42, ct)
+
+		other := bytes.Clone(plain)
+		p.EncryptGroup(43, other)
+		if bytes.Equal(ct[:16], other[:16]) {
+			t.Errorf("size %d: group ID does not change the ciphertext", size)
+		}
+		single := bytes.Clone(plain[:size])
+		p.EncryptPage(0, single)
+		if bytes.Equal(ct[:16], single[:16]) {
+			t.Errorf("size %d: group tweak equals page tweak", size)
+		}
+
+		got := bytes.Clone(ct)
+		p.DecryptGroup(42, got)
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: roundtrip failed", size)
+		}
+
+		// A change in the last segment of sector 2 garbles sectors 3 to 5,
+		// and nothing before them
+		got = bytes.Clone(ct)
+		got[3*size-1] ^= 1
+		p.DecryptGroup(42, got)
+		if !bytes.Equal(got[:2*size], plain[:2*size]) {
+			t.Errorf("size %d: sectors before the change were damaged", size)
+		}
+		for s := 3; s < 6; s++ {
+			if bytes.Equal(got[s*size:s*size+16], plain[s*size:s*size+16]) {
+				t.Errorf("size %d: sector %d survived a change in sector 2", size, s)
+			}
+		}
+	}
+}
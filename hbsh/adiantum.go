@@ -0,0 +1,113 @@
+package hbsh
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"fmt"
+)
+
+// NH parameters of Adiantum: messages are hashed in chunks of up to 1024
+// bytes, and four passes over the key, each shifted by 16 bytes, give 32
+// bytes of output per chunk
+const (
+	nhChunk    = 1024
+	nhKeyBytes = nhChunk + 48
+)
+
+// NewAdiantum returns Adiantum with XChaCha12 and AES-256 (Crowley and
+// Biggers, 2018), the instantiation of HBSH that Linux uses for disk and
+// file name encryption. The 32-byte "key" is the XChaCha12 key; the keys of
+// AES-256, Poly1305 and NH are derived from its key stream as the paper
+// specifies. The ciphertexts match the test vectors of the reference
+// implementation.
+func NewAdiantum(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("hbsh: key must be 32 bytes long, is %d", len(key))
+	}
+	s := &xChaChaStream{rounds: 12}
+	for i := range s.key {
+		s.key[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	// The subkeys are the key stream for the nonce 1 || 0^184
+	sub := make([]byte, 32+16+16+nhKeyBytes)
+	defer clear(sub)
+	var nonce [24]byte
+	nonce[0] = 1
+	xChaCha(&s.key, &nonce, sub, sub, s.rounds)
+	bc, err := aes.NewCipher(sub[0:32])
+	if err != nil {
+		return nil, err
+	}
+	h := &nhPolyHash{
+		kt: polyKey(sub[32:48]),
+		km: polyKey(sub[48:64]),
+	}
+	for i := range h.kn {
+		h.kn[i] = binary.LittleEndian.Uint32(sub[64+4*i:])
+	}
+	return New(h, bc, s)
+}
+
+// xChaChaStream - XChaCha as the stream cipher of Adiantum, with the HBSH
+// nonce N extended to N || 1 || 0^56
+type xChaChaStream struct {
+	key    [8]uint32
+	rounds int
+}
+
+func (s *xChaChaStream) XORKeyStream(nonce [16]byte, dst []byte, src []byte) {
+	var n [24]byte
+	copy(n[:], nonce[:])
+	n[16] = 1
+	xChaCha(&s.key, &n, dst, src, s.rounds)
+}
+
+// nhPolyHash - the hash of Adiantum:
+// Poly1305(kt; le128(8*len(msg)) || tweak) ⊞ Poly1305(km; NH(kn; msg)),
+// where NH hashes the zero-padded message chunk by chunk
+type nhPolyHash struct {
+	kt, km polyR
+	kn     [nhKeyBytes / 4]uint32
+}
+
+func (h *nhPolyHash) Sum(tweak []byte, msg []byte) [16]byte {
+	head := make([]byte, 16, 16+len(tweak))
+	binary.LittleEndian.PutUint64(head, uint64(len(msg))*8)
+	head = append(head, tweak...)
+
+	pm := polyState{r: h.km}
+	var out [32]byte
+	for len(msg) >= nhChunk {
+		h.nh(&out, msg[:nhChunk])
+		pm.update(out[:])
+		msg = msg[nhChunk:]
+	}
+	if len(msg) > 0 {
+		var pad [nhChunk]byte
+		n := copy(pad[:], msg)
+		h.nh(&out, pad[:(n+15)&^15])
+		pm.update(out[:])
+	}
+	return add(poly1305(h.kt, head), pm.sum())
+}
+
+// nh - NH of "m", a multiple of 16 bytes and at most nhChunk long: four
+// sums of products of 32-bit message and key words, modulo 2^64
+func (h *nhPolyHash) nh(out *[32]byte, m []byte) {
+	le := binary.LittleEndian
+	var sums [4]uint64
+	for j := 0; j < len(m); j += 16 {
+		m0 := le.Uint32(m[j:])
+		m1 := le.Uint32(m[j+4:])
+		m2 := le.Uint32(m[j+8:])
+		m3 := le.Uint32(m[j+12:])
+		k := h.kn[j/4:]
+		for i := range sums {
+			ki := k[4*i : 4*i+4]
+			sums[i] += uint64(m0+ki[0])*uint64(m2+ki[2]) + uint64(m1+ki[1])*uint64(m3+ki[3])
+		}
+	}
+	for i, s := range sums {
+		le.PutUint64(out[8*i:], s)
+	}
+}
@@ -0,0 +1,66 @@
+package hbsh
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// NewAESPoly returns HBSH with AES-256 as the block cipher, AES-256-CTR as
+// the stream cipher and Adiantum's Poly1305-based hash of the tweak and the
+// message. The 32-byte "key" is expanded into the keys of the components
+// with HKDF-SHA256.
+//
+// The stream cipher allocates, so this is meant for experiments and as an
+// example; NewAdiantum is the instantiation for real use.
+func NewAESPoly(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("hbsh: key must be 32 bytes long, is %d", len(key))
+	}
+	sub, err := hkdf.Key(sha256.New, key, nil, "eme hbsh aes-poly", 96)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := aes.NewCipher(sub[0:32])
+	if err != nil {
+		return nil, err
+	}
+	sc, err := aes.NewCipher(sub[32:64])
+	if err != nil {
+		return nil, err
+	}
+	h := &polyHash{
+		kt: polyKey(sub[64:80]),
+		km: polyKey(sub[80:96]),
+	}
+	return New(h, bc, ctrStream{sc})
+}
+
+// ctrStream - a block cipher in CTR mode, with the nonce as the initial
+// counter block
+type ctrStream struct {
+	bc cipher.Block
+}
+
+func (s ctrStream) XORKeyStream(nonce [16]byte, dst []byte, src []byte) {
+	cipher.NewCTR(s.bc, nonce[:]).XORKeyStream(dst, src)
+}
+
+// polyHash - the hash of Adiantum without NH:
+// Poly1305(kt; le128(8*len(msg)) || tweak) ⊞ Poly1305(km; msg), where
+// Poly1305 stops before adding the one-time pad, so it is only
+// ε-almost-Δ-universal
+type polyHash struct {
+	kt polyR
+	km polyR
+}
+
+func (h *polyHash) Sum(tweak []byte, msg []byte) [16]byte {
+	head := make([]byte, 16, 16+len(tweak))
+	binary.LittleEndian.PutUint64(head, uint64(len(msg))*8)
+	head = append(head, tweak...)
+	return add(poly1305(h.kt, head), poly1305(h.km, msg))
+}
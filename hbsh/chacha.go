@@ -0,0 +1,83 @@
+package hbsh
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// XChaCha with a configurable number of rounds, as Adiantum uses it: the
+// original ChaCha of Bernstein with a 64-bit block counter and a 64-bit
+// nonce, extended to a 24-byte nonce by HChaCha.
+
+// chachaConst - "expand 32-byte k"
+var chachaConst = [4]uint32{0x61707865, 0x3320646e, 0x79622d32, 0x6b206574}
+
+func quarterRound(a, b, c, d uint32) (uint32, uint32, uint32, uint32) {
+	a += b
+	d = bits.RotateLeft32(d^a, 16)
+	c += d
+	b = bits.RotateLeft32(b^c, 12)
+	a += b
+	d = bits.RotateLeft32(d^a, 8)
+	c += d
+	b = bits.RotateLeft32(b^c, 7)
+	return a, b, c, d
+}
+
+// chachaRounds - apply "rounds" rounds, which must be even, to "x"
+func chachaRounds(x *[16]uint32, rounds int) {
+	for i := 0; i < rounds; i += 2 {
+		x[0], x[4], x[8], x[12] = quarterRound(x[0], x[4], x[8], x[12])
+		x[1], x[5], x[9], x[13] = quarterRound(x[1], x[5], x[9], x[13])
+		x[2], x[6], x[10], x[14] = quarterRound(x[2], x[6], x[10], x[14])
+		x[3], x[7], x[11], x[15] = quarterRound(x[3], x[7], x[11], x[15])
+		x[0], x[5], x[10], x[15] = quarterRound(x[0], x[5], x[10], x[15])
+		x[1], x[6], x[11], x[12] = quarterRound(x[1], x[6], x[11], x[12])
+		x[2], x[7], x[8], x[13] = quarterRound(x[2], x[7], x[8], x[13])
+		x[3], x[4], x[9], x[14] = quarterRound(x[3], x[4], x[9], x[14])
+	}
+}
+
+// hChaCha - the subkey that HChaCha derives from "key" and the first 16
+// bytes of an XChaCha nonce
+func hChaCha(key *[8]uint32, nonce []byte, rounds int) [8]uint32 {
+	le := binary.LittleEndian
+	var x [16]uint32
+	copy(x[0:4], chachaConst[:])
+	copy(x[4:12], key[:])
+	for i := 0; i < 4; i++ {
+		x[12+i] = le.Uint32(nonce[4*i:])
+	}
+	chachaRounds(&x, rounds)
+	var out [8]uint32
+	copy(out[0:4], x[0:4])
+	copy(out[4:8], x[12:16])
+	return out
+}
+
+// xChaCha - XOR the XChaCha key stream for "key" and the 24-byte "nonce"
+// into "src" and write the result to "dst"
+func xChaCha(key *[8]uint32, nonce *[24]byte, dst []byte, src []byte, rounds int) {
+	le := binary.LittleEndian
+	var state [16]uint32
+	copy(state[0:4], chachaConst[:])
+	sub := hChaCha(key, nonce[:16], rounds)
+	copy(state[4:12], sub[:])
+	state[14] = le.Uint32(nonce[16:])
+	state[15] = le.Uint32(nonce[20:])
+	var block [64]byte
+	for counter := uint64(0); len(src) > 0; counter++ {
+		state[12], state[13] = uint32(counter), uint32(counter>>32)
+		x := state
+		chachaRounds(&x, rounds)
+		for i := range x {
+			le.PutUint32(block[4*i:], x[i]+state[i])
+		}
+		n := min(len(src), 64)
+		for i := 0; i < n; i++ {
+			dst[i] = src[i] ^ block[i]
+		}
+		dst, src = dst[n:], src[n:]
+	}
+	clear(block[:])
+}
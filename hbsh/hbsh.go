@@ -0,0 +1,118 @@
+// Package hbsh implements HBSH (hash, block cipher, stream cipher, hash), the
+// construction of tweakable wide-block ciphers behind Adiantum and HPolyC
+// (Crowley and Biggers, "Adiantum: length-preserving encryption for
+// entry-level processors", 2018), as a generic construction parameterized by
+// its three components. Like EME, it encrypts a whole message as one block
+// under a tweak, but messages can have any length from 16 bytes on, not
+// only multiples of 16.
+//
+// A message P is split into PL and its last 16 bytes PR, and
+//
+//	PM = PR ⊞ H(T, PL)
+//	CM = E(PM)
+//	CL = PL ⊕ S(CM)
+//	CR = CM ⊟ H(T, CL)
+//
+// gives the ciphertext CL || CR, where ⊞ and ⊟ are addition and subtraction
+// of little-endian numbers modulo 2^128, H is an ε-almost-Δ-universal hash,
+// E a 16-byte block cipher and S a stream cipher with a 16-byte nonce.
+//
+// Adiantum is HBSH with NH and Poly1305 as H, AES-256 as E and XChaCha12 as
+// S, see NewAdiantum. NewAESPoly is an instantiation from standard library
+// components.
+package hbsh
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// Hash is the ε-almost-Δ-universal hash H of HBSH, with its key.
+type Hash interface {
+	// Sum hashes "msg" under "tweak"
+	Sum(tweak []byte, msg []byte) [16]byte
+}
+
+// StreamCipher is the stream cipher S of HBSH, with its key.
+type StreamCipher interface {
+	// XORKeyStream XORs the key stream for "nonce" into "src" and writes
+	// the result to "dst". They may be the same slice.
+	XORKeyStream(nonce [16]byte, dst []byte, src []byte)
+}
+
+// Cipher is an HBSH tweakable wide-block cipher. It is safe for concurrent
+// use if its components are.
+type Cipher struct {
+	h  Hash
+	bc cipher.Block
+	s  StreamCipher
+}
+
+// New returns the HBSH cipher with hash "h", block cipher "bc", which must
+// have a block size of 16, and stream cipher "s". The components must have
+// independent keys.
+func New(h Hash, bc cipher.Block, s StreamCipher) (*Cipher, error) {
+	if bc.BlockSize() != 16 {
+		return nil, fmt.Errorf("hbsh: block size must be 16, is %d", bc.BlockSize())
+	}
+	return &Cipher{h: h, bc: bc, s: s}, nil
+}
+
+// Encrypt encrypts "msg", which must be at least 16 bytes long, under
+// "tweak" and returns the ciphertext, which is as long as "msg".
+func (c *Cipher) Encrypt(tweak []byte, msg []byte) ([]byte, error) {
+	return c.crypt(tweak, msg, true)
+}
+
+// Decrypt reverses Encrypt.
+func (c *Cipher) Decrypt(tweak []byte, msg []byte) ([]byte, error) {
+	return c.crypt(tweak, msg, false)
+}
+
+func (c *Cipher) crypt(tweak []byte, msg []byte, encrypt bool) ([]byte, error) {
+	if len(msg) < 16 {
+		return nil, fmt.Errorf("hbsh: message must be at least 16 bytes long, is %d", len(msg))
+	}
+	out := make([]byte, len(msg))
+	n := len(msg) - 16
+	inL, outL := msg[:n], out[:n]
+	var m [16]byte
+	copy(m[:], msg[n:])
+	// Decryption runs the same steps as encryption, with the block cipher
+	// turned around
+	m = add(m, c.h.Sum(tweak, inL))
+	if encrypt {
+		c.bc.Encrypt(m[:], m[:])
+	}
+	c.s.XORKeyStream(m, outL, inL)
+	if !encrypt {
+		c.bc.Decrypt(m[:], m[:])
+	}
+	r := sub(m, c.h.Sum(tweak, outL))
+	copy(out[n:], r[:])
+	return out, nil
+}
+
+// add - a ⊞ b, little-endian modulo 2^128
+func add(a [16]byte, b [16]byte) [16]byte {
+	le := binary.LittleEndian
+	lo, carry := bits.Add64(le.Uint64(a[0:]), le.Uint64(b[0:]), 0)
+	hi, _ := bits.Add64(le.Uint64(a[8:]), le.Uint64(b[8:]), carry)
+	var out [16]byte
+	le.PutUint64(out[0:], lo)
+	le.PutUint64(out[8:], hi)
+	return out
+}
+
+// sub - a ⊟ b, little-endian modulo 2^128
+func sub(a [16]byte, b [16]byte) [16]byte {
+	le := binary.LittleEndian
+	lo, borrow := bits.Sub64(le.Uint64(a[0:]), le.Uint64(b[0:]), 0)
+	hi, _ := bits.Sub64(le.Uint64(a[8:]), le.Uint64(b[8:]), borrow)
+	var out [16]byte
+	le.PutUint64(out[0:], lo)
+	le.PutUint64(out[8:], hi)
+	return out
+}
@@ -0,0 +1,152 @@
+package hbsh
+
+import (
+	"bytes"
+	"crypto/des"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// The Poly1305 test vector of RFC 8439 section 2.5.2, with the one-time pad
+// "s" added to the hash as Poly1305 does
+func TestPoly1305Vector(t *testing.T) {
+	r := polyKey(unhex("85d6be7857556d337f4452fe42d506a8"))
+	var s [16]byte
+	copy(s[:], unhex("0103808afb0db2fd4abff6af4149f51b"))
+	tag := add(poly1305(r, []byte("Cryptographic Forum Research Group")), s)
+	if want := unhex("a8061dc1305136c6c22b8baf0c0127a9"); !bytes.Equal(tag[:], want) {
+		t.Errorf("tag = %x, want %x", tag, want)
+	}
+}
+
+// adiantumVector - a test vector in the JSON format of the Adiantum
+// reference implementation (github.com/google/adiantum)
+type adiantumVector struct {
+	Description string `json:"description"`
+	Input       struct {
+		Key   string `json:"key_hex"`
+		Tweak string `json:"tweak_hex"`
+	} `json:"input"`
+	Plaintext  string `json:"plaintext_hex"`
+	Ciphertext string `json:"ciphertext_hex"`
+}
+
+// testdata/Adiantum_XChaCha12_32_AES256.json holds one vector of every
+// message and tweak length of the reference implementation's vectors for
+// XChaCha12 and AES-256
+func TestAdiantumVectors(t *testing.T) {
+	b, err := os.ReadFile("testdata/Adiantum_XChaCha12_32_AES256.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []adiantumVector
+	if err := json.Unmarshal(b, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range vectors {
+		c, err := NewAdiantum(unhex(v.Input.Key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweak, plain, want := unhex(v.Input.Tweak), unhex(v.Plaintext), unhex(v.Ciphertext)
+		ct, err := c.Encrypt(tweak, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ct, want) {
+			t.Errorf("vector %d (%d bytes, %d byte tweak): encryption mismatch", i, len(plain), len(tweak))
+			continue
+		}
+		back, err := c.Decrypt(tweak, ct)
+		if err != nil || !bytes.Equal(back, plain) {
+			t.Errorf("vector %d: decryption mismatch: %v", i, err)
+		}
+	}
+}
+
+func TestAddSub(t *testing.T) {
+	var a, b [16]byte
+	for i := range a {
+		a[i] = 0xff
+	}
+	b[0] = 1
+	if got := add(a, b); got != ([16]byte{}) {
+		t.Errorf("add wraps to %x", got)
+	}
+	if got := sub([16]byte{}, b); got != a {
+		t.Errorf("sub wraps to %x", got)
+	}
+}
+
+func TestRoundtrip(t *testing.T) {
+	c, err := NewAESPoly(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := []byte("tweak")
+	for _, n := range []int{16, 17, 31, 32, 33, 100, 512, 4096} {
+		plain := make([]byte, n)
+		for i := range plain {
+			plain[i] = byte(i)
+		}
+		ct, err := c.Encrypt(tweak, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ct) != n || bytes.Equal(ct, plain) {
+			t.Fatalf("n=%d: bad ciphertext", n)
+		}
+		back, err := c.Decrypt(tweak, ct)
+		if err != nil || !bytes.Equal(back, plain) {
+			t.Errorf("n=%d: roundtrip failed: %v", n, err)
+		}
+		if ct2, _ := c.Encrypt([]byte("other"), plain); bytes.Equal(ct, ct2) {
+			t.Errorf("n=%d: tweak has no effect", n)
+		}
+	}
+}
+
+// A change anywhere in the plaintext must change the whole ciphertext, as
+// with any wide-block cipher
+func TestWideBlock(t *testing.T) {
+	c, err := NewAESPoly(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := make([]byte, 512)
+	ct, _ := c.Encrypt(nil, plain)
+	for _, pos := range []int{0, 300, 511} {
+		p := append([]byte{}, plain...)
+		p[pos] ^= 1
+		ct2, _ := c.Encrypt(nil, p)
+		for i := 0; i < len(ct); i += 16 {
+			if bytes.Equal(ct[i:i+16], ct2[i:i+16]) {
+				t.Errorf("flipping byte %d leaves ciphertext block %d unchanged", pos, i/16)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := NewAESPoly(make([]byte, 16)); err == nil {
+		t.Error("16-byte key accepted")
+	}
+	bc, _ := des.NewCipher(make([]byte, 8))
+	if _, err := New(nil, bc, nil); err == nil {
+		t.Error("8-byte block cipher accepted")
+	}
+	c, _ := NewAESPoly(make([]byte, 32))
+	if _, err := c.Encrypt(nil, make([]byte, 15)); err == nil {
+		t.Error("15-byte message accepted")
+	}
+}
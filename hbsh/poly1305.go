@@ -0,0 +1,109 @@
+package hbsh
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// Poly1305 (RFC 8439) without the final addition of the one-time pad "s",
+// as Adiantum uses it: the polynomial of the message evaluated at "r" modulo
+// 2^130 - 5. The accumulator is three 64-bit limbs, h2 holding the bits
+// above 128.
+
+// polyR - a clamped Poly1305 multiplier "r"
+type polyR struct {
+	r0, r1 uint64
+}
+
+// polyKey - the clamped Poly1305 multiplier from its 16 bytes
+func polyKey(b []byte) polyR {
+	le := binary.LittleEndian
+	return polyR{
+		r0: le.Uint64(b[0:8]) & 0x0ffffffc0fffffff,
+		r1: le.Uint64(b[8:16]) & 0x0ffffffc0ffffffc,
+	}
+}
+
+// polyState - a running Poly1305 evaluation. Every update but the last must
+// be a multiple of 16 bytes long.
+type polyState struct {
+	r          polyR
+	h0, h1, h2 uint64
+}
+
+func (s *polyState) update(msg []byte) {
+	le := binary.LittleEndian
+	h0, h1, h2 := s.h0, s.h1, s.h2
+	r0, r1 := s.r.r0, s.r.r1
+	for len(msg) > 0 {
+		var c uint64
+		if len(msg) >= 16 {
+			h0, c = bits.Add64(h0, le.Uint64(msg[0:8]), 0)
+			h1, c = bits.Add64(h1, le.Uint64(msg[8:16]), c)
+			h2 += c + 1
+			msg = msg[16:]
+		} else {
+			// The last, short chunk with a 1 byte appended
+			var buf [16]byte
+			copy(buf[:], msg)
+			buf[len(msg)] = 1
+			h0, c = bits.Add64(h0, le.Uint64(buf[0:8]), 0)
+			h1, c = bits.Add64(h1, le.Uint64(buf[8:16]), c)
+			h2 += c
+			msg = nil
+		}
+		// h *= r. h2 is at most 7 and r has its top bits clamped, so
+		// h2*r0 and h2*r1 fit in 64 bits.
+		h0r0hi, h0r0lo := bits.Mul64(h0, r0)
+		h1r0hi, h1r0lo := bits.Mul64(h1, r0)
+		h0r1hi, h0r1lo := bits.Mul64(h0, r1)
+		h1r1hi, h1r1lo := bits.Mul64(h1, r1)
+		h2r0 := h2 * r0
+		h2r1 := h2 * r1
+
+		m1lo, c1 := bits.Add64(h1r0lo, h0r1lo, 0)
+		m1hi, _ := bits.Add64(h1r0hi, h0r1hi, c1)
+		m2lo, c2 := bits.Add64(h2r0, h1r1lo, 0)
+		m2hi, _ := bits.Add64(0, h1r1hi, c2)
+
+		t0 := h0r0lo
+		t1, c := bits.Add64(m1lo, h0r0hi, 0)
+		t2, c := bits.Add64(m2lo, m1hi, c)
+		t3, _ := bits.Add64(h2r1, m2hi, c)
+
+		// Reduce: the bits from 130 on, times 2^130 = 5 = 4 + 1
+		h0, h1, h2 = t0, t1, t2&3
+		cLo, cHi := t2&^3, t3
+		h0, c = bits.Add64(h0, cLo, 0)
+		h1, c = bits.Add64(h1, cHi, c)
+		h2 += c
+		cLo, cHi = cLo>>2|cHi<<62, cHi>>2
+		h0, c = bits.Add64(h0, cLo, 0)
+		h1, c = bits.Add64(h1, cHi, c)
+		h2 += c
+	}
+	s.h0, s.h1, s.h2 = h0, h1, h2
+}
+
+// sum - the low 128 bits of the fully reduced accumulator, little-endian
+func (s *polyState) sum() [16]byte {
+	// h is below 2*(2^130 - 5), so subtracting the prime once is enough
+	t0, b := bits.Sub64(s.h0, 0xfffffffffffffffb, 0)
+	t1, b := bits.Sub64(s.h1, 0xffffffffffffffff, b)
+	_, b = bits.Sub64(s.h2, 3, b)
+	h0, h1 := s.h0, s.h1
+	if b == 0 {
+		h0, h1 = t0, t1
+	}
+	var out [16]byte
+	binary.LittleEndian.PutUint64(out[0:], h0)
+	binary.LittleEndian.PutUint64(out[8:], h1)
+	return out
+}
+
+// poly1305 - Poly1305 of "msg" under "r", without the one-time pad
+func poly1305(r polyR, msg []byte) [16]byte {
+	s := polyState{r: r}
+	s.update(msg)
+	return s.sum()
+}
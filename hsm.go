@@ -0,0 +1,89 @@
+package eme
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ECBSession is an HSM session holding an AES key, like a PKCS#11 session:
+// EncryptECB and DecryptECB run one C_EncryptInit/C_Encrypt (or
+// C_DecryptInit/C_Decrypt) with CKM_AES_ECB over "src", which is a multiple
+// of 16 bytes long. The method set matches a thin wrapper around the
+// Encrypt and Decrypt calls of the usual Go PKCS#11 bindings, so no binding
+// is imported here.
+type ECBSession interface {
+	EncryptECB(src []byte) ([]byte, error)
+	DecryptECB(src []byte) ([]byte, error)
+}
+
+// HSMError is the panic value of HSMBlock when the session fails.
+// cipher.Block has no way to return errors, so callers that need to handle
+// HSM failures must recover it.
+type HSMError struct {
+	Err error
+}
+
+func (e *HSMError) Error() string {
+	return "eme: HSM: " + e.Err.Error()
+}
+
+func (e *HSMError) Unwrap() error {
+	return e.Err
+}
+
+// HSMBlock is a cipher.Block whose key never leaves an HSM. It is a
+// BlockBatcher, so an EME transformation of any size costs three round trips
+// to the HSM (EMECipher and Transform add one more to derive L; PageCipher
+// does that only once). Calls are serialized, because PKCS#11 sessions must
+// not be used concurrently. HSMBlock panics with an *HSMError when the
+// session fails.
+type HSMBlock struct {
+	mu      sync.Mutex
+	session ECBSession
+}
+
+// NewHSMBlock returns an HSMBlock using "session".
+func NewHSMBlock(session ECBSession) *HSMBlock {
+	return &HSMBlock{session: session}
+}
+
+// BlockSize returns 16.
+func (b *HSMBlock) BlockSize() int {
+	return 16
+}
+
+// Encrypt encrypts one block.
+func (b *HSMBlock) Encrypt(dst []byte, src []byte) {
+	b.EncryptBlocks(dst[:16], src[:16])
+}
+
+// Decrypt decrypts one block.
+func (b *HSMBlock) Decrypt(dst []byte, src []byte) {
+	b.DecryptBlocks(dst[:16], src[:16])
+}
+
+// EncryptBlocks implements BlockBatcher.
+func (b *HSMBlock) EncryptBlocks(dst []byte, src []byte) {
+	b.do(dst, src, b.session.EncryptECB)
+}
+
+// DecryptBlocks implements BlockBatcher.
+func (b *HSMBlock) DecryptBlocks(dst []byte, src []byte) {
+	b.do(dst, src, b.session.DecryptECB)
+}
+
+func (b *HSMBlock) do(dst []byte, src []byte, op func([]byte) ([]byte, error)) {
+	if len(src)%16 != 0 || len(dst) < len(src) {
+		paramPanicf(ErrDataSize, "HSMBlock: bad lengths src=%d dst=%d", len(src), len(dst))
+	}
+	b.mu.Lock()
+	out, err := op(src)
+	b.mu.Unlock()
+	if err == nil && len(out) != len(src) {
+		err = fmt.Errorf("returned %d bytes for %d", len(out), len(src))
+	}
+	if err != nil {
+		panic(&HSMError{Err: err})
+	}
+	copy(dst, out)
+}
@@ -0,0 +1,93 @@
+package eme_test
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emetest"
+)
+
+// fakeSession - an ECBSession backed by a software AES key
+type fakeSession struct {
+	bc    cipher.Block
+	calls int
+	err   error
+}
+
+func (s *fakeSession) EncryptECB(src []byte) ([]byte, error) {
+	return s.ecb(src, s.bc.Encrypt)
+}
+
+func (s *fakeSession) DecryptECB(src []byte) ([]byte, error) {
+	return s.ecb(src, s.bc.Decrypt)
+}
+
+func (s *fakeSession) ecb(src []byte, f func(dst, src []byte)) ([]byte, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	out := make([]byte, len(src))
+	for i := 0; i < len(src); i += 16 {
+		f(out[i:i+16], src[i:i+16])
+	}
+	return out, nil
+}
+
+func newFakeSession(t testing.TB, key []byte) *fakeSession {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeSession{bc: bc}
+}
+
+func TestHSMBlockRoundTrip(t *testing.T) {
+	emetest.RoundTripSizes(t, func(key []byte) eme.TweakableBlockCipher {
+		return eme.New(eme.NewHSMBlock(newFakeSession(t, key)))
+	}, []int{16, 32, 528, 2048})
+}
+
+func TestHSMBlockMatchesAES(t *testing.T) {
+	key := make([]byte, 32)
+	s := newFakeSession(t, key)
+	hsm := eme.NewHSMBlock(s)
+	tweak := make([]byte, 16)
+	for _, n := range []int{16, 512, 2048} {
+		in := bytes.Repeat([]byte{byte(n)}, n)
+		s.calls = 0
+		got := eme.Transform(hsm, tweak, in, eme.DirectionEncrypt)
+		if want := eme.Transform(s.bc, tweak, in, eme.DirectionEncrypt); !bytes.Equal(got, want) {
+			t.Errorf("n=%d: output differs from AES", n)
+		}
+		// L, the two ECB passes and MC
+		if s.calls != 4 {
+			t.Errorf("n=%d: %d HSM calls, want 4", n, s.calls)
+		}
+	}
+
+	pc := eme.NewPageCipher(hsm, 4096)
+	page := make([]byte, 4096)
+	s.calls = 0
+	pc.EncryptPage(1, page)
+	// Two 2048-byte segments with 3 calls each
+	if s.calls != 6 {
+		t.Errorf("EncryptPage: %d HSM calls, want 6", s.calls)
+	}
+}
+
+func TestHSMBlockError(t *testing.T) {
+	s := newFakeSession(t, make([]byte, 32))
+	s.err = errors.New("CKR_DEVICE_REMOVED")
+	defer func() {
+		var he *eme.HSMError
+		if err, _ := recover().(error); !errors.As(err, &he) || !errors.Is(err, s.err) {
+			t.Errorf("want an *HSMError wrapping the session error, got %v", err)
+		}
+	}()
+	eme.New(eme.NewHSMBlock(s)).Encrypt(make([]byte, 16), make([]byte, 16))
+}
@@ -0,0 +1,127 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"io"
+	"net/http"
+)
+
+// EnvelopeEncoding is the Content-Encoding of HTTP bodies encrypted as
+// envelopes (see NewEnvelopeWriter).
+const EnvelopeEncoding = "x-eme-envelope"
+
+// Handler returns an http.Handler that decrypts request bodies sent with
+// Content-Encoding EnvelopeEncoding before passing them to "h", and always
+// encrypts the response body as an envelope.
+func Handler(h http.Handler, bc cipher.Block) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Content-Encoding") == EnvelopeEncoding {
+			er, err := NewEnvelopeReader(req.Body, bc)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			req.Body = readCloser{er, req.Body}
+			req.Header.Del("Content-Encoding")
+			req.ContentLength = -1
+		}
+		ew := &envelopeResponseWriter{ResponseWriter: w, bc: bc}
+		h.ServeHTTP(ew, req)
+		ew.WriteHeader(http.StatusOK)
+		if ew.ew != nil {
+			ew.ew.Close()
+		}
+	})
+}
+
+// envelopeResponseWriter - encrypts the response body
+type envelopeResponseWriter struct {
+	http.ResponseWriter
+	bc          cipher.Block
+	wroteHeader bool
+	ew          *Writer
+}
+
+func (w *envelopeResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", EnvelopeEncoding)
+	w.ResponseWriter.WriteHeader(code)
+	// An error here shows up again on every Write
+	w.ew, _ = NewEnvelopeWriter(w.ResponseWriter, w.bc)
+}
+
+func (w *envelopeResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.ew == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return w.ew.Write(p)
+}
+
+// Transport is an http.RoundTripper that encrypts request bodies as envelopes
+// and decrypts response bodies sent with Content-Encoding EnvelopeEncoding.
+// It is the client side of Handler.
+type Transport struct {
+	// Base sends the requests. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+	bc   cipher.Block
+}
+
+// NewTransport returns a Transport using "bc" on top of "base", which may be
+// nil.
+func NewTransport(base http.RoundTripper, bc cipher.Block) *Transport {
+	return &Transport{Base: base, bc: bc}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body := req.Body
+		pr, pw := io.Pipe()
+		go func() {
+			defer body.Close()
+			ew, err := NewEnvelopeWriter(pw, t.bc)
+			if err == nil {
+				if _, err = io.Copy(ew, body); err == nil {
+					err = ew.Close()
+				}
+			}
+			pw.CloseWithError(err)
+		}()
+		req = req.Clone(req.Context())
+		req.Body = pr
+		req.GetBody = nil
+		req.ContentLength = -1
+		req.Header.Set("Content-Encoding", EnvelopeEncoding)
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Header.Get("Content-Encoding") == EnvelopeEncoding {
+		er, err := NewEnvelopeReader(resp.Body, t.bc)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = readCloser{er, resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
+// readCloser - reads from Reader, closes Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
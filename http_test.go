@@ -0,0 +1,44 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var onWire []byte
+	echo := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		w.Write(bytes.ToUpper(body))
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		onWire, _ = io.ReadAll(req.Body)
+		req.Body = io.NopCloser(bytes.NewReader(onWire))
+		Handler(echo, bc).ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: NewTransport(nil, bc)}
+	resp, err := client.Post(srv.URL, "text/plain", bytes.NewReader([]byte("secret message")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "SECRET MESSAGE" {
+		t.Errorf("wrong response %q", got)
+	}
+	if bytes.Contains(onWire, []byte("secret")) {
+		t.Errorf("request body sent in plaintext")
+	}
+}
@@ -0,0 +1,246 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// escrowHybrid - the algorithm identifier of WrapKeyHybrid, next to those of
+// escrow.go
+const escrowHybrid = 3
+
+// hybridLabel - the HKDF info of WrapKeyHybrid
+const hybridLabel = "github.com/rfjakob/eme hybrid ML-KEM-768+X25519 v1"
+
+// HybridPublicKeySize is the length of HybridPublicKey.Bytes.
+const HybridPublicKeySize = mlkem.EncapsulationKeySize768 + 32
+
+// HybridPrivateKeySize is the length of HybridPrivateKey.Bytes.
+const HybridPrivateKeySize = mlkem.SeedSize + 32
+
+// HybridPublicKey is the public key of WrapKeyHybrid: an ML-KEM-768
+// encapsulation key and an X25519 public key.
+type HybridPublicKey struct {
+	kem *mlkem.EncapsulationKey768
+	x   *ecdh.PublicKey
+}
+
+// HybridPrivateKey is the private key of UnwrapKeyHybrid.
+type HybridPrivateKey struct {
+	kem *mlkem.DecapsulationKey768
+	x   *ecdh.PrivateKey
+}
+
+// GenerateHybridKey returns a new random HybridPrivateKey.
+func GenerateHybridKey() (*HybridPrivateKey, error) {
+	kem, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, err
+	}
+	x, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &HybridPrivateKey{kem: kem, x: x}, nil
+}
+
+// NewHybridPrivateKey parses the output of HybridPrivateKey.Bytes.
+func NewHybridPrivateKey(b []byte) (*HybridPrivateKey, error) {
+	if len(b) != HybridPrivateKeySize {
+		return nil, fmt.Errorf("eme: hybrid private key must be %d bytes long, is %d", HybridPrivateKeySize, len(b))
+	}
+	kem, err := mlkem.NewDecapsulationKey768(b[:mlkem.SeedSize])
+	if err != nil {
+		return nil, err
+	}
+	x, err := ecdh.X25519().NewPrivateKey(b[mlkem.SeedSize:])
+	if err != nil {
+		return nil, err
+	}
+	return &HybridPrivateKey{kem: kem, x: x}, nil
+}
+
+// Bytes returns the ML-KEM-768 seed followed by the X25519 private key. It is
+// secret.
+func (k *HybridPrivateKey) Bytes() []byte {
+	return append(k.kem.Bytes(), k.x.Bytes()...)
+}
+
+// PublicKey returns the public key of "k".
+func (k *HybridPrivateKey) PublicKey() *HybridPublicKey {
+	return &HybridPublicKey{kem: k.kem.EncapsulationKey(), x: k.x.PublicKey()}
+}
+
+// NewHybridPublicKey parses the output of HybridPublicKey.Bytes.
+func NewHybridPublicKey(b []byte) (*HybridPublicKey, error) {
+	if len(b) != HybridPublicKeySize {
+		return nil, fmt.Errorf("eme: hybrid public key must be %d bytes long, is %d", HybridPublicKeySize, len(b))
+	}
+	kem, err := mlkem.NewEncapsulationKey768(b[:mlkem.EncapsulationKeySize768])
+	if err != nil {
+		return nil, err
+	}
+	x, err := ecdh.X25519().NewPublicKey(b[mlkem.EncapsulationKeySize768:])
+	if err != nil {
+		return nil, err
+	}
+	return &HybridPublicKey{kem: kem, x: x}, nil
+}
+
+// Bytes returns the ML-KEM-768 encapsulation key followed by the X25519
+// public key.
+func (k *HybridPublicKey) Bytes() []byte {
+	return append(k.kem.Bytes(), k.x.Bytes()...)
+}
+
+// WrapKeyHybrid encrypts the data key "key" to "pub" with both ML-KEM-768 and
+// X25519, like WrapKeyECIES. The key-encryption key is derived with
+// HKDF-SHA256 from both shared secrets, so the wrapped key stays safe as long
+// as either of them does: ML-KEM protects it against data recorded today and
+// broken later with a quantum computer, and X25519 against a weakness in the
+// much younger ML-KEM. The result is an algorithm byte, the ML-KEM
+// ciphertext (1088 bytes), the ephemeral X25519 public key (32 bytes) and the
+// key wrapped with WrapKey. Keep it in a container header with
+// ContainerOptions.Escrow, or use NewHybridEnvelopeWriter.
+func WrapKeyHybrid(pub *HybridPublicKey, key []byte) ([]byte, error) {
+	kemShared, kemCT := pub.kem.Encapsulate()
+	defer clear(kemShared)
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	xShared, err := eph.ECDH(pub.x)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(xShared)
+	ephPub := eph.PublicKey().Bytes()
+	kek, err := hybridKEK(kemShared, xShared, kemCT, ephPub, pub.x.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := WrapKey(kek, key)
+	if err != nil {
+		return nil, err
+	}
+	b := append([]byte{escrowHybrid}, kemCT...)
+	b = append(b, ephPub...)
+	return append(b, wrapped...), nil
+}
+
+// UnwrapKeyHybrid reverses WrapKeyHybrid.
+func UnwrapKeyHybrid(priv *HybridPrivateKey, wrapped []byte) ([]byte, error) {
+	const n = 1 + mlkem.CiphertextSize768 + 32
+	if len(wrapped) == 0 || wrapped[0] != escrowHybrid {
+		return nil, errors.New("eme: not a hybrid-wrapped key")
+	}
+	if len(wrapped) < n {
+		return nil, errors.New("eme: hybrid-wrapped key is truncated")
+	}
+	kemCT := wrapped[1 : n-32]
+	ephPub := wrapped[n-32 : n]
+	kemShared, err := priv.kem.Decapsulate(kemCT)
+	if err != nil {
+		return nil, fmt.Errorf("eme: hybrid-wrapped key: %w", err)
+	}
+	defer clear(kemShared)
+	eph, err := ecdh.X25519().NewPublicKey(ephPub)
+	if err != nil {
+		return nil, fmt.Errorf("eme: hybrid-wrapped key: %w", err)
+	}
+	xShared, err := priv.x.ECDH(eph)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(xShared)
+	kek, err := hybridKEK(kemShared, xShared, kemCT, ephPub, priv.x.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return UnwrapKey(kek, wrapped[n:])
+}
+
+// hybridKEK - the key-encryption key of WrapKeyHybrid. Like X-Wing, it binds
+// the ciphertext and the X25519 public keys, since ML-KEM already binds its
+// own encapsulation key.
+func hybridKEK(kemShared []byte, xShared []byte, kemCT []byte, ephPub []byte, xPub []byte) (cipher.Block, error) {
+	ikm := append(append([]byte{}, kemShared...), xShared...)
+	defer clear(ikm)
+	salt := append(append(append([]byte{}, kemCT...), ephPub...), xPub...)
+	key, err := hkdf.Key(sha256.New, ikm, salt, hybridLabel, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	return aes.NewCipher(key)
+}
+
+// hybridEnvelopeMagic - starts every hybrid envelope
+var hybridEnvelopeMagic = []byte("EMEHYB\x00\x01")
+
+// A hybrid envelope is an envelope under a random data key that is wrapped
+// for a HybridPublicKey:
+//
+//	magic "EMEHYB\x00\x01" | length of the wrapped key, uint16 BE |
+//	WrapKeyHybrid output | envelope
+
+// NewHybridEnvelopeWriter writes a hybrid envelope header to "w", with a
+// random AES-256 data key wrapped for "pub", and returns a Writer for the
+// content. Close must be called to finish the envelope.
+func NewHybridEnvelopeWriter(w io.Writer, pub *HybridPublicKey) (*Writer, error) {
+	key := make([]byte, 32)
+	defer clear(key)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := WrapKeyHybrid(pub, key)
+	if err != nil {
+		return nil, err
+	}
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	hdr := append([]byte{}, hybridEnvelopeMagic...)
+	hdr = binary.BigEndian.AppendUint16(hdr, uint16(len(wrapped)))
+	if _, err := w.Write(append(hdr, wrapped...)); err != nil {
+		return nil, err
+	}
+	return NewEnvelopeWriter(w, bc)
+}
+
+// NewHybridEnvelopeReader unwraps the data key of the hybrid envelope in "r"
+// with "priv" and returns a Reader for the content.
+func NewHybridEnvelopeReader(r io.Reader, priv *HybridPrivateKey) (*Reader, error) {
+	hdr := make([]byte, len(hybridEnvelopeMagic)+2)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("eme: reading hybrid envelope header: %w", err)
+	}
+	if !bytes.Equal(hdr[:len(hybridEnvelopeMagic)], hybridEnvelopeMagic) {
+		return nil, errors.New("eme: not a hybrid envelope")
+	}
+	wrapped := make([]byte, binary.BigEndian.Uint16(hdr[len(hybridEnvelopeMagic):]))
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return nil, fmt.Errorf("eme: reading hybrid envelope header: %w", err)
+	}
+	key, err := UnwrapKeyHybrid(priv, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewEnvelopeReader(r, bc)
+}
@@ -0,0 +1,92 @@
+package eme
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestWrapKeyHybrid(t *testing.T) {
+	priv, err := GenerateHybridKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{7}, 32)
+	w, err := WrapKeyHybrid(priv.PublicKey(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := UnwrapKeyHybrid(priv, w); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("UnwrapKeyHybrid = %x, %v", got, err)
+	}
+	other, _ := GenerateHybridKey()
+	if _, err = UnwrapKeyHybrid(other, w); err == nil {
+		t.Errorf("wrong private key was accepted")
+	}
+	if _, err = UnwrapKeyECIES(nil, w); err == nil {
+		t.Errorf("hybrid key passed as ECIES")
+	}
+	// Either half of the key agreement must matter
+	for _, pos := range []int{1, 1 + 1088, len(w) - 1} {
+		bad := append([]byte{}, w...)
+		bad[pos] ^= 1
+		if _, err = UnwrapKeyHybrid(priv, bad); err == nil {
+			t.Errorf("modified byte %d was accepted", pos)
+		}
+	}
+	if _, err = UnwrapKeyHybrid(priv, w[:100]); err == nil {
+		t.Errorf("truncated key was accepted")
+	}
+}
+
+func TestHybridKeyBytes(t *testing.T) {
+	priv, _ := GenerateHybridKey()
+	priv2, err := NewHybridPrivateKey(priv.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := NewHybridPublicKey(priv.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(priv.Bytes()) != HybridPrivateKeySize || len(pub.Bytes()) != HybridPublicKeySize {
+		t.Errorf("key sizes %d and %d", len(priv.Bytes()), len(pub.Bytes()))
+	}
+	w, _ := WrapKeyHybrid(pub, make([]byte, 16))
+	if _, err = UnwrapKeyHybrid(priv2, w); err != nil {
+		t.Errorf("parsed keys do not match: %v", err)
+	}
+	if _, err = NewHybridPublicKey(priv.Bytes()); err == nil {
+		t.Errorf("private key parsed as public key")
+	}
+}
+
+func TestHybridEnvelope(t *testing.T) {
+	priv, _ := GenerateHybridKey()
+	plain := bytes.Repeat([]byte("hybrid "), 1000)
+	var buf bytes.Buffer
+	w, err := NewHybridEnvelopeWriter(&buf, priv.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plain)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	env := buf.Bytes()
+	r, err := NewHybridEnvelopeReader(bytes.NewReader(env), priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("roundtrip failed: %v", err)
+	}
+	other, _ := GenerateHybridKey()
+	if _, err = NewHybridEnvelopeReader(bytes.NewReader(env), other); err == nil {
+		t.Errorf("wrong private key was accepted")
+	}
+	if _, err = NewHybridEnvelopeReader(bytes.NewReader(plain), priv); err == nil {
+		t.Errorf("plaintext accepted as hybrid envelope")
+	}
+}
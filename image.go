@@ -0,0 +1,281 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultCheckpointInterval is the number of sectors EncryptImage and
+// DecryptImage process between two checkpoints if
+// ImageOptions.CheckpointInterval is zero.
+const DefaultCheckpointInterval = 256
+
+// ImageOptions control EncryptImage and DecryptImage.
+type ImageOptions struct {
+	// SectorSize is the size of the independently encrypted sectors. It must
+	// be acceptable to NewPageCipher. Defaults to 512.
+	SectorSize int
+	// Checkpoint is the path of the sidecar file that records progress.
+	// Defaults to the image path with ".eme-progress" appended.
+	Checkpoint string
+	// CheckpointInterval is the number of sectors written between
+	// checkpoints. Defaults to DefaultCheckpointInterval.
+	CheckpointInterval int
+	// Sparse selects how holes and all-zero sectors are handled. It must be
+	// the same for EncryptImage and DecryptImage. With SparsePreserve, empty
+	// sectors are never written, so holes stay holes.
+	Sparse SparsePolicy
+	// Tracer, if set, gets a span for the whole conversion
+	Tracer Tracer
+}
+
+func (o ImageOptions) withDefaults(path string) (ImageOptions, error) {
+	if o.SectorSize == 0 {
+		o.SectorSize = 512
+	}
+	if err := CheckPageSize(o.SectorSize); err != nil {
+		return o, err
+	}
+	if o.Checkpoint == "" {
+		o.Checkpoint = path + ".eme-progress"
+	}
+	if o.CheckpointInterval == 0 {
+		o.CheckpointInterval = DefaultCheckpointInterval
+	}
+	return o, nil
+}
+
+// EncryptImage encrypts the raw image file at "path" in place. Sector "n" is
+// encrypted with a PageCipher under page number "n". The image size must be a
+// multiple of the sector size.
+//
+// Progress is recorded in a sidecar file (see ImageOptions.Checkpoint). If
+// the process is interrupted, calling EncryptImage again with the same
+// options resumes where it stopped. The sidecar is removed when the whole
+// image has been converted.
+func EncryptImage(path string, bc cipher.Block, opts ImageOptions) (err error) {
+	span := startSpan(opts.Tracer, "eme.EncryptImage")
+	defer func() { span.End(err) }()
+	return transformImage(path, bc, opts, DirectionEncrypt, span)
+}
+
+// DecryptImage is the inverse of EncryptImage and resumes in the same way.
+func DecryptImage(path string, bc cipher.Block, opts ImageOptions) (err error) {
+	span := startSpan(opts.Tracer, "eme.DecryptImage")
+	defer func() { span.End(err) }()
+	return transformImage(path, bc, opts, DirectionDecrypt, span)
+}
+
+func transformImage(path string, bc cipher.Block, opts ImageOptions, direction directionConst, span Span) error {
+	opts, err := opts.withDefaults(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	sectorSize := int64(opts.SectorSize)
+	if fi.Size()%sectorSize != 0 {
+		return fmt.Errorf("image size %d is not a multiple of the sector size %d", fi.Size(), sectorSize)
+	}
+	sectors := uint64(fi.Size() / sectorSize)
+	pc := NewPageCipher(bc, opts.SectorSize)
+	span.SetAttribute(AttrSectorSize, sectorSize)
+	span.SetAttribute(AttrSectors, int64(sectors))
+	span.SetAttribute(AttrBytes, fi.Size())
+
+	// Replay the journaled batch, if any. It was transformed completely before
+	// the checkpoint was written, so writing it again is always safe. Like the
+	// batches below, it skips the zero sectors that SparsePreserve left alone.
+	sparse := opts.Sparse == SparsePreserve
+	next := uint64(0)
+	cp, err := loadCheckpoint(opts.Checkpoint)
+	if err == nil {
+		if cp.direction != direction || cp.sectorSize != uint32(opts.SectorSize) {
+			return fmt.Errorf("checkpoint %q was written with different parameters", opts.Checkpoint)
+		}
+		if cp.sector+uint64(len(cp.data))/uint64(sectorSize) > sectors {
+			return fmt.Errorf("checkpoint %q is beyond the end of the image", opts.Checkpoint)
+		}
+		if err = writeBatch(f, cp.data, int64(cp.sector)*sectorSize, opts.SectorSize, sparse); err != nil {
+			return err
+		}
+		if err = f.Sync(); err != nil {
+			return err
+		}
+		next = cp.sector + uint64(len(cp.data))/uint64(sectorSize)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	holes := newHoleFinder(f, fi.Size())
+	buf := make([]byte, opts.CheckpointInterval*opts.SectorSize)
+	for next < sectors {
+		n := uint64(opts.CheckpointInterval)
+		if sectors-next < n {
+			n = sectors - next
+		}
+		batch := buf[:n*uint64(sectorSize)]
+		off := int64(next) * sectorSize
+		if sparse && holes.isHole(off, int64(len(batch))) {
+			next += n
+			continue
+		}
+		if _, err = f.ReadAt(batch, off); err != nil {
+			return err
+		}
+		if sparse {
+			for i := uint64(0); i < n; i++ {
+				sec := batch[i*uint64(sectorSize) : (i+1)*uint64(sectorSize)]
+				if allZero(sec) {
+					continue
+				}
+				pc.transformPage(next+i, sec, direction)
+			}
+		} else {
+			pc.transformRange(next, batch, direction)
+		}
+		// Journal the transformed batch before touching the image
+		cp = checkpoint{
+			direction:  direction,
+			sectorSize: uint32(opts.SectorSize),
+			sector:     next,
+			data:       batch,
+		}
+		if err = cp.save(opts.Checkpoint); err != nil {
+			return err
+		}
+		if err = writeBatch(f, batch, off, opts.SectorSize, sparse); err != nil {
+			return err
+		}
+		if err = f.Sync(); err != nil {
+			return err
+		}
+		next += n
+	}
+	return os.Remove(opts.Checkpoint)
+}
+
+// writeBatch - write "batch" at "off". With "sparse", runs of all-zero sectors
+// (which were left untouched) are skipped so that holes are not filled.
+func writeBatch(f *os.File, batch []byte, off int64, sectorSize int, sparse bool) error {
+	if !sparse {
+		_, err := f.WriteAt(batch, off)
+		return err
+	}
+	start := -1
+	for i := 0; i <= len(batch); i += sectorSize {
+		if i < len(batch) && !allZero(batch[i:i+sectorSize]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			if _, err := f.WriteAt(batch[start:i], off+int64(start)); err != nil {
+				return err
+			}
+			start = -1
+		}
+	}
+	return nil
+}
+
+// checkpointMagic identifies checkpoint sidecar files
+var checkpointMagic = []byte("EMEPROG1")
+
+// checkpoint - on-disk progress record. "data" is the already transformed
+// content of the batch starting at sector "sector". Everything before that
+// batch has been completely written to the image.
+//
+// File layout: magic (8 bytes), direction (1 byte), sector size (uint32),
+// sector (uint64), data length (uint32), data. All integers are big-endian.
+type checkpoint struct {
+	direction  directionConst
+	sectorSize uint32
+	sector     uint64
+	data       []byte
+}
+
+func (c *checkpoint) save(path string) error {
+	var b bytes.Buffer
+	b.Write(checkpointMagic)
+	if c.direction == DirectionEncrypt {
+		b.WriteByte(1)
+	} else {
+		b.WriteByte(0)
+	}
+	var hdr [16]byte
+	binary.BigEndian.PutUint32(hdr[0:4], c.sectorSize)
+	binary.BigEndian.PutUint64(hdr[4:12], c.sector)
+	binary.BigEndian.PutUint32(hdr[12:16], uint32(len(c.data)))
+	b.Write(hdr[:])
+	b.Write(c.data)
+	return writeFileAtomic(path, b.Bytes())
+}
+
+func loadCheckpoint(path string) (checkpoint, error) {
+	var c checkpoint
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if len(buf) < len(checkpointMagic)+17 || !bytes.Equal(buf[:len(checkpointMagic)], checkpointMagic) {
+		return c, fmt.Errorf("%q is not a checkpoint file", path)
+	}
+	buf = buf[len(checkpointMagic):]
+	c.direction = directionConst(buf[0] == 1)
+	c.sectorSize = binary.BigEndian.Uint32(buf[1:5])
+	c.sector = binary.BigEndian.Uint64(buf[5:13])
+	n := binary.BigEndian.Uint32(buf[13:17])
+	c.data = buf[17:]
+	if uint32(len(c.data)) != n || c.sectorSize == 0 || n%c.sectorSize != 0 {
+		return c, errors.New("checkpoint file is truncated or corrupt")
+	}
+	return c, nil
+}
+
+// writeFileAtomic - replace the file at "path" with "data" so that a crash
+// leaves either the old or the new content, never a mix.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	// Persist the rename itself
+	d, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err = d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
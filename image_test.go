@@ -0,0 +1,116 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestImage(t *testing.T, size int) (string, []byte) {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i / 3)
+	}
+	path := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func TestImageRoundtrip(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, orig := writeTestImage(t, 512*10)
+	opts := ImageOptions{CheckpointInterval: 3}
+	if err = EncryptImage(path, bc, opts); err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := os.ReadFile(path)
+	pc := NewPageCipher(bc, 512)
+	want := append([]byte{}, orig...)
+	for i := 0; i < 10; i++ {
+		pc.EncryptPage(uint64(i), want[i*512:(i+1)*512])
+	}
+	if !bytes.Equal(enc, want) {
+		t.Errorf("encrypted image differs from PageCipher output")
+	}
+	if _, err = os.Stat(path + ".eme-progress"); !os.IsNotExist(err) {
+		t.Errorf("checkpoint was not removed: %v", err)
+	}
+	if err = DecryptImage(path, bc, opts); err != nil {
+		t.Fatal(err)
+	}
+	dec, _ := os.ReadFile(path)
+	if !bytes.Equal(dec, orig) {
+		t.Errorf("roundtrip failed")
+	}
+}
+
+// Simulate a crash in the middle of writing the second batch: the first batch
+// is encrypted, the second one is garbage, and the checkpoint holds the
+// encrypted second batch.
+func TestImageResume(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, orig := writeTestImage(t, 512*8)
+	pc := NewPageCipher(bc, 512)
+	want := append([]byte{}, orig...)
+	for i := 0; i < 8; i++ {
+		pc.EncryptPage(uint64(i), want[i*512:(i+1)*512])
+	}
+	crashed := append([]byte{}, orig...)
+	copy(crashed, want[:2*512])
+	for i := 2 * 512; i < 3*512; i++ {
+		crashed[i] = 0xff
+	}
+	if err = os.WriteFile(path, crashed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cp := checkpoint{
+		direction:  DirectionEncrypt,
+		sectorSize: 512,
+		sector:     2,
+		data:       want[2*512 : 4*512],
+	}
+	if err = cp.save(path + ".eme-progress"); err != nil {
+		t.Fatal(err)
+	}
+	if err = EncryptImage(path, bc, ImageOptions{CheckpointInterval: 2}); err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := os.ReadFile(path)
+	if !bytes.Equal(enc, want) {
+		t.Errorf("resumed image differs from expected ciphertext")
+	}
+	// A checkpoint for the other direction must be rejected
+	cp.direction = DirectionDecrypt
+	if err = cp.save(path + ".eme-progress"); err != nil {
+		t.Fatal(err)
+	}
+	if err = EncryptImage(path, bc, ImageOptions{}); err == nil {
+		t.Errorf("mismatching checkpoint was accepted")
+	}
+}
+
+func TestImageBadSize(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := writeTestImage(t, 1000)
+	if err = EncryptImage(path, bc, ImageOptions{}); err == nil {
+		t.Errorf("unaligned image was accepted")
+	}
+	path, _ = writeTestImage(t, 6000)
+	if err = EncryptImage(path, bc, ImageOptions{SectorSize: 3000}); !errors.Is(err, ErrPageSize) {
+		t.Errorf("sector size 3000: got %v", err)
+	}
+}
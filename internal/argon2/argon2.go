@@ -0,0 +1,240 @@
+// Package argon2 implements Argon2id (RFC 9106), which the standard library
+// does not provide.
+//
+// It is not golang.org/x/crypto/argon2 because this module has no
+// dependencies outside the standard library, and key derivation is not worth
+// the first one. The tests check it against the vectors of RFC 9106 and of
+// the reference implementation, and against x/crypto at parameters that
+// cover several passes, lanes, odd memory sizes and long keys.
+package argon2
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+	"sync"
+
+	"github.com/rfjakob/eme/internal/blake2b"
+)
+
+const (
+	version    = 0x13
+	typeID     = 2
+	syncPoints = 4
+	// blockWords - 64-bit words in a 1 KiB memory block
+	blockWords = 128
+)
+
+type block [blockWords]uint64
+
+// IDKey derives a "keyLen"-byte key from "password" and "salt" with
+// Argon2id, making "time" passes over "memory" KiB in "threads" lanes.
+func IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	return deriveKey(password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// deriveKey - Argon2id with the optional secret and associated data
+func deriveKey(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	switch {
+	case time < 1:
+		return nil, errors.New("argon2: time must be at least 1")
+	case threads < 1:
+		return nil, errors.New("argon2: threads must be at least 1")
+	case memory < 8*uint32(threads):
+		return nil, errors.New("argon2: memory must be at least 8 KiB per thread")
+	case keyLen < 4:
+		return nil, errors.New("argon2: key must be at least 4 bytes long")
+	}
+	le := func(v uint32) []byte { return binary.LittleEndian.AppendUint32(nil, v) }
+	h0 := blake2b.Sum(64,
+		le(uint32(threads)), le(keyLen), le(memory), le(time), le(version), le(typeID),
+		le(uint32(len(password))), password,
+		le(uint32(len(salt))), salt,
+		le(uint32(len(secret))), secret,
+		le(uint32(len(data))), data)
+	defer clear(h0)
+
+	lanes := uint32(threads)
+	laneLen := memory / (syncPoints * lanes) * syncPoints
+	segLen := laneLen / syncPoints
+	B := make([]block, laneLen*lanes)
+	defer clear(B)
+	for l := uint32(0); l < lanes; l++ {
+		for i := uint32(0); i < 2; i++ {
+			b := hashLong(1024, h0, le(i), le(l))
+			for k := range B[l*laneLen+i] {
+				B[l*laneLen+i][k] = binary.LittleEndian.Uint64(b[8*k:])
+			}
+			clear(b)
+		}
+	}
+
+	segment := func(pass, slice, lane uint32) {
+		var addresses, in, zero block
+		dataIndependent := pass == 0 && slice < syncPoints/2
+		if dataIndependent {
+			in[0], in[1], in[2] = uint64(pass), uint64(lane), uint64(slice)
+			in[3], in[4], in[5] = uint64(laneLen*lanes), uint64(time), typeID
+		}
+		index := uint32(0)
+		if pass == 0 && slice == 0 {
+			// The first two blocks are already computed
+			index = 2
+			if dataIndependent {
+				nextAddresses(&addresses, &in, &zero)
+			}
+		}
+		offset := lane*laneLen + slice*segLen + index
+		for ; index < segLen; index, offset = index+1, offset+1 {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += laneLen
+			}
+			var pseudoRand uint64
+			if dataIndependent {
+				if index%blockWords == 0 {
+					nextAddresses(&addresses, &in, &zero)
+				}
+				pseudoRand = addresses[index%blockWords]
+			} else {
+				pseudoRand = B[prev][0]
+			}
+			ref := refIndex(pseudoRand, laneLen, segLen, lanes, pass, slice, lane, index)
+			var out block
+			compress(&out, &B[prev], &B[ref])
+			for k := range out {
+				B[offset][k] ^= out[k]
+			}
+		}
+	}
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < lanes; lane++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					segment(pass, slice, lane)
+				}()
+			}
+			wg.Wait()
+		}
+	}
+
+	var final block
+	for l := uint32(0); l < lanes; l++ {
+		for k, v := range B[l*laneLen+laneLen-1] {
+			final[k] ^= v
+		}
+	}
+	fb := make([]byte, 1024)
+	defer clear(fb)
+	for k, v := range final {
+		binary.LittleEndian.PutUint64(fb[8*k:], v)
+	}
+	return hashLong(int(keyLen), fb), nil
+}
+
+// nextAddresses - the next block of Argon2i reference addresses
+func nextAddresses(addresses, in, zero *block) {
+	in[6]++
+	compress(addresses, zero, in)
+	compress(addresses, zero, addresses)
+}
+
+// refIndex - the block referenced from position "index" of the segment
+// (RFC 9106, section 3.4.1.2)
+func refIndex(pseudoRand uint64, laneLen, segLen, lanes, pass, slice, lane, index uint32) uint32 {
+	refLane := uint32(pseudoRand>>32) % lanes
+	if pass == 0 && slice == 0 {
+		refLane = lane
+	}
+	// The reference area: all finished blocks the position may use
+	var area, start uint32
+	if pass == 0 {
+		area = slice * segLen
+		if refLane == lane {
+			area += index - 1
+		} else if index == 0 {
+			area--
+		}
+	} else {
+		area = laneLen - segLen
+		if refLane == lane {
+			area += index - 1
+		} else if index == 0 {
+			area--
+		}
+		start = (slice + 1) % syncPoints * segLen
+	}
+	x := pseudoRand & 0xffffffff
+	x = x * x >> 32
+	y := uint64(area) * x >> 32
+	z := uint64(area) - 1 - y
+	return refLane*laneLen + uint32((uint64(start)+z)%uint64(laneLen))
+}
+
+// compress - the compression function G: out = P(x ^ y) ^ x ^ y, with P
+// applied to the rows and then to the columns of the block
+func compress(out, x, y *block) {
+	var r, q block
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+	q = r
+	for i := 0; i < blockWords; i += 16 {
+		permute(&q[i], &q[i+1], &q[i+2], &q[i+3], &q[i+4], &q[i+5], &q[i+6], &q[i+7],
+			&q[i+8], &q[i+9], &q[i+10], &q[i+11], &q[i+12], &q[i+13], &q[i+14], &q[i+15])
+	}
+	for i := 0; i < 16; i += 2 {
+		permute(&q[i], &q[i+1], &q[i+16], &q[i+17], &q[i+32], &q[i+33], &q[i+48], &q[i+49],
+			&q[i+64], &q[i+65], &q[i+80], &q[i+81], &q[i+96], &q[i+97], &q[i+112], &q[i+113])
+	}
+	for i := range out {
+		out[i] = q[i] ^ r[i]
+	}
+}
+
+// permute - the permutation P, BLAKE2b's round with the multiplications of
+// BlaMka
+func permute(v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 *uint64) {
+	gb(v0, v4, v8, v12)
+	gb(v1, v5, v9, v13)
+	gb(v2, v6, v10, v14)
+	gb(v3, v7, v11, v15)
+	gb(v0, v5, v10, v15)
+	gb(v1, v6, v11, v12)
+	gb(v2, v7, v8, v13)
+	gb(v3, v4, v9, v14)
+}
+
+func gb(a, b, c, d *uint64) {
+	fBlaMka := func(x, y uint64) uint64 {
+		return x + y + 2*(x&0xffffffff)*(y&0xffffffff)
+	}
+	*a = fBlaMka(*a, *b)
+	*d = bits.RotateLeft64(*d^*a, -32)
+	*c = fBlaMka(*c, *d)
+	*b = bits.RotateLeft64(*b^*c, -24)
+	*a = fBlaMka(*a, *b)
+	*d = bits.RotateLeft64(*d^*a, -16)
+	*c = fBlaMka(*c, *d)
+	*b = bits.RotateLeft64(*b^*c, -63)
+}
+
+// hashLong - the variable-length hash H' of Argon2 (RFC 9106, section 3.3)
+func hashLong(out int, in ...[]byte) []byte {
+	t := binary.LittleEndian.AppendUint32(nil, uint32(out))
+	if out <= 64 {
+		return blake2b.Sum(out, append([][]byte{t}, in...)...)
+	}
+	r := (out+31)/32 - 2
+	res := make([]byte, 0, out)
+	v := blake2b.Sum(64, append([][]byte{t}, in...)...)
+	for i := 1; i < r; i++ {
+		res = append(res, v[:32]...)
+		v = blake2b.Sum(64, v)
+	}
+	res = append(res, v[:32]...)
+	return append(res, blake2b.Sum(out-32*r, v)...)
+}
@@ -0,0 +1,83 @@
+package argon2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// The Argon2id test vector of RFC 9106, section 5.3
+func TestRFC9106(t *testing.T) {
+	key, err := deriveKey(bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 16),
+		bytes.Repeat([]byte{3}, 8), bytes.Repeat([]byte{4}, 12), 3, 32, 4, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key); got != "0d640df58d78766c08c037a34a8b53c9d01ef0452d75b65eb52520e96b01e659" {
+		t.Errorf("got %s", got)
+	}
+}
+
+// The Argon2id test vector of the reference implementation, with 64 MiB
+func TestReference(t *testing.T) {
+	if testing.Short() {
+		t.Skip("uses 64 MiB")
+	}
+	key, err := IDKey([]byte("password"), []byte("somesalt"), 2, 1<<16, 1, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key); got != "09316115d5cf24ed5a15a31a3ba326e5cf32edc24702987c02b6566f61913cf7" {
+		t.Errorf("got %s", got)
+	}
+}
+
+// Cross-checks against golang.org/x/crypto/argon2.IDKey: one and several
+// passes and lanes, memory that is not a multiple of the lanes, and keys
+// shorter and longer than the 64-byte output of BLAKE2b
+func TestCrossCheck(t *testing.T) {
+	for _, tc := range []struct {
+		password, salt string
+		time, memory   uint32
+		threads        uint8
+		keyLen         uint32
+		want           string
+	}{
+		{"password", "somesalt", 1, 8, 1, 4, "6b7a947d"},
+		{"password", "somesalt", 1, 64, 1, 32, "729c7a54441bc13559bdca71348c4e554599e719c08a952601ed5c83618c1bbd"},
+		{"password", "somesalt", 3, 64, 1, 32, "b9e3bfda58fb95f1e1e479af4e01bfade5a0dba34d400a254f770462674169e6"},
+		{"password", "somesalt", 1, 64, 2, 32, "7ee97262358926f30e4431533d4ab811ab69977948b628b123dc4cf41e9e6f5d"},
+		{"password", "somesalt", 2, 100, 3, 16, "68e17bd62f018a59ccb25b27331c94da"},
+		{"password", "somesalt", 1, 256, 4, 64, "4ac1076db63a3e6be4f2f62f65c119a71ddb47d2fb393316f31b97e490b6801fdf6bdd9068ae930d5040fcf405ba829cd9ce57c9ed52dded6224ab5b53bf1b5e"},
+		{"password", "somesalt", 1, 64, 1, 65, "de909b81c77dea65f0b23db71f216a2f92b9a9d9abfdfa11e38b1c65f71757d6521d5146d3cf290bc407ff2261e335bd0d297bfa993faaa477bec9afb5c5e95924"},
+		{"password", "somesalt", 2, 128, 2, 100, "fd2baeed52786224b70a785900b48478993128d2eb56a928e7816a7e8c5968d56aa84e6893e4eb2fa72617321e42a73a12d162c3a8d6a4f809129b5dcfd76f103c4b8c0bb762fe6d7335698f4caf7c3ff22aceabe4a7e19533d9a8d0755b2702bfa46d9c"},
+		{"", "saltsalt", 1, 32, 4, 32, "b52da4336f4aaf58bf5e736940f9399401d2a606a8c1cab419c340ecd07d9b27"},
+		{"a much longer password of some sixty-odd bytes, to cross a block", "salt of 17 bytes!", 4, 1024, 8, 48, "de8dfd70e9db1d532aee9e20dbbeacb5d1bf9d9f25b5511f484ef0ea8dd9102f06071694b46eae9d007ece1279af3650"},
+		{"pw", "saltsalt", 1, 19 * 1024, 1, 32, "d6baa1f2d3d92ca424a9ea914648b0014f33516397e04785b0f80b2ae5c9c84d"},
+	} {
+		key, err := IDKey([]byte(tc.password), []byte(tc.salt), tc.time, tc.memory, tc.threads, tc.keyLen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(key); got != tc.want {
+			t.Errorf("t=%d m=%d p=%d len=%d: got %s", tc.time, tc.memory, tc.threads, tc.keyLen, got)
+		}
+	}
+}
+
+func TestIDKeyParams(t *testing.T) {
+	for _, p := range []struct {
+		time, memory uint32
+		threads      uint8
+		keyLen       uint32
+	}{{0, 64, 1, 32}, {1, 7, 1, 32}, {1, 64, 0, 32}, {1, 64, 1, 3}, {1, 31, 4, 32}} {
+		if _, err := IDKey([]byte("p"), []byte("saltsalt"), p.time, p.memory, p.threads, p.keyLen); err == nil {
+			t.Errorf("accepted %+v", p)
+		}
+	}
+	a, _ := IDKey([]byte("p"), []byte("saltsalt"), 1, 64, 2, 100)
+	b, _ := IDKey([]byte("q"), []byte("saltsalt"), 1, 64, 2, 100)
+	if len(a) != 100 || bytes.Equal(a, b) {
+		t.Errorf("bad keys")
+	}
+}
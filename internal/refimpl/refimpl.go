@@ -0,0 +1,121 @@
+// Package refimpl is a slow reference implementation of EME, written to be
+// compared line by line with Figure 2 of "A Parallelizable Enciphering Mode"
+// by Halevi and Rogaway. It favors clarity over speed and shares no code with
+// package eme, so the optimized implementations can be tested against it.
+//
+// Blocks are 16 bytes. Multiplication by 2 in GF(2^128) uses the little-endian
+// byte order of the EME-32 draft (and of package eme): byte 0 holds the least
+// significant bits.
+package refimpl
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// Encrypt enciphers plaintext P of 1 to 128 blocks under key "bc" and tweak T.
+func Encrypt(bc cipher.Block, T []byte, P []byte) []byte {
+	return eme(bc, T, P, bc.Encrypt)
+}
+
+// Decrypt deciphers ciphertext C. Deciphering is enciphering with the block
+// cipher replaced by its inverse; only L is always computed with E_K.
+func Decrypt(bc cipher.Block, T []byte, C []byte) []byte {
+	return eme(bc, T, C, bc.Decrypt)
+}
+
+type block [16]byte
+
+// eme - Figure 2, with E_K given as "ek"
+func eme(bc cipher.Block, T []byte, in []byte, ek func(dst, src []byte)) []byte {
+	if bc.BlockSize() != 16 || len(T) != 16 || len(in)%16 != 0 || len(in) == 0 || len(in) > 128*16 {
+		panic(fmt.Sprintf("refimpl: bad parameters (block size %d, %d byte tweak, %d bytes)", bc.BlockSize(), len(T), len(in)))
+	}
+	m := len(in) / 16
+	E := func(x block) (y block) {
+		ek(y[:], x[:])
+		return y
+	}
+	var t block
+	copy(t[:], T)
+	// P[1..m], 1-based as in the paper
+	P := make([]block, m+1)
+	for i := 1; i <= m; i++ {
+		copy(P[i][:], in[(i-1)*16:])
+	}
+
+	// L <- 2 E_K(0^n), the only use of the forward cipher when deciphering
+	var zero, L block
+	bc.Encrypt(L[:], zero[:])
+	L = times2(L)
+
+	// for i in [1..m]: PP_i <- 2^(i-1) L xor P_i; PPP_i <- E_K(PP_i)
+	PPP := make([]block, m+1)
+	for i := 1; i <= m; i++ {
+		PPP[i] = E(xor(pow2(i-1, L), P[i]))
+	}
+
+	// SP <- PPP_2 xor ... xor PPP_m; MP <- PPP_1 xor SP xor T
+	var SP block
+	for i := 2; i <= m; i++ {
+		SP = xor(SP, PPP[i])
+	}
+	MP := xor(xor(PPP[1], SP), t)
+
+	// MC <- E_K(MP); M <- MP xor MC
+	MC := E(MP)
+	M := xor(MP, MC)
+
+	// for i in [2..m]: CCC_i <- PPP_i xor 2^(i-1) M
+	CCC := make([]block, m+1)
+	for i := 2; i <= m; i++ {
+		CCC[i] = xor(PPP[i], pow2(i-1, M))
+	}
+
+	// SC <- CCC_2 xor ... xor CCC_m; CCC_1 <- MC xor SC xor T
+	var SC block
+	for i := 2; i <= m; i++ {
+		SC = xor(SC, CCC[i])
+	}
+	CCC[1] = xor(xor(MC, SC), t)
+
+	// for i in [1..m]: CC_i <- E_K(CCC_i); C_i <- CC_i xor 2^(i-1) L
+	out := make([]byte, 0, len(in))
+	for i := 1; i <= m; i++ {
+		Ci := xor(E(CCC[i]), pow2(i-1, L))
+		out = append(out, Ci[:]...)
+	}
+	return out
+}
+
+func xor(a block, b block) (c block) {
+	for i := range c {
+		c[i] = a[i] ^ b[i]
+	}
+	return c
+}
+
+// pow2 - 2^k x, by doubling "k" times
+func pow2(k int, x block) block {
+	for ; k > 0; k-- {
+		x = times2(x)
+	}
+	return x
+}
+
+// times2 - multiplication by x modulo x^128 + x^7 + x^2 + x + 1, on the block
+// read as a little-endian 128-bit integer
+func times2(x block) (y block) {
+	lo := binary.LittleEndian.Uint64(x[0:8])
+	hi := binary.LittleEndian.Uint64(x[8:16])
+	carry := hi >> 63
+	hi = hi<<1 | lo>>63
+	lo = lo << 1
+	if carry == 1 {
+		lo ^= 0x87
+	}
+	binary.LittleEndian.PutUint64(y[0:8], lo)
+	binary.LittleEndian.PutUint64(y[8:16], hi)
+	return y
+}
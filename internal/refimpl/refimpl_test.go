@@ -0,0 +1,41 @@
+package refimpl
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+
+	"github.com/rfjakob/eme/emevectors"
+)
+
+func TestVectors(t *testing.T) {
+	for _, v := range emevectors.All {
+		bc, err := aes.NewCipher(v.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := v.In
+		for i := 0; i < v.Iterations; i++ {
+			if v.Decrypt {
+				out = Decrypt(bc, v.Tweak, out)
+			} else {
+				out = Encrypt(bc, v.Tweak, out)
+			}
+		}
+		if !bytes.Equal(out, v.Out) {
+			t.Errorf("vector %s failed", v.Name)
+		}
+	}
+}
+
+func TestTimes2(t *testing.T) {
+	var x block
+	x[15] = 0x80
+	if y := times2(x); y != (block{0: 0x87}) {
+		t.Errorf("x^127 * x = %x, want 87 00 ...", y)
+	}
+	x = block{0: 0x80}
+	if y := times2(x); y != (block{1: 0x01}) {
+		t.Errorf("carry between bytes: %x", y)
+	}
+}
@@ -0,0 +1,55 @@
+// Package testsupport has helpers for testing code built on package eme
+// without real keys.
+package testsupport
+
+import (
+	"crypto/cipher"
+	"fmt"
+)
+
+// RotateCipher is a fake 16-byte block cipher: Encrypt rotates the block
+// left by one byte and XORs every byte with the key byte, Decrypt undoes
+// that. It is deterministic, trivially invertible and completely insecure.
+// Use it to test framing, padding and tweak handling, never to protect data.
+type RotateCipher struct {
+	key byte
+}
+
+// NewRotateCipher returns a RotateCipher. Different key bytes give
+// different ciphers.
+func NewRotateCipher(key byte) *RotateCipher {
+	return &RotateCipher{key: key}
+}
+
+var _ cipher.Block = (*RotateCipher)(nil)
+
+// BlockSize implements cipher.Block.
+func (c *RotateCipher) BlockSize() int {
+	return 16
+}
+
+// Encrypt implements cipher.Block. "dst" and "src" may be the same slice.
+func (c *RotateCipher) Encrypt(dst, src []byte) {
+	in := c.block(dst, src)
+	for i := range 16 {
+		dst[i] = in[(i+1)%16] ^ c.key
+	}
+}
+
+// Decrypt implements cipher.Block. "dst" and "src" may be the same slice.
+func (c *RotateCipher) Decrypt(dst, src []byte) {
+	in := c.block(dst, src)
+	for i := range 16 {
+		dst[(i+1)%16] = in[i] ^ c.key
+	}
+}
+
+// block - copy of the input block, after the length checks crypto/aes does
+func (c *RotateCipher) block(dst, src []byte) [16]byte {
+	if len(src) < 16 || len(dst) < 16 {
+		panic(fmt.Sprintf("testsupport: block too short (src %d, dst %d bytes)", len(src), len(dst)))
+	}
+	var in [16]byte
+	copy(in[:], src)
+	return in
+}
@@ -0,0 +1,29 @@
+package testsupport
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRotateCipher(t *testing.T) {
+	c := NewRotateCipher(0x5a)
+	src := []byte("0123456789abcdef")
+	dst := make([]byte, 16)
+	c.Encrypt(dst, src)
+	if want := []byte("123456789abcdef0"); !bytes.Equal(dst, xorAll(want, 0x5a)) {
+		t.Errorf("Encrypt = %q", dst)
+	}
+	// in place
+	c.Decrypt(dst, dst)
+	if !bytes.Equal(dst, src) {
+		t.Errorf("Decrypt = %q, want %q", dst, src)
+	}
+}
+
+func xorAll(b []byte, k byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ k
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package eme
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestJWE(t *testing.T) {
+	cek := bytes.Repeat([]byte{7}, 64)
+	plain := []byte(`{"msg":"hello"}`)
+	token, err := JWEEncrypt(cek, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts := strings.Split(token, "."); len(parts) != 5 || parts[1] != "" || parts[2] != "" {
+		t.Fatalf("bad compact serialization %q", token)
+	}
+	got, err := JWEDecrypt(cek, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("got %q", got)
+	}
+
+	other := bytes.Clone(cek)
+	other[0] ^= 1
+	if _, err = JWEDecrypt(other, token); err == nil {
+		t.Errorf("wrong MAC key accepted")
+	}
+	// Flip a bit in the ciphertext and in the header
+	parts := strings.Split(token, ".")
+	ct := []byte(parts[3])
+	ct[len(ct)/2] ^= 1
+	if _, err = JWEDecrypt(cek, strings.Join([]string{parts[0], "", "", string(ct), parts[4]}, ".")); err == nil {
+		t.Errorf("modified ciphertext accepted")
+	}
+	if _, err = JWEDecrypt(cek, "e30."+strings.Join(parts[1:], ".")); err == nil {
+		t.Errorf("modified header accepted")
+	}
+	if _, err = JWEEncrypt(cek[:32], plain); err == nil {
+		t.Errorf("short key accepted")
+	}
+}
@@ -0,0 +1,205 @@
+package eme
+
+import (
+	"crypto/aes"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rfjakob/eme/internal/argon2"
+)
+
+// DefaultKDFIterations is the PBKDF2 iteration count used by NewKDFParams,
+// the OWASP recommendation for PBKDF2-HMAC-SHA256.
+const DefaultKDFIterations = 600000
+
+// Algorithm identifiers in the marshaled KDFParams
+const (
+	kdfPBKDF2SHA256 = 1
+	kdfArgon2id     = 2
+)
+
+// Argon2Params are the cost parameters of Argon2id (RFC 9106).
+type Argon2Params struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is the memory size in KiB
+	Memory uint32
+	// Threads is the degree of parallelism
+	Threads uint8
+}
+
+// MaxArgon2Memory is the largest Argon2 memory size, in KiB, that
+// UnmarshalBinary accepts: 4 GiB.
+const MaxArgon2Memory = 4 << 20
+
+// DefaultArgon2Params are the second recommended option of RFC 9106: 3
+// passes over 64 MiB in 4 lanes.
+var DefaultArgon2Params = Argon2Params{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// KDFParams describe how a key is derived from a passphrase: PBKDF2 with
+// HMAC-SHA256, "Iterations" rounds and a random salt, or Argon2id if Argon2
+// is set. They are not secret and are stored next to the data, for example
+// in a container header (see ContainerOptions.KDF).
+type KDFParams struct {
+	Iterations uint32
+	Salt       []byte
+	// Argon2, if set, selects Argon2id with these parameters. Iterations is
+	// unused then.
+	Argon2 *Argon2Params
+}
+
+// NewKDFParams returns parameters with DefaultKDFIterations and a fresh
+// 16-byte salt.
+func NewKDFParams() (*KDFParams, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return &KDFParams{Iterations: DefaultKDFIterations, Salt: salt}, nil
+}
+
+// NewArgon2KDFParams returns Argon2id parameters with DefaultArgon2Params and
+// a fresh 16-byte salt.
+func NewArgon2KDFParams() (*KDFParams, error) {
+	p, err := NewKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	a := DefaultArgon2Params
+	p.Iterations, p.Argon2 = 0, &a
+	return p, nil
+}
+
+// NewCalibratedKDFParams returns Argon2id parameters like NewArgon2KDFParams,
+// but with the memory of DefaultArgon2Params and the number of passes chosen
+// by CalibrateArgon2 for "target".
+func NewCalibratedKDFParams(target time.Duration) (*KDFParams, error) {
+	a, err := CalibrateArgon2(target, DefaultArgon2Params)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewKDFParams()
+	if err != nil {
+		return nil, err
+	}
+	p.Iterations, p.Argon2 = 0, &a
+	return p, nil
+}
+
+// CalibrateArgon2 benchmarks Argon2id on this machine and returns parameters
+// with the threads of "base" for which deriving a key takes about "target".
+// It keeps the memory of "base" and raises the number of passes, unless a
+// single pass already takes longer than "target"; then it halves the memory
+// until it fits, down to 8 MiB. Calibration takes about as long as "target"
+// and a few single passes.
+func CalibrateArgon2(target time.Duration, base Argon2Params) (Argon2Params, error) {
+	const minMemory = 8 * 1024
+	p := base
+	p.Time = 1
+	for {
+		start := time.Now()
+		key, err := argon2.IDKey([]byte("calibrate"), make([]byte, 16), p.Time, p.Memory, p.Threads, 32)
+		if err != nil {
+			return Argon2Params{}, err
+		}
+		clear(key)
+		elapsed := max(time.Since(start), time.Microsecond)
+		if elapsed > target && p.Memory/2 >= minMemory {
+			p.Memory /= 2
+			continue
+		}
+		p.Time = uint32(max(1, min(int64(target/elapsed), 1<<16)))
+		return p, nil
+	}
+}
+
+// CalibratePBKDF2 returns the PBKDF2-HMAC-SHA256 iteration count for which
+// deriving a key takes about "target" on this machine.
+func CalibratePBKDF2(target time.Duration) (uint32, error) {
+	const probe = 10000
+	start := time.Now()
+	key, err := pbkdf2.Key(sha256.New, "calibrate", make([]byte, 16), probe, 32)
+	if err != nil {
+		return 0, err
+	}
+	clear(key)
+	elapsed := max(time.Since(start), time.Microsecond)
+	return uint32(max(1000, min(int64(target)*probe/int64(elapsed), 1<<31))), nil
+}
+
+// NewFromPassphrase returns an EMECipher with AES-256 under the key that
+// Argon2id derives from "passphrase" and "salt" with "params". The salt
+// should be 16 random bytes, stored with the data.
+func NewFromPassphrase(passphrase []byte, salt []byte, params Argon2Params) (*EMECipher, error) {
+	p := KDFParams{Salt: salt, Argon2: &params}
+	key, err := p.Key(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return New(bc), nil
+}
+
+// Key derives a 32-byte key, suitable for AES-256, from "passphrase".
+func (p *KDFParams) Key(passphrase []byte) ([]byte, error) {
+	if a := p.Argon2; a != nil {
+		return argon2.IDKey(passphrase, p.Salt, a.Time, a.Memory, a.Threads, 32)
+	}
+	if p.Iterations == 0 {
+		return nil, errors.New("KDF iteration count is zero")
+	}
+	return pbkdf2.Key(sha256.New, string(passphrase), p.Salt, int(p.Iterations), 32)
+}
+
+// MarshalBinary encodes the parameters as algorithm (1 byte), iterations
+// (uint32, big-endian) and salt. For Argon2id, time and memory (uint32,
+// big-endian) and threads (1 byte) take the place of the iterations.
+func (p *KDFParams) MarshalBinary() ([]byte, error) {
+	if a := p.Argon2; a != nil {
+		b := make([]byte, 10, 10+len(p.Salt))
+		b[0] = kdfArgon2id
+		binary.BigEndian.PutUint32(b[1:5], a.Time)
+		binary.BigEndian.PutUint32(b[5:9], a.Memory)
+		b[9] = a.Threads
+		return append(b, p.Salt...), nil
+	}
+	b := make([]byte, 5, 5+len(p.Salt))
+	b[0] = kdfPBKDF2SHA256
+	binary.BigEndian.PutUint32(b[1:5], p.Iterations)
+	return append(b, p.Salt...), nil
+}
+
+// UnmarshalBinary decodes parameters encoded by MarshalBinary.
+func (p *KDFParams) UnmarshalBinary(b []byte) error {
+	if len(b) < 5 {
+		return errors.New("KDF parameters are truncated")
+	}
+	switch b[0] {
+	case kdfPBKDF2SHA256:
+		p.Iterations, p.Argon2 = binary.BigEndian.Uint32(b[1:5]), nil
+		p.Salt = append([]byte{}, b[5:]...)
+	case kdfArgon2id:
+		if len(b) < 10 {
+			return errors.New("KDF parameters are truncated")
+		}
+		a := &Argon2Params{Time: binary.BigEndian.Uint32(b[1:5]), Memory: binary.BigEndian.Uint32(b[5:9]), Threads: b[9]}
+		// Parameters come from files, so do not let them exhaust memory
+		if a.Memory > MaxArgon2Memory {
+			return fmt.Errorf("Argon2 memory of %d KiB exceeds the limit of %d KiB", a.Memory, MaxArgon2Memory)
+		}
+		p.Iterations, p.Argon2 = 0, a
+		p.Salt = append([]byte{}, b[10:]...)
+	default:
+		return fmt.Errorf("unknown KDF algorithm %d", b[0])
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+	"time"
+)
+
+func TestKDFParams(t *testing.T) {
+	p, err := NewKDFParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Iterations = 1000
+	k1, err := p.Key([]byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := p.MarshalBinary()
+	var q KDFParams
+	if err = q.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	k2, _ := q.Key([]byte("passphrase"))
+	if len(k1) != 32 || !bytes.Equal(k1, k2) {
+		t.Errorf("keys differ after marshaling")
+	}
+	k3, _ := q.Key([]byte("other"))
+	if bytes.Equal(k1, k3) {
+		t.Errorf("different passphrases gave the same key")
+	}
+}
+
+func TestArgon2KDFParams(t *testing.T) {
+	p, err := NewArgon2KDFParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *p.Argon2 != DefaultArgon2Params || len(p.Salt) != 16 {
+		t.Errorf("bad defaults %+v", p)
+	}
+	// Cheap parameters for the test
+	p.Argon2 = &Argon2Params{Time: 1, Memory: 64, Threads: 2}
+	k1, err := p.Key([]byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := p.MarshalBinary()
+	var q KDFParams
+	if err = q.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if q.Argon2 == nil || *q.Argon2 != *p.Argon2 || !bytes.Equal(q.Salt, p.Salt) {
+		t.Fatalf("parameters changed by marshaling: %+v", q)
+	}
+	k2, _ := q.Key([]byte("passphrase"))
+	if len(k1) != 32 || !bytes.Equal(k1, k2) {
+		t.Errorf("keys differ after marshaling")
+	}
+	pb := KDFParams{Iterations: 1, Salt: p.Salt}
+	if k3, _ := pb.Key([]byte("passphrase")); bytes.Equal(k1, k3) {
+		t.Errorf("Argon2id and PBKDF2 gave the same key")
+	}
+
+	c, err := NewFromPassphrase([]byte("passphrase"), p.Salt, *p.Argon2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, _ := aes.NewCipher(k1)
+	tweak := make([]byte, 16)
+	if !bytes.Equal(c.Encrypt(tweak, tweak), New(bc).Encrypt(tweak, tweak)) {
+		t.Errorf("NewFromPassphrase does not use the derived key")
+	}
+
+	b[5] = 0xff
+	if err = q.UnmarshalBinary(b); err == nil {
+		t.Errorf("accepted a huge Argon2 memory size")
+	}
+	if err = q.UnmarshalBinary(b[:8]); err == nil {
+		t.Errorf("accepted truncated parameters")
+	}
+}
+
+func TestCalibrateArgon2(t *testing.T) {
+	// Nothing is fast enough for a nanosecond, so the memory shrinks to the
+	// minimum
+	a, err := CalibrateArgon2(time.Nanosecond, Argon2Params{Memory: 32 * 1024, Threads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != (Argon2Params{Time: 1, Memory: 8 * 1024, Threads: 2}) {
+		t.Errorf("calibrated to %+v", a)
+	}
+	a, err = CalibrateArgon2(time.Hour, Argon2Params{Memory: 8 * 1024, Threads: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Time < 2 || a.Memory != 8*1024 {
+		t.Errorf("calibrated to %+v", a)
+	}
+	if n, err := CalibratePBKDF2(time.Millisecond); err != nil || n < 1000 {
+		t.Errorf("CalibratePBKDF2 = %d, %v", n, err)
+	}
+}
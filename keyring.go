@@ -0,0 +1,134 @@
+package eme
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrUnknownKey is returned for data encrypted under a key ID that is not in
+// the Keyring.
+var ErrUnknownKey = errors.New("eme: unknown key ID")
+
+// Keyring holds the keys of a service under numeric key IDs. New data is
+// encrypted under the current key, the one with the highest ID, and records
+// its key ID, so that data written under older keys can still be decrypted
+// as long as their keys are in the keyring. A Keyring is safe for concurrent
+// use.
+type Keyring struct {
+	mu      sync.RWMutex
+	keys    map[uint32]*EMECipher
+	current uint32
+}
+
+// NewKeyring returns an empty Keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: map[uint32]*EMECipher{}}
+}
+
+// Add adds cipher "c" under key ID "id". IDs start at 1 and must not be
+// reused; adding a key with a higher ID than all others makes it the
+// current key.
+func (k *Keyring) Add(id uint32, c *EMECipher) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id == 0 {
+		logPanicf("Key ID 0 is reserved")
+	}
+	if _, ok := k.keys[id]; ok {
+		logPanicf("Key ID %d is already in the keyring", id)
+	}
+	k.keys[id] = c
+	if id > k.current {
+		k.current = id
+	}
+}
+
+// Remove removes the key with ID "id", once no data needs it any more. The
+// current key cannot be removed.
+func (k *Keyring) Remove(id uint32) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if id == k.current {
+		return fmt.Errorf("eme: key %d is the current key", id)
+	}
+	delete(k.keys, id)
+	return nil
+}
+
+// Current returns the ID of the current key, or 0 if the keyring is empty.
+func (k *Keyring) Current() uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// Cipher returns the cipher with ID "id", or ErrUnknownKey.
+func (k *Keyring) Cipher(id uint32) (*EMECipher, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if c, ok := k.keys[id]; ok {
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w %d", ErrUnknownKey, id)
+}
+
+// currentCipher - the current key and its ID
+func (k *Keyring) currentCipher() (uint32, *EMECipher, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.current == 0 {
+		return 0, nil, errors.New("eme: keyring is empty")
+	}
+	return k.current, k.keys[k.current], nil
+}
+
+// NewWriter writes an envelope (see NewEnvelopeWriter) under the current key
+// to "w", with its key ID in the header.
+func (k *Keyring) NewWriter(w io.Writer) (*Writer, error) {
+	id, c, err := k.currentCipher()
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeWriter(w, c.bc, id)
+}
+
+// NewReader reads an envelope written by NewWriter, with the key its header
+// names.
+func (k *Keyring) NewReader(r io.Reader) (*Reader, error) {
+	hdr, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	c, err := k.Cipher(envelopeKeyID(hdr))
+	if err != nil {
+		return nil, err
+	}
+	return newEnvelopeReader(r, c.bc, hdr), nil
+}
+
+// Encrypt EME-encrypts "inputData" under the current key and returns the key
+// ID (uint32, big-endian) followed by the ciphertext. The length limits of
+// Transform apply.
+func (k *Keyring) Encrypt(tweak []byte, inputData []byte) ([]byte, error) {
+	id, c, err := k.currentCipher()
+	if err != nil {
+		return nil, err
+	}
+	out := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(inputData)), id)
+	return append(out, c.Encrypt(tweak, inputData)...), nil
+}
+
+// Decrypt reverses Encrypt, with the key "ciphertext" names.
+func (k *Keyring) Decrypt(tweak []byte, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 4 {
+		return nil, errors.New("eme: ciphertext has no key ID")
+	}
+	c, err := k.Cipher(binary.BigEndian.Uint32(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+	return c.Decrypt(tweak, ciphertext[4:]), nil
+}
@@ -0,0 +1,108 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func newKeyringCipher(t *testing.T, b byte) *EMECipher {
+	bc, err := aes.NewCipher(bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(bc)
+}
+
+func TestKeyring(t *testing.T) {
+	k := NewKeyring()
+	if _, err := k.NewWriter(io.Discard); err == nil {
+		t.Errorf("empty keyring can encrypt")
+	}
+	k.Add(1, newKeyringCipher(t, 1))
+	tweak := make([]byte, 16)
+	plain := bytes.Repeat([]byte("keyring!"), 600)
+
+	// Data written under key 1
+	var env bytes.Buffer
+	w, err := k.NewWriter(&env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(plain)
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	blob, err := k.Encrypt(tweak, plain[:64])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate to key 2; old data still decrypts, new data uses key 2
+	k.Add(2, newKeyringCipher(t, 2))
+	if k.Current() != 2 {
+		t.Errorf("current key is %d", k.Current())
+	}
+	r, err := k.NewReader(bytes.NewReader(env.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("old envelope: %v", err)
+	}
+	if got, err := k.Decrypt(tweak, blob); err != nil || !bytes.Equal(got, plain[:64]) {
+		t.Errorf("old blob: %v", err)
+	}
+	blob2, _ := k.Encrypt(tweak, plain[:64])
+	if blob2[3] != 2 || len(blob2) != 68 {
+		t.Errorf("new blob %x", blob2[:4])
+	}
+	if env.Bytes()[15] != 1 {
+		t.Errorf("envelope does not record key 1")
+	}
+	// A keyed envelope is a normal envelope for the holder of the key
+	r, err = NewEnvelopeReader(bytes.NewReader(env.Bytes()), newKeyringCipher(t, 1).bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, plain) {
+		t.Errorf("NewEnvelopeReader cannot read a keyed envelope")
+	}
+
+	if err = k.Remove(2); err == nil {
+		t.Errorf("removed the current key")
+	}
+	if err = k.Remove(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Decrypt(tweak, blob); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+	if _, err = k.NewReader(bytes.NewReader(env.Bytes())); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+	// Plain envelopes have key ID 0, which is never in a keyring
+	var plainEnv bytes.Buffer
+	w, _ = NewEnvelopeWriter(&plainEnv, newKeyringCipher(t, 2).bc)
+	w.Close()
+	if _, err = k.NewReader(&plainEnv); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+}
+
+func TestKeyringAddPanics(t *testing.T) {
+	k := NewKeyring()
+	k.Add(5, newKeyringCipher(t, 5))
+	for _, id := range []uint32{0, 5} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Add(%d) did not panic", id)
+				}
+			}()
+			k.Add(id, newKeyringCipher(t, 1))
+		}()
+	}
+}
@@ -0,0 +1,303 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// keystoreVersion - the version of the keystore file format
+const keystoreVersion = 1
+
+// Keystore is a file of data keys, each wrapped (see WrapKey) under one
+// key-encryption key, which is derived from a passphrase or comes from a KMS
+// or HSM. Keys have a numeric ID, starting at 1, and a creation time. The
+// key with the highest ID that is not retired is the current key. Keys are
+// only unwrapped when they are used. A Keystore is not safe for concurrent
+// use.
+//
+// The file is JSON:
+//
+//	{"version": 1, "kdf": HEX, "check": HEX, "keys": [
+//	  {"id": 1, "created": TIME, "retired": TIME, "wrapped": HEX}]}
+//
+// where "kdf" is the marshaled KDFParams if the key-encryption key is
+// derived from a passphrase, and "check" is a block of zeros wrapped under
+// the key-encryption key, which detects a wrong one even while the keystore
+// holds no keys.
+type Keystore struct {
+	kdf     *KDFParams
+	kek     cipher.Block
+	entries []KeystoreEntry
+}
+
+// KeystoreEntry describes a key of a Keystore.
+type KeystoreEntry struct {
+	ID      uint32
+	Created time.Time
+	// Retired is when the key was retired, or zero
+	Retired time.Time
+	// wrapped - the wrapped key, nil once it is retired
+	wrapped []byte
+}
+
+// keystoreFile - the JSON form of a Keystore
+type keystoreFile struct {
+	Version int                 `json:"version"`
+	KDF     string              `json:"kdf,omitempty"`
+	Check   string              `json:"check"`
+	Keys    []keystoreFileEntry `json:"keys"`
+}
+
+type keystoreFileEntry struct {
+	ID      uint32     `json:"id"`
+	Created time.Time  `json:"created"`
+	Retired *time.Time `json:"retired,omitempty"`
+	Wrapped string     `json:"wrapped,omitempty"`
+}
+
+// NewKeystore returns an empty Keystore under the key-encryption key "kek".
+// "kdf" are the parameters "kek" was derived from a passphrase with, or nil.
+func NewKeystore(kek cipher.Block, kdf *KDFParams) *Keystore {
+	return &Keystore{kdf: kdf, kek: kek}
+}
+
+// NewPassphraseKeystore returns an empty Keystore whose key-encryption key is
+// derived from "passphrase" with fresh Argon2id parameters.
+func NewPassphraseKeystore(passphrase []byte) (*Keystore, error) {
+	p, err := NewArgon2KDFParams()
+	if err != nil {
+		return nil, err
+	}
+	kek, err := KeystorePassphrase(passphrase)(p)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeystore(kek, p), nil
+}
+
+// KeystorePassphrase returns the key-encryption key function for
+// LoadKeystore that derives the key from "passphrase".
+func KeystorePassphrase(passphrase []byte) func(*KDFParams) (cipher.Block, error) {
+	return func(p *KDFParams) (cipher.Block, error) {
+		if p == nil {
+			return nil, errors.New("eme: keystore is not protected by a passphrase")
+		}
+		key, err := p.Key(passphrase)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(key)
+		return aes.NewCipher(key)
+	}
+}
+
+// LoadKeystore reads the keystore at "path". "kek" is called with the KDF
+// parameters of the file, nil if it has none, and returns the
+// key-encryption key.
+func LoadKeystore(path string, kek func(*KDFParams) (cipher.Block, error)) (*Keystore, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file keystoreFile
+	if err = json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("eme: keystore %q: %w", path, err)
+	}
+	if file.Version != keystoreVersion {
+		return nil, fmt.Errorf("eme: keystore %q has unsupported version %d", path, file.Version)
+	}
+	ks := &Keystore{}
+	if file.KDF != "" {
+		v, err := hex.DecodeString(file.KDF)
+		if err != nil {
+			return nil, fmt.Errorf("eme: keystore %q: %w", path, err)
+		}
+		ks.kdf = &KDFParams{}
+		if err = ks.kdf.UnmarshalBinary(v); err != nil {
+			return nil, fmt.Errorf("eme: keystore %q: %w", path, err)
+		}
+	}
+	for _, e := range file.Keys {
+		entry := KeystoreEntry{ID: e.ID, Created: e.Created}
+		if e.Retired != nil {
+			entry.Retired = *e.Retired
+		}
+		if entry.wrapped, err = hex.DecodeString(e.Wrapped); err != nil {
+			return nil, fmt.Errorf("eme: keystore %q: key %d: %w", path, e.ID, err)
+		}
+		if e.ID == 0 || (len(ks.entries) > 0 && e.ID <= ks.entries[len(ks.entries)-1].ID) ||
+			entry.Retired.IsZero() == (len(entry.wrapped) == 0) {
+			return nil, fmt.Errorf("eme: keystore %q: invalid key %d", path, e.ID)
+		}
+		ks.entries = append(ks.entries, entry)
+	}
+	if ks.kek, err = kek(ks.kdf); err != nil {
+		return nil, err
+	}
+	check, err := hex.DecodeString(file.Check)
+	if err != nil {
+		return nil, fmt.Errorf("eme: keystore %q: %w", path, err)
+	}
+	zeros, err := UnwrapKey(ks.kek, check)
+	if err != nil || !bytes.Equal(zeros, make([]byte, 16)) {
+		return nil, fmt.Errorf("eme: keystore %q: wrong key-encryption key or passphrase", path)
+	}
+	return ks, nil
+}
+
+// Save writes the keystore to "path", replacing the file atomically. The
+// file is only readable by its owner.
+func (ks *Keystore) Save(path string) error {
+	check, err := WrapKey(ks.kek, make([]byte, 16))
+	if err != nil {
+		return err
+	}
+	file := keystoreFile{Version: keystoreVersion, Check: hex.EncodeToString(check), Keys: []keystoreFileEntry{}}
+	if ks.kdf != nil {
+		v, err := ks.kdf.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		file.KDF = hex.EncodeToString(v)
+	}
+	for _, e := range ks.entries {
+		fe := keystoreFileEntry{ID: e.ID, Created: e.Created, Wrapped: hex.EncodeToString(e.wrapped)}
+		if !e.Retired.IsZero() {
+			fe.Retired = &e.Retired
+		}
+		file.Keys = append(file.Keys, fe)
+	}
+	b, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(b, '\n'))
+}
+
+// AddKey adds a random 32-byte key, which becomes the current key, and
+// returns its ID.
+func (ks *Keystore) AddKey() (uint32, error) {
+	key := make([]byte, 32)
+	defer clear(key)
+	if _, err := rand.Read(key); err != nil {
+		return 0, err
+	}
+	wrapped, err := WrapKey(ks.kek, key)
+	if err != nil {
+		return 0, err
+	}
+	id := uint32(1)
+	if len(ks.entries) > 0 {
+		id = ks.entries[len(ks.entries)-1].ID + 1
+	}
+	ks.entries = append(ks.entries, KeystoreEntry{ID: id, Created: time.Now().UTC(), wrapped: wrapped})
+	return id, nil
+}
+
+// Retire destroys key "id", once no data is encrypted under it any more (see
+// ReEncrypt and Container.RotateKey). Its entry stays in the keystore, so
+// that its ID is not reused. The current key cannot be retired; add a new
+// key first.
+func (ks *Keystore) Retire(id uint32) error {
+	e, err := ks.entry(id)
+	if err != nil {
+		return err
+	}
+	if id == ks.Current() {
+		return fmt.Errorf("eme: key %d is the current key", id)
+	}
+	clear(e.wrapped)
+	e.wrapped = nil
+	e.Retired = time.Now().UTC()
+	return nil
+}
+
+// Keys returns the entries of all keys, retired ones included, ordered by
+// ID.
+func (ks *Keystore) Keys() []KeystoreEntry {
+	return append([]KeystoreEntry{}, ks.entries...)
+}
+
+// Current returns the ID of the current key, or 0 if there is none.
+func (ks *Keystore) Current() uint32 {
+	for i := len(ks.entries) - 1; i >= 0; i-- {
+		if ks.entries[i].Retired.IsZero() {
+			return ks.entries[i].ID
+		}
+	}
+	return 0
+}
+
+// Block returns AES-256 under key "id". It returns ErrUnknownKey for IDs that
+// are not in the keystore or retired.
+func (ks *Keystore) Block(id uint32) (cipher.Block, error) {
+	e, err := ks.entry(id)
+	if err != nil {
+		return nil, err
+	}
+	if !e.Retired.IsZero() {
+		return nil, fmt.Errorf("%w %d (retired)", ErrUnknownKey, id)
+	}
+	key, err := UnwrapKey(ks.kek, e.wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("eme: keystore key %d: %w", id, err)
+	}
+	defer clear(key)
+	return aes.NewCipher(key)
+}
+
+// Keyring returns a Keyring holding all keys that are not retired.
+func (ks *Keystore) Keyring() (*Keyring, error) {
+	k := NewKeyring()
+	for _, e := range ks.entries {
+		if !e.Retired.IsZero() {
+			continue
+		}
+		bc, err := ks.Block(e.ID)
+		if err != nil {
+			return nil, err
+		}
+		k.Add(e.ID, New(bc))
+	}
+	return k, nil
+}
+
+// OpenContainer opens the container at "path" like OpenContainer, with the
+// key whose ID is recorded in its header (see ContainerOptions.KeyID).
+func (ks *Keystore) OpenContainer(path string) (*Container, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ReadContainerHeader(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if h.KeyID() == 0 {
+		return nil, errors.New("eme: container has no key ID")
+	}
+	bc, err := ks.Block(h.KeyID())
+	if err != nil {
+		return nil, err
+	}
+	return OpenContainer(path, bc, nil)
+}
+
+// entry - the entry with ID "id", or ErrUnknownKey
+func (ks *Keystore) entry(id uint32) (*KeystoreEntry, error) {
+	for i := range ks.entries {
+		if ks.entries[i].ID == id {
+			return &ks.entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w %d", ErrUnknownKey, id)
+}
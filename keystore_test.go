@@ -0,0 +1,112 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeystore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	kek := newKeyringCipher(t, 1).bc
+	ks := NewKeystore(kek, nil)
+	for i := 1; i <= 3; i++ {
+		if id, err := ks.AddKey(); err != nil || id != uint32(i) {
+			t.Fatalf("AddKey = %d, %v", id, err)
+		}
+	}
+	if err := ks.Retire(3); err == nil {
+		t.Errorf("the current key was retired")
+	}
+	if err := ks.Retire(1); err != nil {
+		t.Fatal(err)
+	}
+	bc2, _ := ks.Block(2)
+	if err := ks.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(path); fi.Mode().Perm() != 0600 {
+		t.Errorf("mode %v", fi.Mode())
+	}
+
+	ks, err := LoadKeystore(path, func(p *KDFParams) (cipher.Block, error) { return kek, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Current() != 3 || len(ks.Keys()) != 3 || ks.Keys()[0].Retired.IsZero() {
+		t.Errorf("keys not preserved: current %d, %+v", ks.Current(), ks.Keys())
+	}
+	if _, err = ks.Block(1); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("retired key: %v", err)
+	}
+	b, _ := ks.Block(2)
+	tweak := make([]byte, 16)
+	if !bytes.Equal(New(b).Encrypt(tweak, tweak), New(bc2).Encrypt(tweak, tweak)) {
+		t.Errorf("key 2 changed")
+	}
+	if id, _ := ks.AddKey(); id != 4 {
+		t.Errorf("new key got ID %d", id)
+	}
+	kr, err := ks.Keyring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.Current() != 4 {
+		t.Errorf("keyring current key %d", kr.Current())
+	}
+	if _, err = kr.Cipher(1); err == nil {
+		t.Errorf("retired key is in the keyring")
+	}
+
+	wrong := newKeyringCipher(t, 2).bc
+	if _, err = LoadKeystore(path, func(*KDFParams) (cipher.Block, error) { return wrong, nil }); err == nil {
+		t.Errorf("wrong key-encryption key was accepted")
+	}
+}
+
+func TestKeystorePassphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	p := &KDFParams{Salt: make([]byte, 16), Argon2: &Argon2Params{Time: 1, Memory: 64, Threads: 1}}
+	kek, err := KeystorePassphrase([]byte("secret"))(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = NewKeystore(kek, p).Save(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadKeystore(path, KeystorePassphrase([]byte("secret"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadKeystore(path, KeystorePassphrase([]byte("wrong"))); err == nil {
+		t.Errorf("wrong passphrase was accepted")
+	}
+}
+
+func TestKeystoreContainer(t *testing.T) {
+	dir := t.TempDir()
+	ks := NewKeystore(newKeyringCipher(t, 1).bc, nil)
+	ks.AddKey()
+	id, _ := ks.AddKey()
+	img := filepath.Join(dir, "img")
+	os.WriteFile(img, bytes.Repeat([]byte{5}, 3*4096), 0600)
+	bc, _ := ks.Block(id)
+	out := filepath.Join(dir, "c")
+	if err := ImageToContainer(out, img, bc, ContainerOptions{KeyID: id}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ks.OpenContainer(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Header().KeyID() != id {
+		t.Errorf("header key ID %d", c.Header().KeyID())
+	}
+	sec := make([]byte, 4096)
+	if err = c.ReadSector(2, sec); err != nil || sec[0] != 5 {
+		t.Errorf("ReadSector: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// keyWrapIV - the default initial value of RFC 3394
+var keyWrapIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// WrapKey encrypts "key" under the key-encryption key "kek" with the AES Key
+// Wrap algorithm of RFC 3394. "key" must be a multiple of 8 bytes and at least
+// 16 bytes long; the result is 8 bytes longer. Unlike EME, key wrap is
+// authenticated: UnwrapKey detects a wrong KEK or modified data.
+func WrapKey(kek cipher.Block, key []byte) ([]byte, error) {
+	if kek.BlockSize() != 16 {
+		return nil, errors.New("key wrap needs a 16-byte block cipher")
+	}
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, fmt.Errorf("cannot wrap a %d-byte key", len(key))
+	}
+	n := len(key) / 8
+	out := make([]byte, 8+len(key))
+	copy(out, keyWrapIV)
+	copy(out[8:], key)
+	var b [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[:8], out[:8])
+			copy(b[8:], out[i*8:(i+1)*8])
+			kek.Encrypt(b[:], b[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[i*8:], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// UnwrapKey reverses WrapKey.
+func UnwrapKey(kek cipher.Block, wrapped []byte) ([]byte, error) {
+	if kek.BlockSize() != 16 {
+		return nil, errors.New("key wrap needs a 16-byte block cipher")
+	}
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("invalid wrapped key length %d", len(wrapped))
+	}
+	n := len(wrapped)/8 - 1
+	r := append([]byte{}, wrapped...)
+	var b [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(r[:8])^t)
+			copy(b[8:], r[i*8:(i+1)*8])
+			kek.Decrypt(b[:], b[:])
+			copy(r[:8], b[:8])
+			copy(r[i*8:], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(r[:8], keyWrapIV) != 1 {
+		return nil, errors.New("key unwrap failed: wrong key-encryption key or corrupt data")
+	}
+	return r[8:], nil
+}
@@ -0,0 +1,35 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestKeyWrapRFC3394 - test vector 4.6 of RFC 3394, 256-bit key data under a
+// 256-bit KEK
+func TestKeyWrapRFC3394(t *testing.T) {
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F")
+	want, _ := hex.DecodeString("28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21")
+	bc, err := aes.NewCipher(kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := WrapKey(bc, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(wrapped, want) {
+		t.Errorf("wrong result %x", wrapped)
+	}
+	got, err := UnwrapKey(bc, wrapped)
+	if err != nil || !bytes.Equal(got, key) {
+		t.Errorf("unwrap failed: %v", err)
+	}
+	wrapped[10] ^= 1
+	if _, err = UnwrapKey(bc, wrapped); err == nil {
+		t.Errorf("modified wrapped key accepted")
+	}
+}
@@ -0,0 +1,123 @@
+package eme
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KMS is a key management service that creates and unwraps data keys under
+// a master key it never releases. Adapters are a few lines each:
+//
+//   - AWS KMS: GenerateDataKey with KeySpec AES_256 returns Plaintext and
+//     CiphertextBlob; DecryptDataKey is Decrypt.
+//   - GCP Cloud KMS: generate 32 random bytes and Encrypt them;
+//     DecryptDataKey is Decrypt.
+//   - Azure Key Vault: generate 32 random bytes and WrapKey them;
+//     DecryptDataKey is UnwrapKey.
+//
+// The wrapped key must identify the master key (the AWS ciphertext blob
+// does), or the adapter must be bound to one master key.
+type KMS interface {
+	// GenerateDataKey returns a fresh 32-byte data key in plaintext and
+	// wrapped under the master key
+	GenerateDataKey(ctx context.Context) (plaintext []byte, wrapped []byte, err error)
+	// DecryptDataKey returns the plaintext of a key wrapped by
+	// GenerateDataKey
+	DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// GenerateKMSKey returns an AES-256 cipher under a fresh data key from "k",
+// and the wrapped data key, which is all that must be stored. Pass it in
+// ContainerOptions.WrappedKey to keep it in a container header. The
+// plaintext key is zeroed before GenerateKMSKey returns.
+func GenerateKMSKey(ctx context.Context, k KMS) (cipher.Block, []byte, error) {
+	key, wrapped, err := k.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("eme: KMS: %w", err)
+	}
+	bc, err := kmsCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bc, wrapped, nil
+}
+
+// OpenKMSKey returns the AES-256 cipher under the data key "wrapped", as
+// returned by GenerateKMSKey.
+func OpenKMSKey(ctx context.Context, k KMS, wrapped []byte) (cipher.Block, error) {
+	key, err := k.DecryptDataKey(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("eme: KMS: %w", err)
+	}
+	return kmsCipher(key)
+}
+
+// kmsCipher - AES-256 under "key", which is zeroed
+func kmsCipher(key []byte) (cipher.Block, error) {
+	defer clear(key)
+	if len(key) != 32 {
+		return nil, fmt.Errorf("eme: KMS data key must be 32 bytes long, is %d", len(key))
+	}
+	return aes.NewCipher(key)
+}
+
+// OpenKMSContainer opens the container at "path" like OpenContainer, with the
+// data key unwrapped by "k" from the header. An interrupted RotateKMSKey is
+// resumed with the wrapped new key from the header.
+func OpenKMSContainer(ctx context.Context, path string, k KMS) (*Container, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := ReadContainerHeader(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if h.WrappedKey() == nil {
+		return nil, errors.New("eme: container has no KMS-wrapped key")
+	}
+	bc, err := OpenKMSKey(ctx, k, h.WrappedKey())
+	if err != nil {
+		return nil, err
+	}
+	var next cipher.Block
+	if _, _, rotating := h.keyEpoch(); rotating && h.Field(fieldWrappedKeyNext) != nil {
+		if next, err = OpenKMSKey(ctx, k, h.Field(fieldWrappedKeyNext)); err != nil {
+			return nil, err
+		}
+	}
+	return OpenContainer(path, bc, next)
+}
+
+// RotateKMSKey re-encrypts the container under a fresh data key from "k",
+// see RotateKey. The wrapped new key is recorded in the header when the
+// rotation starts and replaces the old one in the header write that
+// finishes it, so the header always holds the keys the data needs. A
+// rotation started by RotateKMSKey and resumed by OpenKMSContainer is
+// finished with the key it was started with.
+func (c *Container) RotateKMSKey(ctx context.Context, k KMS) error {
+	c.mu.Lock()
+	_, _, rotating := c.h.keyEpoch()
+	next := c.h.Field(fieldWrappedKeyNext)
+	c.mu.Unlock()
+	if rotating {
+		if next == nil {
+			return errors.New("eme: the key rotation in progress was not started by RotateKMSKey")
+		}
+		bc, err := OpenKMSKey(ctx, k, next)
+		if err != nil {
+			return err
+		}
+		return c.rotateKey(bc, nil)
+	}
+	bc, wrapped, err := GenerateKMSKey(ctx, k)
+	if err != nil {
+		return err
+	}
+	return c.rotateKey(bc, wrapped)
+}
@@ -0,0 +1,142 @@
+package eme
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testKMS - a KMS that wraps data keys with WrapKey under a local master key
+type testKMS struct {
+	master cipher.Block
+	calls  int
+}
+
+func newTestKMS(t *testing.T) *testKMS {
+	master, err := aes.NewCipher(bytes.Repeat([]byte{0x4b}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKMS{master: master}
+}
+
+func (k *testKMS) GenerateDataKey(ctx context.Context) ([]byte, []byte, error) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	wrapped, err := WrapKey(k.master, key)
+	return key, wrapped, err
+}
+
+func (k *testKMS) DecryptDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	k.calls++
+	return UnwrapKey(k.master, wrapped)
+}
+
+// newKMSContainer - a 300-sector container under a fresh KMS data key
+func newKMSContainer(t *testing.T, k KMS) (string, []byte) {
+	dir := t.TempDir()
+	bc, wrapped, err := GenerateKMSKey(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := filepath.Join(dir, "disk.img")
+	orig := make([]byte, 300*512)
+	rand.Read(orig)
+	if err = os.WriteFile(img, orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cont := filepath.Join(dir, "disk.eme")
+	if err = ImageToContainer(cont, img, bc, ContainerOptions{SectorSize: 512, WrappedKey: wrapped}); err != nil {
+		t.Fatal(err)
+	}
+	return cont, orig
+}
+
+func checkKMSContainer(t *testing.T, cont string, k KMS, orig []byte) *Container {
+	t.Helper()
+	c, err := OpenKMSContainer(context.Background(), cont, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	for _, n := range []uint64{0, 255, 256, 299} {
+		if err = c.ReadSector(n, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, orig[n*512:(n+1)*512]) {
+			t.Errorf("sector %d: wrong content", n)
+		}
+	}
+	return c
+}
+
+func TestKMSContainer(t *testing.T) {
+	k := newTestKMS(t)
+	cont, orig := newKMSContainer(t, k)
+	c := checkKMSContainer(t, cont, k, orig)
+	old := c.Header().WrappedKey()
+	if err := c.RotateKMSKey(context.Background(), k); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(c.Header().WrappedKey(), old) || c.h.Field(fieldWrappedKeyNext) != nil {
+		t.Errorf("wrapped key was not replaced")
+	}
+	c.Close()
+	checkKMSContainer(t, cont, k, orig).Close()
+}
+
+// A RotateKMSKey interrupted after the first batch resumes from the header
+func TestKMSContainerRotationInterrupted(t *testing.T) {
+	k := newTestKMS(t)
+	cont, orig := newKMSContainer(t, k)
+	c := checkKMSContainer(t, cont, k, orig)
+	bc, wrapped, err := GenerateKMSKey(context.Background(), k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.next = c.h.pageCipher(bc)
+	c.h.SetField(fieldWrappedKeyNext, wrapped)
+	if err = c.beginRotation(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.rotateBatch(0, DefaultCheckpointInterval); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	k.calls = 0
+	c = checkKMSContainer(t, cont, k, orig)
+	if k.calls != 2 {
+		t.Errorf("%d keys unwrapped, want 2", k.calls)
+	}
+	if err = c.RotateKMSKey(context.Background(), k); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if h := c.Header(); !bytes.Equal(h.WrappedKey(), wrapped) || h.Field(fieldWrappedKeyNext) != nil {
+		t.Errorf("wrapped key was not replaced")
+	}
+	checkKMSContainer(t, cont, k, orig).Close()
+}
+
+func TestRotateKeyDropsWrappedKey(t *testing.T) {
+	k := newTestKMS(t)
+	cont, orig := newKMSContainer(t, k)
+	c := checkKMSContainer(t, cont, k, orig)
+	newBC, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	if err := c.RotateKey(newBC); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if c.Header().WrappedKey() != nil {
+		t.Errorf("stale wrapped key kept")
+	}
+	if _, err := OpenKMSContainer(context.Background(), cont, k); err == nil {
+		t.Errorf("opened a container without a wrapped key")
+	}
+}
@@ -0,0 +1,142 @@
+package eme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// KubeKMSAPIVersion is the KMS plugin API version KubeKMSPlugin implements.
+const KubeKMSAPIVersion = "v2"
+
+// kubeKMSMaxCiphertext - the longest ciphertext kube-apiserver accepts
+const kubeKMSMaxCiphertext = 1024
+
+// kubeKMSKeyPrefix - starts the key IDs reported to kube-apiserver
+const kubeKMSKeyPrefix = "eme-"
+
+// KubeKMSPlugin implements the Kubernetes KMS v2 plugin service, for
+// encrypting etcd secrets with keys held by a self-hosted provider instead of
+// a cloud KMS. kube-apiserver encrypts every secret under a data key of its
+// own, and sends only that data key to the plugin, which encrypts it into an
+// envelope (see Keyring.NewWriter) under the current key of a Keyring.
+//
+// The gRPC service needs the code generated from k8s.io/kms/apis/v2, which
+// this package does not depend on. Its KeyManagementServiceServer maps one to
+// one onto the methods below:
+//
+//   - Status returns StatusResponse{Version, Healthz, KeyId} from
+//     KubeKMSStatus.
+//   - Encrypt passes Uid and Plaintext and returns EncryptResponse{
+//     Ciphertext, KeyId}.
+//   - Decrypt passes Uid, KeyId and Ciphertext and returns
+//     DecryptResponse{Plaintext}.
+//
+// Serve it on a Unix socket named in the EncryptionConfiguration of
+// kube-apiserver. To rotate, add a new key to the Keyring: Status reports the
+// new key ID, which makes kube-apiserver use it for new data keys, while data
+// keys under older keys decrypt as long as those keys stay in the Keyring.
+//
+// The envelopes are not authenticated, but kube-apiserver encrypts secrets
+// with AES-GCM, so a tampered envelope gives a data key under which no secret
+// decrypts.
+type KubeKMSPlugin struct {
+	ring *Keyring
+}
+
+// KubeKMSStatus is the result of KubeKMSPlugin.Status.
+type KubeKMSStatus struct {
+	// Version is KubeKMSAPIVersion
+	Version string
+	// Healthz is "ok" if the plugin can encrypt and decrypt
+	Healthz string
+	// KeyID names the current key
+	KeyID string
+}
+
+// NewKubeKMSPlugin returns a KubeKMSPlugin with the keys of "ring".
+func NewKubeKMSPlugin(ring *Keyring) *KubeKMSPlugin {
+	return &KubeKMSPlugin{ring: ring}
+}
+
+// Status reports the API version, the health and the current key ID. The
+// plugin is healthy if a probe encrypts and decrypts under the current key;
+// otherwise Healthz holds the error.
+func (p *KubeKMSPlugin) Status(ctx context.Context) (*KubeKMSStatus, error) {
+	st := &KubeKMSStatus{Version: KubeKMSAPIVersion, Healthz: "ok"}
+	probe := []byte("eme kms v2 healthz")
+	ct, keyID, err := p.Encrypt(ctx, "healthz", probe)
+	if err == nil {
+		var got []byte
+		got, err = p.Decrypt(ctx, "healthz", keyID, ct)
+		if err == nil && !bytes.Equal(got, probe) {
+			err = errors.New("probe does not roundtrip")
+		}
+	}
+	if err != nil {
+		st.Healthz = err.Error()
+	}
+	if id := p.ring.Current(); id != 0 {
+		st.KeyID = kubeKMSKeyID(id)
+	}
+	return st, nil
+}
+
+// Encrypt encrypts "plaintext", a data key of kube-apiserver, under the
+// current key and returns the envelope and the key ID. "uid" identifies the
+// request in logs and is not used.
+func (p *KubeKMSPlugin) Encrypt(ctx context.Context, uid string, plaintext []byte) ([]byte, string, error) {
+	var buf bytes.Buffer
+	w, err := p.ring.NewWriter(&buf)
+	if err != nil {
+		return nil, "", err
+	}
+	w.Write(plaintext)
+	if err = w.Close(); err != nil {
+		return nil, "", err
+	}
+	if buf.Len() > kubeKMSMaxCiphertext {
+		return nil, "", fmt.Errorf("eme: KMS ciphertext of %d bytes exceeds the %d bytes kube-apiserver accepts", buf.Len(), kubeKMSMaxCiphertext)
+	}
+	// The key the envelope is under, even if a rotation raced with NewWriter
+	return buf.Bytes(), kubeKMSKeyID(envelopeKeyID(buf.Bytes())), nil
+}
+
+// Decrypt decrypts an envelope from Encrypt. "keyID" must be the key ID
+// Encrypt returned with it, which is checked against the envelope.
+func (p *KubeKMSPlugin) Decrypt(ctx context.Context, uid string, keyID string, ciphertext []byte) ([]byte, error) {
+	r := bytes.NewReader(ciphertext)
+	hdr, err := readEnvelopeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	id := envelopeKeyID(hdr)
+	if want, err := parseKubeKMSKeyID(keyID); err != nil {
+		return nil, err
+	} else if id != want {
+		return nil, fmt.Errorf("eme: envelope is under key %s, not %s", kubeKMSKeyID(id), keyID)
+	}
+	c, err := p.ring.Cipher(id)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(newEnvelopeReader(r, c.bc, hdr))
+}
+
+// kubeKMSKeyID - the key ID of Keyring key "id"
+func kubeKMSKeyID(id uint32) string {
+	return kubeKMSKeyPrefix + strconv.FormatUint(uint64(id), 10)
+}
+
+// parseKubeKMSKeyID - reverse kubeKMSKeyID
+func parseKubeKMSKeyID(s string) (uint32, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(s, kubeKMSKeyPrefix), 10, 32)
+	if err != nil || !strings.HasPrefix(s, kubeKMSKeyPrefix) {
+		return 0, fmt.Errorf("eme: invalid KMS key ID %q", s)
+	}
+	return uint32(n), nil
+}
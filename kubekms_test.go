@@ -0,0 +1,52 @@
+package eme
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"testing"
+)
+
+func TestKubeKMSPlugin(t *testing.T) {
+	ctx := context.Background()
+	ring := NewKeyring()
+	p := NewKubeKMSPlugin(ring)
+	if st, _ := p.Status(ctx); st.Healthz == "ok" || st.KeyID != "" {
+		t.Errorf("empty keyring reported as %+v", st)
+	}
+	bc1, _ := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	ring.Add(1, New(bc1))
+	st, err := p.Status(ctx)
+	if err != nil || *st != (KubeKMSStatus{Version: "v2", Healthz: "ok", KeyID: "eme-1"}) {
+		t.Fatalf("Status = %+v, %v", st, err)
+	}
+	dek := bytes.Repeat([]byte{9}, 32)
+	ct, keyID, err := p.Encrypt(ctx, "uid-1", dek)
+	if err != nil || keyID != "eme-1" {
+		t.Fatalf("Encrypt: %q, %v", keyID, err)
+	}
+	if bytes.Contains(ct, dek[:8]) {
+		t.Errorf("data key visible in ciphertext")
+	}
+	// After a rotation, new data keys use the new key and old ones still
+	// decrypt
+	bc2, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	ring.Add(2, New(bc2))
+	if st, _ := p.Status(ctx); st.KeyID != "eme-2" {
+		t.Errorf("after rotation, key ID is %q", st.KeyID)
+	}
+	if got, err := p.Decrypt(ctx, "uid-2", keyID, ct); err != nil || !bytes.Equal(got, dek) {
+		t.Errorf("Decrypt = %x, %v", got, err)
+	}
+	if _, err := p.Decrypt(ctx, "uid-3", "eme-2", ct); err == nil {
+		t.Errorf("wrong key ID accepted")
+	}
+	for _, bad := range []string{"", "eme-", "1", "eme-x", "eme-99999999999"} {
+		if _, err := p.Decrypt(ctx, "uid-4", bad, ct); err == nil {
+			t.Errorf("key ID %q accepted", bad)
+		}
+	}
+	if _, _, err := p.Encrypt(ctx, "uid-5", make([]byte, 2000)); err == nil {
+		t.Errorf("oversized ciphertext returned")
+	}
+}
@@ -0,0 +1,49 @@
+package eme
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// logger - where the package logs, see SetLogger
+var logger atomic.Pointer[slog.Logger]
+
+func init() {
+	logger.Store(slog.New(slog.DiscardHandler))
+}
+
+// SetLogger makes the package log to "l", or nowhere if "l" is nil, which is
+// the default. The package only logs the message of a panic for invalid
+// parameters (see ParamError) at level Error, just before raising it, with
+// the caller as the source.
+func SetLogger(l *slog.Logger) {
+	if l == nil {
+		l = slog.New(slog.DiscardHandler)
+	}
+	logger.Store(l)
+}
+
+// logPanicf - log the message at level Error and panic with it
+func logPanicf(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	logError(1, msg)
+	panic(msg)
+}
+
+// logError - log "msg" at level Error with the caller "skip" frames above
+// the caller of logError as the source
+func logError(skip int, msg string) {
+	l := logger.Load()
+	if !l.Enabled(context.Background(), slog.LevelError) {
+		return
+	}
+	var pcs [1]uintptr
+	// Skip runtime.Callers, logError and "skip" more
+	runtime.Callers(skip+2, pcs[:])
+	r := slog.NewRecord(time.Now(), slog.LevelError, msg, pcs[0])
+	l.Handler().Handle(context.Background(), r)
+}
@@ -0,0 +1,38 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{AddSource: true})))
+	defer SetLogger(nil)
+	bc, _ := aes.NewCipher(make([]byte, 16))
+	func() {
+		defer func() { recover() }()
+		New(bc).Encrypt(make([]byte, 15), make([]byte, 16))
+	}()
+	out := buf.String()
+	if !strings.Contains(out, "level=ERROR") || !strings.Contains(out, "Tweak") {
+		t.Errorf("not logged: %q", out)
+	}
+	// The source is the function that checked the parameters, not the
+	// logging helpers
+	if strings.Contains(out, "errors.go") || strings.Contains(out, "logging.go") {
+		t.Errorf("wrong source: %q", out)
+	}
+	buf.Reset()
+	SetLogger(nil)
+	func() {
+		defer func() { recover() }()
+		New(bc).Encrypt(make([]byte, 15), make([]byte, 16))
+	}()
+	if buf.Len() != 0 {
+		t.Errorf("logged after SetLogger(nil): %q", buf.String())
+	}
+}
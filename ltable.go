@@ -0,0 +1,180 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLTable is returned when an exported L table was made under a different
+// key or for a different page size, or has been modified.
+var ErrLTable = errors.New("eme: exported L table does not match the key or is corrupt")
+
+// lTableMagic - the first bytes of an exported L table
+var lTableMagic = [8]byte{'E', 'M', 'E', 'L', 'T', 'A', 'B', 0}
+
+const lTableVersion = 1
+
+// lTableDomain - encrypted under the key to derive the encryption and the
+// MAC key of exported L tables, like keyCheckDomain
+var lTableDomain = [4][16]byte{
+	{'e', 'm', 'e', ' ', 'l', 't', 'a', 'b', 'l', 'e', ' ', 'e', 'n', 'c', ' ', '1'},
+	{'e', 'm', 'e', ' ', 'l', 't', 'a', 'b', 'l', 'e', ' ', 'e', 'n', 'c', ' ', '2'},
+	{'e', 'm', 'e', ' ', 'l', 't', 'a', 'b', 'l', 'e', ' ', 'm', 'a', 'c', ' ', '1'},
+	{'e', 'm', 'e', ' ', 'l', 't', 'a', 'b', 'l', 'e', ' ', 'm', 'a', 'c', ' ', '2'},
+}
+
+// lTableKeys - the encryption and the MAC key for exported L tables of "bc"
+type lTableKeys struct {
+	enc, mac [32]byte
+}
+
+func newLTableKeys(bc cipher.Block) *lTableKeys {
+	k := &lTableKeys{}
+	bc.Encrypt(k.enc[:16], lTableDomain[0][:])
+	bc.Encrypt(k.enc[16:], lTableDomain[1][:])
+	bc.Encrypt(k.mac[:16], lTableDomain[2][:])
+	bc.Encrypt(k.mac[16:], lTableDomain[3][:])
+	return k
+}
+
+func (k *lTableKeys) clear() {
+	clear(k.enc[:])
+	clear(k.mac[:])
+}
+
+// fingerprint - identifies the key without revealing it: a truncated HMAC
+// under the MAC key
+func (k *lTableKeys) fingerprint() []byte {
+	m := hmac.New(sha256.New, k.mac[:])
+	m.Write([]byte("eme ltable fingerprint v1"))
+	return m.Sum(nil)[:16]
+}
+
+// ctr - encrypt or decrypt "table" in place with AES-256-CTR under "iv"
+func (k *lTableKeys) ctr(iv []byte, table []byte) error {
+	bc, err := aes.NewCipher(k.enc[:])
+	if err != nil {
+		return err
+	}
+	cipher.NewCTR(bc, iv).XORKeyStream(table, table)
+	return nil
+}
+
+// ExportLTable returns the L table of the PageCipher, encrypted and
+// authenticated under its key, for NewPageCipherFromLTable. The table is
+// derived from the key, so it is as secret as the key and must not be
+// stored in plaintext.
+//
+// Layout (integers big-endian):
+//
+//	0   magic "EMELTAB\0"
+//	8   version (uint16)
+//	10  number of table entries (uint16)
+//	12  key fingerprint (16 bytes)
+//	28  CTR IV (16 bytes)
+//	44  the table, AES-256-CTR encrypted
+//	    HMAC-SHA256 of everything before it
+//
+// Both keys are derived from the PageCipher key, like the check value of a
+// container header.
+func (p *PageCipher) ExportLTable() ([]byte, error) {
+	k := newLTableKeys(p.bc)
+	defer k.clear()
+	m := len(p.lTable) / 16
+	b := make([]byte, 44, 44+len(p.lTable)+sha256.Size)
+	copy(b, lTableMagic[:])
+	binary.BigEndian.PutUint16(b[8:], lTableVersion)
+	binary.BigEndian.PutUint16(b[10:], uint16(m))
+	copy(b[12:28], k.fingerprint())
+	if _, err := rand.Read(b[28:44]); err != nil {
+		return nil, err
+	}
+	b = append(b, p.lTable...)
+	if err := k.ctr(b[28:44], b[44:]); err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, k.mac[:])
+	mac.Write(b)
+	return mac.Sum(b), nil
+}
+
+// NewPageCipherFromLTable is NewPageCipher, but takes the L table from
+// "exported", the output of ExportLTable, instead of computing it. It
+// returns ErrLTable if "exported" was made under a different key or for a
+// different page size, or if it was modified. It panics on invalid
+// parameters like NewPageCipher.
+func NewPageCipherFromLTable(bc cipher.Block, pageSize int, exported []byte) (*PageCipher, error) {
+	m := pageTableBlocks(bc, pageSize)
+	if len(exported) != 44+m*16+sha256.Size || !bytes.Equal(exported[:8], lTableMagic[:]) ||
+		binary.BigEndian.Uint16(exported[8:]) != lTableVersion ||
+		int(binary.BigEndian.Uint16(exported[10:])) != m {
+		return nil, ErrLTable
+	}
+	k := newLTableKeys(bc)
+	defer k.clear()
+	body := exported[:len(exported)-sha256.Size]
+	mac := hmac.New(sha256.New, k.mac[:])
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), exported[len(body):]) || !hmac.Equal(body[12:28], k.fingerprint()) {
+		return nil, ErrLTable
+	}
+	lTable := alignedBytes(m * 16)
+	copy(lTable, body[44:])
+	if err := k.ctr(body[28:44], lTable); err != nil {
+		return nil, err
+	}
+	return &PageCipher{
+		bc:       bc,
+		pageSize: pageSize,
+		lTable:   lTable,
+	}, nil
+}
+
+// LTableCache keeps exported L tables in a directory, so that a daemon that
+// restarts with the same key loads its tables instead of computing them.
+// Files are named by the key fingerprint and the page size, and are only
+// readable by the owner.
+type LTableCache struct {
+	// Dir is the cache directory. It must exist.
+	Dir string
+}
+
+// PageCipher returns a PageCipher for "bc" and "pageSize", with the L table
+// from the cache if it holds a valid one. Otherwise it computes the table
+// and stores it, replacing a cache file that failed the integrity check.
+func (c *LTableCache) PageCipher(bc cipher.Block, pageSize int) (*PageCipher, error) {
+	k := newLTableKeys(bc)
+	name := fmt.Sprintf("%x-%d.ltable", k.fingerprint(), pageSize)
+	k.clear()
+	path := filepath.Join(c.Dir, name)
+	b, err := os.ReadFile(path)
+	if err == nil {
+		p, err := NewPageCipherFromLTable(bc, pageSize, b)
+		if err == nil {
+			return p, nil
+		}
+		if !errors.Is(err, ErrLTable) {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	p := NewPageCipher(bc, pageSize)
+	b, err = p.ExportLTable()
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(path, b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
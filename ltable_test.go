@@ -0,0 +1,121 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// An imported L table must give the same ciphertext as a computed one.
+func TestLTableExportImport(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{16, 512, 2048, 65536} {
+		p := NewPageCipher(bc, size)
+		b, err := p.ExportLTable()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(b, p.lTable[:16]) {
+			t.Errorf("size %d: exported table contains L_0 in plaintext", size)
+		}
+		q, err := NewPageCipherFromLTable(bc, size, b)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		want := make([]byte, size)
+		got := make([]byte, size)
+		p.EncryptPage(3, want)
+		q.EncryptPage(3, got)
+		if !bytes.Equal(got, want) {
+			t.Errorf("size %d: imported table encrypts differently", size)
+		}
+	}
+}
+
+// Tables for another key or page size, and modified tables, are rejected.
+func TestLTableImportRejects(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewPageCipher(bc, 4096).ExportLTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPageCipherFromLTable(other, 4096, b); !errors.Is(err, ErrLTable) {
+		t.Errorf("other key: got %v", err)
+	}
+	if _, err := NewPageCipherFromLTable(bc, 512, b); !errors.Is(err, ErrLTable) {
+		t.Errorf("other page size: got %v", err)
+	}
+	for _, i := range []int{0, 11, 20, 40, 100, len(b) - 1} {
+		c := bytes.Clone(b)
+		c[i] ^= 1
+		if _, err := NewPageCipherFromLTable(bc, 4096, c); !errors.Is(err, ErrLTable) {
+			t.Errorf("byte %d modified: got %v", i, err)
+		}
+	}
+	if _, err := NewPageCipherFromLTable(bc, 4096, b[:len(b)-1]); !errors.Is(err, ErrLTable) {
+		t.Errorf("truncated: got %v", err)
+	}
+}
+
+func TestLTableCache(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &LTableCache{Dir: t.TempDir()}
+	p, err := c.PageCipher(bc, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(c.Dir, "*-4096.ltable"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("cache files: %v, %v", files, err)
+	}
+	stored, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A hit loads the stored table and leaves the file alone
+	q, err := c.PageCipher(bc, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(q.lTable, p.lTable) {
+		t.Error("cached table differs")
+	}
+	if b, _ := os.ReadFile(files[0]); !bytes.Equal(b, stored) {
+		t.Error("cache hit rewrote the file")
+	}
+	// A corrupt file is replaced
+	stored[50] ^= 1
+	if err := os.WriteFile(files[0], stored, 0600); err != nil {
+		t.Fatal(err)
+	}
+	q, err = c.PageCipher(bc, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(q.lTable, p.lTable) {
+		t.Error("table differs after a corrupt cache file")
+	}
+	b, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewPageCipherFromLTable(bc, 4096, b); err != nil {
+		t.Errorf("corrupt cache file was not replaced: %v", err)
+	}
+}
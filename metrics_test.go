@@ -0,0 +1,39 @@
+package eme
+
+import (
+	"crypto/aes"
+	"errors"
+	"expvar"
+	"testing"
+)
+
+func TestExpvarMetrics(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	m := NewExpvarMetrics("eme_test_metrics")
+	e := New(bc)
+	e.SetMetrics(m)
+	tweak := make([]byte, 16)
+	ct := e.Encrypt(tweak, make([]byte, 64))
+	e.Decrypt(tweak, ct)
+	e.Decrypt(tweak, ct[:32])
+	func() {
+		defer func() {
+			if r := recover(); !errors.Is(r.(error), ErrDataSize) {
+				t.Errorf("panic %v", r)
+			}
+		}()
+		e.Encrypt(tweak, make([]byte, 15))
+	}()
+	want := map[string]int64{"encrypt_ops": 2, "encrypt_bytes": 79, "encrypt_errors": 1, "decrypt_ops": 2, "decrypt_bytes": 96}
+	for k, v := range want {
+		if got := m.Map().Get(k); got == nil || got.(*expvar.Int).Value() != v {
+			t.Errorf("%s = %v, want %d", k, got, v)
+		}
+	}
+	if m.Map().Get("decrypt_errors") != nil {
+		t.Errorf("decrypt errors counted")
+	}
+	if m.Map().Get("encrypt_nanoseconds").(*expvar.Int).Value() <= 0 {
+		t.Errorf("no durations recorded")
+	}
+}
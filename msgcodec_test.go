@@ -0,0 +1,55 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestStreamCodec(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	c := NewStreamCodec(jsonCodec{}, bc)
+	payload := bytes.Repeat([]byte("payload "), 500)
+	r1, err := c.EncryptMessage("orders", payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, _ := c.EncryptMessage("orders", payload)
+	if bytes.Equal(r1, r2) {
+		t.Errorf("random prefix has no effect")
+	}
+	s1 := c.EncryptMessageSeq("orders", 7, payload)
+	if !bytes.Equal(s1, c.EncryptMessageSeq("orders", 7, payload)) {
+		t.Errorf("sequence mode is not deterministic")
+	}
+	if bytes.Equal(s1, c.EncryptMessageSeq("orders", 8, payload)) {
+		t.Errorf("sequence number has no effect")
+	}
+	for _, msg := range [][]byte{r1, s1} {
+		got, err := c.DecryptMessage("orders", msg)
+		if err != nil || !bytes.Equal(got, payload) {
+			t.Errorf("kind %d: roundtrip failed: %v", msg[0], err)
+		}
+		if got, _ := c.DecryptMessage("payments", msg); bytes.Equal(got, payload) {
+			t.Errorf("kind %d: message decrypts under another topic", msg[0])
+		}
+	}
+	for _, bad := range [][]byte{nil, {msgRandom}, {msgSeq, 0, 0, 0, 0, 0, 0, 0, 0}, append([]byte{3}, s1[1:]...), s1[:20]} {
+		if _, err := c.DecryptMessage("orders", bad); err == nil {
+			t.Errorf("%x accepted", bad)
+		}
+	}
+}
+
+func TestStreamCodecEncoder(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	c := NewStreamCodec(jsonCodec{}, bc)
+	data, err := c.Encode("updates", map[string]int{"n": 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]int
+	if err = c.Decode("updates", data, &out); err != nil || out["n"] != 42 {
+		t.Errorf("Decode = %v, %v", out, err)
+	}
+}
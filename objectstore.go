@@ -0,0 +1,206 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ObjectStore is the part of an object-storage client (S3, GCS, Azure Blob,
+// ...) that ObjectClient needs. Adapting an SDK client takes a few lines:
+// the multipart calls map one to one, GetRange is a GET with a Range header
+// and Size is a HEAD request.
+type ObjectStore interface {
+	CreateMultipartUpload(key string) (uploadID string, err error)
+	// UploadPart uploads part number "part" (starting at 1).
+	UploadPart(key string, uploadID string, part int, data []byte) error
+	CompleteMultipartUpload(key string, uploadID string) error
+	// AbortMultipartUpload discards the parts of an upload that failed.
+	AbortMultipartUpload(key string, uploadID string) error
+	// GetRange returns "n" bytes of object "key" starting at "off".
+	GetRange(key string, off int64, n int64) ([]byte, error)
+	// Size returns the size of object "key" in bytes.
+	Size(key string) (int64, error)
+}
+
+// DefaultPartSize is the multipart upload part size used by ObjectClient
+// unless PartSize is set. It satisfies the 5 MiB minimum of S3.
+const DefaultPartSize = 8 << 20
+
+// objectSectorSize - the unit of encryption inside objects. Ranged reads are
+// rounded out to whole sectors.
+const objectSectorSize = 4096
+
+// objectTrailerMagic - ends every encrypted object
+var objectTrailerMagic = []byte("EMEOBJ\x00\x01")
+
+// ObjectClient stores EME-encrypted objects in an ObjectStore. Objects are
+// encrypted in 4096-byte sectors; sector "n" of object "key" is encrypted
+// under the tweaks (n, i) XORed with a salt derived from "key", so ranged
+// reads only need to fetch and decrypt the sectors they cover, and equal
+// content under different keys does not produce equal ciphertext.
+//
+// The stored object is the ciphertext, with the last sector zero-padded to a
+// multiple of 16 bytes, followed by a 16-byte trailer holding the plaintext
+// length.
+type ObjectClient struct {
+	store ObjectStore
+	bc    cipher.Block
+	// PartSize is the multipart upload part size. It must be a multiple of
+	// 4096. Zero means DefaultPartSize.
+	PartSize int
+}
+
+// NewObjectClient returns an ObjectClient storing objects in "store",
+// encrypted with "bc".
+func NewObjectClient(store ObjectStore, bc cipher.Block) *ObjectClient {
+	return &ObjectClient{store: store, bc: bc}
+}
+
+// Upload encrypts everything read from "r" and stores it as object "key"
+// using a multipart upload. Memory use is bounded by one part. If reading,
+// encrypting or storing fails, the upload is aborted, so that no parts are
+// left behind.
+func (c *ObjectClient) Upload(key string, r io.Reader) error {
+	partSize := c.PartSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize <= 0 || partSize%objectSectorSize != 0 {
+		return fmt.Errorf("part size must be a positive multiple of %d, is %d", objectSectorSize, partSize)
+	}
+	uploadID, err := c.store.CreateMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+	if err = c.uploadParts(key, uploadID, r, partSize); err != nil {
+		if abortErr := c.store.AbortMultipartUpload(key, uploadID); abortErr != nil {
+			return errors.Join(err, abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// uploadParts - encrypt "r" into the parts of upload "uploadID" and complete
+// it
+func (c *ObjectClient) uploadParts(key string, uploadID string, r io.Reader, partSize int) error {
+	salt := objectSalt(key)
+	buf := make([]byte, partSize+16+16)
+	var size uint64
+	for part := 1; ; part++ {
+		n, err := io.ReadFull(r, buf[:partSize])
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		data := buf[:n]
+		firstSector := size / objectSectorSize
+		size += uint64(n)
+		if last {
+			data = buf[:n+padLen16(n)]
+			for i := n; i < len(data); i++ {
+				data[i] = 0
+			}
+		}
+		for i := 0; i < len(data); i += objectSectorSize {
+			end := i + objectSectorSize
+			if end > len(data) {
+				end = len(data)
+			}
+			transformChunk(c.bc, salt, firstSector+uint64(i/objectSectorSize), data[i:end], DirectionEncrypt)
+		}
+		if last {
+			var trailer [16]byte
+			binary.BigEndian.PutUint64(trailer[0:8], size)
+			copy(trailer[8:], objectTrailerMagic)
+			data = append(data, trailer[:]...)
+		}
+		if err = c.store.UploadPart(key, uploadID, part, data); err != nil {
+			return err
+		}
+		if last {
+			return c.store.CompleteMultipartUpload(key, uploadID)
+		}
+	}
+}
+
+// Size returns the plaintext size of object "key".
+func (c *ObjectClient) Size(key string) (int64, error) {
+	stored, err := c.store.Size(key)
+	if err != nil {
+		return 0, err
+	}
+	return c.plainSize(key, stored)
+}
+
+func (c *ObjectClient) plainSize(key string, stored int64) (int64, error) {
+	if stored < 16 {
+		return 0, errors.New("object too short to be encrypted")
+	}
+	trailer, err := c.store.GetRange(key, stored-16, 16)
+	if err != nil {
+		return 0, err
+	}
+	if len(trailer) != 16 || !bytes.Equal(trailer[8:], objectTrailerMagic) {
+		return 0, fmt.Errorf("object %q is not encrypted by ObjectClient", key)
+	}
+	size := int64(binary.BigEndian.Uint64(trailer[0:8]))
+	if size+int64(padLen16(int(size%16)))+16 != stored {
+		return 0, fmt.Errorf("object %q has a corrupt trailer", key)
+	}
+	return size, nil
+}
+
+// GetRange returns up to "n" plaintext bytes of object "key" starting at
+// "off". Only the sectors that cover the range are fetched. Like
+// io.ReaderAt, it returns io.EOF if the range extends past the end.
+func (c *ObjectClient) GetRange(key string, off int64, n int64) ([]byte, error) {
+	if off < 0 || n < 0 {
+		return nil, errors.New("negative offset or length")
+	}
+	size, err := c.Size(key)
+	if err != nil {
+		return nil, err
+	}
+	var eof error
+	if off+n > size {
+		eof = io.EOF
+		n = size - off
+		if n <= 0 {
+			return nil, io.EOF
+		}
+	}
+	first := off / objectSectorSize
+	end := (off + n + objectSectorSize - 1) / objectSectorSize * objectSectorSize
+	if padded := size + int64(padLen16(int(size%16))); end > padded {
+		end = padded
+	}
+	data, err := c.store.GetRange(key, first*objectSectorSize, end-first*objectSectorSize)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-first*objectSectorSize {
+		return nil, fmt.Errorf("short read on object %q", key)
+	}
+	salt := objectSalt(key)
+	for i := 0; i < len(data); i += objectSectorSize {
+		e := i + objectSectorSize
+		if e > len(data) {
+			e = len(data)
+		}
+		transformChunk(c.bc, salt, uint64(first)+uint64(i/objectSectorSize), data[i:e], DirectionDecrypt)
+	}
+	skip := off - first*objectSectorSize
+	return data[skip : skip+n], eof
+}
+
+// objectSalt - per-object tweak salt, the first 16 bytes of SHA-256("key")
+func objectSalt(key string) []byte {
+	h := sha256.Sum256([]byte(key))
+	return h[:16]
+}
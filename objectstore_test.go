@@ -0,0 +1,168 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// memStore - in-memory ObjectStore
+type memStore struct {
+	objects map[string][]byte
+	parts   map[string][][]byte
+	// aborted - the uploads that were aborted
+	aborted []string
+	// failPart, failComplete - make UploadPart of that part number, or
+	// CompleteMultipartUpload, fail
+	failPart     int
+	failComplete bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{objects: map[string][]byte{}, parts: map[string][][]byte{}}
+}
+
+func (s *memStore) CreateMultipartUpload(key string) (string, error) {
+	s.parts[key] = nil
+	return key, nil
+}
+
+func (s *memStore) UploadPart(key string, uploadID string, part int, data []byte) error {
+	if part != len(s.parts[uploadID])+1 {
+		return errors.New("parts out of order")
+	}
+	if part == s.failPart {
+		return errors.New("upload failed")
+	}
+	s.parts[uploadID] = append(s.parts[uploadID], append([]byte{}, data...))
+	return nil
+}
+
+func (s *memStore) CompleteMultipartUpload(key string, uploadID string) error {
+	if s.failComplete {
+		return errors.New("complete failed")
+	}
+	s.objects[key] = bytes.Join(s.parts[uploadID], nil)
+	return nil
+}
+
+func (s *memStore) AbortMultipartUpload(key string, uploadID string) error {
+	if _, ok := s.parts[uploadID]; !ok {
+		return errors.New("no such upload")
+	}
+	delete(s.parts, uploadID)
+	s.aborted = append(s.aborted, uploadID)
+	return nil
+}
+
+func (s *memStore) GetRange(key string, off int64, n int64) ([]byte, error) {
+	o := s.objects[key]
+	return append([]byte{}, o[off:off+n]...), nil
+}
+
+func (s *memStore) Size(key string) (int64, error) {
+	return int64(len(s.objects[key])), nil
+}
+
+func TestObjectClient(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newMemStore()
+	c := NewObjectClient(store, bc)
+	c.PartSize = 2 * objectSectorSize
+	orig := make([]byte, 5*objectSectorSize+1234)
+	for i := range orig {
+		orig[i] = byte(i % 251)
+	}
+	if err = c.Upload("a/b", bytes.NewReader(orig)); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.parts["a/b"]) != 3 {
+		t.Errorf("expected 3 parts, got %d", len(store.parts["a/b"]))
+	}
+	if size, err := c.Size("a/b"); err != nil || size != int64(len(orig)) {
+		t.Errorf("Size=%d err=%v", size, err)
+	}
+	for _, r := range [][2]int64{{0, 10}, {4090, 20}, {0, int64(len(orig))}, {int64(len(orig)) - 5, 5}, {12345, 8000}} {
+		got, err := c.GetRange("a/b", r[0], r[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, orig[r[0]:r[0]+r[1]]) {
+			t.Errorf("range %v differs", r)
+		}
+	}
+	got, err := c.GetRange("a/b", int64(len(orig))-3, 10)
+	if err != io.EOF || !bytes.Equal(got, orig[len(orig)-3:]) {
+		t.Errorf("read past the end: %v", err)
+	}
+
+	// Same content under another key must not give the same ciphertext
+	if err = c.Upload("other", bytes.NewReader(orig)); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(store.objects["a/b"][:16], store.objects["other"][:16]) {
+		t.Errorf("object key is not part of the tweak")
+	}
+}
+
+// failingReader - returns "n" zero bytes, then an error
+type failingReader struct {
+	n int
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, errors.New("read failed")
+	}
+	n := min(len(p), r.n)
+	clear(p[:n])
+	r.n -= n
+	return n, nil
+}
+
+// A failed upload must be aborted, whichever step fails after
+// CreateMultipartUpload.
+func TestObjectClientAbort(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := 5 * objectSectorSize
+	for _, c := range []struct {
+		name  string
+		setup func(s *memStore)
+		r     io.Reader
+	}{
+		{"read", func(s *memStore) {}, &failingReader{n: 3 * objectSectorSize}},
+		{"first part", func(s *memStore) { s.failPart = 1 }, bytes.NewReader(make([]byte, size))},
+		{"later part", func(s *memStore) { s.failPart = 2 }, bytes.NewReader(make([]byte, size))},
+		{"complete", func(s *memStore) { s.failComplete = true }, bytes.NewReader(make([]byte, size))},
+	} {
+		store := newMemStore()
+		c.setup(store)
+		oc := NewObjectClient(store, bc)
+		oc.PartSize = 2 * objectSectorSize
+		if err := oc.Upload("k", c.r); err == nil {
+			t.Errorf("%s: no error", c.name)
+		}
+		if len(store.aborted) != 1 || store.aborted[0] != "k" {
+			t.Errorf("%s: aborted %v", c.name, store.aborted)
+		}
+		if len(store.parts) != 0 || len(store.objects) != 0 {
+			t.Errorf("%s: left %d uploads and %d objects", c.name, len(store.parts), len(store.objects))
+		}
+	}
+	// A successful upload is not aborted
+	store := newMemStore()
+	if err := NewObjectClient(store, bc).Upload("k", bytes.NewReader(make([]byte, size))); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.aborted) != 0 {
+		t.Errorf("successful upload aborted")
+	}
+}
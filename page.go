@@ -0,0 +1,168 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// pageSegmentSize - EME operates on at most 128 block-cipher blocks, so pages
+// larger than 2048 bytes are processed as independent 2048-byte segments.
+const pageSegmentSize = maxMessageBlocks * 16
+
+// PageCipher encrypts and decrypts fixed-size pages in place, using the page
+// number as the tweak. It is meant for database engines that want at-rest
+// encryption of their 4 KiB, 8 KiB or 16 KiB pages without changing the page
+// size.
+//
+// Pages up to 2048 bytes are a single EME block. Larger pages are split into
+// 2048-byte segments, and segment "i" of page "n" is encrypted under the tweak
+// (n, i), so a change anywhere inside a segment changes the whole segment,
+// but not the other segments of the page.
+//
+// The L table and all scratch space are allocated once in NewPageCipher, so
+// EncryptPage and DecryptPage do not allocate. A PageCipher is not safe for
+// concurrent use; create one per goroutine.
+type PageCipher struct {
+	bc       cipher.Block
+	pageSize int
+	lTable   []byte
+	// salt - XORed into every tweak, see ContainerHeader
+	salt  [16]byte
+	tweak [16]byte
+	w     workspace
+	// parallel - see SetParallel
+	parallel int
+}
+
+// validPageSize - whether NewPageCipher accepts "n", up to 1 MiB. For sizes
+// that come from files and configuration.
+func validPageSize(n int) bool {
+	return n > 0 && n%16 == 0 && (n <= pageSegmentSize || n%pageSegmentSize == 0) && n <= 1<<20
+}
+
+// CheckPageSize returns a *ParamError wrapping ErrPageSize unless
+// NewPageCipher accepts "pageSize" and it is at most 1 MiB. Use it for sizes
+// that come from users, files or configuration, before they reach
+// NewPageCipher.
+func CheckPageSize(pageSize int) error {
+	if !validPageSize(pageSize) {
+		return &ParamError{Err: ErrPageSize, Msg: fmt.Sprintf("eme: invalid page size %d", pageSize)}
+	}
+	return nil
+}
+
+// NewPageCipher returns a PageCipher for pages of "pageSize" bytes. "bc" must
+// have a block size of 16. "pageSize" must be a multiple of 16 that is either
+// at most 2048 or a multiple of 2048 (like 4096, 8192 and 16384). If any of
+// these pre-conditions are not met, the function will panic.
+func NewPageCipher(bc cipher.Block, pageSize int) *PageCipher {
+	return &PageCipher{
+		bc:       bc,
+		pageSize: pageSize,
+		lTable:   tabulateL(bc, pageTableBlocks(bc, pageSize)),
+	}
+}
+
+// pageTableBlocks - the number of L table entries a PageCipher for
+// "pageSize" needs. Panics like NewPageCipher on invalid parameters.
+func pageTableBlocks(bc cipher.Block, pageSize int) int {
+	if bc.BlockSize() != 16 {
+		paramPanicf(ErrBlockSize, "Using a block size other than 16 is not implemented")
+	}
+	if pageSize <= 0 || pageSize%16 != 0 {
+		paramPanicf(ErrPageSize, "Page size must be a positive multiple of 16, is %d", pageSize)
+	}
+	if pageSize > pageSegmentSize && pageSize%pageSegmentSize != 0 {
+		paramPanicf(ErrPageSize, "Page sizes above %d must be a multiple of %d, is %d",
+			pageSegmentSize, pageSegmentSize, pageSize)
+	}
+	return min(pageSize, pageSegmentSize) / 16
+}
+
+// PageSize returns the page size the PageCipher was created with.
+func (p *PageCipher) PageSize() int {
+	return p.pageSize
+}
+
+// EncryptPage encrypts "page", which must be exactly PageSize() bytes long,
+// in place under page number "pageNo".
+func (p *PageCipher) EncryptPage(pageNo uint64, page []byte) {
+	p.transformPage(pageNo, page, DirectionEncrypt)
+}
+
+// DecryptPage decrypts "page", which must be exactly PageSize() bytes long,
+// in place under page number "pageNo".
+func (p *PageCipher) DecryptPage(pageNo uint64, page []byte) {
+	p.transformPage(pageNo, page, DirectionDecrypt)
+}
+
+func (p *PageCipher) transformPage(pageNo uint64, page []byte, direction directionConst) {
+	if len(page) != p.pageSize {
+		paramPanicf(ErrDataSize, "Page must be %d bytes long, is %d", p.pageSize, len(page))
+	}
+	for i := 0; i*pageSegmentSize < len(page); i++ {
+		seg := page[i*pageSegmentSize:]
+		if len(seg) > pageSegmentSize {
+			seg = seg[:pageSegmentSize]
+		}
+		pageTweak(p.tweak[:], pageNo, uint64(i))
+		xorBlocks(p.tweak[:], p.tweak[:], p.salt[:])
+		transform(p.bc, p.tweak[:], seg, seg, direction, p.lTable, &p.w)
+	}
+}
+
+// EncryptSectorRange encrypts the run of sectors (pages) in "data" in place,
+// the first one under page number "start", the next under start+1 and so on.
+// It is equivalent to calling EncryptPage on every sector, but derives the
+// tweaks incrementally. "data" must be a multiple of PageSize() bytes long.
+func (p *PageCipher) EncryptSectorRange(start uint64, data []byte) {
+	p.transformRange(start, data, DirectionEncrypt)
+}
+
+// DecryptSectorRange is the inverse of EncryptSectorRange.
+func (p *PageCipher) DecryptSectorRange(start uint64, data []byte) {
+	p.transformRange(start, data, DirectionDecrypt)
+}
+
+func (p *PageCipher) transformRange(start uint64, data []byte, direction directionConst) {
+	if len(data)%p.pageSize != 0 {
+		paramPanicf(ErrDataSize, "Data must be a multiple of %d bytes long, is %d", p.pageSize, len(data))
+	}
+	if n := rangeWorkers(len(data), p.pageSize, p.parallel); n > 1 {
+		p.transformParallel(start, data, direction, n)
+		return
+	}
+	p.rangeSerial(start, data, direction, &p.tweak, &p.w)
+}
+
+// rangeSerial - transform the sectors of "data" with the scratch space
+// "tweak" and "w"
+func (p *PageCipher) rangeSerial(start uint64, data []byte, direction directionConst, tweak *[16]byte, w *workspace) {
+	// Unsalted tweak: the page number goes into the first 8 bytes, and only
+	// changes once per page
+	var t [16]byte
+	pageNo := start
+	for off := 0; off < len(data); off += p.pageSize {
+		binary.BigEndian.PutUint64(t[0:8], pageNo)
+		page := data[off : off+p.pageSize]
+		for i := 0; i*pageSegmentSize < len(page); i++ {
+			seg := page[i*pageSegmentSize:]
+			if len(seg) > pageSegmentSize {
+				seg = seg[:pageSegmentSize]
+			}
+			binary.BigEndian.PutUint64(t[8:16], uint64(i))
+			xorBlocks(tweak[:], t[:], p.salt[:])
+			transform(p.bc, tweak[:], seg, seg, direction, p.lTable, w)
+		}
+		pageNo++
+	}
+}
+
+// pageTweak - write the tweak for segment "seg" of page "pageNo" into "out".
+// The page number goes into the first 8 bytes and the segment number into the
+// last 8 bytes, both big-endian.
+func pageTweak(out []byte, pageNo uint64, seg uint64) {
+	binary.BigEndian.PutUint64(out[0:8], pageNo)
+	binary.BigEndian.PutUint64(out[8:16], seg)
+}
@@ -0,0 +1,163 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+	"unsafe"
+)
+
+// Pages up to 2048 bytes must be identical to a plain Transform with the
+// page tweak.
+func TestPageMatchesTransform(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPageCipher(bc, 512)
+	page := make([]byte, 512)
+	for i := range page {
+		page[i] = byte(i)
+	}
+	tweak := make([]byte, 16)
+	pageTweak(tweak, 42, 0)
+	want := Transform(bc, tweak, page, DirectionEncrypt)
+	p.EncryptPage(42, page)
+	if !bytes.Equal(page, want) {
+		t.Errorf("EncryptPage differs from Transform")
+	}
+}
+
+func TestPageRoundtrip(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{16, 2048, 4096, 8192, 16384} {
+		p := NewPageCipher(bc, size)
+		orig := make([]byte, size)
+		for i := range orig {
+			orig[i] = byte(i * 7)
+		}
+		page := append([]byte{}, orig...)
+		p.EncryptPage(7, page)
+		if bytes.Equal(page, orig) {
+			t.Errorf("size %d: page not encrypted", size)
+		}
+		enc := append([]byte{}, page...)
+		p.DecryptPage(7, page)
+		if !bytes.Equal(page, orig) {
+			t.Errorf("size %d: roundtrip failed", size)
+		}
+		// A different page number must give a different ciphertext
+		p.EncryptPage(8, page)
+		if bytes.Equal(page, enc) {
+			t.Errorf("size %d: page number not used as tweak", size)
+		}
+	}
+}
+
+// The L table is flat and starts on a cache line, for every table size.
+func TestLTableAligned(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for m := 1; m <= maxMessageBlocks; m++ {
+		l := tabulateL(bc, m)
+		if len(l) != m*16 {
+			t.Fatalf("m=%d: len=%d", m, len(l))
+		}
+		if a := uintptr(unsafe.Pointer(&l[0])) % 64; a != 0 {
+			t.Fatalf("m=%d: table is at offset %d of a cache line", m, a)
+		}
+	}
+}
+
+func TestPageBadSize(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 17, 3072} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("size %d: expected panic", size)
+				}
+			}()
+			NewPageCipher(bc, size)
+		}()
+	}
+}
+
+// A sector range must match EncryptPage on every sector, also for pages that
+// have several segments and with a salt.
+func TestSectorRange(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{512, 4096} {
+		p := NewPageCipher(bc, size)
+		p.salt[3] = 0x55
+		data := make([]byte, 5*size)
+		for i := range data {
+			data[i] = byte(i)
+		}
+		want := bytes.Clone(data)
+		for i := 0; i < 5; i++ {
+			p.EncryptPage(uint64(1000+i), want[i*size:(i+1)*size])
+		}
+		got := bytes.Clone(data)
+		p.EncryptSectorRange(1000, got)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("size %d: range differs from single pages", size)
+		}
+		p.DecryptSectorRange(1000, got)
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: roundtrip failed", size)
+		}
+	}
+	p := NewPageCipher(bc, 512)
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for a partial sector")
+		}
+	}()
+	p.EncryptSectorRange(0, make([]byte, 600))
+}
+
+func BenchmarkPage2048(b *testing.B) {
+	benchmarkPage(b, 2048)
+}
+
+func BenchmarkPage4096(b *testing.B) {
+	benchmarkPage(b, 4096)
+}
+
+func benchmarkPage(b *testing.B, size int) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		b.Fatal(err)
+	}
+	p := NewPageCipher(bc, size)
+	page := make([]byte, size)
+	b.SetBytes(int64(len(page)))
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		p.EncryptPage(uint64(n), page)
+	}
+}
+
+// BenchmarkNewPageCipher measures the setup cost of the largest L-table,
+// which is what a cache of precomputed tables would save
+func BenchmarkNewPageCipher(b *testing.B) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		b.Fatal(err)
+	}
+	for n := 0; n < b.N; n++ {
+		NewPageCipher(bc, 65536)
+	}
+}
@@ -0,0 +1,68 @@
+package eme
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ParallelAuto makes PageCipher.SetParallel use up to GOMAXPROCS goroutines.
+const ParallelAuto = -1
+
+// parallelMinBytes - the least data one goroutine of a parallel sector range
+// gets. A 2048-byte segment takes a few microseconds, about as long as
+// starting and joining a goroutine, so smaller shares do not pay off.
+const parallelMinBytes = 64 * 1024
+
+// SetParallel makes EncryptSectorRange and DecryptSectorRange split long runs
+// of sectors across goroutines. "workers" is the most goroutines to use, or
+// ParallelAuto (any negative value) for GOMAXPROCS at the time of each call.
+// 0, the default, disables splitting. Each goroutine gets at least 64 KiB,
+// so short runs stay on the calling goroutine. The block cipher must be safe
+// for concurrent use, like the ciphers of crypto/aes. SetParallel must not be
+// called while the PageCipher is in use.
+func (p *PageCipher) SetParallel(workers int) {
+	if workers < 0 {
+		workers = ParallelAuto
+	}
+	p.parallel = workers
+}
+
+// rangeWorkers - the number of goroutines for a run of "size" bytes in
+// sectors of "sectorSize" bytes, with the SetParallel setting "workers"
+func rangeWorkers(size int, sectorSize int, workers int) int {
+	if workers == ParallelAuto {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return max(1, min(workers, size/parallelMinBytes, size/sectorSize))
+}
+
+// transformParallel - transformRange on "n" goroutines. Each gets a
+// contiguous share of whole sectors and its own scratch space; the L table
+// is shared read-only. A panic of the block cipher, like an *HSMError, is
+// passed on to the caller.
+func (p *PageCipher) transformParallel(start uint64, data []byte, direction directionConst, n int) {
+	sectors := len(data) / p.pageSize
+	per := (sectors + n - 1) / n
+	var wg sync.WaitGroup
+	var once sync.Once
+	var panicked any
+	for first := 0; first < sectors; first += per {
+		last := min(first+per, sectors)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					once.Do(func() { panicked = r })
+				}
+			}()
+			var tweak [16]byte
+			var w workspace
+			p.rangeSerial(start+uint64(first), data[first*p.pageSize:last*p.pageSize], direction, &tweak, &w)
+		}()
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+}
@@ -0,0 +1,77 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"runtime"
+	"testing"
+)
+
+func TestRangeWorkers(t *testing.T) {
+	procs := runtime.GOMAXPROCS(0)
+	for _, tc := range []struct {
+		size, sectorSize, workers, want int
+	}{
+		{1 << 20, 4096, 0, 1},
+		{1 << 20, 4096, 4, 4},
+		{1 << 20, 4096, 100, 16},
+		{parallelMinBytes - 16, 16, 8, 1},
+		{2 * parallelMinBytes, 4096, 8, 2},
+		{1 << 20, 1 << 20, 8, 1},
+		{64 << 20, 4096, ParallelAuto, procs},
+	} {
+		if got := rangeWorkers(tc.size, tc.sectorSize, tc.workers); got != tc.want {
+			t.Errorf("rangeWorkers(%d, %d, %d) = %d, want %d", tc.size, tc.sectorSize, tc.workers, got, tc.want)
+		}
+	}
+}
+
+// A parallel range must give the same result as a serial one, also when the
+// sectors do not divide evenly among the goroutines.
+func TestParallelRange(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 4096*67)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	want := bytes.Clone(data)
+	NewPageCipher(bc, 4096).EncryptSectorRange(9, want)
+	for _, workers := range []int{ParallelAuto, 3, 5} {
+		p := NewPageCipher(bc, 4096)
+		p.SetParallel(workers)
+		got := bytes.Clone(data)
+		p.EncryptSectorRange(9, got)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("workers=%d: differs from serial", workers)
+		}
+		p.DecryptSectorRange(9, got)
+		if !bytes.Equal(got, data) {
+			t.Fatalf("workers=%d: roundtrip failed", workers)
+		}
+	}
+}
+
+func BenchmarkSectorRange1M(b *testing.B) {
+	for _, workers := range []int{0, ParallelAuto} {
+		name := "serial"
+		if workers != 0 {
+			name = "auto"
+		}
+		b.Run(name, func(b *testing.B) {
+			bc, err := aes.NewCipher(make([]byte, 32))
+			if err != nil {
+				b.Fatal(err)
+			}
+			p := NewPageCipher(bc, 4096)
+			p.SetParallel(workers)
+			data := make([]byte, 1<<20)
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				p.EncryptSectorRange(0, data)
+			}
+		})
+	}
+}
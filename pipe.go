@@ -0,0 +1,63 @@
+package eme
+
+import (
+	"context"
+	"crypto/cipher"
+	"io"
+)
+
+// PipeSectorSize is the sector size of EncryptPipe and DecryptPipe.
+const PipeSectorSize = 4096
+
+// EncryptPipe returns a pipe that encrypts: plaintext written to the
+// io.WriteCloser can be read as ciphertext from the io.Reader, in the format
+// of Writer with sectors of PipeSectorSize bytes and PadPKCS7. Writes block
+// until the ciphertext has been read. Closing the io.WriteCloser writes the
+// final sector and ends the stream. When "ctx" is done, both ends fail with
+// ctx.Err().
+func EncryptPipe(ctx context.Context, bc cipher.Block, baseTweak []byte) (io.WriteCloser, io.Reader) {
+	pr, pw := io.Pipe()
+	stop := context.AfterFunc(ctx, func() { pr.CloseWithError(ctx.Err()) })
+	return &pipeWriter{w: NewWriter(pw, bc, PipeSectorSize, baseTweak), pw: pw, stop: stop}, ctxReader{ctx, pr}
+}
+
+// DecryptPipe is the reverse of EncryptPipe: ciphertext written to the
+// io.WriteCloser can be read as plaintext from the io.Reader.
+func DecryptPipe(ctx context.Context, bc cipher.Block, baseTweak []byte) (io.WriteCloser, io.Reader) {
+	pr, pw := io.Pipe()
+	context.AfterFunc(ctx, func() { pr.CloseWithError(ctx.Err()) })
+	return pw, ctxReader{ctx, NewReader(pr, bc, PipeSectorSize, baseTweak)}
+}
+
+// pipeWriter - closes the pipe after the Writer
+type pipeWriter struct {
+	w    *Writer
+	pw   *io.PipeWriter
+	stop func() bool
+}
+
+func (p *pipeWriter) Write(b []byte) (int, error) {
+	return p.w.Write(b)
+}
+
+func (p *pipeWriter) Close() error {
+	p.stop()
+	err := p.w.Close()
+	p.pw.CloseWithError(err)
+	return err
+}
+
+// ctxReader - reports ctx.Err() instead of the error of a pipe that was
+// closed because "ctx" is done
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF && c.ctx.Err() != nil {
+		err = c.ctx.Err()
+	}
+	return n, err
+}
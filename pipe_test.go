@@ -0,0 +1,53 @@
+package eme
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestPipe(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := make([]byte, 16)
+	ctx := context.Background()
+	plain := bytes.Repeat([]byte("pipe"), 3000)
+	ew, er := EncryptPipe(ctx, bc, tweak)
+	dw, dr := DecryptPipe(ctx, bc, tweak)
+	go func() {
+		ew.Write(plain)
+		ew.Close()
+	}()
+	go func() {
+		io.Copy(dw, er)
+		dw.Close()
+	}()
+	got, err := io.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Errorf("roundtrip failed")
+	}
+}
+
+func TestPipeCancel(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	w, r := EncryptPipe(ctx, bc, make([]byte, 16))
+	cancel()
+	if _, err = w.Write(make([]byte, PipeSectorSize)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Write after cancel: %v", err)
+	}
+	if _, err = r.Read(make([]byte, 10)); !errors.Is(err, context.Canceled) {
+		t.Errorf("Read after cancel: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/rfjakob/eme/internal/blake2b"
+)
+
+// PRF is a keyed pseudorandom function with a 16-byte output. SIV uses one
+// to compress the associated data and the plaintext into the tweak, see
+// NewSIVWithPRF. The choice only affects speed: all of NewCMAC, NewHMACPRF
+// and NewBLAKE2bPRF are secure PRFs, but CMAC runs on the block cipher,
+// while the others only need a hash, which some hardware accelerates
+// better. Implementations must be safe for concurrent use.
+type PRF interface {
+	// Sum16 returns the PRF of "msg"
+	Sum16(msg []byte) [16]byte
+}
+
+// NewCMAC returns AES-CMAC (RFC 4493) with block cipher "bc", which must
+// have a block size of 16. It is the PRF of NewSIV.
+func NewCMAC(bc cipher.Block) (PRF, error) {
+	if bc.BlockSize() != 16 {
+		return nil, ErrBlockSize
+	}
+	return newCMAC(bc), nil
+}
+
+// hmacPRF - HMAC-SHA256, truncated to 16 bytes
+type hmacPRF struct {
+	key []byte
+}
+
+// NewHMACPRF returns HMAC-SHA256 under "key", truncated to 16 bytes. The key
+// should be at least 16 bytes long.
+func NewHMACPRF(key []byte) PRF {
+	return &hmacPRF{key: append([]byte{}, key...)}
+}
+
+func (h *hmacPRF) Sum16(msg []byte) [16]byte {
+	m := hmac.New(sha256.New, h.key)
+	m.Write(msg)
+	var out [16]byte
+	copy(out[:], m.Sum(nil))
+	return out
+}
+
+// blake2bPRF - keyed BLAKE2b with a 16-byte output
+type blake2bPRF struct {
+	key []byte
+}
+
+// NewBLAKE2bPRF returns keyed BLAKE2b-128 under "key", which must be 16 to 64
+// bytes long.
+func NewBLAKE2bPRF(key []byte) (PRF, error) {
+	if len(key) < 16 || len(key) > 64 {
+		return nil, fmt.Errorf("eme: BLAKE2b key must be 16 to 64 bytes long, is %d", len(key))
+	}
+	return &blake2bPRF{key: append([]byte{}, key...)}, nil
+}
+
+func (b *blake2bPRF) Sum16(msg []byte) [16]byte {
+	d := blake2b.New(16, b.key)
+	d.Write(msg)
+	var out [16]byte
+	copy(out[:], d.Sum())
+	return out
+}
@@ -0,0 +1,69 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/des"
+	"encoding/hex"
+	"testing"
+)
+
+// CMAC is checked against RFC 4493, example 2, the others against Python's
+// hmac and hashlib.blake2b
+func TestPRFVectors(t *testing.T) {
+	bc, _ := aes.NewCipher(unhex("2b7e151628aed2a6abf7158809cf4f3c"))
+	cmac, err := NewCMAC(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := bytes.Repeat([]byte{'k'}, 32)
+	b2, err := NewBLAKE2bPRF(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name string
+		prf  PRF
+		msg  []byte
+		want string
+	}{
+		{"CMAC", cmac, unhex("6bc1bee22e409f96e93d7e117393172a"), "070a16b46b4d4144f79bdd9dd04a287c"},
+		{"HMAC", NewHMACPRF(key), []byte("eme prf"), "d1853859458dbcbdce32a685290b9b29"},
+		{"BLAKE2b", b2, []byte("eme prf"), "2305bd43e304e307ed3b999f80b78df9"},
+	} {
+		if got := tc.prf.Sum16(tc.msg); hex.EncodeToString(got[:]) != tc.want {
+			t.Errorf("%s: got %x, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestSIVWithPRF(t *testing.T) {
+	bc, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	b2, _ := NewBLAKE2bPRF(bytes.Repeat([]byte{3}, 32))
+	ad, plain := []byte("ad"), []byte("plaintext")
+	var cts [][]byte
+	for _, prf := range []PRF{NewHMACPRF(bytes.Repeat([]byte{3}, 32)), b2} {
+		s := NewSIVWithPRF(prf, bc)
+		ct, err := s.Seal(ad, plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := s.Open(ad, ct); err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("roundtrip failed: %v", err)
+		}
+		cts = append(cts, ct)
+	}
+	if bytes.Equal(cts[0], cts[1]) {
+		t.Errorf("the PRF does not matter")
+	}
+}
+
+func TestPRFErrors(t *testing.T) {
+	bc, _ := des.NewCipher(make([]byte, 8))
+	if _, err := NewCMAC(bc); err == nil {
+		t.Error("8-byte block cipher accepted")
+	}
+	if _, err := NewBLAKE2bPRF(make([]byte, 8)); err == nil {
+		t.Error("8-byte BLAKE2b key accepted")
+	}
+}
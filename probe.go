@@ -0,0 +1,91 @@
+package eme
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Formats identified by Probe
+const (
+	FormatContainer = "container"
+	FormatEnvelope  = "envelope"
+	FormatArchive   = "archive"
+)
+
+// FormatInfo describes an encrypted file, see Probe.
+type FormatInfo struct {
+	// Format is FormatContainer, FormatEnvelope or FormatArchive
+	Format string
+	// Version is the format version of the file, see ContainerVersion,
+	// EnvelopeVersion and ArchiveVersion
+	Version int
+	// SectorSize is the sector size of containers and envelopes
+	SectorSize int
+	// KeyID is the key ID of containers (see ContainerHeader.KeyID) and
+	// envelopes (see Keyring), or 0
+	KeyID uint32
+	// Header is the header of a container
+	Header *ContainerHeader
+}
+
+// ErrUnknownFormat is returned by Probe for data that starts like none of
+// the formats of this package.
+var ErrUnknownFormat = errors.New("eme: not a container, envelope or archive")
+
+// Probe reads the start of "r" and identifies the format, version and
+// parameters of the encrypted data, without a key. A file in a version this
+// package cannot read is still identified: Probe returns its FormatInfo with
+// an error, so that tools can report the version mismatch.
+func Probe(r io.Reader) (*FormatInfo, error) {
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrUnknownFormat
+		}
+		return nil, err
+	}
+	switch {
+	case bytes.Equal(magic, containerMagic):
+		return probeContainer(io.MultiReader(bytes.NewReader(magic), r))
+	case bytes.Equal(magic[:7], envelopeMagic[:7]):
+		info := &FormatInfo{Format: FormatEnvelope, Version: int(magic[7])}
+		hdr, err := readEnvelopeHeader(io.MultiReader(bytes.NewReader(magic), r))
+		if err != nil {
+			return info, err
+		}
+		info.SectorSize = int(binary.BigEndian.Uint32(hdr[8:]))
+		info.KeyID = binary.BigEndian.Uint32(hdr[12:])
+		return info, nil
+	case bytes.Equal(magic, archiveMagic):
+		v := make([]byte, 2)
+		if _, err := io.ReadFull(r, v); err != nil {
+			return nil, fmt.Errorf("eme: archive header is truncated: %w", err)
+		}
+		info := &FormatInfo{Format: FormatArchive, Version: int(binary.BigEndian.Uint16(v))}
+		if info.Version != ArchiveVersion {
+			return info, fmt.Errorf("unsupported archive version %d", info.Version)
+		}
+		return info, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// probeContainer - the FormatInfo of the container header in "r"
+func probeContainer(r io.Reader) (*FormatInfo, error) {
+	fixed := make([]byte, 10)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, fmt.Errorf("reading container header: %w", err)
+	}
+	info := &FormatInfo{Format: FormatContainer, Version: int(binary.BigEndian.Uint16(fixed[8:10]))}
+	h, err := ReadContainerHeader(io.MultiReader(bytes.NewReader(fixed), r))
+	if err != nil {
+		return info, err
+	}
+	info.SectorSize = int(h.SectorSize)
+	info.KeyID = h.KeyID()
+	info.Header = h
+	return info, nil
+}
@@ -0,0 +1,58 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProbe(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	dir := t.TempDir()
+	img := filepath.Join(dir, "img")
+	os.WriteFile(img, make([]byte, 4096), 0600)
+	ctr := filepath.Join(dir, "c")
+	if err := ImageToContainer(ctr, img, bc, ContainerOptions{SectorSize: 512, KeyID: 7}); err != nil {
+		t.Fatal(err)
+	}
+	c, _ := os.ReadFile(ctr)
+	info, err := Probe(bytes.NewReader(c))
+	if err != nil || info.Format != FormatContainer || info.Version != ContainerVersion || info.SectorSize != 512 || info.KeyID != 7 {
+		t.Errorf("container: %+v, %v", info, err)
+	}
+	binary.BigEndian.PutUint16(c[8:], 9)
+	if info, err = Probe(bytes.NewReader(c)); err == nil || info == nil || info.Version != 9 {
+		t.Errorf("future container: %+v, %v", info, err)
+	}
+
+	var env bytes.Buffer
+	w, _ := NewEnvelopeWriter(&env, bc)
+	w.Close()
+	info, err = Probe(bytes.NewReader(env.Bytes()))
+	if err != nil || info.Format != FormatEnvelope || info.Version != EnvelopeVersion || info.SectorSize != EnvelopeSectorSize {
+		t.Errorf("envelope: %+v, %v", info, err)
+	}
+	e := env.Bytes()
+	e[7] = 2
+	if info, err = Probe(bytes.NewReader(e)); err == nil || info.Version != 2 || !strings.Contains(err.Error(), "version 2") {
+		t.Errorf("future envelope: %+v, %v", info, err)
+	}
+
+	var arc bytes.Buffer
+	aw, _ := NewArchiveWriter(&arc, bc)
+	aw.Close()
+	if info, err = Probe(bytes.NewReader(arc.Bytes())); err != nil || info.Format != FormatArchive || info.Version != ArchiveVersion {
+		t.Errorf("archive: %+v, %v", info, err)
+	}
+
+	for _, b := range [][]byte{nil, []byte("short"), []byte("plain text, no magic")} {
+		if _, err = Probe(bytes.NewReader(b)); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("%q: %v", b, err)
+		}
+	}
+}
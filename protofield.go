@@ -0,0 +1,216 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protocol buffer wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// FieldEncrypter encrypts selected bytes and string fields of serialized
+// protocol buffer messages, working on the wire format so that it needs
+// neither generated code nor a protobuf dependency: pass it the output of
+// proto.Marshal and give its output to proto.Unmarshal.
+//
+// Every field value is PKCS#7-padded and encrypted under a tweak derived
+// from the message type, the field number, the occurrence of the field
+// within the message, and a record key: the raw value of a designated
+// unencrypted field, like the primary key. Encryption is deterministic,
+// which allows equality lookups on encrypted columns but also reveals equal
+// values within the same record key and field, and expands every value by
+// 1 to 16 bytes. Values are not authenticated.
+type FieldEncrypter struct {
+	bc          cipher.Block
+	messageType string
+	recordKey   int
+	fields      map[int]bool
+}
+
+// NewFieldEncrypter returns a FieldEncrypter for messages of the full type
+// name "messageType" (like "shop.v1.Customer"). Field "recordKeyField" holds
+// the record key and is never encrypted; pass 0 for none. "fields" are the
+// numbers of the fields to encrypt, which must be bytes or string fields
+// (including repeated ones).
+func NewFieldEncrypter(bc cipher.Block, messageType string, recordKeyField int, fields ...int) *FieldEncrypter {
+	fe := &FieldEncrypter{bc: bc, messageType: messageType, recordKey: recordKeyField, fields: map[int]bool{}}
+	for _, f := range fields {
+		if f == recordKeyField {
+			logPanicf("Field %d cannot be both the record key and encrypted", f)
+		}
+		fe.fields[f] = true
+	}
+	return fe
+}
+
+// Encrypt encrypts the selected fields of the serialized message "msg".
+func (fe *FieldEncrypter) Encrypt(msg []byte) ([]byte, error) {
+	return fe.transform(msg, DirectionEncrypt)
+}
+
+// Decrypt reverses Encrypt.
+func (fe *FieldEncrypter) Decrypt(msg []byte) ([]byte, error) {
+	return fe.transform(msg, DirectionDecrypt)
+}
+
+// FieldCodec encrypts fields of the messages serialized by an inner Codec
+// with a FieldEncrypter. All messages must be of the FieldEncrypter's type,
+// so use one FieldCodec per message type.
+type FieldCodec struct {
+	inner Codec
+	fe    *FieldEncrypter
+}
+
+// NewFieldCodec returns a FieldCodec wrapping "inner".
+func NewFieldCodec(inner Codec, fe *FieldEncrypter) *FieldCodec {
+	return &FieldCodec{inner: inner, fe: fe}
+}
+
+// Marshal implements Codec.
+func (c *FieldCodec) Marshal(v any) ([]byte, error) {
+	b, err := c.inner.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.fe.Encrypt(b)
+}
+
+// Unmarshal implements Codec.
+func (c *FieldCodec) Unmarshal(data []byte, v any) error {
+	b, err := c.fe.Decrypt(data)
+	if err != nil {
+		return err
+	}
+	return c.inner.Unmarshal(b, v)
+}
+
+// Name implements Codec. It is the name of the inner codec.
+func (c *FieldCodec) Name() string {
+	return c.inner.Name()
+}
+
+// protoField - one top-level field of a serialized message
+type protoField struct {
+	num      int
+	wireType int
+	// tag - the encoded field number and wire type
+	tag []byte
+	// value - the payload; for wireBytes without the length prefix
+	value []byte
+}
+
+func (fe *FieldEncrypter) transform(msg []byte, direction directionConst) ([]byte, error) {
+	fields, err := parseProtoFields(msg)
+	if err != nil {
+		return nil, err
+	}
+	var recordKey []byte
+	for _, f := range fields {
+		if f.num == fe.recordKey {
+			recordKey = f.value
+		}
+	}
+	out := make([]byte, 0, len(msg)+16*len(fe.fields))
+	seen := map[int]int{}
+	for _, f := range fields {
+		if !fe.fields[f.num] {
+			out = appendProtoField(out, f)
+			continue
+		}
+		if f.wireType != wireBytes {
+			return nil, fmt.Errorf("eme: field %d is not a bytes or string field", f.num)
+		}
+		tweak := fe.tweak(f.num, seen[f.num], recordKey)
+		seen[f.num]++
+		var v []byte
+		if direction == DirectionEncrypt {
+			v = pad16(f.value)
+			transformChunk(fe.bc, tweak, 0, v, direction)
+		} else {
+			if len(f.value) == 0 || len(f.value)%16 != 0 {
+				return nil, fmt.Errorf("eme: field %d is not encrypted", f.num)
+			}
+			v = append([]byte{}, f.value...)
+			transformChunk(fe.bc, tweak, 0, v, direction)
+			if v, err = unpad16(v); err != nil {
+				return nil, fmt.Errorf("eme: field %d: %w", f.num, err)
+			}
+		}
+		f.value = v
+		out = appendProtoField(out, f)
+	}
+	return out, nil
+}
+
+// tweak - SHA-256 of the message type, field number, occurrence and record
+// key, truncated to 16 bytes
+func (fe *FieldEncrypter) tweak(num int, occurrence int, recordKey []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("eme protobuf field\x00"))
+	h.Write([]byte(fe.messageType))
+	var b [2 * binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], uint64(num))
+	n += binary.PutUvarint(b[n:], uint64(occurrence))
+	h.Write(b[:n])
+	h.Write(recordKey)
+	return h.Sum(nil)[:16]
+}
+
+// parseProtoFields - split a serialized message into its top-level fields
+func parseProtoFields(msg []byte) ([]protoField, error) {
+	var fields []protoField
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return nil, errors.New("eme: bad protobuf field tag")
+		}
+		f := protoField{num: int(key >> 3), wireType: int(key & 7), tag: msg[:n]}
+		if f.num == 0 {
+			return nil, errors.New("eme: protobuf field number 0")
+		}
+		msg = msg[n:]
+		switch f.wireType {
+		case wireVarint:
+			_, n = binary.Uvarint(msg)
+			if n <= 0 {
+				return nil, errors.New("eme: bad protobuf varint")
+			}
+		case wireFixed64:
+			n = 8
+		case wireFixed32:
+			n = 4
+		case wireBytes:
+			l, k := binary.Uvarint(msg)
+			if k <= 0 || l > uint64(len(msg)-k) {
+				return nil, errors.New("eme: bad protobuf length")
+			}
+			msg = msg[k:]
+			n = int(l)
+		default:
+			return nil, fmt.Errorf("eme: unsupported protobuf wire type %d", f.wireType)
+		}
+		if n > len(msg) {
+			return nil, errors.New("eme: truncated protobuf message")
+		}
+		f.value = msg[:n]
+		msg = msg[n:]
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+func appendProtoField(out []byte, f protoField) []byte {
+	out = append(out, f.tag...)
+	if f.wireType == wireBytes {
+		out = binary.AppendUvarint(out, uint64(len(f.value)))
+	}
+	return append(out, f.value...)
+}
@@ -0,0 +1,35 @@
+package eme
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// EncryptRandomized encrypts "plaintext" under a fresh random 16-byte tweak
+// and returns the tweak followed by the ciphertext. Encrypting the same
+// plaintext twice gives different outputs, so equal messages cannot be told
+// apart, at the cost of 16 bytes per message and without the caller
+// managing tweaks. "plaintext" must be a multiple of 16 bytes long, from 16
+// to 2048 bytes, like for Encrypt.
+//
+// This is not authenticated encryption: a modified ciphertext decrypts to
+// garbage, not to an error.
+func (e *EMECipher) EncryptRandomized(plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 || len(plaintext)%16 != 0 || len(plaintext) > pageSegmentSize {
+		return nil, fmt.Errorf("plaintext must be a multiple of 16 bytes long, from 16 to %d, is %d", pageSegmentSize, len(plaintext))
+	}
+	tweak := make([]byte, 16, 16+len(plaintext))
+	if _, err := rand.Read(tweak); err != nil {
+		return nil, err
+	}
+	return append(tweak, e.Encrypt(tweak, plaintext)...), nil
+}
+
+// DecryptRandomized reverses EncryptRandomized.
+func (e *EMECipher) DecryptRandomized(ciphertext []byte) ([]byte, error) {
+	n := len(ciphertext) - 16
+	if n <= 0 || n%16 != 0 || n > pageSegmentSize {
+		return nil, fmt.Errorf("randomized ciphertext has a bad length %d", len(ciphertext))
+	}
+	return e.Decrypt(ciphertext[:16], ciphertext[16:]), nil
+}
@@ -0,0 +1,40 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestRandomized(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	e := New(bc)
+	plain := bytes.Repeat([]byte("sixteen byte msg"), 4)
+	a, err := e.EncryptRandomized(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := e.EncryptRandomized(plain)
+	if len(a) != len(plain)+16 {
+		t.Errorf("got %d bytes, want %d", len(a), len(plain)+16)
+	}
+	if bytes.Equal(a, b) {
+		t.Error("two encryptions of the same plaintext are equal")
+	}
+	for _, ct := range [][]byte{a, b} {
+		got, err := e.DecryptRandomized(ct)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("roundtrip failed: %v", err)
+		}
+	}
+	for _, n := range []int{0, 15, 2064} {
+		if _, err := e.EncryptRandomized(make([]byte, n)); err == nil {
+			t.Errorf("plaintext of %d bytes: no error", n)
+		}
+	}
+	for _, n := range []int{0, 16, 31, 2080} {
+		if _, err := e.DecryptRandomized(make([]byte, n)); err == nil {
+			t.Errorf("ciphertext of %d bytes: no error", n)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reader decrypts a stream written by Writer. Its Padding must match the one
+// the Writer used.
+type Reader struct {
+	// Padding must be set before the first Read.
+	Padding Padding
+	// Tracer, if set before the first Read, gets a span from the first Read
+	// to the end of the stream or the first error.
+	Tracer Tracer
+
+	r    io.Reader
+	bc   cipher.Block
+	pc   *PageCipher
+	salt []byte
+	ss   int
+	// cbuf - ciphertext read ahead, up to two sectors. The final sector can
+	// only be recognized once the end of the stream has been seen.
+	cbuf []byte
+	n    uint64
+	eof  bool
+	// plain - decrypted data not yet returned by Read
+	plain []byte
+	err   error
+	span  Span
+	// done - plaintext bytes returned so far, for the span
+	done int64
+}
+
+// NewReader returns a Reader that decrypts the ciphertext read from "r". The
+// parameters must be the ones given to NewWriter.
+func NewReader(r io.Reader, bc cipher.Block, sectorSize int, baseTweak []byte) *Reader {
+	if len(baseTweak) != 16 {
+		paramPanicf(ErrTweakSize, "Tweak must be 16 bytes long, is %d", len(baseTweak))
+	}
+	pc := NewPageCipher(bc, sectorSize)
+	copy(pc.salt[:], baseTweak)
+	return &Reader{
+		r:    r,
+		bc:   bc,
+		pc:   pc,
+		salt: append([]byte{}, baseTweak...),
+		ss:   sectorSize,
+		cbuf: make([]byte, 0, 2*sectorSize),
+	}
+}
+
+// Read implements io.Reader.
+func (sr *Reader) Read(p []byte) (int, error) {
+	if sr.span == nil {
+		sr.span = startSpan(sr.Tracer, "eme.Reader")
+		sr.span.SetAttribute(AttrSectorSize, int64(sr.ss))
+	}
+	for len(sr.plain) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		if sr.err = sr.next(); sr.err != nil {
+			sr.endSpan()
+		}
+	}
+	n := copy(p, sr.plain)
+	sr.plain = sr.plain[n:]
+	sr.done += int64(n)
+	return n, nil
+}
+
+// endSpan - end the span once the stream ended or failed
+func (sr *Reader) endSpan() {
+	sr.span.SetAttribute(AttrBytes, sr.done+int64(len(sr.plain)))
+	if sr.err == io.EOF {
+		sr.span.End(nil)
+	} else {
+		sr.span.End(sr.err)
+	}
+	sr.span = noSpan{}
+}
+
+// next - decrypt the next sector, or the final sectors, into "plain". Returns
+// io.EOF once everything has been decrypted.
+func (sr *Reader) next() error {
+	if !sr.eof {
+		n, err := io.ReadFull(sr.r, sr.cbuf[len(sr.cbuf):cap(sr.cbuf)])
+		sr.cbuf = sr.cbuf[:len(sr.cbuf)+n]
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			sr.eof = true
+		} else if err != nil {
+			return err
+		}
+	}
+	if !sr.eof {
+		// At least one more byte follows, so the first sector is not part of
+		// the final sectors
+		sec := make([]byte, sr.ss)
+		copy(sec, sr.cbuf)
+		sr.pc.DecryptPage(sr.n, sec)
+		sr.n++
+		sr.cbuf = sr.cbuf[:copy(sr.cbuf, sr.cbuf[sr.ss:])]
+		sr.plain = sec
+		return nil
+	}
+	if len(sr.cbuf) == 0 && sr.n == 0 && sr.Padding == PadPKCS7 {
+		return errors.New("eme: stream is empty, missing PKCS#7 padding")
+	}
+	if len(sr.cbuf) == 0 {
+		return io.EOF
+	}
+	plain, err := sr.finish(sr.cbuf)
+	sr.cbuf = sr.cbuf[:0]
+	if err != nil {
+		return err
+	}
+	sr.plain = plain
+	if len(plain) == 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+// finish - decrypt the rest of the stream, at most two sectors
+func (sr *Reader) finish(c []byte) ([]byte, error) {
+	if sr.Padding == PadCTS && len(c) > sr.ss && len(c)%16 != 0 {
+		t := len(c) - sr.ss
+		steal := padLen16(t)
+		last := append([]byte{}, c[sr.ss-steal:]...)
+		transformChunk(sr.bc, sr.salt, sr.n+1, last, DirectionDecrypt)
+		sec := append(append([]byte{}, c[:sr.ss-steal]...), last[t:]...)
+		sr.pc.DecryptPage(sr.n, sec)
+		return append(sec, last[:t]...), nil
+	}
+	if len(c)%16 != 0 {
+		return nil, fmt.Errorf("eme: stream length is not a multiple of 16")
+	}
+	plain := append([]byte{}, c...)
+	for i := 0; i < len(plain); i += sr.ss {
+		end := i + sr.ss
+		if end > len(plain) {
+			end = len(plain)
+		}
+		transformChunk(sr.bc, sr.salt, sr.n, plain[i:end], DirectionDecrypt)
+		sr.n++
+	}
+	if sr.Padding == PadPKCS7 {
+		return unpad16(plain)
+	}
+	return plain, nil
+}
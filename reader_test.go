@@ -0,0 +1,65 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReaderRoundtrip(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := bytes.Repeat([]byte{7}, 16)
+	for _, sectorSize := range []int{512, 4096} {
+		for _, size := range []int{0, 16, 100, 511, 512, 513, 1024, 1030, 5000, 8192} {
+			plain := make([]byte, size)
+			for i := range plain {
+				plain[i] = byte(i * 13)
+			}
+			for _, padding := range []Padding{PadPKCS7, PadNone, PadCTS} {
+				var enc bytes.Buffer
+				w := NewWriter(&enc, bc, sectorSize, tweak)
+				w.Padding = padding
+				w.Write(plain)
+				if w.Close() != nil {
+					// Invalid combination, see TestWriterLengths
+					continue
+				}
+				r := NewReader(iotest.OneByteReader(&enc), bc, sectorSize, tweak)
+				r.Padding = padding
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Errorf("sector %d size %d padding %d: %v", sectorSize, size, padding, err)
+					continue
+				}
+				if !bytes.Equal(got, plain) {
+					t.Errorf("sector %d size %d padding %d: roundtrip failed", sectorSize, size, padding)
+				}
+			}
+		}
+	}
+}
+
+func TestReaderBadPadding(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := make([]byte, 16)
+	var enc bytes.Buffer
+	w := NewWriter(&enc, bc, 512, tweak)
+	w.Padding = PadNone
+	w.Write(make([]byte, 32))
+	w.Close()
+	r := NewReader(&enc, bc, 512, tweak)
+	if _, err = io.ReadAll(r); err == nil {
+		t.Errorf("stream without padding accepted as PKCS#7")
+	}
+	if _, err = io.ReadAll(NewReader(&bytes.Buffer{}, bc, 512, tweak)); err == nil {
+		t.Errorf("empty stream accepted as PKCS#7")
+	}
+}
@@ -0,0 +1,133 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecovery(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	cont, orig := newTestContainer(t, t.TempDir(), key)
+	bc, _ := aes.NewCipher(key)
+	// Damage the header checksum and cut off the last two sectors
+	f, err := os.OpenFile(cont, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte{0xff}, 10)
+	fi, _ := f.Stat()
+	f.Truncate(fi.Size() - 2*512 + 100)
+	f.Close()
+
+	if _, err = OpenContainer(cont, bc, nil); err == nil {
+		t.Fatalf("damaged header accepted by OpenContainer")
+	}
+	c, err := OpenContainerForRecovery(cont, bc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.HeaderDamage() == nil {
+		t.Errorf("header damage not reported")
+	}
+	buf := make([]byte, 512)
+	if err = c.ReadSector(0, buf); err != nil || !bytes.Equal(buf, orig[:512]) {
+		t.Errorf("intact sector: %v", err)
+	}
+	var se *SectorError
+	if err = c.ReadSector(299, buf); !errors.As(err, &se) || se.Sector != 299 {
+		t.Errorf("truncated sector: %v", err)
+	}
+	if err = c.WriteSector(0, buf); err != ErrReadOnly {
+		t.Errorf("write to read-only container: %v", err)
+	}
+	bulk := make([]byte, 4*512)
+	err = c.ReadSectors(296, bulk)
+	if failed := SectorErrors(err); len(failed) != 2 || failed[298] == nil || failed[299] == nil {
+		t.Errorf("ReadSectors: %v", err)
+	}
+	if !bytes.Equal(bulk[:2*512], orig[296*512:298*512]) {
+		t.Errorf("ReadSectors did not read the intact sectors")
+	}
+	if err = c.WriteSectors(0, bulk); !errors.Is(err, ErrReadOnly) || len(SectorErrors(err)) != 4 {
+		t.Errorf("WriteSectors to read-only container: %v", err)
+	}
+	if err = c.ReadSectors(299, bulk); err == nil || SectorErrors(err) != nil {
+		t.Errorf("ReadSectors beyond the end: %v", err)
+	}
+	damage := c.DamageMap()
+	if len(damage) != 2 || damage[298] == nil || damage[299] == nil {
+		t.Errorf("unexpected damage map %v", damage)
+	}
+	var out strings.Builder
+	if err = WriteDamageMap(&out, damage); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "298\t") {
+		t.Errorf("unexpected damage map output %q", out.String())
+	}
+}
+
+// A header with a sector size that NewPageCipher rejects must be an error,
+// not a panic, also in recovery mode
+func TestRecoveryBadSectorSize(t *testing.T) {
+	h, err := newContainerHeader(4112, 4112)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/c"
+	os.WriteFile(path, append(hdr, make([]byte, 4112)...), 0600)
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	if _, err = OpenContainerForRecovery(path, bc, nil); err == nil || !strings.Contains(err.Error(), "sector size 4112") {
+		t.Errorf("OpenContainerForRecovery: %v", err)
+	}
+	if _, err = OpenContainer(path, bc, nil); err == nil {
+		t.Errorf("OpenContainer accepted sector size 4112")
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	cont, _ := newTestContainer(t, dir, bytes.Repeat([]byte{1}, 32))
+	bc, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	if _, err := OpenContainer(cont, bc, nil); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("OpenContainer with the wrong key: %v", err)
+	}
+	if _, err := OpenContainerForRecovery(cont, bc, nil); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("OpenContainerForRecovery with the wrong key: %v", err)
+	}
+}
+
+func TestOpenContainerReadOnly(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	cont, orig := newTestContainer(t, t.TempDir(), key)
+	bc, _ := aes.NewCipher(key)
+	before, _ := os.ReadFile(cont)
+	c, err := OpenContainerReadOnly(cont, bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	buf := make([]byte, 512)
+	if err = c.ReadSector(7, buf); err != nil || !bytes.Equal(buf, orig[7*512:8*512]) {
+		t.Errorf("sector 7: %v", err)
+	}
+	if err = c.WriteSector(7, buf); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("WriteSector: got %v", err)
+	}
+	wrong, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	if _, err = OpenContainerReadOnly(cont, wrong); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("wrong key: got %v", err)
+	}
+	if after, _ := os.ReadFile(cont); !bytes.Equal(after, before) {
+		t.Errorf("container modified")
+	}
+}
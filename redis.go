@@ -0,0 +1,130 @@
+package eme
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// RedisStore is the part of a Redis client that RedisClient needs. Adapting
+// go-redis takes one line per method, like rdb.Get(ctx, key).Bytes() for Get
+// and rdb.HSet(ctx, key, field, value).Err() for HSet. A missing key or field
+// must be reported with the client's own error, like redis.Nil, which
+// RedisClient passes on unchanged.
+type RedisStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores "value" under "key", expiring after "ttl" unless it is zero.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	HGet(ctx context.Context, key string, field string) ([]byte, error)
+	HSet(ctx context.Context, key string, field string, value []byte) error
+}
+
+// RedisClient stores EME-encrypted values in a RedisStore. Keys stay in
+// plaintext, so lookups work as before. A value is PKCS#7-padded and
+// encrypted under a tweak salt derived from its key, and for hash fields
+// also from the field name, like ObjectClient does with object keys. So a
+// value copied to another key decrypts to garbage, and equal values under
+// different keys look unrelated.
+//
+// The encryption is deterministic: writing the same value to the same key
+// again gives the same ciphertext, so an observer of the store can tell when
+// a value changes back to an earlier one. Values are not authenticated.
+type RedisClient struct {
+	store RedisStore
+	bc    cipher.Block
+	// EncryptFields, if set before first use, also encrypts the names of
+	// hash fields, deterministically under a salt derived from the key, so
+	// that HGet still finds them. Encrypted names are unpadded URL-safe
+	// base64. Changing the setting makes existing fields unreachable.
+	EncryptFields bool
+}
+
+// NewRedisClient returns a RedisClient storing values in "store", encrypted
+// with "bc".
+func NewRedisClient(store RedisStore, bc cipher.Block) *RedisClient {
+	return &RedisClient{store: store, bc: bc}
+}
+
+// Get returns the decrypted value of "key".
+func (c *RedisClient) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := c.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return c.open(v, redisSalt("value", key))
+}
+
+// Set encrypts "value" and stores it under "key", expiring after "ttl"
+// unless it is zero.
+func (c *RedisClient) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.store.Set(ctx, key, c.seal(value, redisSalt("value", key)), ttl)
+}
+
+// HGet returns the decrypted value of "field" in the hash at "key".
+func (c *RedisClient) HGet(ctx context.Context, key string, field string) ([]byte, error) {
+	v, err := c.store.HGet(ctx, key, c.fieldName(key, field))
+	if err != nil {
+		return nil, err
+	}
+	return c.open(v, redisSalt("hash", key, field))
+}
+
+// HSet encrypts "value" and stores it as "field" in the hash at "key".
+func (c *RedisClient) HSet(ctx context.Context, key string, field string, value []byte) error {
+	return c.store.HSet(ctx, key, c.fieldName(key, field), c.seal(value, redisSalt("hash", key, field)))
+}
+
+// DecryptField returns the plaintext name of a field of the hash at "key", as
+// stored with EncryptFields, for example as listed by HKEYS.
+func (c *RedisClient) DecryptField(key string, stored string) (string, error) {
+	bin, err := base64.RawURLEncoding.Strict().DecodeString(stored)
+	if err != nil {
+		return "", fmt.Errorf("eme: encrypted field name %q: %w", stored, err)
+	}
+	name, err := c.open(bin, redisSalt("field", key))
+	if err != nil {
+		return "", fmt.Errorf("eme: encrypted field name %q: %w", stored, err)
+	}
+	return string(name), nil
+}
+
+// fieldName - the name "field" of the hash at "key" is stored under
+func (c *RedisClient) fieldName(key string, field string) string {
+	if !c.EncryptFields {
+		return field
+	}
+	return base64.RawURLEncoding.EncodeToString(c.seal([]byte(field), redisSalt("field", key)))
+}
+
+// seal - pad and encrypt "plain" under tweak salt "salt"
+func (c *RedisClient) seal(plain []byte, salt []byte) []byte {
+	v := pad16(append([]byte{}, plain...))
+	transformChunk(c.bc, salt, 0, v, DirectionEncrypt)
+	return v
+}
+
+// open - reverse seal
+func (c *RedisClient) open(ct []byte, salt []byte) ([]byte, error) {
+	if len(ct) == 0 || len(ct)%16 != 0 {
+		return nil, fmt.Errorf("eme: Redis value is not encrypted (%d bytes)", len(ct))
+	}
+	v := append([]byte{}, ct...)
+	transformChunk(c.bc, salt, 0, v, DirectionDecrypt)
+	return unpad16(v)
+}
+
+// redisSalt - the tweak salt of "kind" for the strings "parts", each
+// length-prefixed so that no two lists hash alike
+func redisSalt(kind string, parts ...string) []byte {
+	h := sha256.New()
+	h.Write([]byte("eme redis " + kind))
+	for _, p := range parts {
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(p))))
+		h.Write([]byte(p))
+	}
+	return h.Sum(nil)[:16]
+}
@@ -0,0 +1,119 @@
+package eme
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"errors"
+	"testing"
+	"time"
+)
+
+// errRedisNil - what memRedis returns for missing keys, like redis.Nil
+var errRedisNil = errors.New("redis: nil")
+
+// memRedis - in-memory RedisStore
+type memRedis struct {
+	values map[string][]byte
+	hashes map[string]map[string][]byte
+}
+
+func newMemRedis() *memRedis {
+	return &memRedis{values: map[string][]byte{}, hashes: map[string]map[string][]byte{}}
+}
+
+func (r *memRedis) Get(ctx context.Context, key string) ([]byte, error) {
+	v, ok := r.values[key]
+	if !ok {
+		return nil, errRedisNil
+	}
+	return v, nil
+}
+
+func (r *memRedis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	r.values[key] = append([]byte{}, value...)
+	return nil
+}
+
+func (r *memRedis) HGet(ctx context.Context, key string, field string) ([]byte, error) {
+	v, ok := r.hashes[key][field]
+	if !ok {
+		return nil, errRedisNil
+	}
+	return v, nil
+}
+
+func (r *memRedis) HSet(ctx context.Context, key string, field string, value []byte) error {
+	if r.hashes[key] == nil {
+		r.hashes[key] = map[string][]byte{}
+	}
+	r.hashes[key][field] = append([]byte{}, value...)
+	return nil
+}
+
+func TestRedisClient(t *testing.T) {
+	ctx := context.Background()
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	store := newMemRedis()
+	c := NewRedisClient(store, bc)
+	for _, v := range [][]byte{{}, []byte("secret"), bytes.Repeat([]byte{7}, 5000)} {
+		if err := c.Set(ctx, "session:1", v, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Get(ctx, "session:1")
+		if err != nil || !bytes.Equal(got, v) {
+			t.Errorf("%d bytes: Get = %v", len(v), err)
+		}
+	}
+	c.Set(ctx, "a", []byte("same value"), 0)
+	c.Set(ctx, "b", []byte("same value"), 0)
+	if bytes.Equal(store.values["a"], store.values["b"]) || bytes.Contains(store.values["a"], []byte("same")) {
+		t.Errorf("values are not bound to their keys")
+	}
+	// A value moved to another key must not decrypt to the original
+	store.values["b"] = store.values["a"]
+	if got, _ := c.Get(ctx, "b"); bytes.Equal(got, []byte("same value")) {
+		t.Errorf("value decrypts under another key")
+	}
+	if _, err := c.Get(ctx, "missing"); err != errRedisNil {
+		t.Errorf("missing key: %v", err)
+	}
+	store.values["plain"] = []byte("not encrypted")
+	if _, err := c.Get(ctx, "plain"); err == nil {
+		t.Errorf("unencrypted value accepted")
+	}
+}
+
+func TestRedisClientFields(t *testing.T) {
+	ctx := context.Background()
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	store := newMemRedis()
+	for _, encrypt := range []bool{false, true} {
+		c := NewRedisClient(store, bc)
+		c.EncryptFields = encrypt
+		key := "user:42"
+		if encrypt {
+			key = "user:43"
+		}
+		if err := c.HSet(ctx, key, "email", []byte("a@example.com")); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.HGet(ctx, key, "email")
+		if err != nil || string(got) != "a@example.com" {
+			t.Errorf("EncryptFields=%v: HGet = %q, %v", encrypt, got, err)
+		}
+		for stored := range store.hashes[key] {
+			if (stored == "email") == encrypt {
+				t.Errorf("EncryptFields=%v: field stored as %q", encrypt, stored)
+			}
+			if encrypt {
+				if name, err := c.DecryptField(key, stored); err != nil || name != "email" {
+					t.Errorf("DecryptField = %q, %v", name, err)
+				}
+			}
+		}
+		if _, err := c.HGet(ctx, key, "phone"); err != errRedisNil {
+			t.Errorf("missing field: %v", err)
+		}
+	}
+}
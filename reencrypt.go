@@ -0,0 +1,66 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"io"
+)
+
+// ReEncrypt decrypts "ciphertext" under "oldCipher" and encrypts the result
+// under "newCipher", both with "tweak". The plaintext is zeroed as soon as it
+// has been encrypted again.
+func ReEncrypt(oldCipher TweakableBlockCipher, newCipher TweakableBlockCipher, tweak []byte, ciphertext []byte) []byte {
+	plain := oldCipher.Decrypt(tweak, ciphertext)
+	defer clear(plain)
+	return newCipher.Encrypt(tweak, plain)
+}
+
+// ReEncryptPage moves page "pageNo" from "oldPC" to "newPC", in place, so
+// the plaintext never leaves "page". Both must have the same page size.
+// Container.RotateKey is built on it.
+func ReEncryptPage(oldPC *PageCipher, newPC *PageCipher, pageNo uint64, page []byte) {
+	if oldPC.PageSize() != newPC.PageSize() {
+		paramPanicf(ErrPageSize, "Page sizes %d and %d differ", oldPC.PageSize(), newPC.PageSize())
+	}
+	oldPC.DecryptPage(pageNo, page)
+	newPC.EncryptPage(pageNo, page)
+}
+
+// ReEncryptEnvelope reads the envelope in "src" under "oldKey" and writes it
+// to "dst" as a new envelope under "newKey", with a fresh base tweak. The
+// plaintext passes through one buffer of EnvelopeSectorSize bytes, which is
+// zeroed at the end. On error, "dst" holds a truncated envelope.
+func ReEncryptEnvelope(dst io.Writer, src io.Reader, oldKey cipher.Block, newKey cipher.Block) error {
+	r, err := NewEnvelopeReader(src, oldKey)
+	if err != nil {
+		return err
+	}
+	w, err := NewEnvelopeWriter(dst, newKey)
+	if err != nil {
+		return err
+	}
+	return reEncryptStream(w, r)
+}
+
+// ReEncrypt rewrites the envelope in "src", written by NewWriter under any
+// key of the keyring, to "dst" under the current key.
+func (k *Keyring) ReEncrypt(dst io.Writer, src io.Reader) error {
+	r, err := k.NewReader(src)
+	if err != nil {
+		return err
+	}
+	w, err := k.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+	return reEncryptStream(w, r)
+}
+
+// reEncryptStream - copy "r" to "w" and close "w"
+func reEncryptStream(w *Writer, r *Reader) error {
+	buf := make([]byte, EnvelopeSectorSize)
+	defer clear(buf)
+	if _, err := io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{r}, buf); err != nil {
+		return err
+	}
+	return w.Close()
+}
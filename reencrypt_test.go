@@ -0,0 +1,72 @@
+package eme
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestReEncrypt(t *testing.T) {
+	oldC, newC := newKeyringCipher(t, 1), newKeyringCipher(t, 2)
+	tweak := bytes.Repeat([]byte{7}, 16)
+	plain := bytes.Repeat([]byte{0x55}, 512)
+	got := ReEncrypt(oldC, newC, tweak, oldC.Encrypt(tweak, plain))
+	if !bytes.Equal(got, newC.Encrypt(tweak, plain)) {
+		t.Errorf("ReEncrypt result differs from encrypting under the new key")
+	}
+
+	oldPC, newPC := NewPageCipher(oldC.bc, 4096), NewPageCipher(newC.bc, 4096)
+	page := bytes.Repeat([]byte{0x66}, 4096)
+	want := append([]byte{}, page...)
+	newPC.EncryptPage(3, want)
+	oldPC.EncryptPage(3, page)
+	ReEncryptPage(oldPC, newPC, 3, page)
+	if !bytes.Equal(page, want) {
+		t.Errorf("ReEncryptPage result differs from encrypting under the new key")
+	}
+}
+
+func TestReEncryptEnvelope(t *testing.T) {
+	oldC, newC := newKeyringCipher(t, 1), newKeyringCipher(t, 2)
+	plain := bytes.Repeat([]byte("rewrap"), 3000)
+	var src bytes.Buffer
+	w, _ := NewEnvelopeWriter(&src, oldC.bc)
+	w.Write(plain)
+	w.Close()
+	var dst bytes.Buffer
+	if err := ReEncryptEnvelope(&dst, bytes.NewReader(src.Bytes()), oldC.bc, newC.bc); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewEnvelopeReader(&dst, newC.bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("round trip failed: %v", err)
+	}
+	if err = ReEncryptEnvelope(io.Discard, bytes.NewReader(src.Bytes()[:40]), oldC.bc, newC.bc); err == nil {
+		t.Errorf("truncated envelope was accepted")
+	}
+
+	k := NewKeyring()
+	k.Add(1, oldC)
+	src.Reset()
+	w, _ = k.NewWriter(&src)
+	w.Write(plain)
+	w.Close()
+	k.Add(2, newC)
+	dst.Reset()
+	if err = k.ReEncrypt(&dst, &src); err != nil {
+		t.Fatal(err)
+	}
+	if envelopeKeyID(dst.Bytes()) != 2 {
+		t.Errorf("rewritten under key %d", envelopeKeyID(dst.Bytes()))
+	}
+	k.Remove(1)
+	if r, err = k.NewReader(&dst); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("keyring round trip failed: %v", err)
+	}
+}
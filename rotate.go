@@ -0,0 +1,215 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"os"
+)
+
+// RotateKey re-encrypts the container at "path" from "oldKey" to "newKey".
+// It is a shortcut for OpenContainer followed by Container.RotateKey, and
+// also finishes rotations that were interrupted earlier.
+func RotateKey(path string, oldKey cipher.Block, newKey cipher.Block) error {
+	c, err := OpenContainer(path, oldKey, newKey)
+	if err != nil {
+		return err
+	}
+	err = c.RotateKey(newKey)
+	if err2 := c.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// RotateKey re-encrypts every sector of the container under "newKey". If the
+// rotation was resumed by OpenContainer, "newKey" must be the key that was
+// passed there.
+//
+// The container stays usable while the rotation runs: sectors are converted
+// in batches of DefaultCheckpointInterval, and ReadSector and WriteSector
+// calls from other goroutines are served between batches. A per-sector epoch
+// bit, kept in a metadata area behind the data sectors, says which key each
+// sector is encrypted with. Each batch is journaled to a sidecar file
+// (the container path with ".eme-rotate" appended) before it is written, so
+// an interrupted rotation leaves the container consistent. When RotateKey
+// returns, "newKey" is the only key of the container. A KMS-wrapped key in
+// the header no longer matches then and is removed; use RotateKMSKey to
+// replace a KMS key instead. All other header fields, like the KDF and FIDO2
+// parameters, the keystore key ID and the escrowed key, are carried over
+// unchanged.
+func (c *Container) RotateKey(newKey cipher.Block) error {
+	return c.rotateKey(newKey, nil)
+}
+
+// rotateKey - RotateKey, recording "wrapped" as the wrapped new key when the
+// rotation starts
+func (c *Container) rotateKey(newKey cipher.Block, wrapped []byte) error {
+	c.mu.Lock()
+	if c.readOnly {
+		c.mu.Unlock()
+		return ErrReadOnly
+	}
+	c.next = c.h.pageCipher(newKey)
+	var err error
+	if c.epochs == nil {
+		if wrapped != nil {
+			c.h.SetField(fieldWrappedKeyNext, wrapped)
+		} else {
+			c.h.removeField(fieldWrappedKeyNext)
+		}
+		err = c.beginRotation()
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	sectors := c.h.Sectors()
+	for start := uint64(0); start < sectors; start += DefaultCheckpointInterval {
+		n := uint64(DefaultCheckpointInterval)
+		if sectors-start < n {
+			n = sectors - start
+		}
+		c.mu.Lock()
+		err = c.rotateBatch(start, n)
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.finishRotation()
+}
+
+func (c *Container) journalPath() string {
+	return c.path + ".eme-rotate"
+}
+
+// beginRotation - allocate the zeroed epoch map behind the data sectors and
+// record it in the header
+func (c *Container) beginRotation() error {
+	epoch, _, _ := c.h.keyEpoch()
+	mapOff := c.h.DataOffset + c.h.Sectors()*uint64(c.h.SectorSize)
+	c.epochs = make([]byte, c.epochMapLen())
+	if _, err := c.f.WriteAt(c.epochs, int64(mapOff)); err != nil {
+		return err
+	}
+	if err := c.f.Sync(); err != nil {
+		return err
+	}
+	c.h.setKeyEpoch(epoch, mapOff, true)
+	c.h.SetField(fieldKeyCheckNext, keyCheck(c.next.bc, c.h.Field(fieldSalt)))
+	return c.writeHeader()
+}
+
+// rotateBatch - move sectors [start, start+n) to the new key. "start" must be
+// a multiple of 8 so the batch covers whole bytes of the epoch map.
+func (c *Container) rotateBatch(start uint64, n uint64) error {
+	ss := uint64(c.h.SectorSize)
+	batch := make([]byte, n*ss)
+	if _, err := c.f.ReadAt(batch, c.sectorOffset(start)); err != nil {
+		return err
+	}
+	sparse := c.h.sparsePolicy() == SparsePreserve
+	todo := false
+	for i := uint64(0); i < n; i++ {
+		if c.cipherFor(start+i) == c.next {
+			continue
+		}
+		todo = true
+		sec := batch[i*ss : (i+1)*ss]
+		if sparse && allZero(sec) {
+			continue
+		}
+		ReEncryptPage(c.cur, c.next, start+i, sec)
+	}
+	if !todo {
+		return nil
+	}
+	cp := checkpoint{
+		direction:  DirectionEncrypt,
+		sectorSize: c.h.SectorSize,
+		sector:     start,
+		data:       batch,
+	}
+	if err := cp.save(c.journalPath()); err != nil {
+		return err
+	}
+	if err := c.applyRotation(cp); err != nil {
+		return err
+	}
+	return os.Remove(c.journalPath())
+}
+
+// applyRotation - write the new-key sectors of "cp" and mark them in the
+// epoch map
+func (c *Container) applyRotation(cp checkpoint) error {
+	n := uint64(len(cp.data)) / uint64(c.h.SectorSize)
+	if cp.sector+n > c.h.Sectors() {
+		return fmt.Errorf("rotation journal %q is beyond the end of the container", c.journalPath())
+	}
+	// Under SparsePreserve, the zero sectors of the batch were left alone, and
+	// writing them would fill their holes
+	sparse := c.h.sparsePolicy() == SparsePreserve
+	if err := writeBatch(c.f, cp.data, c.sectorOffset(cp.sector), int(c.h.SectorSize), sparse); err != nil {
+		return err
+	}
+	for i := cp.sector; i < cp.sector+n; i++ {
+		c.epochs[i/8] |= 1 << (i % 8)
+	}
+	_, mapOff, _ := c.h.keyEpoch()
+	first, last := cp.sector/8, (cp.sector+n+7)/8
+	if _, err := c.f.WriteAt(c.epochs[first:last], int64(mapOff+first)); err != nil {
+		return err
+	}
+	return c.f.Sync()
+}
+
+// replayRotation - apply the journaled batch of an interrupted rotation
+func (c *Container) replayRotation() error {
+	cp, err := loadCheckpoint(c.journalPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if cp.sectorSize != c.h.SectorSize {
+		return fmt.Errorf("rotation journal %q does not match the container", c.journalPath())
+	}
+	if err = c.applyRotation(cp); err != nil {
+		return err
+	}
+	return os.Remove(c.journalPath())
+}
+
+// finishRotation - make the new key the only key and drop the epoch map
+func (c *Container) finishRotation() error {
+	epoch, mapOff, _ := c.h.keyEpoch()
+	c.h.setKeyEpoch(epoch+1, 0, false)
+	// Switch the wrapped key in the same header write, so that it always
+	// matches the data
+	if v := c.h.Field(fieldWrappedKeyNext); v != nil {
+		c.h.SetField(fieldWrappedKey, v)
+		c.h.removeField(fieldWrappedKeyNext)
+	} else {
+		c.h.removeField(fieldWrappedKey)
+	}
+	c.h.SetField(fieldKeyCheck, keyCheck(c.next.bc, c.h.Field(fieldSalt)))
+	c.h.removeField(fieldKeyCheckNext)
+	if err := c.writeHeader(); err != nil {
+		return err
+	}
+	c.cur, c.next, c.epochs = c.next, nil, nil
+	return c.f.Truncate(int64(mapOff))
+}
+
+func (c *Container) writeHeader() error {
+	hdr, err := c.h.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err = c.f.WriteAt(hdr, 0); err != nil {
+		return err
+	}
+	return c.f.Sync()
+}
@@ -0,0 +1,250 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestContainer - a 300-sector container at "dir", returned together with
+// its plaintext
+func newTestContainer(t *testing.T, dir string, key []byte) (string, []byte) {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := filepath.Join(dir, "disk.img")
+	orig := make([]byte, 300*512)
+	for i := range orig {
+		orig[i] = byte(i / 512)
+	}
+	if err = os.WriteFile(img, orig, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cont := filepath.Join(dir, "disk.eme")
+	if err = ImageToContainer(cont, img, bc, ContainerOptions{SectorSize: 512}); err != nil {
+		t.Fatal(err)
+	}
+	return cont, orig
+}
+
+func TestRotateKey(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	cont, orig := newTestContainer(t, dir, oldKey)
+	oldBC, _ := aes.NewCipher(oldKey)
+	newBC, _ := aes.NewCipher(newKey)
+	if err := RotateKey(cont, oldBC, newBC); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.img")
+	if err := ContainerToImage(out, cont, newBC); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	if !bytes.Equal(got, orig) {
+		t.Errorf("content changed by rotation")
+	}
+	c, err := OpenContainer(cont, newBC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if epoch, _, rotating := c.Header().keyEpoch(); epoch != 1 || rotating {
+		t.Errorf("epoch=%d rotating=%v", epoch, rotating)
+	}
+}
+
+// Every header field except the wrapped KMS key and the key state must
+// survive a rotation
+func TestRotateKeyKeepsFields(t *testing.T) {
+	dir := t.TempDir()
+	oldBC, _ := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	newBC, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	img := filepath.Join(dir, "disk.img")
+	if err := os.WriteFile(img, bytes.Repeat([]byte{3}, 20*512), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cont := filepath.Join(dir, "disk.eme")
+	opts := ContainerOptions{
+		SectorSize: 512,
+		Sparse:     SparsePreserve,
+		KDF:        &KDFParams{Salt: make([]byte, 16), Argon2: &Argon2Params{Time: 1, Memory: 64, Threads: 1}},
+		FIDO2:      &FIDO2Params{CredentialID: []byte("cred"), Salt: bytes.Repeat([]byte{4}, 32)},
+		WrappedKey: []byte("wrapped"),
+		Escrow:     []byte("escrow"),
+		KeyID:      42,
+	}
+	if err := ImageToContainer(cont, img, oldBC, opts); err != nil {
+		t.Fatal(err)
+	}
+	readHeader := func() *ContainerHeader {
+		f, err := os.Open(cont)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		h, err := ReadContainerHeader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	before := readHeader()
+	if err := RotateKey(cont, oldBC, newBC); err != nil {
+		t.Fatal(err)
+	}
+	after := readHeader()
+	for _, f := range before.Fields {
+		switch f.Type {
+		case fieldKeyEpoch, fieldKeyCheck:
+			continue
+		case fieldWrappedKey:
+			if after.Field(f.Type) != nil {
+				t.Errorf("stale wrapped key kept")
+			}
+			continue
+		}
+		if got := after.Field(f.Type); !bytes.Equal(got, f.Value) {
+			t.Errorf("field %d: %q after rotation, was %q", f.Type, got, f.Value)
+		}
+	}
+	if after.KeyID() != 42 || after.Escrow() == nil {
+		t.Errorf("key ID %d, escrow %q", after.KeyID(), after.Escrow())
+	}
+	if err := after.checkKey(newBC); err != nil {
+		t.Errorf("new key: %v", err)
+	}
+}
+
+// Interrupt a rotation after the first batch, with the second batch only
+// journaled, and check that the container is readable and can be finished.
+func TestRotateKeyInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	cont, orig := newTestContainer(t, dir, oldKey)
+	oldBC, _ := aes.NewCipher(oldKey)
+	newBC, _ := aes.NewCipher(newKey)
+
+	c, err := OpenContainer(cont, oldBC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.next = c.h.pageCipher(newBC)
+	if err = c.beginRotation(); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.rotateBatch(0, DefaultCheckpointInterval); err != nil {
+		t.Fatal(err)
+	}
+	// Journal the rest without applying it
+	rest := make([]byte, (300-DefaultCheckpointInterval)*512)
+	copy(rest, orig[DefaultCheckpointInterval*512:])
+	for i := 0; i < len(rest)/512; i++ {
+		c.next.EncryptPage(uint64(DefaultCheckpointInterval+i), rest[i*512:(i+1)*512])
+	}
+	cp := checkpoint{direction: DirectionEncrypt, sectorSize: 512, sector: DefaultCheckpointInterval, data: rest}
+	if err = cp.save(c.journalPath()); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	if _, err = OpenContainer(cont, oldBC, nil); err == nil {
+		t.Errorf("opened a rotating container without the new key")
+	}
+	// Read-only opens must not replay the journal
+	if _, err = OpenContainerReadOnly(cont, oldBC); err == nil {
+		t.Errorf("opened a rotating container read-only")
+	}
+	wrongBC, _ := aes.NewCipher(bytes.Repeat([]byte{3}, 32))
+	if _, err = OpenContainer(cont, oldBC, wrongBC); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("resumed the rotation with a wrong new key: %v", err)
+	}
+	if _, err = os.Stat(c.journalPath()); err != nil {
+		t.Errorf("journal gone after a wrong new key: %v", err)
+	}
+	c, err = OpenContainer(cont, oldBC, newBC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	for _, n := range []uint64{0, 255, 256, 299} {
+		if err = c.ReadSector(n, buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf, orig[n*512:(n+1)*512]) {
+			t.Errorf("sector %d: wrong content during rotation", n)
+		}
+	}
+	if err = c.RotateKey(newBC); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	out := filepath.Join(dir, "out.img")
+	if err = ContainerToImage(out, cont, newBC); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	if !bytes.Equal(got, orig) {
+		t.Errorf("content changed by rotation")
+	}
+}
+
+// A rotation must not fill the holes of a SparsePreserve container
+func TestRotateKeySparse(t *testing.T) {
+	dir := t.TempDir()
+	oldBC, _ := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	newBC, _ := aes.NewCipher(bytes.Repeat([]byte{2}, 32))
+	const ss = 4096
+	img := filepath.Join(dir, "disk.img")
+	f, err := os.Create(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Data in sector 3 only
+	if _, err = f.WriteAt(bytes.Repeat([]byte{0xaa}, ss), 3*ss); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(64 * ss); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	cont := filepath.Join(dir, "disk.eme")
+	if err = ImageToContainer(cont, img, oldBC, ContainerOptions{SectorSize: ss, Sparse: SparsePreserve}); err != nil {
+		t.Fatal(err)
+	}
+	isHole := func() bool {
+		f, err := os.Open(cont)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		fi, _ := f.Stat()
+		// Sectors 4 to 63 of the data area
+		return newHoleFinder(f, fi.Size()).isHole(int64(containerMinHeader)+4*ss, 60*ss)
+	}
+	if !isHole() {
+		t.Skip("the filesystem does not report holes")
+	}
+	if err = RotateKey(cont, oldBC, newBC); err != nil {
+		t.Fatal(err)
+	}
+	if !isHole() {
+		t.Errorf("rotation filled the holes")
+	}
+	out := filepath.Join(dir, "out.img")
+	if err = ContainerToImage(out, cont, newBC); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	want := make([]byte, 64*ss)
+	copy(want[3*ss:], bytes.Repeat([]byte{0xaa}, ss))
+	if !bytes.Equal(got, want) {
+		t.Errorf("content changed by rotation")
+	}
+}
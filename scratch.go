@@ -0,0 +1,63 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"unsafe"
+)
+
+// ScratchSize is the memory a Scratch needs: the L table of the longest
+// message and the intermediate blocks of EME.
+const ScratchSize = maxMessageBlocks*16 + int(unsafe.Sizeof(workspace{}))
+
+// Scratch is the working memory of TransformWithScratch. Transform allocates
+// it on every call; callers with strict allocation budgets allocate a
+// Scratch once and pass it to every call instead. It holds values derived
+// from the key while in use, so it can be placed in locked memory, see
+// NewScratchFrom, and cleared with Wipe. A Scratch must not be used by two
+// transformations at the same time.
+type Scratch struct {
+	lTable []byte
+	w      *workspace
+}
+
+// NewScratch returns a Scratch on the Go heap.
+func NewScratch() *Scratch {
+	return NewScratchFrom(alignedBytes(ScratchSize))
+}
+
+// NewScratchFrom returns a Scratch that lives in the first ScratchSize bytes
+// of "mem", which the caller owns: for example memory from mmap that was
+// locked with mlock, so that key-derived values are never swapped out.
+// "mem" must not be used for anything else while the Scratch is in use. It
+// panics with a *ParamError if "mem" is shorter than ScratchSize.
+func NewScratchFrom(mem []byte) *Scratch {
+	if len(mem) < ScratchSize {
+		paramPanicf(ErrDataSize, "Scratch memory must be at least %d bytes long, is %d", ScratchSize, len(mem))
+	}
+	l := maxMessageBlocks * 16
+	return &Scratch{
+		lTable: mem[:l:l],
+		// workspace only holds byte arrays, so any memory can back it
+		w: (*workspace)(unsafe.Pointer(&mem[l])),
+	}
+}
+
+// Wipe clears the memory of the Scratch.
+func (s *Scratch) Wipe() {
+	clear(s.lTable)
+	*s.w = workspace{}
+}
+
+// TransformWithScratch is Transform, but writes the result into "dst", which
+// must be as long as "inputData", and works in "s" instead of allocating.
+// "dst" and "inputData" may be the same slice. It does not allocate, unless
+// the block cipher does.
+func TransformWithScratch(bc cipher.Block, tweak []byte, dst []byte, inputData []byte, direction directionConst, s *Scratch) {
+	m := checkParams(bc, tweak, inputData)
+	if len(dst) != len(inputData) {
+		paramPanicf(ErrDataSize, "dst must be %d bytes long, is %d", len(inputData), len(dst))
+	}
+	LTable := s.lTable[:m*16]
+	fillL(bc, LTable, s.w)
+	transform(bc, tweak, dst, inputData, direction, LTable, s.w)
+}
@@ -0,0 +1,60 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"testing"
+)
+
+// TransformWithScratch must match Transform, also in place and with memory
+// supplied by the caller.
+func TestTransformWithScratch(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := make([]byte, 16)
+	tweak[0] = 9
+	mem := make([]byte, ScratchSize+5)
+	for _, s := range []*Scratch{NewScratch(), NewScratchFrom(mem[5:])} {
+		for _, n := range []int{16, 512, 2048} {
+			in := make([]byte, n)
+			for i := range in {
+				in[i] = byte(i)
+			}
+			want := Transform(bc, tweak, in, DirectionEncrypt)
+			got := make([]byte, n)
+			TransformWithScratch(bc, tweak, got, in, DirectionEncrypt, s)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("n=%d: differs from Transform", n)
+			}
+			TransformWithScratch(bc, tweak, got, got, DirectionDecrypt, s)
+			if !bytes.Equal(got, in) {
+				t.Fatalf("n=%d: in-place roundtrip failed", n)
+			}
+		}
+		s.Wipe()
+	}
+	if !bytes.Equal(mem[5:], make([]byte, ScratchSize)) {
+		t.Error("Wipe left data in the caller's memory")
+	}
+}
+
+func TestScratchBadParams(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 16))
+	expectParamPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			err, _ := recover().(error)
+			if !errors.Is(err, ErrDataSize) {
+				t.Errorf("%s: got %v, want ErrDataSize", name, err)
+			}
+		}()
+		f()
+	}
+	expectParamPanic("short memory", func() { NewScratchFrom(make([]byte, ScratchSize-1)) })
+	expectParamPanic("short dst", func() {
+		TransformWithScratch(bc, make([]byte, 16), make([]byte, 16), make([]byte, 32), DirectionEncrypt, NewScratch())
+	})
+}
@@ -0,0 +1,135 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"errors"
+	"io"
+	"sync"
+)
+
+// SeekReader gives random access to a stream written by Writer. Only the
+// sectors that cover a read are fetched from the underlying io.ReaderAt and
+// decrypted. It implements io.ReadSeeker and io.ReaderAt; ReadAt is safe for
+// concurrent use.
+type SeekReader struct {
+	r   io.ReaderAt
+	ss  int64
+	mu  sync.Mutex
+	pc  *PageCipher
+	buf []byte
+	// tailStart - the first plaintext byte of the final sectors, whose
+	// padding has already been removed into "tail"
+	tailStart int64
+	tail      []byte
+	size      int64
+	// off - position for Read and Seek
+	off int64
+}
+
+// NewSeekReader returns a SeekReader for the "size" bytes of ciphertext in
+// "r". The parameters, including "padding", must be the ones the Writer used.
+// The final sectors are decrypted right away to learn the plaintext size.
+func NewSeekReader(r io.ReaderAt, size int64, bc cipher.Block, sectorSize int, baseTweak []byte, padding Padding) (*SeekReader, error) {
+	if size < 0 {
+		return nil, errors.New("negative size")
+	}
+	ss := int64(sectorSize)
+	// The final sectors are the last two, so that ciphertext stealing can be
+	// undone, or fewer if the stream is shorter
+	var tailSector int64
+	if size > ss {
+		tailSector = (size-1)/ss - 1
+	}
+	tr := NewReader(io.NewSectionReader(r, tailSector*ss, size-tailSector*ss), bc, sectorSize, baseTweak)
+	tr.Padding = padding
+	tr.n = uint64(tailSector)
+	tail, err := io.ReadAll(tr)
+	if err != nil {
+		return nil, err
+	}
+	pc := NewPageCipher(bc, sectorSize)
+	copy(pc.salt[:], baseTweak)
+	return &SeekReader{
+		r:         r,
+		ss:        ss,
+		pc:        pc,
+		buf:       make([]byte, sectorSize),
+		tailStart: tailSector * ss,
+		tail:      tail,
+		size:      tailSector*ss + int64(len(tail)),
+	}, nil
+}
+
+// Size returns the plaintext size.
+func (sr *SeekReader) Size() int64 {
+	return sr.size
+}
+
+// ReadAt implements io.ReaderAt. It does not allocate, apart from what the
+// underlying io.ReaderAt does.
+func (sr *SeekReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= sr.size {
+			return n, io.EOF
+		}
+		if pos >= sr.tailStart {
+			n += copy(p[n:], sr.tail[pos-sr.tailStart:])
+			continue
+		}
+		k, err := sr.readSector(p[n:], pos)
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// readSector - decrypt the sector containing plaintext offset "pos", which is
+// not part of the final sectors, and copy it to "p" starting at "pos"
+func (sr *SeekReader) readSector(p []byte, pos int64) (int, error) {
+	sector := pos / sr.ss
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if _, err := sr.r.ReadAt(sr.buf, sector*sr.ss); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	sr.pc.DecryptPage(uint64(sector), sr.buf)
+	return copy(p, sr.buf[pos-sector*sr.ss:]), nil
+}
+
+// Read implements io.Reader.
+func (sr *SeekReader) Read(p []byte) (int, error) {
+	n, err := sr.ReadAt(p, sr.off)
+	sr.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (sr *SeekReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += sr.off
+	case io.SeekEnd:
+		offset += sr.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	sr.off = offset
+	return offset, nil
+}
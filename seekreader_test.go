@@ -0,0 +1,60 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+)
+
+func TestSeekReader(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := bytes.Repeat([]byte{3}, 16)
+	for _, size := range []int{0, 16, 500, 512, 1030, 2048, 5000} {
+		plain := make([]byte, size)
+		for i := range plain {
+			plain[i] = byte(i * 7)
+		}
+		for _, padding := range []Padding{PadPKCS7, PadNone, PadCTS} {
+			var enc bytes.Buffer
+			w := NewWriter(&enc, bc, 512, tweak)
+			w.Padding = padding
+			w.Write(plain)
+			if w.Close() != nil {
+				continue
+			}
+			sr, err := NewSeekReader(bytes.NewReader(enc.Bytes()), int64(enc.Len()), bc, 512, tweak, padding)
+			if err != nil {
+				t.Fatalf("size %d padding %d: %v", size, padding, err)
+			}
+			if sr.Size() != int64(size) {
+				t.Fatalf("size %d padding %d: Size() = %d", size, padding, sr.Size())
+			}
+			for _, r := range [][2]int{{0, size}, {1, 600}, {511, 2}, {size / 2, size}, {size - 1, 10}} {
+				off, n := r[0], r[1]
+				if off < 0 {
+					continue
+				}
+				buf := make([]byte, n)
+				k, err := sr.ReadAt(buf, int64(off))
+				want := plain[min(off, size):min(off+n, size)]
+				if !bytes.Equal(buf[:k], want) {
+					t.Errorf("size %d padding %d: ReadAt(%d, %d) returned wrong data", size, padding, n, off)
+				}
+				if off+n > size && err != io.EOF {
+					t.Errorf("size %d padding %d: ReadAt(%d, %d) past the end: err=%v", size, padding, n, off, err)
+				}
+			}
+			if _, err = sr.Seek(int64(size/3), io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			rest, err := io.ReadAll(sr)
+			if err != nil || !bytes.Equal(rest, plain[size/3:]) {
+				t.Errorf("size %d padding %d: Seek+Read failed: %v", size, padding, err)
+			}
+		}
+	}
+}
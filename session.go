@@ -0,0 +1,104 @@
+package eme
+
+import (
+	"crypto/aes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net"
+)
+
+// sessionInfo - the HKDF info of the session keys
+const sessionInfo = "github.com/rfjakob/eme session v1"
+
+// SessionKey is an ephemeral X25519 key pair for one connection. Both peers
+// create one, exchange the public keys and call Conn; the shared secret
+// becomes the AES-256 key and the two tweaks of a Conn with HKDF-SHA256,
+// salted with both public keys. A SessionKey must not be used for more than
+// one connection.
+//
+// The exchange is not authenticated: an attacker who can modify the traffic
+// can run one exchange with each peer and read everything. Compare or sign
+// the public keys out of band where that matters.
+type SessionKey struct {
+	priv *ecdh.PrivateKey
+}
+
+// NewSessionKey generates a SessionKey.
+func NewSessionKey() (*SessionKey, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionKey{priv: priv}, nil
+}
+
+// PublicKey returns the 32-byte public key to send to the peer.
+func (k *SessionKey) PublicKey() []byte {
+	return k.priv.PublicKey().Bytes()
+}
+
+// Conn wraps "c" with the keys agreed with the peer whose public key is
+// "peer". Exactly one of the peers is the "initiator", usually the one that
+// dialed.
+func (k *SessionKey) Conn(c net.Conn, peer []byte, initiator bool) (*Conn, error) {
+	pub, err := ecdh.X25519().NewPublicKey(peer)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := k.priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(shared)
+	// The salt binds the keys to the transcript, initiator first
+	salt := append(k.PublicKey(), peer...)
+	if !initiator {
+		salt = append(append([]byte{}, peer...), k.PublicKey()...)
+	}
+	okm, err := hkdf.Key(sha256.New, shared, salt, sessionInfo, 32+16+16)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(okm)
+	bc, err := aes.NewCipher(okm[:32])
+	if err != nil {
+		return nil, err
+	}
+	send, recv := okm[32:48], okm[48:64]
+	if !initiator {
+		send, recv = recv, send
+	}
+	return NewConn(c, bc, send, recv), nil
+}
+
+// NewSessionConn runs an ephemeral X25519 exchange over "c", each peer
+// sending its 32-byte public key in the clear, and wraps "c" with the agreed
+// keys. See SessionKey for what this does and does not protect against.
+func NewSessionConn(c net.Conn, initiator bool) (*Conn, error) {
+	k, err := NewSessionKey()
+	if err != nil {
+		return nil, err
+	}
+	// Send while receiving, so that net.Pipe and other unbuffered
+	// connections do not deadlock
+	werr := make(chan error, 1)
+	go func() {
+		_, err := c.Write(k.PublicKey())
+		werr <- err
+	}()
+	peer := make([]byte, 32)
+	if _, err = io.ReadFull(c, peer); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("eme: session key exchange: %w", err)
+	}
+	if err = <-werr; err != nil {
+		return nil, fmt.Errorf("eme: session key exchange: %w", err)
+	}
+	return k.Conn(c, peer, initiator)
+}
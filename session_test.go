@@ -0,0 +1,58 @@
+package eme
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestSessionConn(t *testing.T) {
+	ca, cb := net.Pipe()
+	var b *Conn
+	var berr error
+	done := make(chan struct{})
+	go func() {
+		b, berr = NewSessionConn(cb, false)
+		close(done)
+	}()
+	a, err := NewSessionConn(ca, true)
+	<-done
+	if err != nil || berr != nil {
+		t.Fatal(err, berr)
+	}
+	if bytes.Equal(a.wtweak, a.rtweak) || !bytes.Equal(a.wtweak, b.rtweak) || !bytes.Equal(a.rtweak, b.wtweak) {
+		t.Errorf("tweaks do not match")
+	}
+	go func() {
+		a.Write([]byte("hello"))
+		a.Close()
+	}()
+	got, err := io.ReadAll(b)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestSessionKeyPeers(t *testing.T) {
+	k1, _ := NewSessionKey()
+	k2, _ := NewSessionKey()
+	k3, _ := NewSessionKey()
+	a, err := k1.Conn(nil, k2.PublicKey(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := k2.Conn(nil, k1.PublicKey(), false)
+	c, _ := k3.Conn(nil, k1.PublicKey(), false)
+	tweak := make([]byte, 16)
+	in := make([]byte, 32)
+	if !bytes.Equal(New(a.bc).Encrypt(tweak, in), New(b.bc).Encrypt(tweak, in)) {
+		t.Errorf("peers derived different keys")
+	}
+	if bytes.Equal(New(a.bc).Encrypt(tweak, in), New(c.bc).Encrypt(tweak, in)) {
+		t.Errorf("third party derived the same key")
+	}
+	if _, err = k1.Conn(nil, make([]byte, 32), true); err == nil {
+		t.Errorf("all-zero public key was accepted")
+	}
+}
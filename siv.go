@@ -0,0 +1,154 @@
+package eme
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+)
+
+// SIV is deterministic authenticated encryption built on EME, in the style
+// of AES-SIV (RFC 5297): the synthetic IV, S2V with AES-CMAC over the
+// associated data and the plaintext, is the EME tweak, and it is appended
+// to the ciphertext as the tag. Equal (associated data, plaintext) pairs give
+// equal ciphertexts, which is what makes lookups of encrypted database keys
+// and identifiers possible, and nothing else about the plaintext leaks. There
+// is no nonce that could be misused.
+//
+// The plaintext is padded to a multiple of 16 bytes (PKCS#7) and must be at
+// most 2047 bytes long. The ciphertext is the padded plaintext followed by
+// the 16-byte tag.
+type SIV struct {
+	mac PRF
+	eme *EMECipher
+}
+
+// NewSIV returns an SIV under "key", which is 32, 48 or 64 bytes long: the
+// first half is the AES key of CMAC, the second half that of EME.
+func NewSIV(key []byte) (*SIV, error) {
+	switch len(key) {
+	case 32, 48, 64:
+	default:
+		return nil, fmt.Errorf("eme: SIV key must be 32, 48 or 64 bytes long, is %d", len(key))
+	}
+	macBlock, err := aes.NewCipher(key[:len(key)/2])
+	if err != nil {
+		return nil, err
+	}
+	encBlock, err := aes.NewCipher(key[len(key)/2:])
+	if err != nil {
+		return nil, err
+	}
+	return &SIV{mac: newCMAC(macBlock), eme: New(encBlock)}, nil
+}
+
+// NewSIVWithPRF returns an SIV that computes S2V with "prf" instead of
+// AES-CMAC, and encrypts with EME under "bc". The PRF key and "bc" must be
+// independent. The ciphertexts differ from those of NewSIV, and from those
+// of other PRFs.
+func NewSIVWithPRF(prf PRF, bc cipher.Block) *SIV {
+	return &SIV{mac: prf, eme: New(bc)}
+}
+
+// Seal encrypts and authenticates "plaintext" together with "ad", which is
+// authenticated but not encrypted.
+func (s *SIV) Seal(ad []byte, plaintext []byte) ([]byte, error) {
+	if len(plaintext) >= pageSegmentSize {
+		return nil, fmt.Errorf("eme: SIV plaintext must be shorter than %d bytes, is %d", pageSegmentSize, len(plaintext))
+	}
+	v := s2v(s.mac, ad, plaintext)
+	return append(s.eme.Encrypt(v[:], pad16(append([]byte{}, plaintext...))), v[:]...), nil
+}
+
+// Open checks and decrypts "ciphertext" from Seal with the same "ad".
+func (s *SIV) Open(ad []byte, ciphertext []byte) ([]byte, error) {
+	n := len(ciphertext) - 16
+	if n <= 0 || n%16 != 0 || n > pageSegmentSize {
+		return nil, errSIVAuth
+	}
+	tag := ciphertext[n:]
+	plain, err := unpad16(s.eme.Decrypt(tag, ciphertext[:n]))
+	if err != nil {
+		return nil, errSIVAuth
+	}
+	v := s2v(s.mac, ad, plain)
+	if subtle.ConstantTimeCompare(v[:], tag) != 1 {
+		clear(plain)
+		return nil, errSIVAuth
+	}
+	return plain, nil
+}
+
+var errSIVAuth = errors.New("eme: SIV authentication failed")
+
+// cmac - AES-CMAC, RFC 4493
+type cmac struct {
+	bc     cipher.Block
+	k1, k2 [16]byte
+}
+
+func newCMAC(bc cipher.Block) *cmac {
+	c := &cmac{bc: bc}
+	var l [16]byte
+	bc.Encrypt(l[:], l[:])
+	c.k1 = dbl(l)
+	c.k2 = dbl(c.k1)
+	return c
+}
+
+// dbl - doubling in GF(2^128) with big-endian blocks, as in RFC 5297. EME's
+// multByTwo uses little-endian blocks instead.
+func dbl(b [16]byte) [16]byte {
+	var out [16]byte
+	for i := 0; i < 15; i++ {
+		out[i] = b[i]<<1 | b[i+1]>>7
+	}
+	out[15] = b[15] << 1
+	if b[0]&0x80 != 0 {
+		out[15] ^= 0x87
+	}
+	return out
+}
+
+// Sum16 returns the CMAC of "msg".
+func (c *cmac) Sum16(msg []byte) [16]byte {
+	var x [16]byte
+	for len(msg) > 16 {
+		subtle.XORBytes(x[:], x[:], msg[:16])
+		c.bc.Encrypt(x[:], x[:])
+		msg = msg[16:]
+	}
+	var last [16]byte
+	copy(last[:], msg)
+	if len(msg) == 16 {
+		subtle.XORBytes(last[:], last[:], c.k1[:])
+	} else {
+		last[len(msg)] = 0x80
+		subtle.XORBytes(last[:], last[:], c.k2[:])
+	}
+	subtle.XORBytes(x[:], x[:], last[:])
+	c.bc.Encrypt(x[:], x[:])
+	return x
+}
+
+// s2v - S2V of RFC 5297 with "prf" over the strings "ad" and "plain"
+func s2v(prf PRF, ad []byte, plain []byte) [16]byte {
+	d := prf.Sum16(make([]byte, 16))
+	m := prf.Sum16(ad)
+	d = dbl(d)
+	subtle.XORBytes(d[:], d[:], m[:])
+	var t []byte
+	if len(plain) >= 16 {
+		t = append([]byte{}, plain...)
+		subtle.XORBytes(t[len(t)-16:], t[len(t)-16:], d[:])
+	} else {
+		d = dbl(d)
+		var p [16]byte
+		copy(p[:], plain)
+		p[len(plain)] = 0x80
+		subtle.XORBytes(d[:], d[:], p[:])
+		t = d[:]
+	}
+	return prf.Sum16(t)
+}
@@ -0,0 +1,58 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+// The synthetic IV of RFC 5297, appendix A.1
+func TestS2VVector(t *testing.T) {
+	bc, _ := aes.NewCipher(unhex("fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0"))
+	ad := unhex("101112131415161718191a1b1c1d1e1f2021222324252627")
+	plain := unhex("112233445566778899aabbccddee")
+	v := s2v(newCMAC(bc), ad, plain)
+	if want := "85632d07c6e8f37f950acd320a2ecc93"; hex.EncodeToString(v[:]) != want {
+		t.Errorf("got %x, want %s", v, want)
+	}
+}
+
+func TestSIV(t *testing.T) {
+	s, err := NewSIV(bytes.Repeat([]byte{1}, 64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ad := []byte("users.email")
+	for _, n := range []int{0, 1, 15, 16, 17, 2047} {
+		plain := bytes.Repeat([]byte{'x'}, n)
+		ct, err := s.Seal(ad, plain)
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+		if len(ct) != n+16-n%16+16 {
+			t.Errorf("n=%d: ciphertext is %d bytes", n, len(ct))
+		}
+		again, _ := s.Seal(ad, plain)
+		if !bytes.Equal(ct, again) {
+			t.Errorf("n=%d: not deterministic", n)
+		}
+		got, err := s.Open(ad, ct)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Fatalf("n=%d: roundtrip failed: %v", n, err)
+		}
+		if _, err := s.Open([]byte("users.name"), ct); err == nil {
+			t.Errorf("n=%d: wrong associated data accepted", n)
+		}
+		ct[0] ^= 1
+		if _, err := s.Open(ad, ct); err == nil {
+			t.Errorf("n=%d: modified ciphertext accepted", n)
+		}
+	}
+	if _, err := s.Seal(ad, make([]byte, 2048)); err == nil {
+		t.Error("2048-byte plaintext accepted")
+	}
+	if _, err := NewSIV(make([]byte, 16)); err == nil {
+		t.Error("16-byte key accepted")
+	}
+}
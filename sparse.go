@@ -0,0 +1,83 @@
+package eme
+
+import (
+	"os"
+)
+
+// SparsePolicy selects how holes and all-zero sectors of sparse images are
+// handled.
+type SparsePolicy int
+
+const (
+	// SparseEncrypt encrypts holes and all-zero sectors like any other data.
+	// The output is not sparse, but it does not reveal which sectors are
+	// empty. This is the default.
+	SparseEncrypt SparsePolicy = iota
+	// SparsePreserve stores every all-zero plaintext sector, including holes,
+	// as an all-zero ciphertext sector, and leaves it as a hole in the output
+	// where possible. Decryption maps all-zero ciphertext sectors back to
+	// all-zero plaintext. This reveals which sectors are empty.
+	SparsePreserve
+)
+
+// holeFinder - answers "is this range a hole" using SEEK_DATA and SEEK_HOLE,
+// caching the last data and hole extents to keep the number of syscalls low.
+// On platforms or filesystems without hole support, nothing is a hole.
+type holeFinder struct {
+	f           *os.File
+	size        int64
+	unsupported bool
+	// [dataStart, dataEnd) is known to be data
+	dataStart, dataEnd int64
+	// [holeStart, holeEnd) is known to be a hole
+	holeStart, holeEnd int64
+}
+
+func newHoleFinder(f *os.File, size int64) *holeFinder {
+	return &holeFinder{f: f, size: size, unsupported: seekData < 0}
+}
+
+// isHole - reports whether [off, off+n) lies entirely inside a hole
+func (h *holeFinder) isHole(off int64, n int64) bool {
+	if h.unsupported {
+		return false
+	}
+	if off >= h.dataStart && off < h.dataEnd {
+		return false
+	}
+	if off >= h.holeStart && off+n <= h.holeEnd {
+		return true
+	}
+	d, err := h.f.Seek(off, seekData)
+	if err != nil {
+		if !isENXIO(err) {
+			// Probably not supported by the filesystem
+			h.unsupported = true
+			return false
+		}
+		// No data after "off"
+		d = h.size
+	}
+	if d > off {
+		h.holeStart, h.holeEnd = off, d
+		if off+n <= d {
+			return true
+		}
+	}
+	e, err := h.f.Seek(d, seekHole)
+	if err != nil {
+		e = h.size
+	}
+	h.dataStart, h.dataEnd = d, e
+	return false
+}
+
+// allZero - reports whether every byte of "b" is zero
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
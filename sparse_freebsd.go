@@ -0,0 +1,16 @@
+package eme
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Whence values for lseek(2)
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+func isENXIO(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
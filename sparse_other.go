@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package eme
+
+// No hole support: a negative seekData disables the holeFinder.
+const (
+	seekData = -1
+	seekHole = -1
+)
+
+func isENXIO(err error) bool {
+	return false
+}
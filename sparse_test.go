@@ -0,0 +1,132 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeSparseImage - 16 sectors of 512 bytes, with data only in sector 3 and
+// a hole everywhere else (if the filesystem supports it)
+func writeSparseImage(t *testing.T, path string) []byte {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := make([]byte, 16*512)
+	for i := 3 * 512; i < 4*512; i++ {
+		want[i] = 0xaa
+	}
+	if _, err = f.WriteAt(want[3*512:4*512], 3*512); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(int64(len(want))); err != nil {
+		t.Fatal(err)
+	}
+	return want
+}
+
+func TestSparseContainer(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	img := filepath.Join(dir, "sparse.img")
+	orig := writeSparseImage(t, img)
+	for _, policy := range []SparsePolicy{SparseEncrypt, SparsePreserve} {
+		cont := filepath.Join(dir, "sparse.eme")
+		if err = ImageToContainer(cont, img, bc, ContainerOptions{SectorSize: 512, Sparse: policy}); err != nil {
+			t.Fatal(err)
+		}
+		enc, _ := os.ReadFile(cont)
+		// Sector 0 of the data area is empty in the plaintext
+		zero := allZero(enc[containerMinHeader : containerMinHeader+512])
+		if zero != (policy == SparsePreserve) {
+			t.Errorf("policy %d: empty sector stored as zero = %v", policy, zero)
+		}
+		out := filepath.Join(dir, "out.img")
+		if err = ContainerToImage(out, cont, bc); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := os.ReadFile(out)
+		if !bytes.Equal(got, orig) {
+			t.Errorf("policy %d: roundtrip failed", policy)
+		}
+	}
+}
+
+func TestSparseImage(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := filepath.Join(t.TempDir(), "sparse.img")
+	orig := writeSparseImage(t, img)
+	opts := ImageOptions{CheckpointInterval: 4, Sparse: SparsePreserve}
+	if err = EncryptImage(img, bc, opts); err != nil {
+		t.Fatal(err)
+	}
+	enc, _ := os.ReadFile(img)
+	if !allZero(enc[:3*512]) || allZero(enc[3*512:4*512]) || !allZero(enc[4*512:]) {
+		t.Errorf("unexpected sparse layout")
+	}
+	if err = DecryptImage(img, bc, opts); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(img)
+	if !bytes.Equal(got, orig) {
+		t.Errorf("roundtrip failed")
+	}
+}
+
+// Replaying a checkpoint must not fill the holes of the zero sectors in it,
+// just like the batches written without a crash
+func TestSparseImageResume(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sectors of 4096 bytes, so that holes can be sector-sized on common
+	// filesystems, with data only in sector 3
+	const ss = 4096
+	img := filepath.Join(t.TempDir(), "sparse.img")
+	f, err := os.Create(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	want := make([]byte, 4*ss)
+	data := bytes.Repeat([]byte{0xaa}, ss)
+	if _, err = f.WriteAt(data, 3*ss); err != nil {
+		t.Fatal(err)
+	}
+	if !newHoleFinder(f, int64(len(want))).isHole(0, 3*ss) {
+		t.Skip("the filesystem does not report holes")
+	}
+	// Crash after journaling the first batch, before writing it
+	copy(want[3*ss:], data)
+	NewPageCipher(bc, ss).EncryptPage(3, want[3*ss:])
+	cp := checkpoint{
+		direction:  DirectionEncrypt,
+		sectorSize: ss,
+		sector:     0,
+		data:       append([]byte{}, want...),
+	}
+	if err = cp.save(img + ".eme-progress"); err != nil {
+		t.Fatal(err)
+	}
+	if err = EncryptImage(img, bc, ImageOptions{SectorSize: ss, CheckpointInterval: 4, Sparse: SparsePreserve}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(img)
+	if !bytes.Equal(got, want) {
+		t.Errorf("resumed image differs from expected ciphertext")
+	}
+	if !newHoleFinder(f, int64(len(want))).isHole(0, 3*ss) {
+		t.Errorf("replay filled the hole of sectors 0 to 2")
+	}
+}
@@ -0,0 +1,118 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"crypto/sha256"
+	"database/sql/driver"
+	"fmt"
+)
+
+// ColumnSpec says how a database column is encrypted. Implement it on an
+// empty struct type per column and use that type as the parameter of
+// EncryptedBytes or EncryptedString:
+//
+//	type customerEmail struct{}
+//
+//	func (customerEmail) ColumnCipher() (cipher.Block, string) {
+//		return columnKey, "customers.email"
+//	}
+//
+//	type Customer struct {
+//		ID    int64
+//		Email eme.EncryptedString[customerEmail]
+//	}
+type ColumnSpec interface {
+	// ColumnCipher returns the block cipher and the column name. The tweak
+	// is derived from the name, so renaming a column needs re-encryption.
+	ColumnCipher() (cipher.Block, string)
+}
+
+// EncryptedBytes is a []byte column that is EME-encrypted in the database.
+// It implements driver.Valuer and sql.Scanner. Values are PKCS#7-padded, so
+// they grow by 1 to 16 bytes, and they are encrypted under one tweak per
+// column: equal values in the same column give equal ciphertexts, which
+// allows lookups by value but reveals which rows are equal. Values are not
+// authenticated.
+type EncryptedBytes[C ColumnSpec] struct {
+	Bytes []byte
+	// Valid is false for NULL
+	Valid bool
+}
+
+// EncryptedString is a string column, see EncryptedBytes.
+type EncryptedString[C ColumnSpec] struct {
+	String string
+	// Valid is false for NULL
+	Valid bool
+}
+
+// Value implements driver.Valuer.
+func (e EncryptedBytes[C]) Value() (driver.Value, error) {
+	if !e.Valid {
+		return nil, nil
+	}
+	return encryptColumn[C](e.Bytes), nil
+}
+
+// Scan implements sql.Scanner.
+func (e *EncryptedBytes[C]) Scan(src any) error {
+	b, valid, err := decryptColumn[C](src)
+	e.Bytes, e.Valid = b, valid
+	return err
+}
+
+// Value implements driver.Valuer.
+func (e EncryptedString[C]) Value() (driver.Value, error) {
+	if !e.Valid {
+		return nil, nil
+	}
+	return encryptColumn[C]([]byte(e.String)), nil
+}
+
+// Scan implements sql.Scanner.
+func (e *EncryptedString[C]) Scan(src any) error {
+	b, valid, err := decryptColumn[C](src)
+	e.String, e.Valid = string(b), valid
+	return err
+}
+
+// columnTweak - the tweak of column "name"
+func columnTweak(name string) []byte {
+	h := sha256.Sum256([]byte("eme sql column\x00" + name))
+	return h[:16]
+}
+
+// encryptColumn - the padded and encrypted value of column C
+func encryptColumn[C ColumnSpec](plain []byte) []byte {
+	var spec C
+	bc, name := spec.ColumnCipher()
+	v := pad16(plain)
+	transformChunk(bc, columnTweak(name), 0, v, DirectionEncrypt)
+	return v
+}
+
+// decryptColumn - the plaintext of a scanned value, and false for NULL
+func decryptColumn[C ColumnSpec](src any) ([]byte, bool, error) {
+	var ct []byte
+	switch v := src.(type) {
+	case nil:
+		return nil, false, nil
+	case []byte:
+		ct = append([]byte{}, v...)
+	case string:
+		ct = []byte(v)
+	default:
+		return nil, false, fmt.Errorf("eme: cannot scan %T into an encrypted column", src)
+	}
+	var spec C
+	bc, name := spec.ColumnCipher()
+	if len(ct) == 0 || len(ct)%16 != 0 {
+		return nil, false, fmt.Errorf("eme: column %s: value is not encrypted", name)
+	}
+	transformChunk(bc, columnTweak(name), 0, ct, DirectionDecrypt)
+	plain, err := unpad16(ct)
+	if err != nil {
+		return nil, false, fmt.Errorf("eme: column %s: %w", name, err)
+	}
+	return plain, true, nil
+}
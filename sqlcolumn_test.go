@@ -0,0 +1,72 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+)
+
+var testColumnKey, _ = aes.NewCipher(make([]byte, 32))
+
+type testEmail struct{}
+
+func (testEmail) ColumnCipher() (cipher.Block, string) { return testColumnKey, "customers.email" }
+
+type testNotes struct{}
+
+func (testNotes) ColumnCipher() (cipher.Block, string) { return testColumnKey, "customers.notes" }
+
+var (
+	_ driver.Valuer = EncryptedString[testEmail]{}
+	_ sql.Scanner   = (*EncryptedString[testEmail])(nil)
+	_ driver.Valuer = EncryptedBytes[testEmail]{}
+	_ sql.Scanner   = (*EncryptedBytes[testEmail])(nil)
+)
+
+func TestEncryptedColumns(t *testing.T) {
+	v, err := EncryptedString[testEmail]{String: "alice@example.com", Valid: true}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := v.([]byte)
+	if len(ct) != 32 || bytes.Contains(ct, []byte("alice")) {
+		t.Errorf("bad ciphertext %x", ct)
+	}
+	var s EncryptedString[testEmail]
+	if err = s.Scan(ct); err != nil || !s.Valid || s.String != "alice@example.com" {
+		t.Errorf("Scan: %+v, %v", s, err)
+	}
+	// Drivers may return strings
+	if err = s.Scan(string(ct)); err != nil || s.String != "alice@example.com" {
+		t.Errorf("Scan string: %+v, %v", s, err)
+	}
+
+	// Per-column tweaks
+	v2, _ := EncryptedBytes[testNotes]{Bytes: []byte("alice@example.com"), Valid: true}.Value()
+	if bytes.Equal(v2.([]byte), ct) {
+		t.Errorf("same ciphertext in two columns")
+	}
+	var wrong EncryptedString[testNotes]
+	if err = wrong.Scan(ct); err == nil && wrong.String == "alice@example.com" {
+		t.Errorf("column tweak is ignored")
+	}
+
+	// NULL
+	if v, err = (EncryptedBytes[testNotes]{}).Value(); v != nil || err != nil {
+		t.Errorf("NULL Value: %v, %v", v, err)
+	}
+	b := EncryptedBytes[testNotes]{Bytes: []byte{1}, Valid: true}
+	if err = b.Scan(nil); err != nil || b.Valid || b.Bytes != nil {
+		t.Errorf("NULL Scan: %+v, %v", b, err)
+	}
+
+	if err = s.Scan(int64(3)); err == nil {
+		t.Errorf("scanned an integer")
+	}
+	if err = s.Scan([]byte("short")); err == nil {
+		t.Errorf("scanned a plaintext")
+	}
+}
@@ -0,0 +1,138 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"slices"
+)
+
+// The types below hold key material. Their String and GoString methods only
+// print what identifies them, like key IDs and sizes, so that formatting one
+// with %v or %#v by accident cannot leak a key.
+
+// blockName - the type of the block cipher, which does not reveal the key
+func blockName(bc cipher.Block) string {
+	return fmt.Sprintf("%T", bc)
+}
+
+// String describes the cipher without its key.
+func (e *EMECipher) String() string {
+	s := "eme.EMECipher{block: " + blockName(e.bc)
+	if e.usage != nil {
+		u := e.Usage()
+		s += fmt.Sprintf(", used: %d bytes in %d operations", u.Bytes, u.Ops)
+	}
+	return s + "}"
+}
+
+// GoString is String.
+func (e *EMECipher) GoString() string {
+	return e.String()
+}
+
+// String describes the cipher without its key.
+func (p *PageCipher) String() string {
+	return fmt.Sprintf("eme.PageCipher{block: %s, page size: %d}", blockName(p.bc), p.pageSize)
+}
+
+// GoString is String.
+func (p *PageCipher) GoString() string {
+	return p.String()
+}
+
+// String describes the Scratch without its contents.
+func (s *Scratch) String() string {
+	return fmt.Sprintf("eme.Scratch{size: %d}", ScratchSize)
+}
+
+// GoString is String.
+func (s *Scratch) GoString() string {
+	return s.String()
+}
+
+// String lists the key IDs of the keyring.
+func (k *Keyring) String() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	ids := make([]uint32, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return fmt.Sprintf("eme.Keyring{keys: %v, current: %d}", ids, k.current)
+}
+
+// GoString is String.
+func (k *Keyring) GoString() string {
+	return k.String()
+}
+
+// String describes the keystore by the number of keys and the current key.
+func (ks *Keystore) String() string {
+	return fmt.Sprintf("eme.Keystore{keys: %d, current: %d, passphrase: %t}", len(ks.entries), ks.Current(), ks.kdf != nil)
+}
+
+// GoString is String.
+func (ks *Keystore) GoString() string {
+	return ks.String()
+}
+
+// String describes the container by its path and geometry.
+func (c *Container) String() string {
+	return fmt.Sprintf("eme.Container{path: %q, sectors: %d, sector size: %d}", c.path, c.h.Sectors(), c.h.SectorSize)
+}
+
+// GoString is String.
+func (c *Container) GoString() string {
+	return c.String()
+}
+
+// String describes the cascade without its keys.
+func (c *Cascade) String() string {
+	return fmt.Sprintf("eme.Cascade{first: %s, second: %s}", blockName(c.first.bc), blockName(c.second.bc))
+}
+
+// GoString is String.
+func (c *Cascade) GoString() string {
+	return c.String()
+}
+
+// String describes the cipher without its key.
+func (x *XEXCipher) String() string {
+	return "eme.XEXCipher{block: " + blockName(x.bc) + "}"
+}
+
+// GoString is String.
+func (x *XEXCipher) GoString() string {
+	return x.String()
+}
+
+// String hides the key.
+func (h *hmacPRF) String() string {
+	return "eme.hmacPRF(redacted)"
+}
+
+// GoString is String.
+func (h *hmacPRF) GoString() string {
+	return h.String()
+}
+
+// String hides the key.
+func (b *blake2bPRF) String() string {
+	return "eme.blake2bPRF(redacted)"
+}
+
+// GoString is String.
+func (b *blake2bPRF) GoString() string {
+	return b.String()
+}
+
+// String hides the key.
+func (c *cmac) String() string {
+	return "eme.cmac{block: " + blockName(c.bc) + "}"
+}
+
+// GoString is String.
+func (c *cmac) GoString() string {
+	return c.String()
+}
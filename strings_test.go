@@ -0,0 +1,47 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStringsHideKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+	bc, _ := aes.NewCipher(key)
+	k := NewKeyring()
+	k.Add(10, New(bc))
+	k.Add(2, New(bc))
+	ks := NewKeystore(bc, nil)
+	ks.AddKey()
+	dir := t.TempDir()
+	img := filepath.Join(dir, "img")
+	os.WriteFile(img, make([]byte, 4096), 0600)
+	ImageToContainer(filepath.Join(dir, "c"), img, bc, ContainerOptions{})
+	c, err := OpenContainer(filepath.Join(dir, "c"), bc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	cmacPRF, _ := NewCMAC(bc)
+	blake2bPRF, _ := NewBLAKE2bPRF(key)
+	values := []interface{}{NewHMACPRF(key), blake2bPRF, cmacPRF, New(bc), NewWithUsagePolicy(bc, UsagePolicy{}), NewPageCipher(bc, 4096), NewScratch(), NewCascade(bc, bc), NewXEX(bc), k, ks, c}
+	for _, v := range values {
+		for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+			s := fmt.Sprintf(format, v)
+			if strings.Contains(s, "ab") || strings.Contains(s, "171") || strings.Contains(s, "0x") {
+				t.Errorf("%s of %T may leak the key: %s", format, v, s)
+			}
+		}
+	}
+	if s := k.String(); s != "eme.Keyring{keys: [2 10], current: 10}" {
+		t.Errorf("Keyring: %s", s)
+	}
+	if s := c.String(); !strings.Contains(s, "sectors: 1") {
+		t.Errorf("Container: %s", s)
+	}
+}
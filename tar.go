@@ -0,0 +1,150 @@
+package eme
+
+import (
+	"archive/tar"
+	"crypto/cipher"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// tarSectorSize - sector size of encrypted tar entries
+const tarSectorSize = 4096
+
+// tarSizeRecord - PAX record holding the plaintext size of an entry
+const tarSizeRecord = "EME.size"
+
+// TarWriter writes a tar archive whose regular file contents are encrypted.
+// Each entry is encrypted like a Writer stream with sectors of 4096 bytes,
+// zero-padded to a multiple of 16 bytes, with the first 16 bytes of
+// SHA-256(name) as the base tweak. The plaintext size is kept in the PAX
+// record "EME.size". Entry names and all other header fields stay
+// readable, and the archive can still be written and read as a stream.
+type TarWriter struct {
+	tw *tar.Writer
+	bc cipher.Block
+	// ew - encrypts the current entry, nil if it is not a regular file
+	ew *Writer
+	// pad - zero bytes to add when the current entry is finished
+	pad int
+}
+
+// NewTarWriter returns a TarWriter writing to "w".
+func NewTarWriter(w io.Writer, bc cipher.Block) *TarWriter {
+	return &TarWriter{tw: tar.NewWriter(w), bc: bc}
+}
+
+// WriteHeader finishes the current entry and starts a new one, like
+// tar.Writer.WriteHeader. The contents of regular files must then be
+// written with Write, exactly hdr.Size bytes.
+func (t *TarWriter) WriteHeader(hdr *tar.Header) error {
+	if err := t.finishEntry(); err != nil {
+		return err
+	}
+	if !isTarRegular(hdr) {
+		return t.tw.WriteHeader(hdr)
+	}
+	h := *hdr
+	h.Typeflag = tar.TypeReg
+	h.PAXRecords = make(map[string]string, len(hdr.PAXRecords)+1)
+	for k, v := range hdr.PAXRecords {
+		h.PAXRecords[k] = v
+	}
+	h.PAXRecords[tarSizeRecord] = strconv.FormatInt(hdr.Size, 10)
+	t.pad = padLen16(int(hdr.Size % 16))
+	h.Size += int64(t.pad)
+	h.Format = tar.FormatPAX
+	if err := t.tw.WriteHeader(&h); err != nil {
+		return err
+	}
+	t.ew = NewWriter(t.tw, t.bc, tarSectorSize, objectSalt(hdr.Name))
+	t.ew.Padding = PadNone
+	return nil
+}
+
+// Write encrypts "p" as content of the current entry.
+func (t *TarWriter) Write(p []byte) (int, error) {
+	if t.ew == nil {
+		return t.tw.Write(p)
+	}
+	return t.ew.Write(p)
+}
+
+func (t *TarWriter) finishEntry() error {
+	if t.ew == nil {
+		return nil
+	}
+	ew := t.ew
+	t.ew = nil
+	if _, err := ew.Write(make([]byte, t.pad)); err != nil {
+		return err
+	}
+	return ew.Close()
+}
+
+// Close finishes the current entry and the archive. It does not close the
+// underlying writer.
+func (t *TarWriter) Close() error {
+	if err := t.finishEntry(); err != nil {
+		return err
+	}
+	return t.tw.Close()
+}
+
+// TarReader reads an archive written by TarWriter.
+type TarReader struct {
+	tr *tar.Reader
+	bc cipher.Block
+	r  io.Reader
+}
+
+// NewTarReader returns a TarReader reading from "r".
+func NewTarReader(r io.Reader, bc cipher.Block) *TarReader {
+	return &TarReader{tr: tar.NewReader(r), bc: bc}
+}
+
+// Next advances to the next entry, like tar.Reader.Next. The header is the
+// one given to TarWriter.WriteHeader, with the plaintext size.
+func (t *TarReader) Next() (*tar.Header, error) {
+	hdr, err := t.tr.Next()
+	if err != nil {
+		return nil, err
+	}
+	t.r = t.tr
+	sizeRec, ok := hdr.PAXRecords[tarSizeRecord]
+	if !isTarRegular(hdr) || !ok {
+		return hdr, nil
+	}
+	size, err := strconv.ParseInt(sizeRec, 10, 64)
+	if err != nil || size < 0 || size+int64(padLen16(int(size%16))) != hdr.Size {
+		return nil, fmt.Errorf("eme: tar entry %q has an invalid %s record %q", hdr.Name, tarSizeRecord, sizeRec)
+	}
+	delete(hdr.PAXRecords, tarSizeRecord)
+	hdr.Size = size
+	er := NewReader(t.tr, t.bc, tarSectorSize, objectSalt(hdr.Name))
+	er.Padding = PadNone
+	t.r = io.LimitReader(er, size)
+	return hdr, nil
+}
+
+// Read reads the decrypted content of the current entry.
+func (t *TarReader) Read(p []byte) (int, error) {
+	if t.r == nil {
+		return 0, io.EOF
+	}
+	return t.r.Read(p)
+}
+
+// isTarRegular - whether "hdr" is a regular file. Like archive/tar, this
+// includes the old TypeRegA, the zero value of Typeflag, unless the name ends
+// in a slash.
+func isTarRegular(hdr *tar.Header) bool {
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		return true
+	case tar.TypeRegA:
+		return !strings.HasSuffix(hdr.Name, "/")
+	}
+	return false
+}
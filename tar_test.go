@@ -0,0 +1,95 @@
+package eme
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+)
+
+func TestTar(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"empty":     {},
+		"short.txt": []byte("hello tar"),
+		"big.bin":   bytes.Repeat([]byte("0123456789"), 1000),
+	}
+	names := []string{"empty", "short.txt", "big.bin"}
+	var buf bytes.Buffer
+	tw := NewTarWriter(&buf, bc)
+	tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, name := range names {
+		if err = tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(files[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tw.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("hello tar")) {
+		t.Errorf("file content stored in plaintext")
+	}
+	tr := NewTarReader(&buf, bc)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != "dir/" {
+		t.Fatalf("first entry: %v %v", hdr, err)
+	}
+	for _, name := range names {
+		hdr, err = tr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Name != name || hdr.Size != int64(len(files[name])) {
+			t.Errorf("wrong header %q size %d", hdr.Name, hdr.Size)
+		}
+		got, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, files[name]) {
+			t.Errorf("%s: wrong content", name)
+		}
+	}
+	if _, err = tr.Next(); err != io.EOF {
+		t.Errorf("expected end of archive, got %v", err)
+	}
+}
+
+// A header that leaves Typeflag at zero (TypeRegA) is a regular file too
+func TestTarZeroTypeflag(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret contents of a zero-typeflag entry")
+	var buf bytes.Buffer
+	tw := NewTarWriter(&buf, bc)
+	if err = tw.WriteHeader(&tar.Header{Name: "plain", Mode: 0644, Size: int64(len(secret))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tw.Write(secret); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(buf.Bytes(), secret) {
+		t.Fatalf("file content stored in plaintext")
+	}
+	tr := NewTarReader(&buf, bc)
+	hdr, err := tr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(tr)
+	if err != nil || hdr.Size != int64(len(secret)) || !bytes.Equal(got, secret) {
+		t.Errorf("got %q (size %d), %v", got, hdr.Size, err)
+	}
+}
@@ -3,3 +3,11 @@
 go build
 go test . "$@"
 go tool vet -all -shadow .
+
+# The examples double as integration tests
+go run ./examples/sector
+go run ./examples/filename . > /dev/null
+KEY=$(go run ./cmd/eme keygen)
+head -c 100000 /dev/urandom > /tmp/eme-example-in
+EME_KEY=$KEY go run ./examples/stream < /tmp/eme-example-in | EME_KEY=$KEY go run ./examples/stream -d | cmp - /tmp/eme-example-in
+rm /tmp/eme-example-in
@@ -0,0 +1,221 @@
+// Package tpm loads EME keys sealed in a TPM 2.0 under a PCR policy, for
+// appliances that unlock their disks without a passphrase.
+//
+// It speaks the TPM2 command protocol directly over the resource manager
+// device, so it needs no TPM library. The key only ever lives in byte
+// slices, which are zeroed once the cipher is set up; it is never converted
+// to a string, which could not be wiped.
+//
+// Sealing is left to the provisioning tools: seal a 32-byte key as a keyed
+// hash object with no auth value and a PCR policy, for example with
+// tpm2_create -i key -L policy.digest, and make it persistent. The policy
+// must be a single PolicyPCR over SHA-256 PCR banks.
+package tpm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultDevice is the TPM resource manager device on Linux.
+const DefaultDevice = "/dev/tpmrm0"
+
+// TPM2 constants, from part 2 of the TPM 2.0 library specification
+const (
+	stNoSessions = 0x8001
+	stSessions   = 0x8002
+
+	ccUnseal           = 0x0000015e
+	ccFlushContext     = 0x00000165
+	ccStartAuthSession = 0x00000176
+	ccPolicyPCR        = 0x0000017f
+
+	rhNull    = 0x40000007
+	algNull   = 0x0010
+	algSHA256 = 0x000b
+	sePolicy  = 0x01
+
+	// pcrSelectSize - bytes of the PCR bitmap, for PCRs 0 to 23
+	pcrSelectSize = 3
+	// maxResponse - the largest response read from the TPM
+	maxResponse = 4096
+)
+
+// ResponseError is a TPM command that failed with a response code.
+type ResponseError struct {
+	Command uint32
+	Code    uint32
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("tpm: command 0x%x failed with response code 0x%x", e.Command, e.Code)
+}
+
+// Open opens the TPM device at "path", usually DefaultDevice.
+func Open(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR, 0)
+}
+
+// Unseal returns the data sealed in the object at the persistent handle
+// "handle" (like 0x81000001), satisfying its policy with PolicyPCR over the
+// SHA-256 bank of "pcrs". "rw" is the TPM device, see Open. The caller should
+// zero the result when done with it.
+func Unseal(rw io.ReadWriter, handle uint32, pcrs []int) ([]byte, error) {
+	sel, err := pcrSelection(pcrs)
+	if err != nil {
+		return nil, err
+	}
+	session, err := startPolicySession(rw)
+	if err != nil {
+		return nil, err
+	}
+	data, err := unseal(rw, session, handle, sel)
+	if err != nil {
+		// A successful Unseal consumes the session, a failed one leaves it
+		flushContext(rw, session)
+		return nil, err
+	}
+	return data, nil
+}
+
+// NewCipher returns an AES-256 cipher under the 32-byte key that Unseal
+// returns for "handle" and "pcrs". The unsealed key is zeroed before
+// NewCipher returns.
+func NewCipher(rw io.ReadWriter, handle uint32, pcrs []int) (cipher.Block, error) {
+	key, err := Unseal(rw, handle, pcrs)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	if len(key) != 32 {
+		return nil, fmt.Errorf("tpm: sealed key must be 32 bytes long, is %d", len(key))
+	}
+	return aes.NewCipher(key)
+}
+
+// pcrSelection - the TPML_PCR_SELECTION of "pcrs" in the SHA-256 bank
+func pcrSelection(pcrs []int) ([]byte, error) {
+	if len(pcrs) == 0 {
+		return nil, errors.New("tpm: no PCRs selected")
+	}
+	var bitmap [pcrSelectSize]byte
+	for _, p := range pcrs {
+		if p < 0 || p >= 8*pcrSelectSize {
+			return nil, fmt.Errorf("tpm: PCR %d out of range", p)
+		}
+		bitmap[p/8] |= 1 << (p % 8)
+	}
+	b := binary.BigEndian.AppendUint32(nil, 1)
+	b = binary.BigEndian.AppendUint16(b, algSHA256)
+	b = append(b, pcrSelectSize)
+	return append(b, bitmap[:]...), nil
+}
+
+// startPolicySession - an unsalted, unbound SHA-256 policy session
+func startPolicySession(rw io.ReadWriter) (uint32, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	b := binary.BigEndian.AppendUint32(nil, rhNull) // tpmKey
+	b = binary.BigEndian.AppendUint32(b, rhNull)    // bind
+	b = appendTPM2B(b, nonce)
+	b = appendTPM2B(b, nil) // encryptedSalt
+	b = append(b, sePolicy)
+	b = binary.BigEndian.AppendUint16(b, algNull) // symmetric
+	b = binary.BigEndian.AppendUint16(b, algSHA256)
+	resp, err := run(rw, stNoSessions, ccStartAuthSession, b)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) < 4 {
+		return 0, errors.New("tpm: short StartAuthSession response")
+	}
+	return binary.BigEndian.Uint32(resp), nil
+}
+
+// unseal - PolicyPCR on "session", then Unseal "handle" with it
+func unseal(rw io.ReadWriter, session uint32, handle uint32, sel []byte) ([]byte, error) {
+	b := binary.BigEndian.AppendUint32(nil, session)
+	// An empty pcrDigest makes the TPM use the current PCR values
+	b = appendTPM2B(b, nil)
+	b = append(b, sel...)
+	if _, err := run(rw, stNoSessions, ccPolicyPCR, b); err != nil {
+		return nil, err
+	}
+
+	b = binary.BigEndian.AppendUint32(nil, handle)
+	// Authorization area: the policy session with empty nonce and HMAC,
+	// and continueSession clear
+	auth := binary.BigEndian.AppendUint32(nil, session)
+	auth = appendTPM2B(auth, nil)
+	auth = append(auth, 0)
+	auth = appendTPM2B(auth, nil)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(auth)))
+	b = append(b, auth...)
+	resp, err := run(rw, stSessions, ccUnseal, b)
+	defer clear(resp)
+	if err != nil {
+		return nil, err
+	}
+	// parameterSize, then the TPM2B_SENSITIVE_DATA
+	if len(resp) < 6 {
+		return nil, errors.New("tpm: short Unseal response")
+	}
+	n := int(binary.BigEndian.Uint16(resp[4:6]))
+	if 6+n > len(resp) {
+		return nil, errors.New("tpm: truncated Unseal response")
+	}
+	return append([]byte{}, resp[6:6+n]...), nil
+}
+
+func flushContext(rw io.ReadWriter, handle uint32) error {
+	_, err := run(rw, stNoSessions, ccFlushContext, binary.BigEndian.AppendUint32(nil, handle))
+	return err
+}
+
+// run - send one command and return the response after its header
+func run(rw io.ReadWriter, tag uint16, cc uint32, body []byte) ([]byte, error) {
+	cmd := binary.BigEndian.AppendUint16(nil, tag)
+	cmd = binary.BigEndian.AppendUint32(cmd, uint32(10+len(body)))
+	cmd = binary.BigEndian.AppendUint32(cmd, cc)
+	cmd = append(cmd, body...)
+	if _, err := rw.Write(cmd); err != nil {
+		return nil, fmt.Errorf("tpm: %w", err)
+	}
+	resp := make([]byte, maxResponse)
+	n := 0
+	for n < 10 || n < int(binary.BigEndian.Uint32(resp[2:6])) {
+		k, err := rw.Read(resp[n:])
+		n += k
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			clear(resp)
+			return nil, fmt.Errorf("tpm: %w", err)
+		}
+		if n >= 6 {
+			if size := binary.BigEndian.Uint32(resp[2:6]); size < 10 || size > maxResponse {
+				clear(resp)
+				return nil, fmt.Errorf("tpm: bad response size %d", size)
+			}
+		}
+	}
+	size := int(binary.BigEndian.Uint32(resp[2:6]))
+	if rc := binary.BigEndian.Uint32(resp[6:10]); rc != 0 {
+		return nil, &ResponseError{Command: cc, Code: rc}
+	}
+	return resp[10:size], nil
+}
+
+func appendTPM2B(b []byte, v []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(v)))
+	return append(b, v...)
+}
@@ -0,0 +1,129 @@
+package tpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// fakeTPM - answers the commands Unseal sends, checking their layout
+type fakeTPM struct {
+	t      *testing.T
+	sealed []byte
+	// policyFail - answer Unseal with TPM_RC_POLICY_FAIL
+	policyFail bool
+	commands   []uint32
+	resp       bytes.Buffer
+}
+
+const (
+	testSession = 0x03000000
+	testHandle  = 0x81000001
+)
+
+func (f *fakeTPM) Write(cmd []byte) (int, error) {
+	if len(cmd) < 10 || int(binary.BigEndian.Uint32(cmd[2:6])) != len(cmd) {
+		f.t.Fatalf("bad command header % x", cmd)
+	}
+	tag := binary.BigEndian.Uint16(cmd)
+	cc := binary.BigEndian.Uint32(cmd[6:10])
+	body := cmd[10:]
+	f.commands = append(f.commands, cc)
+	var rc uint32
+	var params []byte
+	switch cc {
+	case ccStartAuthSession:
+		want := []byte{0x40, 0, 0, 7, 0x40, 0, 0, 7, 0, 16}
+		if tag != stNoSessions || !bytes.HasPrefix(body, want) || !bytes.HasSuffix(body, []byte{0, 0, sePolicy, 0, 0x10, 0, 0x0b}) {
+			f.t.Errorf("bad StartAuthSession % x", body)
+		}
+		params = []byte{3, 0, 0, 0, 0, 2, 0xaa, 0xbb}
+	case ccPolicyPCR:
+		// session, empty digest, one SHA-256 selection of PCRs 0 and 7
+		want := []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0x0b, 3, 0x81, 0, 0}
+		if tag != stNoSessions || !bytes.Equal(body, want) {
+			f.t.Errorf("bad PolicyPCR % x", body)
+		}
+	case ccUnseal:
+		want := []byte{0x81, 0, 0, 1, 0, 0, 0, 9, 3, 0, 0, 0, 0, 0, 0, 0, 0}
+		if tag != stSessions || !bytes.Equal(body, want) {
+			f.t.Errorf("bad Unseal % x", body)
+		}
+		if f.policyFail {
+			rc = 0x99d
+			break
+		}
+		params = binary.BigEndian.AppendUint32(nil, uint32(2+len(f.sealed)))
+		params = appendTPM2B(params, f.sealed)
+		params = append(params, 0, 0, 0, 0, 0)
+		tag = stSessions
+	case ccFlushContext:
+		if !bytes.Equal(body, []byte{3, 0, 0, 0}) {
+			f.t.Errorf("bad FlushContext % x", body)
+		}
+	default:
+		f.t.Errorf("unexpected command 0x%x", cc)
+	}
+	if rc != 0 {
+		params = nil
+		tag = stNoSessions
+	}
+	f.resp.Write(binary.BigEndian.AppendUint16(nil, tag))
+	f.resp.Write(binary.BigEndian.AppendUint32(nil, uint32(10+len(params))))
+	f.resp.Write(binary.BigEndian.AppendUint32(nil, rc))
+	f.resp.Write(params)
+	return len(cmd), nil
+}
+
+// Read returns the response in two parts, to exercise partial reads
+func (f *fakeTPM) Read(p []byte) (int, error) {
+	if len(p) > 7 {
+		p = p[:7]
+	}
+	return f.resp.Read(p)
+}
+
+func TestNewCipher(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	f := &fakeTPM{t: t, sealed: key}
+	bc, err := NewCipher(f, testHandle, []int{0, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bc.BlockSize() != 16 {
+		t.Errorf("block size %d", bc.BlockSize())
+	}
+	want := []uint32{ccStartAuthSession, ccPolicyPCR, ccUnseal}
+	if !slices.Equal(f.commands, want) {
+		t.Errorf("commands %x, want %x", f.commands, want)
+	}
+}
+
+func TestUnsealPolicyFail(t *testing.T) {
+	f := &fakeTPM{t: t, policyFail: true}
+	_, err := Unseal(f, testHandle, []int{7, 0})
+	var re *ResponseError
+	if !errors.As(err, &re) || re.Command != ccUnseal || re.Code != 0x99d {
+		t.Errorf("want a ResponseError for Unseal, got %v", err)
+	}
+	want := []uint32{ccStartAuthSession, ccPolicyPCR, ccUnseal, ccFlushContext}
+	if !slices.Equal(f.commands, want) {
+		t.Errorf("commands %x, want %x", f.commands, want)
+	}
+}
+
+func TestNewCipherKeySize(t *testing.T) {
+	if _, err := NewCipher(&fakeTPM{t: t, sealed: make([]byte, 16)}, testHandle, []int{0, 7}); err == nil {
+		t.Errorf("accepted a 16-byte key")
+	}
+}
+
+func TestPCRSelection(t *testing.T) {
+	for _, pcrs := range [][]int{nil, {24}, {-1}} {
+		if _, err := pcrSelection(pcrs); err == nil {
+			t.Errorf("accepted %v", pcrs)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"sync/atomic"
+)
+
+// TransformTrace holds the intermediate values of one EME transformation,
+// named as in the paper. Each slice holds one 16-byte block per input block.
+// L is the first mask: 2*AES(K, 0), or 2*AES(K, T) for TransformXEX.
+//
+// The intermediates are key-dependent and the first ones directly reveal
+// L. They are meant for debugging other implementations
+// against this one and must never be computed for production keys or data.
+type TransformTrace struct {
+	L   []byte
+	PP  [][]byte
+	PPP [][]byte
+	MP  []byte
+	MC  []byte
+	M   []byte
+	CCC [][]byte
+	CC  [][]byte
+	C   [][]byte
+}
+
+// Trace is Transform, but also returns the intermediate values. It is a
+// separate, straightforward implementation of the algorithm that does not
+// share code with Transform, so that comparing both also checks Transform.
+func Trace(bc cipher.Block, tweak []byte, inputData []byte, direction directionConst) ([]byte, *TransformTrace) {
+	if bc.BlockSize() != 16 {
+		paramPanicf(ErrBlockSize, "Using a block size other than 16 is not implemented")
+	}
+	if len(tweak) != 16 {
+		paramPanicf(ErrTweakSize, "Tweak must be 16 bytes long, is %d", len(tweak))
+	}
+	m := len(inputData) / 16
+	if len(inputData)%16 != 0 || m == 0 || m > maxMessageBlocks {
+		paramPanicf(ErrDataSize, "EME operates on 1 to %d block-cipher blocks, you passed %d bytes", maxMessageBlocks, len(inputData))
+	}
+	// L = 2*AES-enc(K; 0), always encryption
+	L := make([]byte, 16)
+	bc.Encrypt(L, L)
+	multByTwo(L, L)
+	return trace(bc, tweak, inputData, direction, L)
+}
+
+// trace - Trace with the first mask "L", of 16 bytes, given by the caller.
+// The parameters must have been checked.
+func trace(bc cipher.Block, tweak []byte, inputData []byte, direction directionConst, L []byte) ([]byte, *TransformTrace) {
+	m := len(inputData) / 16
+	block := func(b []byte, j int) []byte { return append([]byte{}, b[j*16:(j+1)*16]...) }
+	aes := func(in []byte) []byte {
+		out := make([]byte, 16)
+		aesTransform(out, in, direction, bc)
+		return out
+	}
+	xor := func(a []byte, b []byte) []byte {
+		out := make([]byte, 16)
+		xorBlocks(out, a, b)
+		return out
+	}
+	double := func(in []byte) []byte {
+		out := make([]byte, 16)
+		multByTwo(out, in)
+		return out
+	}
+	tr := &TransformTrace{L: append([]byte{}, L...)}
+	zero := make([]byte, 16)
+	Lj := tr.L
+	for j := 0; j < m; j++ {
+		tr.PP = append(tr.PP, xor(block(inputData, j), Lj))
+		tr.PPP = append(tr.PPP, aes(tr.PP[j]))
+		Lj = double(Lj)
+	}
+	tr.MP = xor(tweak, zero)
+	for j := 0; j < m; j++ {
+		tr.MP = xor(tr.MP, tr.PPP[j])
+	}
+	tr.MC = aes(tr.MP)
+	tr.M = xor(tr.MP, tr.MC)
+	tr.CCC = make([][]byte, m)
+	Mj := tr.M
+	CCC1 := xor(tr.MC, tweak)
+	for j := 1; j < m; j++ {
+		Mj = double(Mj)
+		tr.CCC[j] = xor(tr.PPP[j], Mj)
+		CCC1 = xor(CCC1, tr.CCC[j])
+	}
+	tr.CCC[0] = CCC1
+	out := make([]byte, 0, len(inputData))
+	Lj = tr.L
+	for j := 0; j < m; j++ {
+		tr.CC = append(tr.CC, aes(tr.CCC[j]))
+		tr.C = append(tr.C, xor(tr.CC[j], Lj))
+		out = append(out, tr.C[j]...)
+		Lj = double(Lj)
+	}
+	return out, tr
+}
+
+// InsecureTraceHook receives the intermediate values of a transformation,
+// see SetInsecureTraceHook. "tweak" and "tr" are copies the hook may keep.
+type InsecureTraceHook func(tweak []byte, encrypt bool, tr *TransformTrace)
+
+// traceHook - the hook set with SetInsecureTraceHook, or nil
+var traceHook atomic.Pointer[InsecureTraceHook]
+
+// SetInsecureTraceHook makes every EME transformation of this package,
+// including those of PageCipher, the streams and the containers, also run
+// Trace on its input and report the result to "h". A nil "h" removes the
+// hook.
+//
+// INSECURE: the hook sees the plaintext and the key-dependent intermediates
+// of every transformation, under every key in the process. It is
+// meant for byte-level debugging of interop problems with test keys only,
+// without rebuilding the package, and makes every transformation several
+// times slower. Never set it in production.
+func SetInsecureTraceHook(h InsecureTraceHook) {
+	if h == nil {
+		traceHook.Store(nil)
+		return
+	}
+	traceHook.Store(&h)
+}
+
+// runTraceHook - report the transformation of "P" with the masks of
+// "LTable" to the hook, if one is set. Must run before "P" is overwritten.
+func runTraceHook(bc cipher.Block, T []byte, P []byte, direction directionConst, LTable []byte) {
+	h := traceHook.Load()
+	if h == nil {
+		return
+	}
+	_, tr := trace(bc, T, P, direction, LTable[:16])
+	(*h)(append([]byte{}, T...), direction == DirectionEncrypt, tr)
+}
@@ -0,0 +1,84 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestTraceMatchesTransform(t *testing.T) {
+	bc, err := aes.NewCipher(bytes.Repeat([]byte{0x42}, 16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := bytes.Repeat([]byte{9}, 16)
+	for _, n := range []int{16, 32, 512, 2048} {
+		in := make([]byte, n)
+		for i := range in {
+			in[i] = byte(i)
+		}
+		for _, dir := range []directionConst{DirectionEncrypt, DirectionDecrypt} {
+			got, tr := Trace(bc, tweak, in, dir)
+			want := Transform(bc, tweak, in, dir)
+			if !bytes.Equal(got, want) {
+				t.Errorf("%d bytes, direction %v: Trace and Transform differ", n, dir)
+			}
+			if len(tr.PP) != n/16 || len(tr.CCC) != n/16 || len(tr.C) != n/16 {
+				t.Errorf("%d bytes: wrong number of intermediate blocks", n)
+			}
+		}
+	}
+}
+
+func TestInsecureTraceHook(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 16))
+	tweak := bytes.Repeat([]byte{3}, 16)
+	var traces []*TransformTrace
+	SetInsecureTraceHook(func(tw []byte, encrypt bool, tr *TransformTrace) {
+		if !encrypt {
+			t.Errorf("decryption reported")
+		}
+		traces = append(traces, tr)
+	})
+	out := New(bc).Encrypt(tweak, make([]byte, 64))
+	if len(traces) != 1 || !bytes.Equal(bytes.Join(traces[0].C, nil), out) {
+		t.Fatalf("%d traces", len(traces))
+	}
+	NewPageCipher(bc, 4096).EncryptPage(1, make([]byte, 4096))
+	if len(traces) != 3 {
+		t.Errorf("page: %d traces", len(traces)-1)
+	}
+	SetInsecureTraceHook(nil)
+	New(bc).Encrypt(tweak, make([]byte, 64))
+	if len(traces) != 3 {
+		t.Errorf("hook ran after it was removed")
+	}
+}
+
+// TransformXEX must report the masks it actually uses.
+func TestInsecureTraceHookXEX(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 16))
+	tweak := bytes.Repeat([]byte{3}, 16)
+	var traces []*TransformTrace
+	SetInsecureTraceHook(func(tw []byte, encrypt bool, tr *TransformTrace) {
+		traces = append(traces, tr)
+	})
+	defer SetInsecureTraceHook(nil)
+	out := TransformXEX(bc, tweak, make([]byte, 64), DirectionEncrypt)
+	if len(traces) != 1 {
+		t.Fatalf("%d traces", len(traces))
+	}
+	L := make([]byte, 16)
+	bc.Encrypt(L, tweak)
+	multByTwo(L, L)
+	if !bytes.Equal(traces[0].L, L) {
+		t.Errorf("trace has L=%x, want 2*AES(K, T)=%x", traces[0].L, L)
+	}
+	if !bytes.Equal(bytes.Join(traces[0].C, nil), out) {
+		t.Errorf("traced ciphertext differs from TransformXEX")
+	}
+	TransformXEX(bc, tweak, out, DirectionDecrypt)
+	if len(traces) != 2 || !bytes.Equal(bytes.Join(traces[1].C, nil), make([]byte, 64)) {
+		t.Errorf("traced decryption differs from TransformXEX")
+	}
+}
@@ -0,0 +1,55 @@
+package eme
+
+// Tracer starts spans for bulk operations, like a trace.Tracer of
+// OpenTelemetry. The method set is small enough to be implemented by a thin
+// adapter, so no tracing library is imported here. The adapter captures the
+// parent context, for example
+//
+//	type otelTracer struct {
+//		ctx context.Context
+//		t   trace.Tracer
+//	}
+//
+//	func (o otelTracer) StartSpan(name string) eme.Span {
+//		_, s := o.t.Start(o.ctx, name)
+//		return otelSpan{s}
+//	}
+//
+// Operations that accept a Tracer (see ImageOptions, ContainerOptions, Writer
+// and Reader) start one span each, named after the operation, like
+// "eme.EncryptImage".
+type Tracer interface {
+	StartSpan(name string) Span
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute records a size attribute, like "eme.sectors"
+	SetAttribute(key string, value int64)
+	// End ends the span, with the error the operation failed with or nil
+	End(err error)
+}
+
+// Attributes recorded on spans
+const (
+	// AttrSectorSize - the sector size in bytes
+	AttrSectorSize = "eme.sector_size"
+	// AttrSectors - the number of sectors processed
+	AttrSectors = "eme.sectors"
+	// AttrBytes - the number of plaintext bytes processed
+	AttrBytes = "eme.bytes"
+)
+
+// startSpan - a span from "t", or one that does nothing if "t" is nil
+func startSpan(t Tracer, name string) Span {
+	if t == nil {
+		return noSpan{}
+	}
+	return t.StartSpan(name)
+}
+
+type noSpan struct{}
+
+func (noSpan) SetAttribute(string, int64) {}
+
+func (noSpan) End(error) {}
@@ -0,0 +1,94 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recordingTracer - a Tracer that keeps its spans
+type recordingTracer struct {
+	spans []*recordedSpan
+}
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]int64
+	ended bool
+	err   error
+}
+
+func (r *recordingTracer) StartSpan(name string) Span {
+	s := &recordedSpan{name: name, attrs: map[string]int64{}}
+	r.spans = append(r.spans, s)
+	return s
+}
+
+func (s *recordedSpan) SetAttribute(key string, value int64) {
+	s.attrs[key] = value
+}
+
+func (s *recordedSpan) End(err error) {
+	if s.ended {
+		panic("span ended twice")
+	}
+	s.ended, s.err = true, err
+}
+
+func TestTracerImage(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	dir := t.TempDir()
+	img := filepath.Join(dir, "img")
+	os.WriteFile(img, bytes.Repeat([]byte{1}, 8*512), 0600)
+	tr := &recordingTracer{}
+	if err := EncryptImage(img, bc, ImageOptions{Tracer: tr}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImageToContainer(filepath.Join(dir, "c"), img, bc, ContainerOptions{Tracer: tr}); err != nil {
+		t.Fatal(err)
+	}
+	if err := EncryptImage(filepath.Join(dir, "missing"), bc, ImageOptions{Tracer: tr}); err == nil {
+		t.Fatal("missing image was encrypted")
+	}
+	if len(tr.spans) != 3 {
+		t.Fatalf("%d spans", len(tr.spans))
+	}
+	s := tr.spans[0]
+	if s.name != "eme.EncryptImage" || !s.ended || s.err != nil || s.attrs[AttrSectors] != 8 || s.attrs[AttrBytes] != 4096 {
+		t.Errorf("span %+v", s)
+	}
+	if s = tr.spans[1]; s.name != "eme.ImageToContainer" || s.attrs[AttrSectors] != 1 || s.attrs[AttrSectorSize] != 4096 {
+		t.Errorf("span %+v", s)
+	}
+	if s = tr.spans[2]; !s.ended || s.err == nil {
+		t.Errorf("failed operation: span %+v", s)
+	}
+}
+
+func TestTracerStream(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	tweak := make([]byte, 16)
+	tr := &recordingTracer{}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, bc, 512, tweak)
+	w.Tracer = tr
+	w.Write(make([]byte, 1000))
+	w.Close()
+	w.Close()
+	r := NewReader(&buf, bc, 512, tweak)
+	r.Tracer = tr
+	if got, err := io.ReadAll(r); err != nil || len(got) != 1000 {
+		t.Fatalf("read %d bytes, %v", len(got), err)
+	}
+	if len(tr.spans) != 2 {
+		t.Fatalf("%d spans", len(tr.spans))
+	}
+	for _, s := range tr.spans {
+		if !s.ended || s.err != nil || s.attrs[AttrBytes] != 1000 {
+			t.Errorf("span %+v", s)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// TreeOptions control EncryptTree and DecryptTree.
+type TreeOptions struct {
+	// Workers is the number of files processed concurrently. Defaults to
+	// GOMAXPROCS.
+	Workers int
+	// SectorSize is passed to ImageToContainer. Defaults to 4096.
+	SectorSize int
+	// Progress, if set, is called after every file. Calls are serialized.
+	Progress func(TreeProgress)
+	// DirIVs manages the filename IVs of the encrypted directories.
+	// Defaults to a new FileDirIVStore.
+	DirIVs DirIVStore
+}
+
+func (o TreeOptions) dirIVs() DirIVStore {
+	if o.DirIVs == nil {
+		return NewFileDirIVStore()
+	}
+	return o.DirIVs
+}
+
+// TreeProgress reports how far EncryptTree or DecryptTree got.
+type TreeProgress struct {
+	// Path is the plaintext path, relative to the tree root, of the file
+	// that was just finished
+	Path       string
+	Files      int
+	TotalFiles int
+	// Bytes and TotalBytes count the size of the input files
+	Bytes      int64
+	TotalBytes int64
+}
+
+// maxNameLen - longest file name most filesystems accept
+const maxNameLen = 255
+
+// treeJob - one file to convert
+type treeJob struct {
+	rel  string
+	src  string
+	dst  string
+	size int64
+}
+
+// EncryptTree encrypts the directory tree "srcDir" into "dstDir", which is
+// created if needed. Every file becomes an encrypted container (see
+// ImageToContainer) and every file and directory name is encrypted with
+// EMECipher.EncryptFilename, using the random IV of the encrypted directory
+// that contains it (see TreeOptions.DirIVs). Only regular files and
+// directories are supported.
+func EncryptTree(srcDir string, dstDir string, bc cipher.Block, opts TreeOptions) error {
+	e := New(bc)
+	ivs := opts.dirIVs()
+	var jobs []treeJob
+	encPath := map[string]string{".": dstDir}
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			if err = os.MkdirAll(dstDir, 0700); err != nil {
+				return err
+			}
+			if _, err = ivs.LoadDirIV(dstDir); os.IsNotExist(err) {
+				_, err = ivs.CreateDirIV(dstDir)
+			}
+			return err
+		}
+		parent := filepath.Dir(rel)
+		iv, err := ivs.LoadDirIV(encPath[parent])
+		if err != nil {
+			return err
+		}
+		name, err := e.EncryptFilename(iv, d.Name())
+		if err != nil {
+			return err
+		}
+		if len(name) > maxNameLen {
+			return fmt.Errorf("%q: encrypted name is too long (%d bytes)", rel, len(name))
+		}
+		dst := filepath.Join(encPath[parent], name)
+		switch {
+		case d.IsDir():
+			encPath[rel] = dst
+			if err = os.Mkdir(dst, 0700); err != nil {
+				return err
+			}
+			_, err = ivs.CreateDirIV(dst)
+			return err
+		case d.Type().IsRegular():
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, treeJob{rel: rel, src: path, dst: dst, size: fi.Size()})
+			return nil
+		default:
+			return fmt.Errorf("%q: unsupported file type %v", rel, d.Type())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return runTreeJobs(jobs, opts, func(j treeJob) error {
+		return ImageToContainer(j.dst, j.src, bc, ContainerOptions{SectorSize: opts.SectorSize})
+	})
+}
+
+// DecryptTree reverses EncryptTree.
+func DecryptTree(srcDir string, dstDir string, bc cipher.Block, opts TreeOptions) error {
+	e := New(bc)
+	ivs := opts.dirIVs()
+	var jobs []treeJob
+	plainPath := map[string]string{".": "."}
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return os.MkdirAll(dstDir, 0700)
+		}
+		if d.Name() == DirIVFileName {
+			return nil
+		}
+		iv, err := ivs.LoadDirIV(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		parent := plainPath[filepath.Dir(rel)]
+		name, err := e.DecryptFilename(iv, d.Name())
+		if err != nil {
+			return err
+		}
+		plain := filepath.Join(parent, name)
+		dst := filepath.Join(dstDir, plain)
+		switch {
+		case d.IsDir():
+			plainPath[rel] = plain
+			return os.Mkdir(dst, 0700)
+		case d.Type().IsRegular():
+			fi, err := d.Info()
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, treeJob{rel: plain, src: path, dst: dst, size: fi.Size()})
+			return nil
+		default:
+			return fmt.Errorf("%q: unsupported file type %v", rel, d.Type())
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return runTreeJobs(jobs, opts, func(j treeJob) error {
+		return ContainerToImage(j.dst, j.src, bc)
+	})
+}
+
+// runTreeJobs - run "fn" on all jobs with opts.Workers goroutines, stopping
+// at the first error
+func runTreeJobs(jobs []treeJob, opts TreeOptions, fn func(treeJob) error) error {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	p := TreeProgress{TotalFiles: len(jobs)}
+	for _, j := range jobs {
+		p.TotalBytes += j.size
+	}
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	ch := make(chan treeJob)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range ch {
+				err := fn(j)
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("%q: %w", j.rel, err)
+					}
+				} else {
+					p.Path = j.rel
+					p.Files++
+					p.Bytes += j.size
+					if opts.Progress != nil {
+						opts.Progress(p)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, j := range jobs {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		ch <- j
+	}
+	close(ch)
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,64 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	files := map[string][]byte{
+		"a.txt":          []byte("hello"),
+		"sub/b.txt":      bytes.Repeat([]byte("b"), 10000),
+		"sub/deep/a.txt": {},
+		"other/a.txt":    []byte("same name, other dir"),
+	}
+	for rel, data := range files {
+		p := filepath.Join(src, rel)
+		os.MkdirAll(filepath.Dir(p), 0700)
+		if err = os.WriteFile(p, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	enc := filepath.Join(dir, "enc")
+	var last TreeProgress
+	calls := 0
+	opts := TreeOptions{Workers: 2, Progress: func(p TreeProgress) {
+		calls++
+		last = p
+	}}
+	if err = EncryptTree(src, enc, bc, opts); err != nil {
+		t.Fatal(err)
+	}
+	if calls != len(files) || last.Files != len(files) || last.Bytes != last.TotalBytes {
+		t.Errorf("progress: %d calls, last %+v", calls, last)
+	}
+	filepath.WalkDir(enc, func(path string, d os.DirEntry, err error) error {
+		if strings.Contains(path, "a.txt") || strings.Contains(path, "sub") {
+			t.Errorf("plaintext name visible: %q", path)
+		}
+		return nil
+	})
+	dec := filepath.Join(dir, "dec")
+	if err = DecryptTree(enc, dec, bc, TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for rel, data := range files {
+		got, err := os.ReadFile(filepath.Join(dec, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("%q differs", rel)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrUsageLimit is the error of a UsageLimitError when UsagePolicy.OnLimit is
+// not set.
+var ErrUsageLimit = errors.New("eme: key usage limit exceeded")
+
+// KeyUsage is what an EMECipher has transformed under its key.
+type KeyUsage struct {
+	// Bytes is the total length of the data
+	Bytes uint64
+	// Ops is the number of Encrypt and Decrypt calls
+	Ops uint64
+}
+
+// UsagePolicy limits the use of a key, for compliance regimes that require
+// rekeying after a number of bytes or operations. See NewWithUsagePolicy.
+type UsagePolicy struct {
+	// MaxBytes is the most data the key may transform, or 0 for no limit
+	MaxBytes uint64
+	// MaxOps is the most operations the key may perform, or 0 for no limit
+	MaxOps uint64
+	// OnLimit, if set, is called once, before the operation that would
+	// exceed a limit, with the usage including that operation. If it returns
+	// nil, the operation and all later ones proceed, so that the application
+	// can schedule a rekey instead of failing. If it is not set or returns an
+	// error, the key is refused from then on.
+	OnLimit func(KeyUsage) error
+}
+
+// UsageLimitError is the panic value of EMECipher.Encrypt and Decrypt when
+// the UsagePolicy refuses the key. Encrypt and Decrypt have no way to return
+// errors, so callers that set a policy without an accepting OnLimit must
+// recover it, or check Usage before every call.
+type UsageLimitError struct {
+	// Usage is the usage the refused operation would have resulted in
+	Usage KeyUsage
+	// Err is the error returned by OnLimit, or ErrUsageLimit
+	Err error
+}
+
+func (e *UsageLimitError) Error() string {
+	return fmt.Sprintf("%v after %d bytes in %d operations", e.Err, e.Usage.Bytes, e.Usage.Ops)
+}
+
+func (e *UsageLimitError) Unwrap() error {
+	return e.Err
+}
+
+// usageCounter - the counters and policy state of an EMECipher
+type usageCounter struct {
+	policy UsagePolicy
+	bytes  atomic.Uint64
+	ops    atomic.Uint64
+
+	// once - guards the single OnLimit call
+	once    sync.Once
+	refused error
+}
+
+// NewWithUsagePolicy returns an EMECipher like New that counts its usage
+// (see EMECipher.Usage) and enforces "p". Counting costs two atomic adds per
+// operation; New does not count.
+func NewWithUsagePolicy(bc cipher.Block, p UsagePolicy) *EMECipher {
+	e := New(bc)
+	e.usage = &usageCounter{policy: p}
+	return e
+}
+
+// Usage returns what the cipher has transformed so far. It is zero for
+// ciphers from New.
+func (e *EMECipher) Usage() KeyUsage {
+	if e.usage == nil {
+		return KeyUsage{}
+	}
+	return KeyUsage{Bytes: e.usage.bytes.Load(), Ops: e.usage.ops.Load()}
+}
+
+// count - account for an operation on "n" bytes, or panic with a
+// *UsageLimitError if the policy refuses it
+func (u *usageCounter) count(n int) {
+	got := KeyUsage{Bytes: u.bytes.Add(uint64(n)), Ops: u.ops.Add(1)}
+	p := &u.policy
+	if (p.MaxBytes == 0 || got.Bytes <= p.MaxBytes) && (p.MaxOps == 0 || got.Ops <= p.MaxOps) {
+		return
+	}
+	u.once.Do(func() {
+		u.refused = ErrUsageLimit
+		if p.OnLimit != nil {
+			u.refused = p.OnLimit(got)
+		}
+	})
+	if u.refused != nil {
+		// Refused operations do not count
+		u.bytes.Add(^uint64(n - 1))
+		u.ops.Add(^uint64(0))
+		panic(&UsageLimitError{Usage: got, Err: u.refused})
+	}
+}
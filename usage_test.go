@@ -0,0 +1,56 @@
+package eme
+
+import (
+	"crypto/aes"
+	"errors"
+	"testing"
+)
+
+// usagePanic - the *UsageLimitError "f" panics with, or nil
+func usagePanic(f func()) (err *UsageLimitError) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = r.(*UsageLimitError)
+		}
+	}()
+	f()
+	return nil
+}
+
+func TestUsagePolicy(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	tweak := make([]byte, 16)
+	data := make([]byte, 64)
+
+	e := NewWithUsagePolicy(bc, UsagePolicy{MaxBytes: 128})
+	e.Encrypt(tweak, data)
+	e.Decrypt(tweak, data)
+	if u := e.Usage(); u.Bytes != 128 || u.Ops != 2 {
+		t.Errorf("usage %+v", u)
+	}
+	err := usagePanic(func() { e.Encrypt(tweak, data) })
+	if err == nil || !errors.Is(err, ErrUsageLimit) || err.Usage.Bytes != 192 {
+		t.Fatalf("limit not enforced: %v", err)
+	}
+	if u := e.Usage(); u.Bytes != 128 || u.Ops != 2 {
+		t.Errorf("refused operation was counted: %+v", u)
+	}
+
+	calls := 0
+	e = NewWithUsagePolicy(bc, UsagePolicy{MaxOps: 1, OnLimit: func(u KeyUsage) error {
+		calls++
+		return nil
+	}})
+	for i := 0; i < 3; i++ {
+		if err = usagePanic(func() { e.Encrypt(tweak, data) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 || e.Usage().Ops != 3 {
+		t.Errorf("OnLimit called %d times, usage %+v", calls, e.Usage())
+	}
+
+	if u := New(bc).Usage(); u != (KeyUsage{}) {
+		t.Errorf("New counts usage: %+v", u)
+	}
+}
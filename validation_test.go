@@ -0,0 +1,105 @@
+package eme_test
+
+import (
+	"crypto/aes"
+	"crypto/des"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/rfjakob/eme"
+	"github.com/rfjakob/eme/emetest"
+)
+
+// TestParamErrors locks in which kind of ParamError every invalid parameter
+// produces, including the order of the checks when several are invalid.
+func TestParamErrors(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc8, err := des.NewCipher(make([]byte, 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := func(n int) []byte { return make([]byte, n) }
+	enc := eme.DirectionEncrypt
+	pc := eme.NewPageCipher(bc, 4096)
+	cases := []struct {
+		name string
+		want error
+		f    func()
+	}{
+		{"Transform block size", eme.ErrBlockSize, func() { eme.Transform(bc8, b(16), b(16), enc) }},
+		{"Transform block size before tweak", eme.ErrBlockSize, func() { eme.Transform(bc8, b(1), b(1), enc) }},
+		{"Transform empty tweak", eme.ErrTweakSize, func() { eme.Transform(bc, b(0), b(16), enc) }},
+		{"Transform short tweak", eme.ErrTweakSize, func() { eme.Transform(bc, b(15), b(16), enc) }},
+		{"Transform long tweak", eme.ErrTweakSize, func() { eme.Transform(bc, b(17), b(16), enc) }},
+		{"Transform tweak before data", eme.ErrTweakSize, func() { eme.Transform(bc, b(15), b(15), enc) }},
+		{"Transform empty data", eme.ErrDataSize, func() { eme.Transform(bc, b(16), b(0), enc) }},
+		{"Transform partial block", eme.ErrDataSize, func() { eme.Transform(bc, b(16), b(17), enc) }},
+		{"Transform 129 blocks", eme.ErrDataSize, func() { eme.Transform(bc, b(16), b(2064), enc) }},
+		{"Encrypt", eme.ErrDataSize, func() { eme.New(bc).Encrypt(b(16), b(8)) }},
+		{"Decrypt", eme.ErrTweakSize, func() { eme.New(bc).Decrypt(b(8), b(16)) }},
+		{"Trace block size", eme.ErrBlockSize, func() { eme.Trace(bc8, b(16), b(16), enc) }},
+		{"Trace tweak", eme.ErrTweakSize, func() { eme.Trace(bc, b(15), b(16), enc) }},
+		{"Trace data", eme.ErrDataSize, func() { eme.Trace(bc, b(16), b(2064), enc) }},
+		{"NewPageCipher block size", eme.ErrBlockSize, func() { eme.NewPageCipher(bc8, 512) }},
+		{"NewPageCipher zero", eme.ErrPageSize, func() { eme.NewPageCipher(bc, 0) }},
+		{"NewPageCipher negative", eme.ErrPageSize, func() { eme.NewPageCipher(bc, -16) }},
+		{"NewPageCipher partial block", eme.ErrPageSize, func() { eme.NewPageCipher(bc, 520) }},
+		{"NewPageCipher not a segment multiple", eme.ErrPageSize, func() { eme.NewPageCipher(bc, 3072) }},
+		{"EncryptPage short", eme.ErrDataSize, func() { pc.EncryptPage(0, b(4080)) }},
+		{"DecryptPage long", eme.ErrDataSize, func() { pc.DecryptPage(0, b(4112)) }},
+		{"NewWriter tweak", eme.ErrTweakSize, func() { eme.NewWriter(io.Discard, bc, 4096, b(15)) }},
+		{"NewWriter sector size", eme.ErrPageSize, func() { eme.NewWriter(io.Discard, bc, 100, b(16)) }},
+		{"NewWriter block size", eme.ErrBlockSize, func() { eme.NewWriter(io.Discard, bc8, 4096, b(16)) }},
+		{"NewReader tweak", eme.ErrTweakSize, func() { eme.NewReader(nil, bc, 4096, b(0)) }},
+		{"NewReader sector size", eme.ErrPageSize, func() { eme.NewReader(nil, bc, 3000, b(16)) }},
+		{"NewConn send tweak", eme.ErrTweakSize, func() { eme.NewConn(nil, bc, b(15), b(16)) }},
+		{"NewConn receive tweak", eme.ErrTweakSize, func() { eme.NewConn(nil, bc, b(16), b(17)) }},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			emetest.ExpectParamError(t, c.want, c.f)
+		})
+	}
+}
+
+func TestSafeTransform(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	tweak := make([]byte, 16)
+	out, err := eme.SafeTransform(bc, tweak, make([]byte, 32), eme.DirectionEncrypt)
+	if err != nil || len(out) != 32 {
+		t.Fatalf("valid call: %d bytes, %v", len(out), err)
+	}
+	var pe *eme.ParamError
+	out, err = eme.SafeTransform(bc, tweak[:8], make([]byte, 32), eme.DirectionEncrypt)
+	if !errors.As(err, &pe) || !errors.Is(err, eme.ErrTweakSize) || out != nil {
+		t.Errorf("short tweak: %v", err)
+	}
+	if _, err = eme.SafeTransform(bc, tweak, make([]byte, 17), eme.DirectionDecrypt); !errors.Is(err, eme.ErrDataSize) {
+		t.Errorf("odd length: %v", err)
+	}
+}
+
+// bugBlock - a block cipher with a bug
+type bugBlock struct{}
+
+func (bugBlock) BlockSize() int { return 16 }
+func (bugBlock) Encrypt(dst, src []byte) {
+	var p *[16]byte
+	copy(dst, p[:])
+}
+func (bugBlock) Decrypt(dst, src []byte) {}
+
+// Runtime errors are bugs, not errors to return
+func TestSafeTransformRuntimeError(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(runtime.Error); !ok {
+			t.Errorf("runtime error was not passed on")
+		}
+	}()
+	eme.SafeTransform(bugBlock{}, make([]byte, 16), make([]byte, 32), eme.DirectionEncrypt)
+}
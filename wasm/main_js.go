@@ -0,0 +1,55 @@
+//go:build js && wasm
+
+// Command wasm exposes package eme to JavaScript. Build it with
+//
+//	GOOS=js GOARCH=wasm go build -o eme.wasm ./wasm
+//
+// and load it with the wasm_exec.js of the same Go release. It defines the
+// global object "eme" with
+//
+//	eme.encrypt(key, tweak, data)
+//	eme.decrypt(key, tweak, data)
+//
+// All arguments and the result are Uint8Arrays. On invalid arguments the
+// result is an Error object instead.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+func main() {
+	js.Global().Set("eme", js.ValueOf(map[string]any{
+		"encrypt": js.FuncOf(func(this js.Value, args []js.Value) any { return call(args, true) }),
+		"decrypt": js.FuncOf(func(this js.Value, args []js.Value) any { return call(args, false) }),
+	}))
+	// Keep the functions alive
+	select {}
+}
+
+// call - run transform on the Uint8Array arguments
+func call(args []js.Value, encrypt bool) any {
+	if len(args) != 3 {
+		return jsError("want 3 arguments (key, tweak, data), got %d", len(args))
+	}
+	var in [3][]byte
+	for i, a := range args {
+		if !a.InstanceOf(js.Global().Get("Uint8Array")) {
+			return jsError("argument %d is not a Uint8Array", i+1)
+		}
+		in[i] = make([]byte, a.Get("length").Int())
+		js.CopyBytesToGo(in[i], a)
+	}
+	out, err := transform(in[0], in[1], in[2], encrypt)
+	if err != nil {
+		return jsError("%v", err)
+	}
+	res := js.Global().Get("Uint8Array").New(len(out))
+	js.CopyBytesToJS(res, out)
+	return res
+}
+
+func jsError(format string, a ...any) js.Value {
+	return js.Global().Get("Error").New(fmt.Sprintf("eme: "+format, a...))
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/aes"
+	"fmt"
+
+	"github.com/rfjakob/eme"
+)
+
+// transform - the work behind eme.encrypt and eme.decrypt. Validates
+// everything, because a panic would stop the Go program for good.
+func transform(key []byte, tweak []byte, data []byte, encrypt bool) ([]byte, error) {
+	bc, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(tweak) != 16 {
+		return nil, fmt.Errorf("tweak must be 16 bytes long, is %d", len(tweak))
+	}
+	if len(data) == 0 || len(data)%16 != 0 || len(data) > 2048 {
+		return nil, fmt.Errorf("data must be a multiple of 16 bytes from 16 to 2048, is %d", len(data))
+	}
+	dir := eme.DirectionEncrypt
+	if !encrypt {
+		dir = eme.DirectionDecrypt
+	}
+	return eme.Transform(bc, tweak, data, dir), nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rfjakob/eme/emevectors"
+)
+
+func TestTransform(t *testing.T) {
+	for _, v := range emevectors.All {
+		if v.Iterations != 1 {
+			continue
+		}
+		out, err := transform(v.Key, v.Tweak, v.In, !v.Decrypt)
+		if err != nil || !bytes.Equal(out, v.Out) {
+			t.Errorf("vector %s: %v", v.Name, err)
+		}
+	}
+	key := make([]byte, 32)
+	for _, c := range []struct{ key, tweak, data []byte }{
+		{key[:7], key[:16], key[:16]},
+		{key, key[:15], key[:16]},
+		{key, key[:16], key[:0]},
+		{key, key[:16], key[:17]},
+	} {
+		if _, err := transform(c.key, c.tweak, c.data, true); err == nil {
+			t.Errorf("accepted %d byte key, %d byte tweak, %d bytes", len(c.key), len(c.tweak), len(c.data))
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package eme
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Padding selects how Writer handles a final sector that is shorter than
+// the sector size.
+type Padding int
+
+const (
+	// PadPKCS7 appends 1 to 16 bytes of PKCS#7 padding, so the final
+	// sector becomes a multiple of 16 bytes. Works for every stream length
+	// and expands it by up to 16 bytes. This is the default.
+	PadPKCS7 Padding = iota
+	// PadNone adds nothing. The stream length must be a multiple of 16.
+	PadNone
+	// PadCTS uses ciphertext stealing: the final sector borrows the bytes it
+	// is missing from the end of the encrypted previous sector. The output
+	// has exactly the length of the input, but the stream must be at least
+	// one sector long unless its length is a multiple of 16.
+	PadCTS
+)
+
+// BurstSize is how much data a Writer in burst mode stages before it
+// encrypts and writes it, see Writer.Burst.
+const BurstSize = 1 << 20
+
+// errClosed - returned after Close
+var errClosed = errors.New("eme: use of closed stream")
+
+// Writer encrypts everything written to it in sectors and writes the
+// ciphertext to an underlying io.Writer. Sector "n" is encrypted like a
+// PageCipher page "n" whose tweaks are additionally XORed with the base
+// tweak, so a stream written from offset 0 can also be decrypted sector by
+// sector with random access. The final, short sector is handled according to
+// Padding.
+type Writer struct {
+	// Padding must be set before the first Write.
+	Padding Padding
+	// Tracer, if set before the first Write, gets a span from the first
+	// Write to Close.
+	Tracer Tracer
+	// Burst, if set before the first Write, makes the Writer stage BurstSize
+	// bytes of sectors, encrypt them on all CPUs (see PageCipher.SetParallel)
+	// and pass them to the underlying writer in one Write. This is for
+	// writing to fast storage, where per-sector writes and encryption on a
+	// single core are the bottleneck. The output is the same.
+	Burst bool
+
+	w    io.Writer
+	bc   cipher.Block
+	pc   *PageCipher
+	salt []byte
+	// buf - plaintext of sector "n", being filled, or of the sectors from
+	// "n" on in burst mode
+	buf []byte
+	n   uint64
+	// pend - with PadCTS, the encrypted previous sector, held back until it
+	// is known whether the final sector needs to steal from it
+	pend []byte
+	// stage - in burst mode, one sector for "pend" followed by the memory of
+	// "buf", so that both can be written in one go
+	stage []byte
+	err   error
+	span  Span
+}
+
+// NewWriter returns a Writer that encrypts to "w" with block cipher "bc" in
+// sectors of "sectorSize" bytes (see NewPageCipher), using the 16-byte
+// "baseTweak". Close must be called to write the final sector.
+func NewWriter(w io.Writer, bc cipher.Block, sectorSize int, baseTweak []byte) *Writer {
+	if len(baseTweak) != 16 {
+		paramPanicf(ErrTweakSize, "Tweak must be 16 bytes long, is %d", len(baseTweak))
+	}
+	pc := NewPageCipher(bc, sectorSize)
+	copy(pc.salt[:], baseTweak)
+	return &Writer{
+		w:    w,
+		bc:   bc,
+		pc:   pc,
+		salt: append([]byte{}, baseTweak...),
+		buf:  make([]byte, 0, sectorSize),
+	}
+}
+
+// Write encrypts "p". Full sectors are written out as soon as they are
+// complete. Write does not allocate.
+func (sw *Writer) Write(p []byte) (int, error) {
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	if sw.span == nil {
+		sw.span = startSpan(sw.Tracer, "eme.Writer")
+		if sw.Burst {
+			ss := sw.pc.pageSize
+			sw.stage = make([]byte, ss+max(BurstSize/ss, 1)*ss)
+			sw.buf = sw.stage[ss:ss]
+			sw.pc.SetParallel(ParallelAuto)
+		}
+	}
+	written := 0
+	for len(p) > 0 {
+		k := copy(sw.buf[len(sw.buf):cap(sw.buf)], p)
+		sw.buf = sw.buf[:len(sw.buf)+k]
+		p = p[k:]
+		written += k
+		if len(sw.buf) == cap(sw.buf) {
+			if sw.err = sw.flushSectors(); sw.err != nil {
+				return written, sw.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flushSectors - encrypt and write the full sectors in "buf", and move the
+// rest to its start
+func (sw *Writer) flushSectors() error {
+	ss := sw.pc.pageSize
+	full := len(sw.buf) / ss * ss
+	if full == 0 {
+		return nil
+	}
+	data := sw.buf[:full]
+	sw.pc.EncryptSectorRange(sw.n, data)
+	sw.n += uint64(full / ss)
+	var last []byte
+	if sw.Padding == PadCTS {
+		// Hold back the last sector, and write the one held back before
+		last = data[full-ss:]
+		data = data[:full-ss]
+		if sw.pend != nil {
+			if sw.stage != nil {
+				// "pend" is right in front of "data"
+				data = sw.stage[:full]
+			} else if _, err := sw.w.Write(sw.pend); err != nil {
+				return err
+			}
+		}
+	}
+	if len(data) > 0 {
+		if _, err := sw.w.Write(data); err != nil {
+			return err
+		}
+	}
+	if last != nil {
+		if sw.stage != nil {
+			sw.pend = sw.stage[:ss]
+		} else if sw.pend == nil {
+			sw.pend = make([]byte, ss)
+		}
+		copy(sw.pend, last)
+	}
+	sw.buf = sw.buf[:copy(sw.buf, sw.buf[full:])]
+	return nil
+}
+
+// Flush zero-pads the current sector to the full sector size and writes it,
+// so that everything written so far can be decrypted from the output. The
+// zeros become part of the plaintext: records written between flushes must
+// be self-delimiting, and the next Write starts on a sector boundary. If the
+// underlying writer has a Flush method, it is called too.
+//
+// Flush does not work with PadCTS, which must hold back the last sector
+// until Close.
+func (sw *Writer) Flush() error {
+	if sw.err != nil {
+		return sw.err
+	}
+	if sw.Padding == PadCTS {
+		return errors.New("eme: Flush is not supported with ciphertext stealing")
+	}
+	if len(sw.buf) > 0 {
+		n := len(sw.buf)
+		ss := sw.pc.pageSize
+		sw.buf = sw.buf[:(n+ss-1)/ss*ss]
+		clear(sw.buf[n:])
+		if sw.err = sw.flushSectors(); sw.err != nil {
+			return sw.err
+		}
+	}
+	if f, ok := sw.w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close writes the final sector. It does not close the underlying writer.
+func (sw *Writer) Close() error {
+	if sw.err == errClosed {
+		return nil
+	}
+	if sw.span == nil {
+		sw.span = startSpan(sw.Tracer, "eme.Writer")
+	}
+	ss := int64(sw.pc.pageSize)
+	sw.span.SetAttribute(AttrSectorSize, ss)
+	sw.span.SetAttribute(AttrBytes, int64(sw.n)*ss+int64(len(sw.buf)))
+	if sw.err == nil {
+		// In burst mode, "buf" can still hold full sectors
+		sw.err = sw.flushSectors()
+	}
+	if sw.err == nil {
+		sw.err = sw.finish()
+	}
+	sw.span.End(sw.err)
+	sw.span = noSpan{}
+	if sw.err != nil {
+		return sw.err
+	}
+	sw.err = errClosed
+	return nil
+}
+
+func (sw *Writer) finish() error {
+	tail := sw.buf
+	switch sw.Padding {
+	case PadPKCS7:
+		tail = pad16(tail)
+	case PadNone:
+		if len(tail)%16 != 0 {
+			return fmt.Errorf("stream length is not a multiple of 16 and padding is disabled")
+		}
+	case PadCTS:
+		return sw.finishCTS()
+	default:
+		return fmt.Errorf("unknown padding %d", sw.Padding)
+	}
+	if len(tail) == 0 {
+		return nil
+	}
+	transformChunk(sw.bc, sw.salt, sw.n, tail, DirectionEncrypt)
+	_, err := sw.w.Write(tail)
+	return err
+}
+
+// finishCTS - the final sector takes the bytes it needs to reach a multiple
+// of 16 from the end of the previous ciphertext sector
+func (sw *Writer) finishCTS() error {
+	tail := sw.buf
+	steal := padLen16(len(tail))
+	if steal > 0 && sw.pend == nil {
+		return fmt.Errorf("ciphertext stealing needs at least one full sector, stream is %d bytes", len(tail))
+	}
+	if sw.pend != nil {
+		keep := len(sw.pend) - steal
+		tail = append(tail, sw.pend[keep:]...)
+		if _, err := sw.w.Write(sw.pend[:keep]); err != nil {
+			return err
+		}
+	}
+	if len(tail) == 0 {
+		return nil
+	}
+	transformChunk(sw.bc, sw.salt, sw.n, tail, DirectionEncrypt)
+	_, err := sw.w.Write(tail)
+	return err
+}
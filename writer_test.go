@@ -0,0 +1,155 @@
+package eme
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+)
+
+func TestWriterLengths(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := bytes.Repeat([]byte{7}, 16)
+	for _, size := range []int{0, 1, 16, 511, 512, 513, 1500} {
+		plain := make([]byte, size)
+		for _, c := range []struct {
+			padding Padding
+			want    int
+		}{
+			{PadPKCS7, size + 16 - size%16},
+			{PadNone, size},
+			{PadCTS, size},
+		} {
+			var out bytes.Buffer
+			w := NewWriter(&out, bc, 512, tweak)
+			w.Padding = c.padding
+			// Write in odd-sized pieces
+			for p := plain; len(p) > 0; {
+				k := 100
+				if k > len(p) {
+					k = len(p)
+				}
+				w.Write(p[:k])
+				p = p[k:]
+			}
+			err := w.Close()
+			invalid := (c.padding == PadNone && size%16 != 0) || (c.padding == PadCTS && size < 512 && size%16 != 0)
+			if invalid {
+				if err == nil {
+					t.Errorf("size %d padding %d: expected an error", size, c.padding)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("size %d padding %d: %v", size, c.padding, err)
+				continue
+			}
+			if out.Len() != c.want {
+				t.Errorf("size %d padding %d: got %d bytes, want %d", size, c.padding, out.Len(), c.want)
+			}
+			// Full sectors that are not involved in padding match PageCipher
+			if size > 1024 {
+				pc := NewPageCipher(bc, 512)
+				copy(pc.salt[:], tweak)
+				sec := append([]byte{}, plain[:512]...)
+				pc.EncryptPage(0, sec)
+				if !bytes.Equal(out.Bytes()[:512], sec) {
+					t.Errorf("size %d padding %d: sector 0 differs from PageCipher", size, c.padding)
+				}
+			}
+		}
+	}
+}
+
+func TestWriterFlush(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := make([]byte, 16)
+	var enc bytes.Buffer
+	out := bufio.NewWriter(&enc)
+	w := NewWriter(out, bc, 512, tweak)
+	w.Write([]byte("first record"))
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if enc.Len() != 512 {
+		t.Fatalf("flushed %d bytes, want one sector", enc.Len())
+	}
+	w.Write([]byte("second record"))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Flush()
+	got, err := io.ReadAll(NewReader(&enc, bc, 512, tweak))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte("first record"), make([]byte, 500)...), "second record"...)
+	if !bytes.Equal(got, want) {
+		t.Errorf("wrong plaintext %q", got)
+	}
+	w = NewWriter(&enc, bc, 512, tweak)
+	w.Padding = PadCTS
+	if w.Flush() == nil {
+		t.Errorf("Flush with PadCTS succeeded")
+	}
+}
+
+// countingWriter - counts the Write calls it gets
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.Buffer.Write(p)
+}
+
+// Burst mode must give the same output as the default, in fewer writes.
+func TestWriterBurst(t *testing.T) {
+	bc, err := aes.NewCipher(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := bytes.Repeat([]byte{3}, 16)
+	plain := make([]byte, 3*BurstSize+5000)
+	for i := range plain {
+		plain[i] = byte(i * 13)
+	}
+	for _, size := range []int{0, 100, 4096, BurstSize, BurstSize + 4096, len(plain)} {
+		for _, padding := range []Padding{PadPKCS7, PadNone, PadCTS} {
+			var want bytes.Buffer
+			w := NewWriter(&want, bc, 4096, tweak)
+			w.Padding = padding
+			w.Write(plain[:size])
+			wantErr := w.Close()
+
+			var got countingWriter
+			w = NewWriter(&got, bc, 4096, tweak)
+			w.Padding = padding
+			w.Burst = true
+			for p := plain[:size]; len(p) > 0; {
+				k := min(len(p), 70000)
+				w.Write(p[:k])
+				p = p[k:]
+			}
+			gotErr := w.Close()
+			if (gotErr == nil) != (wantErr == nil) {
+				t.Fatalf("size %d padding %d: error %v, want %v", size, padding, gotErr, wantErr)
+			}
+			if !bytes.Equal(got.Bytes(), want.Bytes()) {
+				t.Fatalf("size %d padding %d: output differs", size, padding)
+			}
+			if max := size/BurstSize + 3; got.writes > max {
+				t.Errorf("size %d padding %d: %d writes, want at most %d", size, padding, got.writes, max)
+			}
+		}
+	}
+}
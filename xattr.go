@@ -0,0 +1,62 @@
+package eme
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// xattrName is the extended attribute that holds the FileParams
+const xattrName = "user.eme.params"
+
+// ErrXattrUnsupported is returned by SaveFileParams and LoadFileParams on
+// platforms where this package cannot access extended attributes.
+var ErrXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// FileParams are the per-file encryption parameters that a file-encryption
+// tool needs to decrypt a file later. They are stored next to the data in an
+// extended attribute, so they travel with the file on copies that preserve
+// xattrs.
+type FileParams struct {
+	// KeyID identifies the key the file is encrypted with. It must not be
+	// the key itself.
+	KeyID string `json:"key_id"`
+	// SectorSize is the size of the independently encrypted sectors.
+	SectorSize int `json:"sector_size"`
+	// Mode names the file layout, for example "page" or "container".
+	Mode string `json:"mode"`
+}
+
+// fileParamsVersion - bumped on incompatible changes of the encoding
+const fileParamsVersion = 1
+
+type fileParamsJSON struct {
+	Version int `json:"v"`
+	FileParams
+}
+
+// SaveFileParams stores "p" in an extended attribute of the file at "path",
+// replacing earlier parameters.
+func SaveFileParams(path string, p FileParams) error {
+	buf, err := json.Marshal(fileParamsJSON{Version: fileParamsVersion, FileParams: p})
+	if err != nil {
+		return err
+	}
+	return setxattr(path, xattrName, buf)
+}
+
+// LoadFileParams reads the parameters stored by SaveFileParams.
+func LoadFileParams(path string) (FileParams, error) {
+	buf, err := getxattr(path, xattrName)
+	if err != nil {
+		return FileParams{}, err
+	}
+	var j fileParamsJSON
+	if err = json.Unmarshal(buf, &j); err != nil {
+		return FileParams{}, fmt.Errorf("parsing %s of %q: %w", xattrName, path, err)
+	}
+	if j.Version != fileParamsVersion {
+		return FileParams{}, fmt.Errorf("unsupported %s version %d", xattrName, j.Version)
+	}
+	return j.FileParams, nil
+}
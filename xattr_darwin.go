@@ -0,0 +1,66 @@
+package eme
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Package syscall does not wrap the xattr calls of macOS, but it has their
+// numbers. Both calls take two more arguments than on Linux: a position,
+// which is only used for resource forks, and options.
+
+func setxattr(path string, name string, data []byte) error {
+	p, n, err := xattrStrings(path, name)
+	if err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	var v unsafe.Pointer
+	if len(data) > 0 {
+		v = unsafe.Pointer(&data[0])
+	}
+	_, _, e := syscall.Syscall6(syscall.SYS_SETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)),
+		uintptr(v), uintptr(len(data)), 0, 0)
+	if e != 0 {
+		return &os.PathError{Op: "setxattr", Path: path, Err: e}
+	}
+	return nil
+}
+
+func getxattr(path string, name string) ([]byte, error) {
+	p, n, err := xattrStrings(path, name)
+	if err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+	}
+	buf := make([]byte, 256)
+	for {
+		size, _, e := syscall.Syscall6(syscall.SYS_GETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)),
+			uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, 0)
+		if e == syscall.ERANGE {
+			// Ask for the size and retry
+			size, _, e = syscall.Syscall6(syscall.SYS_GETXATTR, uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(n)),
+				0, 0, 0, 0)
+			if e == 0 {
+				buf = make([]byte, max(size, 1))
+				continue
+			}
+		}
+		if e != 0 {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: e}
+		}
+		return buf[:size], nil
+	}
+}
+
+// xattrStrings - "path" and "name" as C strings
+func xattrStrings(path string, name string) (*byte, *byte, error) {
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	n, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, n, nil
+}
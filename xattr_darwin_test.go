@@ -0,0 +1,23 @@
+package eme
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// macOS has extended attributes on all of its filesystems, so they must not
+// be reported as unsupported
+func TestXattrDarwin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := setxattr(path, xattrName, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getxattr(path, xattrName)
+	if err != nil || string(got) != "x" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
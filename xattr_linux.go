@@ -0,0 +1,31 @@
+package eme
+
+import (
+	"os"
+	"syscall"
+)
+
+func setxattr(path string, name string, data []byte) error {
+	if err := syscall.Setxattr(path, name, data, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: path, Err: err}
+	}
+	return nil
+}
+
+func getxattr(path string, name string) ([]byte, error) {
+	buf := make([]byte, 256)
+	for {
+		n, err := syscall.Getxattr(path, name, buf)
+		if err == syscall.ERANGE {
+			// Ask for the size and retry
+			if n, err = syscall.Getxattr(path, name, nil); err == nil {
+				buf = make([]byte, n)
+				continue
+			}
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: path, Err: err}
+		}
+		return buf[:n], nil
+	}
+}
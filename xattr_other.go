@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package eme
+
+// Without golang.org/x/sys there is no portable way to reach the xattr
+// syscalls on the BSDs and other platforms.
+
+func setxattr(path string, name string, data []byte) error {
+	return ErrXattrUnsupported
+}
+
+func getxattr(path string, name string) ([]byte, error) {
+	return nil, ErrXattrUnsupported
+}
@@ -0,0 +1,53 @@
+package eme
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestFileParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := FileParams{KeyID: "backup-2024", SectorSize: 4096, Mode: "container"}
+	err := SaveFileParams(path, want)
+	if errors.Is(err, ErrXattrUnsupported) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadFileParams(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// Values longer than the first read buffer take the ERANGE retry
+func TestXattrLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	want := FileParams{KeyID: strings.Repeat("k", 1000), SectorSize: 512, Mode: "page"}
+	err := SaveFileParams(path, want)
+	if errors.Is(err, ErrXattrUnsupported) || errors.Is(err, syscall.ENOTSUP) || errors.Is(err, syscall.EOPNOTSUPP) {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadFileParams(path)
+	if err != nil || got != want {
+		t.Errorf("got %d-byte key ID, %v", len(got.KeyID), err)
+	}
+	if _, err = getxattr(path, "user.eme.missing"); err == nil {
+		t.Errorf("read a missing attribute")
+	}
+}
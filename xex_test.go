@@ -0,0 +1,46 @@
+package eme
+
+import (
+	"bytes"
+	"crypto/aes"
+	"errors"
+	"testing"
+)
+
+func TestTransformXEX(t *testing.T) {
+	bc, _ := aes.NewCipher(make([]byte, 32))
+	x := NewXEX(bc)
+	plain := bytes.Repeat([]byte{9}, 512)
+	tweak := bytes.Repeat([]byte{1}, 16)
+	ct := x.Encrypt(tweak, plain)
+	if got := x.Decrypt(tweak, ct); !bytes.Equal(got, plain) {
+		t.Errorf("roundtrip failed")
+	}
+	if bytes.Equal(ct, New(bc).Encrypt(tweak, plain)) {
+		t.Errorf("XEX variant equals EME")
+	}
+	// The masks start from 2*AESenc(K; T)
+	var w workspace
+	LTable := alignedBytes(32)
+	fillLTweak(bc, tweak, LTable, &w)
+	L := make([]byte, 16)
+	bc.Encrypt(L, tweak)
+	multByTwo(L, L)
+	if !bytes.Equal(LTable[:16], L) {
+		t.Errorf("first mask is %x, want %x", LTable[:16], L)
+	}
+	// With the all-zero tweak, the masks are those of EME, and so is the
+	// output
+	zero := make([]byte, 16)
+	if !bytes.Equal(x.Encrypt(zero, plain), New(bc).Encrypt(zero, plain)) {
+		t.Errorf("XEX variant differs from EME under the zero tweak")
+	}
+	func() {
+		defer func() {
+			if r, _ := recover().(error); !errors.Is(r, ErrDataSize) {
+				t.Errorf("short data: got %v", r)
+			}
+		}()
+		x.Encrypt(tweak, make([]byte, 15))
+	}()
+}